@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 
 	"github.com/firebase/genkit/go/ai"
+	"github.com/habiliai/agentruntime/audit"
 	"github.com/habiliai/agentruntime/config"
 	"github.com/habiliai/agentruntime/engine"
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/internal/httpclient"
 	"github.com/habiliai/agentruntime/internal/mylog"
 	"github.com/habiliai/agentruntime/knowledge"
 	"github.com/habiliai/agentruntime/memory"
@@ -26,10 +29,21 @@ type (
 		knowledgeService knowledge.Service
 		memoryService    memory.Service
 
+		// ownsKnowledgeService is true if the runtime created its knowledge service, which it closes
+		ownsKnowledgeService bool
+
 		modelConfig     *config.ModelConfig
 		knowledgeConfig *config.KnowledgeConfig
 		logConfig       *config.LogConfig
 		memoryConfig    *config.MemoryConfig
+		toolConfig      *config.ToolConfig
+		httpConfig      *config.HTTPConfig
+		auditConfig     *config.AuditConfig
+
+		httpClient         *http.Client
+		auditSink          audit.Sink
+		ownsAuditSink      bool
+		toolManagerOptions []tool.ManagerOption
 	}
 	Option func(*AgentRuntime)
 )
@@ -52,6 +66,21 @@ func (r *AgentRuntime) Run(ctx context.Context, req engine.RunRequest, streamCal
 
 func (r *AgentRuntime) Close() {
 	r.toolManager.Close()
+	r.closeOwnedServices()
+}
+
+// closeOwnedServices closes the knowledge service and the audit log if the runtime created them
+func (r *AgentRuntime) closeOwnedServices() {
+	if r.ownsKnowledgeService {
+		if err := r.knowledgeService.Close(); err != nil {
+			r.logger.Warn("failed to close knowledge service", "error", err)
+		}
+	}
+	if r.ownsAuditSink {
+		if err := r.auditSink.Close(); err != nil {
+			r.logger.Warn("failed to close audit log", "error", err)
+		}
+	}
 }
 
 func NewAgentRuntime(ctx context.Context, optionFuncs ...Option) (*AgentRuntime, error) {
@@ -60,6 +89,9 @@ func NewAgentRuntime(ctx context.Context, optionFuncs ...Option) (*AgentRuntime,
 		knowledgeConfig: config.NewKnowledgeConfig(),
 		logConfig:       config.NewLogConfig(),
 		memoryConfig:    config.NewMemoryConfig(),
+		toolConfig:      config.NewToolConfig(),
+		httpConfig:      config.NewHTTPConfig(),
+		auditConfig:     config.NewAuditConfig(),
 	}
 	for _, f := range optionFuncs {
 		f(e)
@@ -80,22 +112,52 @@ func NewAgentRuntime(ctx context.Context, optionFuncs ...Option) (*AgentRuntime,
 	g := genkit.NewGenkit(ctx, e.modelConfig, e.logger, e.modelConfig.TraceVerbose)
 
 	var err error
+	if e.httpClient == nil {
+		if e.httpClient, err = httpclient.New(e.httpConfig); err != nil {
+			return nil, err
+		}
+	}
+
 	if e.knowledgeService == nil {
-		e.knowledgeService, err = knowledge.NewServiceWithStore(ctx, e.knowledgeConfig, e.modelConfig, e.logger, knowledge.NewInMemoryStore())
+		store, err := knowledge.NewInMemoryStoreFromConfig(e.knowledgeConfig)
+		if err != nil {
+			return nil, err
+		}
+		e.knowledgeService, err = knowledge.NewServiceWithStore(ctx, e.knowledgeConfig, e.modelConfig, e.logger, store, knowledge.WithHTTPClient(e.httpClient))
 		if err != nil {
 			return nil, err
 		}
+		e.ownsKnowledgeService = true
 	}
 
 	if e.memoryService == nil {
 		e.memoryService, err = memory.NewService(ctx, e.modelConfig, e.memoryConfig, e.logger)
 		if err != nil {
+			e.closeOwnedServices()
+			return nil, err
+		}
+	}
+
+	if e.auditSink == nil {
+		if e.auditSink, err = audit.Open(e.auditConfig); err != nil {
+			e.closeOwnedServices()
 			return nil, err
 		}
+		e.ownsAuditSink = e.auditSink != nil
+	}
+	var auditor *audit.Auditor
+	if e.auditSink != nil {
+		var redactFields []string
+		if e.auditConfig != nil {
+			redactFields = e.auditConfig.RedactFields
+		}
+		auditor = audit.NewAuditor(e.auditSink, redactFields, e.logger)
 	}
 
-	e.toolManager, err = tool.NewToolManager(ctx, e.agent.Skills, e.logger, g, e.knowledgeService, e.memoryService)
+	toolManagerOptions := append([]tool.ManagerOption{tool.WithHTTPClient(e.httpClient), tool.WithAuditor(auditor)}, e.toolManagerOptions...)
+	e.toolManager, err = tool.NewToolManager(ctx, e.agent.Skills, e.logger, g, e.knowledgeService, e.memoryService, e.toolConfig, toolManagerOptions...)
 	if err != nil {
+		e.closeOwnedServices()
 		return nil, err
 	}
 
@@ -186,12 +248,62 @@ func WithLogConfig(logConfig *config.LogConfig) func(e *AgentRuntime) {
 	}
 }
 
+func WithToolConfig(toolConfig *config.ToolConfig) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.toolConfig = toolConfig
+	}
+}
+
+// WithMCPSamplingApprover sets the hook approving sampling requests of MCP servers before they are sent to a model
+func WithMCPSamplingApprover(approver tool.MCPSamplingApprover) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.toolManagerOptions = append(e.toolManagerOptions, tool.WithMCPSamplingApprover(approver))
+	}
+}
+
+// WithHTTPConfig configures the HTTP client of the native tools and the embedder: timeout, proxy, CA,
+// response cache and the cassette recording or replaying the requests
+func WithHTTPConfig(httpConfig *config.HTTPConfig) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.httpConfig = httpConfig
+	}
+}
+
+// WithAuditConfig records the tool calls to the audit log of the configuration, which is closed with the runtime
+func WithAuditConfig(auditConfig *config.AuditConfig) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.auditConfig = auditConfig
+	}
+}
+
+// WithAuditSink records the tool calls to sink, which may be shared by several runtimes and is not closed with them.
+// It takes precedence over the sink of WithAuditConfig, whose RedactFields still apply
+func WithAuditSink(sink audit.Sink) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.auditSink = sink
+	}
+}
+
+// WithHTTPClient sets the HTTP client of the native tools and the embedder. It takes precedence over WithHTTPConfig
+func WithHTTPClient(client *http.Client) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.httpClient = client
+	}
+}
+
 func WithAgent(agent entity.Agent) func(e *AgentRuntime) {
 	return func(e *AgentRuntime) {
 		e.agent = &agent
 	}
 }
 
+// WithKnowledgeConfig configures the knowledge service created by the runtime, such as its embedder
+func WithKnowledgeConfig(knowledgeConfig *config.KnowledgeConfig) func(e *AgentRuntime) {
+	return func(e *AgentRuntime) {
+		e.knowledgeConfig = knowledgeConfig
+	}
+}
+
 func WithKnowledgeService(knowledgeService knowledge.Service) func(e *AgentRuntime) {
 	return func(e *AgentRuntime) {
 		e.knowledgeService = knowledgeService
@@ -0,0 +1,170 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+type (
+	// Record is the audit entry of a tool call
+	Record struct {
+		Timestamp time.Time `json:"timestamp"`
+		RunID     string    `json:"run_id,omitempty"`
+		Agent     string    `json:"agent,omitempty"`
+		Thread    string    `json:"thread,omitempty"`
+		Tool      string    `json:"tool"`
+		// Server is the MCP server of the tool, empty for native and LLM tools
+		Server string `json:"server,omitempty"`
+		// Arguments are the arguments of the call with the secret fields redacted
+		Arguments json.RawMessage `json:"arguments,omitempty"`
+		// ResultDigest is the SHA-256 of the JSON result, so that results can be matched without being stored
+		ResultDigest string `json:"result_digest,omitempty"`
+		ResultSize   int    `json:"result_size"`
+		DurationMs   int64  `json:"duration_ms"`
+		Error        string `json:"error,omitempty"`
+	}
+
+	// Filter selects audit records. Empty fields match all records
+	Filter struct {
+		RunID  string
+		Agent  string
+		Thread string
+		Tool   string
+		Server string
+		Since  time.Time
+		Until  time.Time
+		// ErrorsOnly only matches the calls that failed or were rejected
+		ErrorsOnly bool
+		// Limit is the maximum number of records returned, the latest ones. Zero means no limit
+		Limit int
+	}
+
+	// Sink stores audit records
+	Sink interface {
+		Write(ctx context.Context, record Record) error
+		// Query returns the records matching filter, latest first
+		Query(ctx context.Context, filter Filter) ([]Record, error)
+		Close() error
+	}
+
+	// RunInfo identifies the run the tool calls of a context belong to
+	RunInfo struct {
+		RunID  string
+		Agent  string
+		Thread string
+	}
+
+	runInfoContextKeyType string
+)
+
+var runInfoContextKey = runInfoContextKeyType("ctx.auditRunInfo")
+
+// WithRunInfo returns a context whose tool calls are recorded as part of the run
+func WithRunInfo(ctx context.Context, info RunInfo) context.Context {
+	return context.WithValue(ctx, runInfoContextKey, info)
+}
+
+func RunInfoFromContext(ctx context.Context) RunInfo {
+	info, _ := ctx.Value(runInfoContextKey).(RunInfo)
+	return info
+}
+
+// Open opens the sink of the configuration. It returns nil if the audit log is disabled
+func Open(conf *config.AuditConfig) (Sink, error) {
+	if conf == nil {
+		return nil, nil
+	}
+
+	switch conf.Sink {
+	case "":
+		return nil, nil
+	case config.AuditSinkJSONL:
+		path := conf.Path
+		if path == "" {
+			path = "agentruntime-audit.jsonl"
+		}
+		return NewJSONLSink(path)
+	case config.AuditSinkSQLite:
+		path := conf.Path
+		if path == "" {
+			path = "agentruntime-audit.db"
+		}
+		return NewSQLiteSink(path)
+	default:
+		return nil, errors.Errorf("unknown audit sink %s", conf.Sink)
+	}
+}
+
+// Matches reports whether the record is selected by the filter, ignoring the limit
+func (f Filter) Matches(record Record) bool {
+	switch {
+	case f.RunID != "" && record.RunID != f.RunID,
+		f.Agent != "" && record.Agent != f.Agent,
+		f.Thread != "" && record.Thread != f.Thread,
+		f.Tool != "" && record.Tool != f.Tool,
+		f.Server != "" && record.Server != f.Server,
+		!f.Since.IsZero() && record.Timestamp.Before(f.Since),
+		!f.Until.IsZero() && !record.Timestamp.Before(f.Until),
+		f.ErrorsOnly && record.Error == "":
+		return false
+	}
+	return true
+}
+
+// Auditor records tool calls to a sink. A nil Auditor records nothing
+type Auditor struct {
+	sink     Sink
+	redactor *Redactor
+	logger   *slog.Logger
+}
+
+func NewAuditor(sink Sink, redactFields []string, logger *slog.Logger) *Auditor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Auditor{
+		sink:     sink,
+		redactor: NewRedactor(redactFields...),
+		logger:   logger,
+	}
+}
+
+// RecordCall records a call of the tool that started at startedAt. Failures to record are logged, so that
+// auditing never fails a tool call
+func (a *Auditor) RecordCall(ctx context.Context, toolName, server string, args, result json.RawMessage, callErr error, startedAt time.Time) {
+	if a == nil || a.sink == nil {
+		return
+	}
+
+	info := RunInfoFromContext(ctx)
+	record := Record{
+		Timestamp:  startedAt.UTC(),
+		RunID:      info.RunID,
+		Agent:      info.Agent,
+		Thread:     info.Thread,
+		Tool:       toolName,
+		Server:     server,
+		Arguments:  a.redactor.Redact(args),
+		DurationMs: time.Since(startedAt).Milliseconds(),
+	}
+	if len(result) > 0 {
+		digest := sha256.Sum256(result)
+		record.ResultDigest = "sha256:" + hex.EncodeToString(digest[:])
+		record.ResultSize = len(result)
+	}
+	if callErr != nil {
+		record.Error = callErr.Error()
+	}
+
+	// The record is written even if the run was cancelled by the call
+	if err := a.sink.Write(context.WithoutCancel(ctx), record); err != nil {
+		a.logger.WarnContext(ctx, "failed to write audit record", "tool", toolName, "error", err)
+	}
+}
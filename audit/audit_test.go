@@ -0,0 +1,143 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/audit"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor(t *testing.T) {
+	redactor := audit.NewRedactor("session_id")
+
+	redacted := redactor.Redact(json.RawMessage(`{
+		"query": "weather",
+		"max_tokens": 100,
+		"api_key": "sk-123",
+		"headers": {"Authorization": "Bearer abc", "Accept": "*/*"},
+		"accounts": [{"name": "bot", "githubToken": "ghp_1", "Password": "hunter2"}],
+		"Session-ID": "s-1",
+		"id": 12345678901234567890
+	}`))
+
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(redacted, &doc))
+	assert.Equal(t, "weather", doc["query"])
+	assert.Equal(t, float64(100), doc["max_tokens"])
+	assert.Equal(t, audit.RedactedValue, doc["api_key"])
+	assert.Equal(t, map[string]any{"Authorization": audit.RedactedValue, "Accept": "*/*"}, doc["headers"])
+	assert.Equal(t, []any{map[string]any{"name": "bot", "githubToken": audit.RedactedValue, "Password": audit.RedactedValue}}, doc["accounts"])
+	assert.Equal(t, audit.RedactedValue, doc["Session-ID"])
+	assert.Contains(t, string(redacted), "12345678901234567890")
+
+	assert.JSONEq(t, `"[UNPARSEABLE] (25 bytes)"`, string(redactor.Redact(json.RawMessage(`password=hunter2 not json`))))
+	assert.Empty(t, redactor.Redact(nil))
+}
+
+func TestSinks(t *testing.T) {
+	for _, sinkType := range []string{config.AuditSinkJSONL, config.AuditSinkSQLite} {
+		t.Run(sinkType, func(t *testing.T) {
+			ctx := context.Background()
+			sink, err := audit.Open(&config.AuditConfig{
+				Sink: sinkType,
+				Path: filepath.Join(t.TempDir(), "audit"),
+			})
+			require.NoError(t, err)
+			defer sink.Close()
+
+			start := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+			records := []audit.Record{
+				{Timestamp: start, RunID: "run-1", Agent: "alice", Thread: "1", Tool: "get_weather", Arguments: json.RawMessage(`{"location":"Seoul"}`), ResultDigest: "sha256:aa", ResultSize: 10, DurationMs: 120},
+				{Timestamp: start.Add(time.Minute), RunID: "run-1", Agent: "alice", Thread: "1", Tool: "github_search", Server: "github", Error: "rate limited"},
+				{Timestamp: start.Add(2 * time.Minute), RunID: "run-2", Agent: "bob", Tool: "get_weather"},
+			}
+			for _, record := range records {
+				require.NoError(t, sink.Write(ctx, record))
+			}
+
+			all, err := sink.Query(ctx, audit.Filter{})
+			require.NoError(t, err)
+			require.Len(t, all, 3)
+			assert.Equal(t, "run-2", all[0].RunID)
+			assert.True(t, records[0].Timestamp.Equal(all[2].Timestamp))
+			assert.JSONEq(t, `{"location":"Seoul"}`, string(all[2].Arguments))
+			assert.Equal(t, "sha256:aa", all[2].ResultDigest)
+			assert.Equal(t, int64(120), all[2].DurationMs)
+
+			byTool, err := sink.Query(ctx, audit.Filter{Tool: "get_weather", Agent: "alice"})
+			require.NoError(t, err)
+			require.Len(t, byTool, 1)
+			assert.Equal(t, "run-1", byTool[0].RunID)
+
+			errorsOnly, err := sink.Query(ctx, audit.Filter{ErrorsOnly: true})
+			require.NoError(t, err)
+			require.Len(t, errorsOnly, 1)
+			assert.Equal(t, "github", errorsOnly[0].Server)
+
+			since, err := sink.Query(ctx, audit.Filter{Since: start.Add(time.Minute), Until: start.Add(2 * time.Minute)})
+			require.NoError(t, err)
+			require.Len(t, since, 1)
+			assert.Equal(t, "github_search", since[0].Tool)
+
+			limited, err := sink.Query(ctx, audit.Filter{RunID: "run-1", Limit: 1})
+			require.NoError(t, err)
+			require.Len(t, limited, 1)
+			assert.Equal(t, "github_search", limited[0].Tool)
+		})
+	}
+}
+
+func TestOpenDisabled(t *testing.T) {
+	sink, err := audit.Open(config.NewAuditConfig())
+	require.NoError(t, err)
+	assert.Nil(t, sink)
+
+	_, err = audit.Open(&config.AuditConfig{Sink: "kafka"})
+	assert.Error(t, err)
+}
+
+func TestAuditorRecordCall(t *testing.T) {
+	sink, err := audit.NewJSONLSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	auditor := audit.NewAuditor(sink, nil, nil)
+	ctx := audit.WithRunInfo(context.Background(), audit.RunInfo{RunID: "run-1", Agent: "alice", Thread: "7"})
+	startedAt := time.Now().Add(-50 * time.Millisecond)
+	auditor.RecordCall(ctx, "fetch", "web", json.RawMessage(`{"url":"https://example.com","token":"abc"}`), json.RawMessage(`{"ok":true}`), nil, startedAt)
+	auditor.RecordCall(ctx, "fetch", "web", json.RawMessage(`{}`), nil, errors.New("timeout"), startedAt)
+
+	// A nil auditor records nothing
+	var disabled *audit.Auditor
+	disabled.RecordCall(ctx, "fetch", "web", nil, nil, nil, startedAt)
+
+	records, err := sink.Query(context.Background(), audit.Filter{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	var succeeded, failed audit.Record
+	for _, record := range records {
+		if record.Error == "" {
+			succeeded = record
+		} else {
+			failed = record
+		}
+	}
+	assert.Equal(t, "run-1", succeeded.RunID)
+	assert.Equal(t, "alice", succeeded.Agent)
+	assert.Equal(t, "7", succeeded.Thread)
+	assert.Equal(t, "web", succeeded.Server)
+	assert.JSONEq(t, `{"url":"https://example.com","token":"[REDACTED]"}`, string(succeeded.Arguments))
+	assert.Equal(t, "sha256:4062edaf750fb8074e7e83e0c9028c94e32468a8b6f1614774328ef045150f93", succeeded.ResultDigest)
+	assert.Equal(t, 11, succeeded.ResultSize)
+	assert.GreaterOrEqual(t, succeeded.DurationMs, int64(50))
+	assert.Equal(t, "timeout", failed.Error)
+	assert.Empty(t, failed.ResultDigest)
+}
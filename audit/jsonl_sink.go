@@ -0,0 +1,107 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// maxJSONLRecordSize bounds the size of a line read back from a JSON Lines file
+const maxJSONLRecordSize = 16 * 1024 * 1024
+
+// JSONLSink appends the records to a JSON Lines file, one record per line
+type JSONLSink struct {
+	path string
+
+	mtx  sync.Mutex
+	file *os.File
+}
+
+var _ Sink = (*JSONLSink)(nil)
+
+func NewJSONLSink(path string) (*JSONLSink, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, errors.Wrapf(err, "failed to create directory of audit log %s", path)
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open audit log %s", path)
+	}
+	return &JSONLSink{path: path, file: file}, nil
+}
+
+func (s *JSONLSink) Write(_ context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal audit record")
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.file == nil {
+		return errors.New("audit log is closed")
+	}
+	// A single write keeps the lines of concurrent processes appending to the file intact
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return errors.Wrapf(err, "failed to write audit log %s", s.path)
+	}
+	return nil
+}
+
+// Query scans the whole file. Lines that are not valid records are skipped
+func (s *JSONLSink) Query(ctx context.Context, filter Filter) ([]Record, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open audit log %s", s.path)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxJSONLRecordSize)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil || !filter.Matches(record) {
+			continue
+		}
+		records = append(records, record)
+		// Only the latest records are kept
+		if filter.Limit > 0 && len(records) > 2*filter.Limit {
+			records = slices.Delete(records, 0, len(records)-filter.Limit)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read audit log %s", s.path)
+	}
+
+	slices.SortStableFunc(records, func(a, b Record) int {
+		return b.Timestamp.Compare(a.Timestamp)
+	})
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+func (s *JSONLSink) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
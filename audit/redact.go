@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// RedactedValue replaces the values of secret fields
+	RedactedValue = "[REDACTED]"
+	// UnparseableValue replaces the documents that are not valid JSON, since their secrets cannot be found
+	UnparseableValue = "[UNPARSEABLE]"
+)
+
+// DefaultRedactedFields are the argument names that are always redacted
+var DefaultRedactedFields = []string{
+	"password",
+	"passwd",
+	"passphrase",
+	"secret",
+	"token",
+	"apikey",
+	"authorization",
+	"credential",
+	"credentials",
+	"privatekey",
+	"cookie",
+}
+
+// Redactor replaces the values of secret fields in JSON documents
+type Redactor struct {
+	suffixes []string
+}
+
+// NewRedactor redacts the default fields and fields. Field names are compared in lower case without "_" and "-",
+// and match as suffixes, so "token" redacts access_token and githubToken but not max_tokens
+func NewRedactor(fields ...string) *Redactor {
+	r := &Redactor{}
+	for _, field := range slices.Concat(DefaultRedactedFields, fields) {
+		if suffix := normalizeFieldName(field); suffix != "" {
+			r.suffixes = append(r.suffixes, suffix)
+		}
+	}
+	return r
+}
+
+func normalizeFieldName(name string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+}
+
+func (r *Redactor) isSecret(name string) bool {
+	name = normalizeFieldName(name)
+	for _, suffix := range r.suffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns doc with the values of secret fields replaced at any depth. Documents that cannot be redacted, like
+// the ones that are not valid JSON, are replaced by a placeholder with their size, never returned as they are
+func (r *Redactor) Redact(doc json.RawMessage) json.RawMessage {
+	if len(doc) == 0 {
+		return doc
+	}
+
+	// Numbers are kept as written
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return unparseable(doc)
+	}
+
+	redacted, err := json.Marshal(r.redactValue(value))
+	if err != nil {
+		return unparseable(doc)
+	}
+	return redacted
+}
+
+// unparseable is the placeholder of a document that cannot be redacted
+func unparseable(doc json.RawMessage) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`"%s (%d bytes)"`, UnparseableValue, len(doc)))
+}
+
+func (r *Redactor) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			if r.isSecret(key) {
+				v[key] = RedactedValue
+			} else {
+				v[key] = r.redactValue(item)
+			}
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.redactValue(item)
+		}
+		return v
+	default:
+		return value
+	}
+}
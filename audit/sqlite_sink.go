@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// SQLiteSink stores the records in the audit_records table of a SQLite database
+type SQLiteSink struct {
+	db *gorm.DB
+}
+
+// SqliteAuditRecord represents the database structure for audit records
+type SqliteAuditRecord struct {
+	ID           uint      `gorm:"primaryKey"`
+	Timestamp    time.Time `gorm:"index"`
+	RunID        string    `gorm:"index"`
+	Agent        string    `gorm:"index"`
+	Thread       string
+	Tool         string `gorm:"index"`
+	Server       string
+	Arguments    string
+	ResultDigest string
+	ResultSize   int
+	DurationMs   int64
+	Error        string
+}
+
+func (SqliteAuditRecord) TableName() string {
+	return "audit_records"
+}
+
+var _ Sink = (*SQLiteSink)(nil)
+
+func NewSQLiteSink(dbPath string) (*SQLiteSink, error) {
+	db, err := gorm.Open(
+		sqlite.Open(fmt.Sprintf("file:%s?mode=rwc&_journal_mode=WAL&_busy_timeout=5000", dbPath)),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)},
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open audit database %s", dbPath)
+	}
+	if err := db.AutoMigrate(&SqliteAuditRecord{}); err != nil {
+		return nil, errors.Wrapf(err, "failed to migrate audit table")
+	}
+	return &SQLiteSink{db: db}, nil
+}
+
+func (s *SQLiteSink) Write(ctx context.Context, record Record) error {
+	row := SqliteAuditRecord{
+		Timestamp:    record.Timestamp.UTC(),
+		RunID:        record.RunID,
+		Agent:        record.Agent,
+		Thread:       record.Thread,
+		Tool:         record.Tool,
+		Server:       record.Server,
+		Arguments:    string(record.Arguments),
+		ResultDigest: record.ResultDigest,
+		ResultSize:   record.ResultSize,
+		DurationMs:   record.DurationMs,
+		Error:        record.Error,
+	}
+	return errors.Wrapf(s.db.WithContext(ctx).Create(&row).Error, "failed to insert audit record")
+}
+
+func (s *SQLiteSink) Query(ctx context.Context, filter Filter) ([]Record, error) {
+	tx := s.db.WithContext(ctx).Model(&SqliteAuditRecord{})
+	for column, value := range map[string]string{
+		"run_id": filter.RunID,
+		"agent":  filter.Agent,
+		"thread": filter.Thread,
+		"tool":   filter.Tool,
+		"server": filter.Server,
+	} {
+		if value != "" {
+			tx = tx.Where(column+" = ?", value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		tx = tx.Where("timestamp >= ?", filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		tx = tx.Where("timestamp < ?", filter.Until.UTC())
+	}
+	if filter.ErrorsOnly {
+		tx = tx.Where("error <> ''")
+	}
+	if filter.Limit > 0 {
+		tx = tx.Limit(filter.Limit)
+	}
+
+	var rows []SqliteAuditRecord
+	if err := tx.Order("timestamp desc, id desc").Find(&rows).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to query audit records")
+	}
+
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		record := Record{
+			Timestamp:    row.Timestamp,
+			RunID:        row.RunID,
+			Agent:        row.Agent,
+			Thread:       row.Thread,
+			Tool:         row.Tool,
+			Server:       row.Server,
+			ResultDigest: row.ResultDigest,
+			ResultSize:   row.ResultSize,
+			DurationMs:   row.DurationMs,
+			Error:        row.Error,
+		}
+		if row.Arguments != "" {
+			record.Arguments = json.RawMessage(row.Arguments)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (s *SQLiteSink) Close() error {
+	db, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
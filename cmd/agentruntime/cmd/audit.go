@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/habiliai/agentruntime/audit"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newAuditCmd(auditConfig *config.AuditConfig) *cobra.Command {
+	params := &struct {
+		audit.Filter
+		Since string
+		Until string
+		JSON  bool
+	}{}
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Query the audit log of tool calls",
+		Long: "Prints the tool calls recorded with --audit-sink, latest first. " +
+			"--since and --until take a duration before now, such as 24h, or an RFC 3339 time.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if auditConfig.Sink == "" {
+				return errors.New("no audit log to query, set --audit-sink and --audit-path")
+			}
+
+			filter := params.Filter
+			var err error
+			if filter.Since, err = parseAuditTime(params.Since); err != nil {
+				return errors.Wrapf(err, "invalid --since")
+			}
+			if filter.Until, err = parseAuditTime(params.Until); err != nil {
+				return errors.Wrapf(err, "invalid --until")
+			}
+
+			sink, err := audit.Open(auditConfig)
+			if err != nil {
+				return err
+			}
+			defer sink.Close()
+
+			records, err := sink.Query(cmd.Context(), filter)
+			if err != nil {
+				return err
+			}
+
+			if params.JSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				for _, record := range records {
+					if err := encoder.Encode(record); err != nil {
+						return errors.Wrapf(err, "failed to encode audit record")
+					}
+				}
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "TIME\tRUN\tAGENT\tTHREAD\tTOOL\tSERVER\tDURATION\tRESULT")
+			for _, record := range records {
+				result := record.ResultDigest
+				if record.Error != "" {
+					result = "error: " + record.Error
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%dms\t%s\n",
+					record.Timestamp.Local().Format(time.DateTime),
+					orDash(record.RunID),
+					orDash(record.Agent),
+					orDash(record.Thread),
+					record.Tool,
+					orDash(record.Server),
+					record.DurationMs,
+					orDash(result),
+				)
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().StringVar(&params.RunID, "run", "", "Only the calls of the run")
+	cmd.Flags().StringVar(&params.Agent, "agent", "", "Only the calls of the agent")
+	cmd.Flags().StringVar(&params.Thread, "thread", "", "Only the calls of the thread")
+	cmd.Flags().StringVar(&params.Tool, "tool", "", "Only the calls of the tool")
+	cmd.Flags().StringVar(&params.Server, "server", "", "Only the calls of tools of the MCP server")
+	cmd.Flags().StringVar(&params.Since, "since", "", "Only the calls at or after this time")
+	cmd.Flags().StringVar(&params.Until, "until", "", "Only the calls before this time")
+	cmd.Flags().BoolVar(&params.ErrorsOnly, "errors", false, "Only the calls that failed or were rejected")
+	cmd.Flags().IntVar(&params.Limit, "limit", 50, "Maximum number of calls printed, 0 for all")
+	cmd.Flags().BoolVar(&params.JSON, "json", false, "Print the records as JSON lines")
+
+	return cmd
+}
+
+// parseAuditTime parses a duration before now or an RFC 3339 time. An empty value is the zero time
+func parseAuditTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.Errorf("%q is neither a duration nor an RFC 3339 time", value)
+	}
+	return t, nil
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/habiliai/agentruntime/config"
+	xgenkit "github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/internal/mylog"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newKnowledgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "knowledge",
+		Short: "Manage knowledge stores",
+	}
+	cmd.AddCommand(newKnowledgeReembedCmd())
+	return cmd
+}
+
+func newKnowledgeReembedCmd() *cobra.Command {
+	params := &struct {
+		Path         string
+		KnowledgeIds []string
+	}{}
+	knowledgeConfig := config.NewKnowledgeConfig()
+	cmd := &cobra.Command{
+		Use:   "reembed",
+		Short: "Re-embed the knowledge of a SQLite knowledge store with another embedder",
+		Long: "Embeds again the documents of the knowledge embedded with another model than the given embedder, " +
+			"from their stored texts and images, so that the knowledge is searched by vectors again. " +
+			"The vector table is rebuilt if the embedder has another dimension.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			logger := mylog.NewLogger("info", "text")
+
+			knowledgeConfig.RerankEnabled = false
+			modelConfig := &config.ModelConfig{OpenAIAPIKey: os.Getenv("OPENAI_API_KEY")}
+			embedder, err := knowledge.NewEmbedderFromConfig(xgenkit.NewGenkit(ctx, modelConfig, logger, false), knowledgeConfig, nil)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create embedder")
+			}
+
+			store, err := knowledge.NewSqliteStore(params.Path, embedder.GetEmbedSize(), knowledge.WithVectorTableRebuild())
+			if err != nil {
+				return err
+			}
+			defer store.Close()
+
+			service, err := knowledge.NewServiceWithStore(ctx, knowledgeConfig, modelConfig, logger, store, knowledge.WithEmbedder(embedder))
+			if err != nil {
+				return err
+			}
+
+			reembedded, err := service.ReembedKnowledge(ctx, params.KnowledgeIds...)
+			for _, id := range reembedded {
+				fmt.Fprintln(cmd.OutOrStdout(), id)
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&params.Path, "path", "", "SQLite knowledge store")
+	cmd.Flags().StringSliceVar(&params.KnowledgeIds, "knowledge", nil, "Only re-embed these knowledge IDs (default all)")
+	cmd.Flags().StringVar(&knowledgeConfig.EmbedderProvider, "embedder-provider", knowledgeConfig.EmbedderProvider, "Embedder provider: nomic, openai, openai-compatible or hash")
+	cmd.Flags().StringVar(&knowledgeConfig.EmbedderModel, "embedder-model", knowledgeConfig.EmbedderModel, "Embedding model of the provider")
+	cmd.Flags().StringVar(&knowledgeConfig.EmbedderBaseURL, "embedder-base-url", knowledgeConfig.EmbedderBaseURL, "Base URL of the openai-compatible endpoint")
+	cmd.Flags().StringVar(&knowledgeConfig.EmbedderAPIKey, "embedder-api-key", knowledgeConfig.EmbedderAPIKey, "API key of the openai-compatible endpoint")
+	cmd.Flags().IntVar(&knowledgeConfig.EmbedderDimension, "embedder-dimension", knowledgeConfig.EmbedderDimension, "Dimension of the embeddings")
+	_ = cmd.MarkFlagRequired("path")
+
+	return cmd
+}
@@ -4,12 +4,14 @@ import (
 	"context"
 	"log/slog"
 	"os"
+	"strconv"
 
 	"github.com/habiliai/agentruntime"
 	"github.com/habiliai/agentruntime/engine"
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/habiliai/agentruntime/internal/msgutils"
 	"github.com/mokiat/gog"
+	"github.com/pkg/errors"
 	"gorm.io/gorm"
 )
 
@@ -19,6 +21,7 @@ func loopMentionedBy(
 	agents map[string]entity.Agent,
 	logger *slog.Logger,
 	messageCh chan *Message,
+	runtimeOptions []agentruntime.Option,
 ) {
 	for {
 		select {
@@ -40,70 +43,76 @@ func loopMentionedBy(
 					logger.Error("agent not found", "mention", mention)
 					continue
 				}
-				runtime, err := agentruntime.NewAgentRuntime(
-					ctx,
-					agentruntime.WithOpenAIAPIKey(os.Getenv("OPENAI_API_KEY")),
-					agentruntime.WithAnthropicAPIKey(os.Getenv("ANTHROPIC_API_KEY")),
-					agentruntime.WithXAIAPIKey(os.Getenv("XAI_API_KEY")),
-					agentruntime.WithLogger(logger),
-					agentruntime.WithTraceVerbose(true),
-					agentruntime.WithAgent(agent),
-				)
+				reply, err := replyInThread(ctx, db, agent, &msg.Thread, logger, runtimeOptions...)
 				if err != nil {
-					logger.Error("failed to create agent runtime", "mention", mention, "error", err)
+					logger.Error("failed to reply", "mention", mention, "error", err)
 					continue
 				}
-				defer runtime.Close()
 
-				var out string
-				resp, err := runtime.Run(ctx, engine.RunRequest{
-					ThreadInstruction: msg.Thread.Instruction,
-					History: gog.Map(msg.Thread.History, func(m Message) engine.Conversation {
-						return engine.Conversation{
-							User: m.User,
-							Text: m.Content,
-							Actions: gog.Map(m.Actions, func(a Action) engine.Action {
-								return engine.Action{
-									Name:      a.Name,
-									Arguments: a.Args,
-									Result:    a.Result,
-								}
-							}),
-						}
-					}),
-					Participant: gog.Map(msg.Thread.Participants, func(p string) engine.Participant {
-						return engine.Participant{
-							Name: p,
-						}
-					}),
-				}, nil)
-				if err != nil {
-					logger.Error("failed to run agent", "mention", mention, "error", err)
-					continue
-				}
+				messageCh <- reply
+			}
+		}
+	}
+}
 
-				out = resp.Text()
-				actions := gog.Map(resp.ToolCalls, func(t engine.ToolCall) Action {
-					return Action{
-						Name:   t.Name,
-						Args:   t.Arguments,
-						Result: t.Result,
-					}
-				})
+// replyInThread runs the agent on the history of the thread and posts its answer to the thread
+func replyInThread(ctx context.Context, db *gorm.DB, agent entity.Agent, thread *Thread, logger *slog.Logger, runtimeOptions ...agentruntime.Option) (*Message, error) {
+	runtime, err := agentruntime.NewAgentRuntime(
+		ctx,
+		append([]agentruntime.Option{
+			agentruntime.WithOpenAIAPIKey(os.Getenv("OPENAI_API_KEY")),
+			agentruntime.WithAnthropicAPIKey(os.Getenv("ANTHROPIC_API_KEY")),
+			agentruntime.WithXAIAPIKey(os.Getenv("XAI_API_KEY")),
+			agentruntime.WithLogger(logger),
+			agentruntime.WithTraceVerbose(true),
+			agentruntime.WithAgent(agent),
+		}, runtimeOptions...)...,
+	)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create agent runtime")
+	}
+	defer runtime.Close()
 
-				msg := &Message{
-					ThreadID: msg.ThreadID,
-					Content:  out,
-					User:     runtime.Agent().Name,
-					Actions:  actions,
-				}
-				if err := db.Create(msg).Error; err != nil {
-					logger.Error("failed to create message", "error", err)
-					continue
-				}
+	resp, err := runtime.Run(ctx, engine.RunRequest{
+		ThreadID:          strconv.FormatUint(uint64(thread.ID), 10),
+		ThreadInstruction: thread.Instruction,
+		History: gog.Map(thread.History, func(m Message) engine.Conversation {
+			return engine.Conversation{
+				User: m.User,
+				Text: m.Content,
+				Actions: gog.Map(m.Actions, func(a Action) engine.Action {
+					return engine.Action{
+						Name:      a.Name,
+						Arguments: a.Args,
+						Result:    a.Result,
+					}
+				}),
+			}
+		}),
+		Participant: gog.Map(thread.Participants, func(p string) engine.Participant {
+			return engine.Participant{
+				Name: p,
+			}
+		}),
+	}, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to run agent")
+	}
 
-				messageCh <- msg
+	msg := &Message{
+		ThreadID: thread.ID,
+		Content:  resp.Text(),
+		User:     runtime.Agent().Name,
+		Actions: gog.Map(resp.ToolCalls, func(t engine.ToolCall) Action {
+			return Action{
+				Name:   t.Name,
+				Args:   t.Arguments,
+				Result: t.Result,
 			}
-		}
+		}),
+	}
+	if err := db.WithContext(ctx).Create(msg).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to create message")
 	}
+	return msg, nil
 }
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"github.com/goccy/go-yaml"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newMCPCmd(secretConfig *config.SecretConfig) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Manage the MCP servers of agents",
+	}
+
+	cmd.AddCommand(newMCPAuthCmd(secretConfig))
+
+	return cmd
+}
+
+func newMCPAuthCmd(secretConfig *config.SecretConfig) *cobra.Command {
+	params := &struct {
+		TokenDir  string
+		NoBrowser bool
+		Logout    bool
+	}{}
+	toolConfig := config.NewToolConfig()
+
+	cmd := &cobra.Command{
+		Use:   "auth <agent-file> <skill>",
+		Short: "Authorize an oauth-sse MCP server of an agent",
+		Long: "Runs the OAuth authorization-code flow with PKCE for an oauth-sse MCP skill and stores the token, " +
+			"encrypted, where the agent runtime picks it up. Set AGENTRUNTIME_MCP_TOKEN_KEY to encrypt the tokens with a passphrase.",
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			agent, err := loadAgentFile(args[0], secretConfig)
+			if err != nil {
+				return err
+			}
+
+			var skill *entity.AgentSkillUnion
+			for i := range agent.Skills {
+				if agent.Skills[i].Type == entity.AgentSkillTypeMCP && (agent.Skills[i].OfMCP.Name == args[1] || agent.Skills[i].OfMCP.ID == args[1]) {
+					skill = &agent.Skills[i]
+					break
+				}
+			}
+			if skill == nil {
+				return errors.Errorf("agent %s has no mcp skill %s", agent.Name, args[1])
+			}
+
+			serverConfig, err := tool.ConvertAgentSkillToMCPServerConfig(*skill)
+			if err != nil {
+				return err
+			}
+			if serverConfig.OAuthConfig == nil {
+				return errors.Errorf("mcp skill %s has no oauth configuration", args[1])
+			}
+
+			storage := tool.NewFileTokenStorage(params.TokenDir, toolConfig.MCPTokenKey)
+			if params.Logout {
+				if err := storage.Delete(serverConfig.URL, serverConfig.OAuthConfig.ClientID); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed the token of %s\n", serverConfig.URL)
+				return nil
+			}
+
+			if err := tool.AuthorizeMCPServer(ctx, tool.AuthorizeMCPServerRequest{
+				Config:     *serverConfig,
+				Storage:    storage,
+				ClientName: fmt.Sprintf("agentruntime (%s)", agent.Name),
+				OpenURL: func(authURL string) error {
+					fmt.Fprintf(cmd.OutOrStdout(), "Open the following URL to authorize %s:\n\n  %s\n\n", args[1], authURL)
+					if !params.NoBrowser {
+						if err := openBrowser(authURL); err != nil {
+							fmt.Fprintf(cmd.ErrOrStderr(), "failed to open browser: %v\n", err)
+						}
+					}
+					return nil
+				},
+			}); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Authorized %s, the token is stored in %s\n", args[1], params.TokenDir)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&params.TokenDir, "token-dir", toolConfig.MCPTokenDir, "Directory where the tokens are stored")
+	cmd.Flags().BoolVar(&params.NoBrowser, "no-browser", false, "Print the authorization URL without opening a browser")
+	cmd.Flags().BoolVar(&params.Logout, "logout", false, "Remove the stored token instead of authorizing")
+
+	return cmd
+}
+
+// loadAgentFile reads an agent file and interpolates the variables of its skills
+func loadAgentFile(agentFile string, secretConfig *config.SecretConfig) (entity.Agent, error) {
+	var agent entity.Agent
+	agentFileBytes, err := os.ReadFile(agentFile)
+	if err != nil {
+		return agent, errors.Wrapf(err, "failed to read agent file: %s", agentFile)
+	}
+	if err := yaml.Unmarshal(agentFileBytes, &agent); err != nil {
+		return agent, errors.Wrapf(err, "failed to unmarshal agent file: %s", agentFile)
+	}
+
+	resolver, err := config.NewSecretResolver(secretConfig)
+	if err != nil {
+		return agent, err
+	}
+	if err := agent.Interpolate(resolver); err != nil {
+		return agent, errors.Wrapf(err, "failed to interpolate agent file: %s", agentFile)
+	}
+	return agent, nil
+}
+
+func openBrowser(url string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", url).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	default:
+		return exec.Command("xdg-open", url).Start()
+	}
+}
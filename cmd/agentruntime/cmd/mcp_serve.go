@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/habiliai/agentruntime"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/internal/mylog"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func newMCPServeCmd(secretConfig *config.SecretConfig, auditConfig *config.AuditConfig) *cobra.Command {
+	params := &struct {
+		Transport       string
+		Addr            string
+		Path            string
+		ExportTools     bool
+		ExportKnowledge bool
+		LogLevel        string
+	}{}
+	cmd := &cobra.Command{
+		Use:   "mcp-serve <agent-file>",
+		Short: "Serve an agent as an MCP server",
+		Long: "Serves the agent over stdio or streamable HTTP. The agent is exposed as a chat tool, " +
+			"optionally together with its native tools and its knowledge.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+
+			// Logs go to stderr, so they never mix with the protocol on stdout
+			logger := mylog.NewLogger(params.LogLevel, "text")
+
+			agent, err := loadAgentFile(args[0], secretConfig)
+			if err != nil {
+				return err
+			}
+
+			runtime, err := agentruntime.NewAgentRuntime(
+				ctx,
+				agentruntime.WithOpenAIAPIKey(os.Getenv("OPENAI_API_KEY")),
+				agentruntime.WithAnthropicAPIKey(os.Getenv("ANTHROPIC_API_KEY")),
+				agentruntime.WithXAIAPIKey(os.Getenv("XAI_API_KEY")),
+				agentruntime.WithLogger(logger),
+				agentruntime.WithAgent(agent),
+				agentruntime.WithAuditConfig(auditConfig),
+			)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create agent runtime")
+			}
+			defer runtime.Close()
+
+			mcpServer, err := runtime.NewMCPServer(ctx, agentruntime.MCPServerOptions{
+				ExportNativeTools: params.ExportTools,
+				ExportKnowledge:   params.ExportKnowledge,
+			})
+			if err != nil {
+				return err
+			}
+
+			switch params.Transport {
+			case "stdio":
+				logger.Info("serving agent over stdio", "agent", agent.Name)
+				if err := server.NewStdioServer(mcpServer).Listen(ctx, os.Stdin, os.Stdout); err != nil && !errors.Is(err, context.Canceled) {
+					return err
+				}
+			case "http":
+				httpServer := server.NewStreamableHTTPServer(mcpServer, server.WithEndpointPath(params.Path))
+				go func() {
+					<-ctx.Done()
+					if err := httpServer.Shutdown(context.WithoutCancel(ctx)); err != nil {
+						logger.Error("failed to shutdown server", "error", err)
+					}
+				}()
+
+				logger.Info("serving agent over streamable http", "agent", agent.Name, "addr", params.Addr, "path", params.Path)
+				if err := httpServer.Start(params.Addr); err != nil && ctx.Err() == nil {
+					return err
+				}
+			default:
+				return errors.Errorf("unsupported transport %s, expected stdio or http", params.Transport)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&params.Transport, "transport", "t", "stdio", "Transport to serve on: stdio or http")
+	cmd.Flags().StringVar(&params.Addr, "addr", ":3002", "Address to listen on for the http transport")
+	cmd.Flags().StringVar(&params.Path, "path", "/mcp", "Endpoint path for the http transport")
+	cmd.Flags().BoolVar(&params.ExportTools, "export-tools", false, "Re-export the native tools of the agent")
+	cmd.Flags().BoolVar(&params.ExportKnowledge, "export-knowledge", false, "Expose the knowledge of the agent as resources and a knowledge_search tool")
+	cmd.Flags().StringVar(&params.LogLevel, "log-level", "info", "Log level")
+
+	return cmd
+}
@@ -11,7 +11,9 @@ import (
 	"sync"
 	"syscall"
 
-	"github.com/goccy/go-yaml"
+	"github.com/habiliai/agentruntime"
+	"github.com/habiliai/agentruntime/audit"
+	"github.com/habiliai/agentruntime/config"
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/habiliai/agentruntime/internal/mylog"
 	"github.com/pkg/errors"
@@ -22,11 +24,15 @@ import (
 
 func newRootCmd() *cobra.Command {
 	params := &struct {
-		Port int
+		Port          int
+		SchedulesFile string
 	}{}
+	secretConfig := config.NewSecretConfig()
+	auditConfig := config.NewAuditConfig()
 	cmd := &cobra.Command{
 		Use:   "agentruntime <agent-file OR agent-files-dir> [...<agent-file OR agent-files-dir>]",
 		Short: "Agent runtime",
+		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			ctx, cancel := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
 			defer cancel()
@@ -60,13 +66,9 @@ func newRootCmd() *cobra.Command {
 
 			agents := map[string]entity.Agent{}
 			for _, agentFile := range agentFiles {
-				var agent entity.Agent
-				agentFileBytes, err := os.ReadFile(agentFile)
+				agent, err := loadAgentFile(agentFile, secretConfig)
 				if err != nil {
-					return errors.Wrapf(err, "failed to read agent file: %s", agentFile)
-				}
-				if err := yaml.Unmarshal(agentFileBytes, &agent); err != nil {
-					return errors.Wrapf(err, "failed to unmarshal agent file: %s", agentFile)
+					return err
 				}
 				agents[strings.ToLower(agent.Name)] = agent
 			}
@@ -76,20 +78,44 @@ func newRootCmd() *cobra.Command {
 				return errors.Wrap(err, "failed to open database")
 			}
 
-			if err := db.AutoMigrate(&Thread{}, &Message{}); err != nil {
+			if err := db.AutoMigrate(&Thread{}, &Message{}, &ScheduleState{}, &ScheduleRun{}); err != nil {
 				return errors.Wrap(err, "failed to migrate database")
 			}
 
+			var serverSchedules []serverSchedule
+			if params.SchedulesFile != "" {
+				if serverSchedules, err = loadServerSchedules(params.SchedulesFile, secretConfig); err != nil {
+					return err
+				}
+			}
+
+			// The audit log is shared by the runtimes created for every reply
+			auditSink, err := audit.Open(auditConfig)
+			if err != nil {
+				return err
+			}
+			var runtimeOptions []agentruntime.Option
+			if auditSink != nil {
+				defer auditSink.Close()
+				runtimeOptions = append(runtimeOptions, agentruntime.WithAuditConfig(auditConfig), agentruntime.WithAuditSink(auditSink))
+			}
+
 			messageCh := make(chan *Message, len(agents)*2)
+			scheduler, err := newScheduler(db, agents, serverSchedules, logger, messageCh, runtimeOptions)
+			if err != nil {
+				return err
+			}
+
 			var wg sync.WaitGroup
 			wg.Add(1)
 			go func() {
-				defer close(messageCh)
 				defer wg.Done()
-				loopMentionedBy(ctx, db, agents, logger, messageCh)
+				loopMentionedBy(ctx, db, agents, logger, messageCh, runtimeOptions)
 			}()
+			scheduler.Start(ctx)
+			defer scheduler.Wait()
 
-			handler, err := createServerHandler(agents, db, logger, messageCh)
+			handler, err := createServerHandler(agents, db, logger, messageCh, scheduler)
 			if err != nil {
 				return err
 			}
@@ -121,6 +147,18 @@ func newRootCmd() *cobra.Command {
 	}
 
 	cmd.Flags().IntVarP(&params.Port, "port", "p", 3001, "Port to listen on")
+	cmd.Flags().StringVar(&params.SchedulesFile, "schedules-file", "", "YAML file with schedules of the served agents in addition to those of the agent files")
+	cmd.PersistentFlags().StringVar(&secretConfig.EnvFile, "env-file", secretConfig.EnvFile, "Dotenv file with the values of ${VAR} references in agent files")
+	cmd.PersistentFlags().StringVar(&secretConfig.SecretsDir, "secrets-dir", secretConfig.SecretsDir, "Directory with one file per secret referenced as ${VAR} in agent files")
+
+	cmd.PersistentFlags().StringVar(&auditConfig.Sink, "audit-sink", auditConfig.Sink, "Record tool calls to an audit log: jsonl or sqlite")
+	cmd.PersistentFlags().StringVar(&auditConfig.Path, "audit-path", auditConfig.Path, "File of the audit log (default agentruntime-audit.jsonl or agentruntime-audit.db)")
+	cmd.PersistentFlags().StringSliceVar(&auditConfig.RedactFields, "audit-redact", auditConfig.RedactFields, "Additional argument names redacted in the audit log")
+
+	cmd.AddCommand(newMCPCmd(secretConfig))
+	cmd.AddCommand(newMCPServeCmd(secretConfig, auditConfig))
+	cmd.AddCommand(newAuditCmd(auditConfig))
+	cmd.AddCommand(newKnowledgeCmd())
 
 	return cmd
 }
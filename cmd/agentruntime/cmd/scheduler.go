@@ -0,0 +1,655 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	_ "time/tzdata" // schedules may name time zones missing from minimal container images
+
+	"github.com/goccy/go-yaml"
+	"github.com/habiliai/agentruntime"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/cron"
+	"github.com/habiliai/agentruntime/tool/rss"
+	"github.com/pkg/errors"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+const (
+	ScheduleTriggerCron    = "cron"
+	ScheduleTriggerMissed  = "missed"
+	ScheduleTriggerRSS     = "rss"
+	ScheduleTriggerWebhook = "webhook"
+
+	ScheduleRunPending   = "pending"
+	ScheduleRunRunning   = "running"
+	ScheduleRunSucceeded = "succeeded"
+	ScheduleRunFailed    = "failed"
+	ScheduleRunSkipped   = "skipped"
+
+	// schedulerUser is the author of the instructions the scheduler posts to threads
+	schedulerUser = "SCHEDULER"
+
+	// maxMissedRuns bounds the missed activations a cron schedule catches up on
+	maxMissedRuns = 100
+	// missedRunGrace is how late an activation may start before it counts as missed
+	missedRunGrace = time.Minute
+	// maxSeenItems bounds the feed items an RSS schedule remembers per feed beyond the items still in the feed
+	maxSeenItems = 1000
+	// defaultRSSInterval is how often the feeds of an RSS schedule are polled by default
+	defaultRSSInterval = 15 * time.Minute
+)
+
+type (
+	// ScheduleState is the progress of a schedule kept across restarts
+	ScheduleState struct {
+		Key       string    `gorm:"primarykey" json:"key"`
+		UpdatedAt time.Time `json:"updated_at"`
+
+		// ThreadID is the thread created for a schedule without a target thread
+		ThreadID uint `json:"thread_id"`
+		// LastActivationAt is the last cron activation handled, or the last poll of the feeds
+		LastActivationAt time.Time `json:"last_activation_at"`
+		// SeenFeedItems are the GUIDs or links of the items already reported, per feed URL. A feed has no entry
+		// until a poll returned items from it
+		SeenFeedItems datatypes.JSONType[map[string][]string] `json:"-"`
+	}
+
+	// ScheduleRun is an entry of the run history of a schedule
+	ScheduleRun struct {
+		Model
+
+		Schedule    string     `gorm:"index" json:"schedule"`
+		Agent       string     `json:"agent"`
+		Trigger     string     `json:"trigger"`
+		Status      string     `json:"status"`
+		ScheduledAt time.Time  `json:"scheduled_at"`
+		StartedAt   *time.Time `json:"started_at,omitempty"`
+		FinishedAt  *time.Time `json:"finished_at,omitempty"`
+		ThreadID    uint       `json:"thread_id,omitempty"`
+		MessageID   uint       `json:"message_id,omitempty"`
+		Error       string     `json:"error,omitempty"`
+	}
+
+	// serverSchedule is a schedule of the server schedules file, which names the agent it runs
+	serverSchedule struct {
+		Agent                string `yaml:"agent"`
+		entity.AgentSchedule `yaml:",inline"`
+	}
+
+	scheduleJob struct {
+		key      string
+		agent    entity.Agent
+		schedule entity.AgentSchedule
+		cron     cron.Schedule
+		interval time.Duration
+
+		// mtx serializes the runs of the schedule, which share a thread
+		mtx sync.Mutex
+		// webhookRunning is set while a run started by the webhook is pending or running
+		webhookRunning atomic.Bool
+	}
+
+	scheduler struct {
+		db        *gorm.DB
+		logger    *slog.Logger
+		messageCh chan<- *Message
+		reader    *rss.RSSReader
+		options   []agentruntime.Option
+		jobs      map[string]*scheduleJob
+		keys      []string
+
+		ctx context.Context
+		wg  sync.WaitGroup
+	}
+
+	// scheduleInfo describes a schedule in the API
+	scheduleInfo struct {
+		Key              string     `json:"key"`
+		Agent            string     `json:"agent"`
+		Name             string     `json:"name"`
+		Trigger          string     `json:"trigger"`
+		ThreadID         uint       `json:"thread_id,omitempty"`
+		LastActivationAt *time.Time `json:"last_activation_at,omitempty"`
+		NextRunAt        *time.Time `json:"next_run_at,omitempty"`
+	}
+)
+
+// loadServerSchedules reads the schedules file of the server
+func loadServerSchedules(file string, secretConfig *config.SecretConfig) ([]serverSchedule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read schedules file: %s", file)
+	}
+
+	var content struct {
+		Schedules []serverSchedule `yaml:"schedules"`
+	}
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal schedules file: %s", file)
+	}
+
+	resolver, err := config.NewSecretResolver(secretConfig)
+	if err != nil {
+		return nil, err
+	}
+	for i := range content.Schedules {
+		if err := content.Schedules[i].Interpolate(resolver); err != nil {
+			return nil, errors.Wrapf(err, "failed to interpolate schedules file: %s", file)
+		}
+	}
+	return content.Schedules, nil
+}
+
+// newScheduler validates the schedules of the agents and of the server. Schedules are identified by
+// "<agent>/<name>" with the agent name in lower case
+func newScheduler(
+	db *gorm.DB,
+	agents map[string]entity.Agent,
+	serverSchedules []serverSchedule,
+	logger *slog.Logger,
+	messageCh chan<- *Message,
+	runtimeOptions []agentruntime.Option,
+) (*scheduler, error) {
+	s := &scheduler{
+		db:        db,
+		logger:    logger,
+		messageCh: messageCh,
+		reader:    rss.NewRSSReader(),
+		options:   runtimeOptions,
+		jobs:      map[string]*scheduleJob{},
+	}
+
+	for _, agentKey := range slices.Sorted(maps.Keys(agents)) {
+		agent := agents[agentKey]
+		for _, schedule := range agent.Schedules {
+			if err := s.addJob(agentKey, agent, schedule); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, schedule := range serverSchedules {
+		agentKey := strings.ToLower(schedule.Agent)
+		agent, ok := agents[agentKey]
+		if !ok {
+			return nil, errors.Errorf("agent %s of schedule %s not found", schedule.Agent, schedule.Name)
+		}
+		if err := s.addJob(agentKey, agent, schedule.AgentSchedule); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *scheduler) addJob(agentKey string, agent entity.Agent, schedule entity.AgentSchedule) error {
+	if err := schedule.Validate(); err != nil {
+		return errors.Wrapf(err, "invalid schedule of agent %s", agent.Name)
+	}
+
+	job := &scheduleJob{
+		key:      agentKey + "/" + schedule.Name,
+		agent:    agent,
+		schedule: schedule,
+	}
+	if _, ok := s.jobs[job.key]; ok {
+		return errors.Errorf("duplicate schedule %s", job.key)
+	}
+
+	switch {
+	case schedule.Cron != "":
+		location := time.UTC
+		if schedule.Timezone != "" {
+			var err error
+			if location, err = time.LoadLocation(schedule.Timezone); err != nil {
+				return errors.Wrapf(err, "invalid timezone of schedule %s", job.key)
+			}
+		}
+		var err error
+		if job.cron, err = cron.Parse(schedule.Cron, location); err != nil {
+			return errors.Wrapf(err, "invalid cron of schedule %s", job.key)
+		}
+	case schedule.RSS != nil:
+		job.interval = defaultRSSInterval
+		if schedule.RSS.Interval != "" {
+			var err error
+			if job.interval, err = time.ParseDuration(schedule.RSS.Interval); err != nil {
+				return errors.Wrapf(err, "invalid rss interval of schedule %s", job.key)
+			}
+			if job.interval < time.Minute {
+				return errors.Errorf("rss interval of schedule %s must be at least one minute", job.key)
+			}
+		}
+	}
+
+	s.jobs[job.key] = job
+	s.keys = append(s.keys, job.key)
+	return nil
+}
+
+// Start runs the cron and RSS schedules in the background until ctx is done
+func (s *scheduler) Start(ctx context.Context) {
+	s.ctx = ctx
+	for _, job := range s.jobs {
+		switch {
+		case job.cron != nil:
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.loopCron(ctx, job)
+			}()
+		case job.schedule.RSS != nil:
+			s.wg.Add(1)
+			go func() {
+				defer s.wg.Done()
+				s.loopRSS(ctx, job)
+			}()
+		}
+		s.logger.Info("schedule started", "schedule", job.key)
+	}
+}
+
+// Wait blocks until the schedules and the runs they started have stopped
+func (s *scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// loopCron runs the schedule at its activations. Activations passed while the server was down or while a previous
+// run was still going are handled according to the missed run policy
+func (s *scheduler) loopCron(ctx context.Context, job *scheduleJob) {
+	state, err := s.loadState(ctx, job.key)
+	if err != nil {
+		s.logger.Error("failed to load schedule state", "schedule", job.key, "error", err)
+		return
+	}
+	last := state.LastActivationAt
+	if last.IsZero() {
+		// A new schedule has not missed anything
+		last = time.Now()
+		if err := s.saveActivation(ctx, job.key, last); err != nil {
+			s.logger.Error("failed to save schedule state", "schedule", job.key, "error", err)
+		}
+	}
+
+	for {
+		next := job.cron.Next(last)
+		if next.IsZero() {
+			s.logger.Warn("schedule has no next activation", "schedule", job.key)
+			return
+		}
+		if wait := time.Until(next); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+
+		now := time.Now()
+		due, truncated := cron.Between(job.cron, last, now, maxMissedRuns)
+		if truncated {
+			s.logger.Warn("too many missed runs, only the first ones are handled", "schedule", job.key, "limit", maxMissedRuns)
+		}
+		for i, activation := range due {
+			if ctx.Err() != nil {
+				return
+			}
+			onTime := i == len(due)-1 && !truncated && now.Sub(activation) < missedRunGrace
+			s.handleActivation(ctx, job, activation, onTime, i == len(due)-1)
+
+			if err := s.saveActivation(ctx, job.key, activation); err != nil {
+				s.logger.Error("failed to save schedule state", "schedule", job.key, "error", err)
+			}
+		}
+		last = now
+		if len(due) > 0 && !truncated {
+			last = due[len(due)-1]
+		}
+	}
+}
+
+// handleActivation runs or skips an activation. With the "once" policy, only the latest of the missed activations runs
+func (s *scheduler) handleActivation(ctx context.Context, job *scheduleJob, activation time.Time, onTime, latest bool) {
+	if onTime {
+		s.run(ctx, job, ScheduleTriggerCron, activation, "")
+		return
+	}
+
+	switch job.schedule.MissedRunPolicy {
+	case entity.MissedRunAll:
+		s.run(ctx, job, ScheduleTriggerMissed, activation, "")
+		return
+	case entity.MissedRunOnce:
+		if latest {
+			s.run(ctx, job, ScheduleTriggerMissed, activation, "")
+			return
+		}
+	}
+
+	s.logger.Info("schedule run missed", "schedule", job.key, "scheduled_at", activation)
+	if err := s.db.WithContext(ctx).Create(&ScheduleRun{
+		Schedule:    job.key,
+		Agent:       job.agent.Name,
+		Trigger:     ScheduleTriggerMissed,
+		Status:      ScheduleRunSkipped,
+		ScheduledAt: activation,
+	}).Error; err != nil {
+		s.logger.Error("failed to record schedule run", "schedule", job.key, "error", err)
+	}
+}
+
+// loopRSS polls the feeds of the schedule and runs it with the items that were not seen before.
+// The items of a feed published before its first poll returning items are not reported
+func (s *scheduler) loopRSS(ctx context.Context, job *scheduleJob) {
+	state, err := s.loadState(ctx, job.key)
+	if err != nil {
+		s.logger.Error("failed to load schedule state", "schedule", job.key, "error", err)
+		return
+	}
+	seenItems := state.SeenFeedItems.Data()
+	if seenItems == nil {
+		seenItems = map[string][]string{}
+	}
+
+	ticker := time.NewTicker(job.interval)
+	defer ticker.Stop()
+	for {
+		polledAt := time.Now()
+		var newItems []rss.FeedItem
+		reported := map[string]bool{}
+		feeds := s.reader.ReadMultipleFeeds(ctx, job.schedule.RSS.URLs)
+		for _, url := range job.schedule.RSS.URLs {
+			// A feed that failed or returned nothing keeps what it had, so that its items are not reported again
+			items := feeds[url]
+			if len(items) == 0 {
+				continue
+			}
+			previous, initialized := seenItems[url]
+			seen := make(map[string]bool, len(previous))
+			for _, key := range previous {
+				seen[key] = true
+			}
+
+			current := make([]string, 0, len(items))
+			inFeed := make(map[string]bool, len(items))
+			for _, item := range items {
+				key := feedItemKey(item)
+				if key == "" || inFeed[key] {
+					continue
+				}
+				inFeed[key] = true
+				current = append(current, key)
+				if initialized && !seen[key] && !reported[key] {
+					reported[key] = true
+					newItems = append(newItems, item)
+				}
+			}
+
+			// The items still in the feed are always remembered, and the ones that left it only up to maxSeenItems
+			for _, key := range previous {
+				if len(current) >= len(items)+maxSeenItems {
+					break
+				}
+				if !inFeed[key] {
+					current = append(current, key)
+				}
+			}
+			seenItems[url] = current
+		}
+
+		if len(newItems) > 0 {
+			s.run(ctx, job, ScheduleTriggerRSS, polledAt, formatFeedItems(newItems))
+		}
+
+		if err := s.db.WithContext(ctx).Model(&ScheduleState{Key: job.key}).Updates(map[string]any{
+			"last_activation_at": polledAt,
+			"seen_feed_items":    datatypes.NewJSONType(seenItems),
+		}).Error; err != nil {
+			s.logger.Error("failed to save schedule state", "schedule", job.key, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// feedItemKey identifies a feed item by its GUID, or its link if it has none
+func feedItemKey(item rss.FeedItem) string {
+	if item.GUID != "" {
+		return item.GUID
+	}
+	return item.Link
+}
+
+func formatFeedItems(items []rss.FeedItem) string {
+	var sb strings.Builder
+	sb.WriteString("New items:\n")
+	for _, item := range items {
+		fmt.Fprintf(&sb, "- %s (%s)", item.Title, item.Link)
+		if !item.Published.IsZero() {
+			fmt.Fprintf(&sb, ", published %s", item.Published.Format(time.RFC3339))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// errWebhookRunInProgress is returned by Trigger while a run started by the webhook has not finished
+var errWebhookRunInProgress = errors.New("a webhook run of the schedule is in progress")
+
+// Trigger records a pending run of the webhook schedule and starts it in the background. The payload is appended
+// to the instruction. The webhook is refused while a run it started is pending or running, so that its calls do not
+// pile up
+func (s *scheduler) Trigger(key, payload string) (*ScheduleRun, error) {
+	job, ok := s.jobs[key]
+	if !ok || job.schedule.Webhook == nil {
+		return nil, errors.Errorf("webhook schedule %s not found", key)
+	}
+	if !job.webhookRunning.CompareAndSwap(false, true) {
+		return nil, errWebhookRunInProgress
+	}
+
+	run := &ScheduleRun{
+		Schedule:    job.key,
+		Agent:       job.agent.Name,
+		Trigger:     ScheduleTriggerWebhook,
+		Status:      ScheduleRunPending,
+		ScheduledAt: time.Now(),
+	}
+	if err := s.db.WithContext(s.ctx).Create(run).Error; err != nil {
+		job.webhookRunning.Store(false)
+		return nil, errors.Wrapf(err, "failed to record schedule run")
+	}
+
+	if payload != "" {
+		payload = "Webhook payload:\n" + payload
+	}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer job.webhookRunning.Store(false)
+		s.execute(s.ctx, job, run, payload)
+	}()
+	return run, nil
+}
+
+// run records a run of the schedule and executes it
+func (s *scheduler) run(ctx context.Context, job *scheduleJob, trigger string, scheduledAt time.Time, extra string) {
+	run := &ScheduleRun{
+		Schedule:    job.key,
+		Agent:       job.agent.Name,
+		Trigger:     trigger,
+		Status:      ScheduleRunPending,
+		ScheduledAt: scheduledAt,
+	}
+	if err := s.db.WithContext(ctx).Create(run).Error; err != nil {
+		s.logger.Error("failed to record schedule run", "schedule", job.key, "error", err)
+		return
+	}
+	s.execute(ctx, job, run, extra)
+}
+
+// execute posts the instruction, followed by extra, to the thread of the schedule and the agent's answer after it
+func (s *scheduler) execute(ctx context.Context, job *scheduleJob, run *ScheduleRun, extra string) {
+	job.mtx.Lock()
+	defer job.mtx.Unlock()
+
+	startedAt := time.Now()
+	run.StartedAt = &startedAt
+	run.Status = ScheduleRunRunning
+	if err := s.db.WithContext(ctx).Save(run).Error; err != nil {
+		s.logger.Error("failed to record schedule run", "schedule", job.key, "error", err)
+	}
+
+	s.logger.Info("schedule run started", "schedule", job.key, "run_id", run.ID, "trigger", run.Trigger)
+	reply, err := s.reply(ctx, job, run, extra)
+
+	finishedAt := time.Now()
+	run.FinishedAt = &finishedAt
+	if err != nil {
+		s.logger.Error("schedule run failed", "schedule", job.key, "run_id", run.ID, "error", err)
+		run.Status = ScheduleRunFailed
+		run.Error = err.Error()
+	} else {
+		s.logger.Info("schedule run succeeded", "schedule", job.key, "run_id", run.ID)
+		run.Status = ScheduleRunSucceeded
+		run.MessageID = reply.ID
+	}
+	// The run is recorded even if the server is shutting down
+	if err := s.db.WithContext(context.WithoutCancel(ctx)).Save(run).Error; err != nil {
+		s.logger.Error("failed to record schedule run", "schedule", job.key, "error", err)
+	}
+
+	if reply != nil {
+		// Agents mentioned in the answer reply to it as in threads of users
+		select {
+		case s.messageCh <- reply:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (s *scheduler) reply(ctx context.Context, job *scheduleJob, run *ScheduleRun, extra string) (*Message, error) {
+	threadID, err := s.threadID(ctx, job)
+	if err != nil {
+		return nil, err
+	}
+	run.ThreadID = threadID
+
+	instruction := job.schedule.Instruction
+	if extra != "" {
+		instruction = strings.TrimRight(instruction, "\n") + "\n\n" + extra
+	}
+	if err := s.db.WithContext(ctx).Create(&Message{
+		ThreadID: threadID,
+		Content:  instruction,
+		User:     schedulerUser,
+	}).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to create message")
+	}
+
+	var thread Thread
+	if err := s.db.WithContext(ctx).Preload("History").First(&thread, "id = ?", threadID).Error; err != nil {
+		return nil, errors.Wrapf(err, "thread %d not found", threadID)
+	}
+	return replyInThread(ctx, s.db, job.agent, &thread, s.logger, s.options...)
+}
+
+// threadID returns the target thread of the schedule, creating a thread for it on its first run if it has none
+func (s *scheduler) threadID(ctx context.Context, job *scheduleJob) (uint, error) {
+	if job.schedule.ThreadID != 0 {
+		return job.schedule.ThreadID, nil
+	}
+
+	state, err := s.loadState(ctx, job.key)
+	if err != nil {
+		return 0, err
+	}
+	if state.ThreadID != 0 {
+		return state.ThreadID, nil
+	}
+
+	thread := Thread{
+		Instruction:  fmt.Sprintf("Scheduled runs of %s", job.key),
+		Participants: []string{job.agent.Name},
+	}
+	if err := s.db.WithContext(ctx).Create(&thread).Error; err != nil {
+		return 0, errors.Wrapf(err, "failed to create thread")
+	}
+	state.ThreadID = thread.ID
+	if err := s.db.WithContext(ctx).Save(state).Error; err != nil {
+		return 0, errors.Wrapf(err, "failed to save schedule state")
+	}
+	return thread.ID, nil
+}
+
+func (s *scheduler) loadState(ctx context.Context, key string) (*ScheduleState, error) {
+	state := &ScheduleState{Key: key}
+	if err := s.db.WithContext(ctx).FirstOrCreate(state, "key = ?", key).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to load state of schedule %s", key)
+	}
+	return state, nil
+}
+
+func (s *scheduler) saveActivation(ctx context.Context, key string, activation time.Time) error {
+	return s.db.WithContext(ctx).Model(&ScheduleState{Key: key}).Update("last_activation_at", activation).Error
+}
+
+// Schedules describes the schedules in the order they were defined
+func (s *scheduler) Schedules(ctx context.Context) ([]scheduleInfo, error) {
+	infos := make([]scheduleInfo, 0, len(s.keys))
+	for _, key := range s.keys {
+		job := s.jobs[key]
+		info := scheduleInfo{
+			Key:      key,
+			Agent:    job.agent.Name,
+			Name:     job.schedule.Name,
+			ThreadID: job.schedule.ThreadID,
+		}
+
+		var state ScheduleState
+		err := s.db.WithContext(ctx).Limit(1).Find(&state, "key = ?", key).Error
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load state of schedule %s", key)
+		}
+		if info.ThreadID == 0 && state.ThreadID != 0 {
+			info.ThreadID = state.ThreadID
+		}
+		if !state.LastActivationAt.IsZero() {
+			info.LastActivationAt = &state.LastActivationAt
+		}
+
+		switch {
+		case job.cron != nil:
+			info.Trigger = ScheduleTriggerCron
+			if !state.LastActivationAt.IsZero() {
+				next := job.cron.Next(state.LastActivationAt)
+				info.NextRunAt = &next
+			}
+		case job.schedule.RSS != nil:
+			info.Trigger = ScheduleTriggerRSS
+			if !state.LastActivationAt.IsZero() {
+				next := state.LastActivationAt.Add(job.interval)
+				info.NextRunAt = &next
+			}
+		case job.schedule.Webhook != nil:
+			info.Trigger = ScheduleTriggerWebhook
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
@@ -2,17 +2,21 @@ package cmd
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"io"
 	"log/slog"
 	"maps"
 	"net/http"
 	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/habiliai/agentruntime/entity"
+	"github.com/pkg/errors"
 	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
@@ -184,9 +188,102 @@ func createThreadsRouter(router *mux.Router, db *gorm.DB, messageCh chan *Messag
 	}).Methods("GET")
 }
 
-func createServerHandler(agents map[string]entity.Agent, db *gorm.DB, logger *slog.Logger, messageCh chan *Message) (http.Handler, error) {
+// maxWebhookPayload bounds the request bodies of schedule webhooks
+const maxWebhookPayload = 64 * 1024
+
+func createSchedulesRouter(router *mux.Router, db *gorm.DB, scheduler *scheduler) {
+	router.HandleFunc("/schedules", func(w http.ResponseWriter, r *http.Request) {
+		schedules, err := scheduler.Schedules(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(schedules); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}).Methods("GET")
+
+	// Get the run history of a schedule, latest first
+	router.HandleFunc("/schedules/{agent}/{name}/runs", func(w http.ResponseWriter, r *http.Request) {
+		tx := db.WithContext(r.Context())
+
+		vars := mux.Vars(r)
+		key := strings.ToLower(vars["agent"]) + "/" + vars["name"]
+
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+		}
+
+		var runs []ScheduleRun
+		if err := tx.Order("id desc").Limit(limit).Find(&runs, "schedule = ?", key).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(runs); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}).Methods("GET")
+
+	// Trigger a webhook schedule. The request body is passed to the agent after the instruction
+	router.HandleFunc("/schedules/{agent}/{name}/webhook", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		key := strings.ToLower(vars["agent"]) + "/" + vars["name"]
+
+		job, ok := scheduler.jobs[key]
+		if !ok || job.schedule.Webhook == nil {
+			http.Error(w, "webhook schedule not found", http.StatusNotFound)
+			return
+		}
+		// Schedules validate that a webhook without a secret is marked insecure
+		if secret := job.schedule.Webhook.Secret; secret != "" {
+			token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		run, err := scheduler.Trigger(key, string(payload))
+		if errors.Is(err, errWebhookRunInProgress) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(map[string]any{
+			"run_id": run.ID,
+		}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}).Methods("POST")
+}
+
+func createServerHandler(agents map[string]entity.Agent, db *gorm.DB, logger *slog.Logger, messageCh chan *Message, scheduler *scheduler) (http.Handler, error) {
 	router := mux.NewRouter()
 	createThreadsRouter(router, db, messageCh)
+	createSchedulesRouter(router, db, scheduler)
 	router.HandleFunc("/agents", func(w http.ResponseWriter, r *http.Request) {
 		agents := slices.Collect(maps.Values(agents))
 
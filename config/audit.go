@@ -0,0 +1,29 @@
+package config
+
+const (
+	// AuditSinkJSONL appends the audit records to a JSON Lines file
+	AuditSinkJSONL = "jsonl"
+	// AuditSinkSQLite stores the audit records in a SQLite database
+	AuditSinkSQLite = "sqlite"
+)
+
+// AuditConfig configures the persistent log of tool calls
+type AuditConfig struct {
+	// Sink is where the tool calls are recorded: "jsonl", "sqlite", or empty to disable the audit log
+	// Default: ""
+	Sink string `json:"sink,omitempty"`
+
+	// Path is the JSON Lines file or the SQLite database of the sink
+	// Default: "agentruntime-audit.jsonl" for jsonl, "agentruntime-audit.db" for sqlite
+	Path string `json:"path,omitempty"`
+
+	// RedactFields are argument names whose values are replaced by "[REDACTED]", in addition to the
+	// default ones such as password, secret, token, api_key and authorization. Names match case-insensitively,
+	// ignoring "_" and "-", and as suffixes, so "token" redacts access_token and githubToken
+	// Default: []
+	RedactFields []string `json:"redactFields,omitempty"`
+}
+
+func NewAuditConfig() *AuditConfig {
+	return &AuditConfig{}
+}
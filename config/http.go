@@ -0,0 +1,53 @@
+package config
+
+import "time"
+
+const (
+	// CassetteModeRecord sends requests to the network and records the interactions to the cassette
+	CassetteModeRecord = "record"
+	// CassetteModeReplay answers requests from the cassette and fails on requests that were not recorded
+	CassetteModeReplay = "replay"
+	// CassetteModeReplayOrRecord answers recorded requests from the cassette and records the others
+	CassetteModeReplayOrRecord = "replay-or-record"
+)
+
+// HTTPConfig configures the HTTP client the native tools and the embedder use
+type HTTPConfig struct {
+	// Timeout limits a whole request, including reading the response body
+	// Default: 30s
+	Timeout time.Duration `json:"timeout,omitempty"`
+
+	// ProxyURL is the proxy all requests are sent through
+	// If empty, the proxy is taken from HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+	// Default: ""
+	ProxyURL string `json:"proxyUrl,omitempty"`
+
+	// CAFile is a PEM file with certificates trusted in addition to the system roots
+	// Default: ""
+	CAFile string `json:"caFile,omitempty"`
+
+	// CacheTTL keeps successful GET responses for the given duration. Zero disables the cache
+	// Default: 0
+	CacheTTL time.Duration `json:"cacheTtl,omitempty"`
+
+	// CacheMaxEntries is the number of responses the cache holds before evicting the oldest
+	// Default: 1000
+	CacheMaxEntries int `json:"cacheMaxEntries,omitempty"`
+
+	// CassetteFile records the HTTP interactions to, or replays them from, the given file
+	// to make tests deterministic. Empty disables recording and replaying
+	// Default: ""
+	CassetteFile string `json:"cassetteFile,omitempty"`
+
+	// CassetteMode is one of "record", "replay" and "replay-or-record"
+	// Default: "replay-or-record"
+	CassetteMode string `json:"cassetteMode,omitempty"`
+}
+
+func NewHTTPConfig() *HTTPConfig {
+	return &HTTPConfig{
+		Timeout:         30 * time.Second,
+		CacheMaxEntries: 1000,
+		CassetteMode:    CassetteModeReplayOrRecord,
+	}
+}
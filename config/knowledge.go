@@ -2,14 +2,107 @@ package config
 
 import "os"
 
+const (
+	// EmbedderProviderNomic embeds with the Nomic Atlas API, which also embeds images
+	EmbedderProviderNomic = "nomic"
+	// EmbedderProviderOpenAI embeds with the OpenAI embedding models of genkit
+	EmbedderProviderOpenAI = "openai"
+	// EmbedderProviderOpenAICompatible embeds with any OpenAI compatible /v1/embeddings endpoint
+	EmbedderProviderOpenAICompatible = "openai-compatible"
+	// EmbedderProviderHash embeds with a deterministic hashing of the words, for offline tests
+	EmbedderProviderHash = "hash"
+)
+
+const (
+	// SearchModeVector matches documents by the similarity of their embeddings to the query
+	SearchModeVector = "vector"
+	// SearchModeKeyword matches documents by the words of the query, ranked by BM25
+	SearchModeKeyword = "keyword"
+	// SearchModeHybrid merges the vector and keyword rankings with reciprocal rank fusion
+	SearchModeHybrid = "hybrid"
+)
+
+const (
+	// VectorIndexFlat compares the query with the embedding of every document, which finds the nearest ones exactly
+	VectorIndexFlat = "flat"
+	// VectorIndexHNSW searches a hierarchical navigable small world graph of the embeddings, which finds most of the
+	// nearest documents much faster once there are tens of thousands of them
+	VectorIndexHNSW = "hnsw"
+)
+
+const (
+	// ChunkingStrategyRecursive splits on paragraphs, then lines, sentences and words until the pieces fit
+	ChunkingStrategyRecursive = "recursive"
+	// ChunkingStrategySentence groups whole sentences into chunks
+	ChunkingStrategySentence = "sentence"
+	// ChunkingStrategyMarkdown splits markdown into its sections, with the path of their headings
+	ChunkingStrategyMarkdown = "markdown"
+	// ChunkingStrategyToken splits into windows of a fixed number of tokens
+	ChunkingStrategyToken = "token"
+	// ChunkingStrategyCode splits source code on the boundaries of its functions, types and methods
+	ChunkingStrategyCode = "code"
+
+	// ChunkingContentTypeDefault is the key of Chunking for the content types without their own chunking
+	ChunkingContentTypeDefault = "*"
+	// ChunkingContentTypeCode is the key of Chunking for source code, whatever its language
+	ChunkingContentTypeCode = "code"
+)
+
+// ChunkingConfig is how documents of a content type are split into chunks. Sizes are in tokens, estimated from
+// the words and punctuation of the text
+type ChunkingConfig struct {
+	// Strategy is how the text is split
+	// Options: "recursive", "sentence", "markdown", "token", "code"
+	// Default: "recursive"
+	Strategy string `json:"strategy,omitempty"`
+
+	// Size is the maximum number of tokens of a chunk
+	Size int `json:"size,omitempty"`
+
+	// Overlap is the number of tokens of the end of a chunk repeated at the start of the next one, so that text
+	// across a boundary is found in either chunk. Must be less than Size. Code chunks do not overlap
+	Overlap int `json:"overlap,omitempty"`
+}
+
 type KnowledgeConfig struct {
 	NomicAPIKey string `json:"nomicApiKey,omitempty"`
 
+	// Embedder Settings
+	// EmbedderProvider specifies which embedder to use
+	// Options: "nomic", "openai", "openai-compatible", "hash"
+	// Only "nomic" embeds images, for image knowledge and the "vision" PDF embedding method
+	// Default: "nomic"
+	EmbedderProvider string `json:"embedderProvider,omitempty"`
+
+	// EmbedderModel specifies the embedding model of the provider
+	// Required for "openai-compatible"
+	// Default: "nomic-embed-text-v1.5" for nomic, "text-embedding-3-small" for openai
+	EmbedderModel string `json:"embedderModel,omitempty"`
+
+	// EmbedderBaseURL is the base URL of the "openai-compatible" endpoint, to which /embeddings is appended
+	// Default: "http://localhost:11434/v1"
+	EmbedderBaseURL string `json:"embedderBaseUrl,omitempty"`
+
+	// EmbedderAPIKey is the bearer token of the "openai-compatible" endpoint, if it requires one
+	// Default: ""
+	EmbedderAPIKey string `json:"embedderApiKey,omitempty"`
+
+	// EmbedderDimension is the size of the embeddings. Required for "openai-compatible". For "openai",
+	// a value below the size of the model shortens the embeddings of the text-embedding-3 models
+	// Default: 0 (the size of the model, 256 for hash)
+	EmbedderDimension int `json:"embedderDimension,omitempty"`
+
 	// PDFEmbeddingMethod specifies which method to use for PDF embedding
 	// Options: "vision" (use Vision embedding model), "text" (use text embedding model)
 	// Default: "text"
 	PDFEmbeddingMethod string `json:"pdfEmbeddingMethod,omitempty"`
 
+	// Chunking selects how text, markdown, HTML and DOCX documents are split into chunks, by content type, with
+	// "code" for source code and "*" for the other content types
+	// Default: markdown sections of up to 512 tokens for "text/markdown", "text/html" and DOCX, code symbols of up
+	// to 512 tokens for "code", recursive chunks of up to 256 tokens for the others, with an overlap of 32 tokens
+	Chunking map[string]ChunkingConfig `json:"chunking,omitempty"`
+
 	// Core Database Settings
 	// SqliteEnabled controls whether SQLite knowledge service is activated
 	// Default: true
@@ -25,6 +118,52 @@ type KnowledgeConfig struct {
 	// Default: true
 	VectorEnabled bool `json:"vectorEnabled,omitempty"`
 
+	// VectorIndex specifies how the in-memory store searches the embeddings
+	// Options: "flat" (exact, linear in the number of documents), "hnsw" (approximate, logarithmic)
+	// Default: "flat"
+	VectorIndex string `json:"vectorIndex,omitempty"`
+
+	// HNSWM is the number of neighbors of the nodes of the HNSW graph. Higher values find more of the nearest
+	// documents, with more memory and slower insertions
+	// Default: 16
+	HNSWM int `json:"hnswM,omitempty"`
+
+	// HNSWEfConstruction is the number of candidate neighbors searched when inserting a document in the HNSW graph.
+	// Higher values build a better graph, more slowly
+	// Default: 200
+	HNSWEfConstruction int `json:"hnswEfConstruction,omitempty"`
+
+	// HNSWEfSearch is the number of candidates searched by a query of the HNSW graph, at least the number of
+	// results. Higher values find more of the nearest documents, more slowly
+	// Default: 64
+	HNSWEfSearch int `json:"hnswEfSearch,omitempty"`
+
+	// InMemorySnapshotPath is the file the in-memory store is loaded from when it is created, if it exists, and saved
+	// to when it is closed, with its documents, embeddings and HNSW graph, so that a restart neither embeds the
+	// documents again nor rebuilds the graph
+	// Default: "" (not saved)
+	InMemorySnapshotPath string `json:"inMemorySnapshotPath,omitempty"`
+
+	// Search Mode Settings
+	// SearchMode specifies how documents are matched to the query
+	// Options: "vector" (embedding similarity), "keyword" (BM25 full-text search, which also finds exact
+	// identifiers, error codes and SKUs), "hybrid" (both, merged by reciprocal rank fusion)
+	// Default: "vector"
+	SearchMode string `json:"searchMode,omitempty"`
+
+	// HybridVectorWeight is the weight of the vector ranking in hybrid search
+	// Default: 1.0
+	HybridVectorWeight float64 `json:"hybridVectorWeight,omitempty"`
+
+	// HybridKeywordWeight is the weight of the keyword ranking in hybrid search
+	// Default: 1.0
+	HybridKeywordWeight float64 `json:"hybridKeywordWeight,omitempty"`
+
+	// RRFK is the rank constant k of reciprocal rank fusion, where a document scores weight / (k + rank) in each
+	// ranking. Higher values give lower ranks more influence relative to the top ones
+	// Default: 60
+	RRFK int `json:"rrfK,omitempty"`
+
 	// Rerank Settings
 	// RerankEnabled controls whether to use LLM-based reranking after vector search
 	// This improves search accuracy by evaluating semantic relevance
@@ -86,7 +225,17 @@ func NewKnowledgeConfig() *KnowledgeConfig {
 		SqlitePath:    ":memory:",
 
 		// Vector Search Settings
-		VectorEnabled: true,
+		VectorEnabled:      true,
+		VectorIndex:        VectorIndexFlat,
+		HNSWM:              16,
+		HNSWEfConstruction: 200,
+		HNSWEfSearch:       64,
+
+		// Search Mode Settings
+		SearchMode:          SearchModeVector,
+		HybridVectorWeight:  1.0,
+		HybridKeywordWeight: 1.0,
+		RRFK:                60,
 
 		// Rerank Settings
 		RerankEnabled:   true,
@@ -105,6 +254,17 @@ func NewKnowledgeConfig() *KnowledgeConfig {
 		PDFExtractionMethod:    "library",
 		PDFEmbeddingMethod:     "text",
 
+		Chunking: map[string]ChunkingConfig{
+			"text/markdown": {Strategy: ChunkingStrategyMarkdown, Size: 512, Overlap: 32},
+			"text/html":     {Strategy: ChunkingStrategyMarkdown, Size: 512, Overlap: 32},
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document": {Strategy: ChunkingStrategyMarkdown, Size: 512, Overlap: 32},
+			ChunkingContentTypeCode:    {Strategy: ChunkingStrategyCode, Size: 512},
+			ChunkingContentTypeDefault: {Strategy: ChunkingStrategyRecursive, Size: 256, Overlap: 32},
+		},
+
+		EmbedderProvider: EmbedderProviderNomic,
+		EmbedderBaseURL:  "http://localhost:11434/v1",
+
 		NomicAPIKey: os.Getenv("NOMIC_API_KEY"),
 	}
 }
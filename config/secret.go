@@ -0,0 +1,114 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/joho/godotenv"
+	"github.com/pkg/errors"
+)
+
+type SecretConfig struct {
+	// EnvFile is a dotenv file with the values of the variables referenced in agent files
+	// Default: $AGENTRUNTIME_ENV_FILE
+	EnvFile string `json:"envFile,omitempty"`
+
+	// SecretsDir is a directory holding one file per secret, named after the variable,
+	// e.g. the secrets mounted by Docker or Kubernetes
+	// Default: $AGENTRUNTIME_SECRETS_DIR
+	SecretsDir string `json:"secretsDir,omitempty"`
+}
+
+type (
+	// EnvSecretResolver resolves variables from the environment of the process
+	EnvSecretResolver struct{}
+
+	// MapSecretResolver resolves variables from a map, e.g. the contents of a dotenv file
+	MapSecretResolver map[string]string
+
+	// DirSecretResolver resolves a variable from the file of the same name in a directory.
+	// Trailing newlines of the file are trimmed.
+	DirSecretResolver struct {
+		Dir string
+	}
+
+	// SecretResolvers resolves a variable from the first resolver defining it
+	SecretResolvers []entity.SecretResolver
+)
+
+var (
+	_ entity.SecretResolver = EnvSecretResolver{}
+	_ entity.SecretResolver = MapSecretResolver{}
+	_ entity.SecretResolver = DirSecretResolver{}
+	_ entity.SecretResolver = SecretResolvers{}
+)
+
+func NewSecretConfig() *SecretConfig {
+	return &SecretConfig{
+		EnvFile:    os.Getenv("AGENTRUNTIME_ENV_FILE"),
+		SecretsDir: os.Getenv("AGENTRUNTIME_SECRETS_DIR"),
+	}
+}
+
+// NewSecretResolver returns a resolver looking up variables in the environment, then in the env file
+// and then in the secrets directory
+func NewSecretResolver(config *SecretConfig) (entity.SecretResolver, error) {
+	resolvers := SecretResolvers{EnvSecretResolver{}}
+	if config.EnvFile != "" {
+		resolver, err := NewDotenvSecretResolver(config.EnvFile)
+		if err != nil {
+			return nil, err
+		}
+		resolvers = append(resolvers, resolver)
+	}
+	if config.SecretsDir != "" {
+		resolvers = append(resolvers, DirSecretResolver{Dir: config.SecretsDir})
+	}
+	return resolvers, nil
+}
+
+// NewDotenvSecretResolver reads the variables of a dotenv file
+func NewDotenvSecretResolver(path string) (MapSecretResolver, error) {
+	values, err := godotenv.Read(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read env file %s", path)
+	}
+	return values, nil
+}
+
+func (EnvSecretResolver) ResolveSecret(name string) (string, bool, error) {
+	value, ok := os.LookupEnv(name)
+	return value, ok, nil
+}
+
+func (r MapSecretResolver) ResolveSecret(name string) (string, bool, error) {
+	value, ok := r[name]
+	return value, ok, nil
+}
+
+func (r DirSecretResolver) ResolveSecret(name string) (string, bool, error) {
+	// Names are file names within the directory, never paths
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", false, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(r.Dir, name))
+	if os.IsNotExist(err) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, errors.Wrapf(err, "failed to read secret %s", name)
+	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
+
+func (r SecretResolvers) ResolveSecret(name string) (string, bool, error) {
+	for _, resolver := range r {
+		value, ok, err := resolver.ResolveSecret(name)
+		if err != nil || ok {
+			return value, ok, err
+		}
+	}
+	return "", false, nil
+}
@@ -0,0 +1,43 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/habiliai/agentruntime/config"
+)
+
+func (s *ConfigTestSuite) TestSecretResolver() {
+	dir := s.T().TempDir()
+	envFile := filepath.Join(dir, ".env")
+	s.Require().NoError(os.WriteFile(envFile, []byte("API_KEY=from-env-file\nHOST=env-file.example.com\n"), 0600))
+	secretsDir := filepath.Join(dir, "secrets")
+	s.Require().NoError(os.Mkdir(secretsDir, 0700))
+	s.Require().NoError(os.WriteFile(filepath.Join(secretsDir, "DB_PASSWORD"), []byte("from-secrets-dir\n"), 0600))
+	s.Require().NoError(os.WriteFile(filepath.Join(secretsDir, "API_KEY"), []byte("shadowed"), 0600))
+	s.T().Setenv("HOST", "env.example.com")
+
+	resolver, err := config.NewSecretResolver(&config.SecretConfig{EnvFile: envFile, SecretsDir: secretsDir})
+	s.Require().NoError(err)
+
+	// The environment takes precedence over the env file, which takes precedence over the secrets directory
+	for name, expected := range map[string]string{
+		"HOST":        "env.example.com",
+		"API_KEY":     "from-env-file",
+		"DB_PASSWORD": "from-secrets-dir",
+	} {
+		value, ok, err := resolver.ResolveSecret(name)
+		s.Require().NoError(err)
+		s.Require().True(ok, name)
+		s.Equal(expected, value)
+	}
+
+	for _, name := range []string{"MISSING", "../secrets/DB_PASSWORD"} {
+		_, ok, err := resolver.ResolveSecret(name)
+		s.Require().NoError(err)
+		s.False(ok, name)
+	}
+
+	_, err = config.NewSecretResolver(&config.SecretConfig{EnvFile: filepath.Join(dir, "missing.env")})
+	s.Error(err)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+type ToolConfig struct {
+	// MaxResultSize is the maximum size in bytes of a tool result handed back to the model.
+	// Larger results are truncated (or summarized when ResultSummaryModel is set) and the
+	// full result stays available through the read_tool_result tool.
+	// Skills can override it with their own maxResultSize. Zero disables the limit.
+	// Default: 65536
+	MaxResultSize int `json:"maxResultSize,omitempty"`
+
+	// ResultSummaryModel specifies which LLM model to use for condensing over-limit tool results
+	// If empty, over-limit results are truncated with a notice instead
+	// Default: ""
+	ResultSummaryModel string `json:"resultSummaryModel,omitempty"`
+
+	// MCPTokenDir is the directory where the OAuth tokens of oauth-sse MCP servers are stored, encrypted
+	// If empty, tokens are kept in memory and lost on restart
+	// Default: ~/.agentruntime/mcp-tokens
+	MCPTokenDir string `json:"mcpTokenDir,omitempty"`
+
+	// MCPTokenKey is the passphrase the stored tokens are encrypted with
+	// If empty, a random key is generated and kept in MCPTokenDir
+	// Default: $AGENTRUNTIME_MCP_TOKEN_KEY
+	MCPTokenKey string `json:"-"`
+}
+
+func NewToolConfig() *ToolConfig {
+	return &ToolConfig{
+		MaxResultSize: 64 * 1024,
+		MCPTokenDir:   defaultMCPTokenDir(),
+		MCPTokenKey:   os.Getenv("AGENTRUNTIME_MCP_TOKEN_KEY"),
+	}
+}
+
+func defaultMCPTokenDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".agentruntime", "mcp-tokens")
+}
@@ -51,6 +51,10 @@ func (s *Engine) BuildPromptValues(ctx context.Context, agent entity.Agent, req
 			return nil, errors.Wrapf(err, "failed to get tools by skill")
 		}
 		for _, tool := range tools {
+			// Skills may share tools such as read_tool_result
+			if slices.ContainsFunc(promptValues.Tools, func(t ai.Tool) bool { return t.Name() == tool.Name() }) {
+				continue
+			}
 			promptValues.AvailableActions = append(promptValues.AvailableActions, AvailableAction{
 				Action:      tool.Name(),
 				Description: tool.Definition().Description,
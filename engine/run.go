@@ -9,6 +9,8 @@ import (
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
+	"github.com/google/uuid"
+	"github.com/habiliai/agentruntime/audit"
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/habiliai/agentruntime/internal/sliceutils"
 	"github.com/habiliai/agentruntime/tool"
@@ -74,6 +76,8 @@ type (
 	}
 
 	RunRequest struct {
+		// ThreadID identifies the conversation in the audit log of the tool calls
+		ThreadID          string         `json:"thread_id,omitempty"`
 		ThreadInstruction string         `json:"thread_instruction,omitempty"`
 		History           []Conversation `json:"history"`
 		Participant       []Participant  `json:"participants,omitempty"`
@@ -91,10 +95,13 @@ type (
 
 	RunResponse struct {
 		*ai.ModelResponse
+		// RunID identifies the run in the audit log of the tool calls
+		RunID     string     `json:"run_id"`
 		ToolCalls []ToolCall `json:"tool_calls"`
 	}
 
 	ToolCall struct {
+		ID        string          `json:"id,omitempty"`
 		Name      string          `json:"name"`
 		Arguments json.RawMessage `json:"arguments"`
 		Result    json.RawMessage `json:"result"`
@@ -131,8 +138,19 @@ func (s *Engine) Run(
 		promptValues.RecentConversations = recentConversations
 	}
 
+	// The tool calls are audited as part of this run, whose ID may be chosen by the caller
+	runInfo := audit.RunInfoFromContext(ctx)
+	if runInfo.RunID == "" {
+		runInfo.RunID = uuid.NewString()
+	}
+	runInfo.Agent = agent.Name
+	if req.ThreadID != "" {
+		runInfo.Thread = req.ThreadID
+	}
+	ctx = audit.WithRunInfo(ctx, runInfo)
+
 	ctx = tool.WithEmptyCallDataStore(ctx)
-	var res RunResponse
+	res := RunResponse{RunID: runInfo.RunID}
 	res.ModelResponse, err = genkit.Generate(
 		ctx,
 		s.genkit,
@@ -155,6 +173,7 @@ func (s *Engine) Run(
 	toolCallData := tool.GetCallData(ctx)
 	for _, data := range toolCallData {
 		tc := ToolCall{
+			ID:   data.ID,
 			Name: data.Name,
 		}
 
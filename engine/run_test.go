@@ -78,7 +78,7 @@ func (s *EngineTestSuite) TestMissmatchStreamingAndOutput() {
 	}, slog.Default())
 	s.Require().NoError(err)
 
-	toolManager, err := tool.NewToolManager(ctx, skills, slog.Default(), g, knowledgeService, memoryService)
+	toolManager, err := tool.NewToolManager(ctx, skills, slog.Default(), g, knowledgeService, memoryService, nil)
 	s.Require().NoError(err)
 	defer toolManager.Close()
 
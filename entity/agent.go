@@ -1,6 +1,10 @@
 package entity
 
-import "strings"
+import (
+	"encoding/json"
+	"log/slog"
+	"strings"
+)
 
 type Agent struct {
 	Name            string             `json:"name"`
@@ -17,6 +21,9 @@ type Agent struct {
 	// Skills are a unit of capability that an agent can perform.
 	Skills []AgentSkillUnion `json:"skills"`
 
+	// Schedules run the agent periodically or on events when it is served by the agentruntime server
+	Schedules []AgentSchedule `json:"schedules,omitempty"`
+
 	// ArtifactGeneration enables artifact generation capabilities for this agent
 	ArtifactGeneration bool `json:"artifactGeneration,omitempty"`
 
@@ -41,3 +48,12 @@ func (a Agent) GetModelProvider() string {
 	}
 	return values[0]
 }
+
+// LogValue logs the agent as JSON, so that interpolated secrets are redacted in logs as well
+func (a Agent) LogValue() slog.Value {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return slog.StringValue(a.Name)
+	}
+	return slog.StringValue(string(data))
+}
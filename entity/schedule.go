@@ -0,0 +1,125 @@
+package entity
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// MissedRunSkip drops the runs missed while the server was down and waits for the next one
+	MissedRunSkip = "skip"
+	// MissedRunOnce runs once for all the runs missed while the server was down
+	MissedRunOnce = "once"
+	// MissedRunAll runs once for every run missed while the server was down
+	MissedRunAll = "all"
+)
+
+type (
+	// AgentSchedule runs the agent without a user message, either periodically or when an event arrives.
+	// The instruction is posted to the thread and the agent's answer follows it as a message.
+	AgentSchedule struct {
+		// Name identifies the schedule among the schedules of the agent
+		Name string `json:"name"`
+		// Instruction is the message the agent answers on each run
+		Instruction string `json:"instruction"`
+		// ThreadID is the thread the runs post to. If zero, a thread is created for the schedule on its first run
+		ThreadID uint `json:"thread,omitempty"`
+
+		// Cron is a five field cron expression, a descriptor such as @daily, or "@every <duration>"
+		Cron string `json:"cron,omitempty"`
+		// Timezone is the IANA time zone the cron expression is interpreted in. Default: UTC
+		Timezone string `json:"timezone,omitempty"`
+		// MissedRunPolicy is one of "skip", "once" and "all". Default: "skip"
+		MissedRunPolicy string `json:"missedRunPolicy,omitempty"`
+
+		// RSS runs the schedule when new items are published in the feeds
+		RSS *RSSTrigger `json:"rss,omitempty"`
+		// Webhook runs the schedule when its webhook endpoint is called
+		Webhook *WebhookTrigger `json:"webhook,omitempty"`
+	}
+
+	RSSTrigger struct {
+		URLs []string `json:"urls"`
+		// Interval is how often the feeds are polled, as a Go duration. Default: 15m
+		Interval string `json:"interval,omitempty"`
+	}
+
+	WebhookTrigger struct {
+		// Secret must be sent as a bearer token to trigger the schedule. It is required unless Insecure is set
+		Secret string `json:"secret,omitempty"`
+		// Insecure allows a webhook without a secret, which anyone reaching the server can trigger
+		Insecure bool `json:"insecure,omitempty"`
+
+		templates secretTemplates
+	}
+)
+
+// Validate checks that the schedule has a name, an instruction and exactly one trigger. A webhook trigger needs
+// a secret unless it is marked insecure
+func (s AgentSchedule) Validate() error {
+	if s.Name == "" {
+		return errors.New("schedule name is required")
+	}
+	if s.Instruction == "" {
+		return errors.Errorf("instruction of schedule %s is required", s.Name)
+	}
+
+	triggers := 0
+	if s.Cron != "" {
+		triggers++
+	}
+	if s.RSS != nil {
+		triggers++
+		if len(s.RSS.URLs) == 0 {
+			return errors.Errorf("rss trigger of schedule %s has no urls", s.Name)
+		}
+	}
+	if s.Webhook != nil {
+		triggers++
+	}
+	if triggers != 1 {
+		return errors.Errorf("schedule %s must have exactly one of cron, rss and webhook", s.Name)
+	}
+	if s.Webhook != nil && s.Webhook.Secret == "" && !s.Webhook.Insecure {
+		return errors.Errorf("webhook trigger of schedule %s has no secret, set insecure to allow it", s.Name)
+	}
+
+	switch s.MissedRunPolicy {
+	case "", MissedRunSkip, MissedRunOnce, MissedRunAll:
+	default:
+		return errors.Errorf("invalid missed run policy %s of schedule %s", s.MissedRunPolicy, s.Name)
+	}
+	return nil
+}
+
+// Interpolate replaces the variables in the webhook secret with the values of resolver. The secret is serialized
+// as written in the agent file
+func (s *AgentSchedule) Interpolate(resolver SecretResolver) error {
+	if s.Webhook == nil {
+		return nil
+	}
+	return errors.Wrapf(s.Webhook.interpolate(resolver), "failed to interpolate schedule %s", s.Name)
+}
+
+func (t *WebhookTrigger) interpolate(resolver SecretResolver) error {
+	secret, changed, err := interpolateString(t.Secret, resolver)
+	if err != nil {
+		return errors.Wrapf(err, "invalid secret")
+	}
+	if changed {
+		t.templates = secretTemplates{"secret": t.Secret}
+		t.Secret = secret
+	}
+	return nil
+}
+
+// MarshalJSON serializes the trigger with its secret as written in the agent file
+func (t WebhookTrigger) MarshalJSON() ([]byte, error) {
+	type trigger WebhookTrigger
+	redacted := trigger(t)
+	if template, ok := t.templates["secret"]; ok {
+		redacted.Secret = template.(string)
+	}
+	return json.Marshal(redacted)
+}
@@ -0,0 +1,97 @@
+package entity_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentScheduleValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule entity.AgentSchedule
+		err      string
+	}{
+		{
+			name:     "cron",
+			schedule: entity.AgentSchedule{Name: "briefing", Instruction: "Summarize the news", Cron: "0 8 * * *", MissedRunPolicy: entity.MissedRunOnce},
+		},
+		{
+			name:     "rss",
+			schedule: entity.AgentSchedule{Name: "feeds", Instruction: "Summarize the new items", RSS: &entity.RSSTrigger{URLs: []string{"https://example.com/rss"}}},
+		},
+		{
+			name:     "webhook",
+			schedule: entity.AgentSchedule{Name: "deploy", Instruction: "Report the deployment", Webhook: &entity.WebhookTrigger{Secret: "hook_secret"}},
+		},
+		{
+			name:     "insecure webhook",
+			schedule: entity.AgentSchedule{Name: "deploy", Instruction: "Report the deployment", Webhook: &entity.WebhookTrigger{Insecure: true}},
+		},
+		{
+			name:     "webhook without secret",
+			schedule: entity.AgentSchedule{Name: "deploy", Instruction: "Report the deployment", Webhook: &entity.WebhookTrigger{}},
+			err:      "webhook trigger of schedule deploy has no secret",
+		},
+		{
+			name:     "missing name",
+			schedule: entity.AgentSchedule{Instruction: "Summarize the news", Cron: "@daily"},
+			err:      "schedule name is required",
+		},
+		{
+			name:     "missing instruction",
+			schedule: entity.AgentSchedule{Name: "briefing", Cron: "@daily"},
+			err:      "instruction of schedule briefing is required",
+		},
+		{
+			name:     "no trigger",
+			schedule: entity.AgentSchedule{Name: "briefing", Instruction: "Summarize the news"},
+			err:      "exactly one of cron, rss and webhook",
+		},
+		{
+			name:     "two triggers",
+			schedule: entity.AgentSchedule{Name: "briefing", Instruction: "Summarize the news", Cron: "@daily", Webhook: &entity.WebhookTrigger{}},
+			err:      "exactly one of cron, rss and webhook",
+		},
+		{
+			name:     "rss without urls",
+			schedule: entity.AgentSchedule{Name: "feeds", Instruction: "Summarize the new items", RSS: &entity.RSSTrigger{}},
+			err:      "has no urls",
+		},
+		{
+			name:     "invalid missed run policy",
+			schedule: entity.AgentSchedule{Name: "briefing", Instruction: "Summarize the news", Cron: "@daily", MissedRunPolicy: "sometimes"},
+			err:      "invalid missed run policy",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.schedule.Validate()
+			if tt.err == "" {
+				require.NoError(t, err)
+			} else {
+				require.ErrorContains(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAgentInterpolateWebhookSecret(t *testing.T) {
+	agent := entity.Agent{
+		Name: "deployer",
+		Schedules: []entity.AgentSchedule{
+			{Name: "deploy", Instruction: "Report the deployment", Webhook: &entity.WebhookTrigger{Secret: "${WEBHOOK_SECRET}"}},
+		},
+	}
+
+	require.NoError(t, agent.Interpolate(testSecretResolver{"WEBHOOK_SECRET": "hook_secret"}))
+	require.Equal(t, "hook_secret", agent.Schedules[0].Webhook.Secret)
+
+	data, err := json.Marshal(agent)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "hook_secret")
+	require.Contains(t, string(data), `"secret":"${WEBHOOK_SECRET}"`)
+}
@@ -0,0 +1,248 @@
+package entity
+
+import (
+	"encoding/json"
+	"maps"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SecretResolver looks up the values of the variables referenced as ${NAME} in agent files
+type SecretResolver interface {
+	// ResolveSecret returns the value of the variable and whether it is defined
+	ResolveSecret(name string) (string, bool, error)
+}
+
+// secretTemplates keeps the values of skill fields as written in the agent file, before interpolation.
+// They are serialized in place of the resolved values so that secrets never leave the process.
+type secretTemplates map[string]any
+
+// Interpolate replaces ${NAME} and ${NAME:-default} in the URL, env and headers of the MCP skills, in the
+// env of the native skills and in the webhook secrets of the schedules with the values of resolver. $${ escapes a literal ${.
+// The interpolated fields are serialized as written in the agent file.
+func (a *Agent) Interpolate(resolver SecretResolver) error {
+	for _, skill := range a.Skills {
+		switch {
+		case skill.OfMCP != nil:
+			if err := skill.OfMCP.interpolate(resolver); err != nil {
+				return errors.Wrapf(err, "failed to interpolate skill %s", skill.OfMCP.Name)
+			}
+		case skill.OfNative != nil:
+			if err := skill.OfNative.interpolate(resolver); err != nil {
+				return errors.Wrapf(err, "failed to interpolate skill %s", skill.OfNative.Name)
+			}
+		}
+	}
+	for i := range a.Schedules {
+		if err := a.Schedules[i].Interpolate(resolver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *MCPAgentSkill) interpolate(resolver SecretResolver) error {
+	if s.templates == nil {
+		s.templates = secretTemplates{}
+	}
+
+	url, changed, err := interpolateString(s.URL, resolver)
+	if err != nil {
+		return errors.Wrapf(err, "invalid url")
+	}
+	if changed {
+		s.templates["url"] = s.URL
+		s.URL = url
+	}
+
+	if s.Env, err = s.templates.interpolateMap("env", s.Env, resolver); err != nil {
+		return err
+	}
+
+	if len(s.Headers) > 0 {
+		headers := make(map[string]string, len(s.Headers))
+		for key, value := range s.Headers {
+			resolved, changed, err := interpolateString(value, resolver)
+			if err != nil {
+				return errors.Wrapf(err, "invalid header %s", key)
+			}
+			if changed {
+				s.templates["headers."+key] = value
+			}
+			headers[key] = resolved
+		}
+		s.Headers = headers
+	}
+
+	return nil
+}
+
+func (s *NativeAgentSkill) interpolate(resolver SecretResolver) error {
+	if s.templates == nil {
+		s.templates = secretTemplates{}
+	}
+
+	var err error
+	s.Env, err = s.templates.interpolateMap("env", s.Env, resolver)
+	return err
+}
+
+// MarshalJSON serializes the skill with its interpolated fields as written in the agent file
+func (s MCPAgentSkill) MarshalJSON() ([]byte, error) {
+	type skill MCPAgentSkill
+	redacted := skill(s)
+	if len(s.templates) > 0 {
+		if template, ok := s.templates["url"]; ok {
+			redacted.URL = template.(string)
+		}
+		redacted.Env = s.templates.redactMap("env", s.Env)
+		if len(s.Headers) > 0 {
+			redacted.Headers = maps.Clone(s.Headers)
+			for key := range s.Headers {
+				if template, ok := s.templates["headers."+key]; ok {
+					redacted.Headers[key] = template.(string)
+				}
+			}
+		}
+	}
+	return json.Marshal(redacted)
+}
+
+// MarshalJSON serializes the skill with its interpolated fields as written in the agent file
+func (s NativeAgentSkill) MarshalJSON() ([]byte, error) {
+	type skill NativeAgentSkill
+	redacted := skill(s)
+	if len(s.templates) > 0 {
+		redacted.Env = s.templates.redactMap("env", s.Env)
+	}
+	return json.Marshal(redacted)
+}
+
+func (t secretTemplates) interpolateMap(prefix string, values map[string]any, resolver SecretResolver) (map[string]any, error) {
+	if len(values) == 0 {
+		return values, nil
+	}
+
+	result := make(map[string]any, len(values))
+	for key, value := range values {
+		resolved, changed, err := interpolateValue(value, resolver)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid %s %s", prefix, key)
+		}
+		if changed {
+			t[prefix+"."+key] = value
+		}
+		result[key] = resolved
+	}
+	return result, nil
+}
+
+func (t secretTemplates) redactMap(prefix string, values map[string]any) map[string]any {
+	if len(values) == 0 {
+		return values
+	}
+
+	result := maps.Clone(values)
+	for key := range values {
+		if template, ok := t[prefix+"."+key]; ok {
+			result[key] = template
+		}
+	}
+	return result
+}
+
+// interpolateValue interpolates the strings within value, which may be nested in lists and maps
+func interpolateValue(value any, resolver SecretResolver) (any, bool, error) {
+	switch v := value.(type) {
+	case string:
+		return interpolateString(v, resolver)
+	case []any:
+		result := make([]any, len(v))
+		changed := false
+		for i, item := range v {
+			resolved, itemChanged, err := interpolateValue(item, resolver)
+			if err != nil {
+				return nil, false, err
+			}
+			result[i] = resolved
+			changed = changed || itemChanged
+		}
+		return result, changed, nil
+	case []string:
+		result := make([]string, len(v))
+		changed := false
+		for i, item := range v {
+			resolved, itemChanged, err := interpolateString(item, resolver)
+			if err != nil {
+				return nil, false, err
+			}
+			result[i] = resolved
+			changed = changed || itemChanged
+		}
+		return result, changed, nil
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		changed := false
+		for key, item := range v {
+			resolved, itemChanged, err := interpolateValue(item, resolver)
+			if err != nil {
+				return nil, false, err
+			}
+			result[key] = resolved
+			changed = changed || itemChanged
+		}
+		return result, changed, nil
+	default:
+		return value, false, nil
+	}
+}
+
+// interpolateString expands the variables in s and reports whether s contained any
+func interpolateString(s string, resolver SecretResolver) (string, bool, error) {
+	if !strings.Contains(s, "${") {
+		return s, false, nil
+	}
+
+	var b strings.Builder
+	rest := s
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		if start > 0 && rest[start-1] == '$' {
+			b.WriteString(rest[:start-1])
+			b.WriteString("${")
+			rest = rest[start+2:]
+			continue
+		}
+		b.WriteString(rest[:start])
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", false, errors.Errorf("unterminated variable in %q", s)
+		}
+		expr := rest[start+2 : start+end]
+		rest = rest[start+end+1:]
+
+		name, defaultValue, hasDefault := strings.Cut(expr, ":-")
+		if name == "" {
+			return "", false, errors.Errorf("empty variable name in %q", s)
+		}
+		value, ok, err := resolver.ResolveSecret(name)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "failed to resolve %s", name)
+		}
+		if !ok || (value == "" && hasDefault) {
+			if !hasDefault {
+				return "", false, errors.Errorf("variable %s is not defined", name)
+			}
+			value = defaultValue
+		}
+		b.WriteString(value)
+	}
+
+	return b.String(), true, nil
+}
@@ -0,0 +1,103 @@
+package entity_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/stretchr/testify/require"
+)
+
+type testSecretResolver map[string]string
+
+func (r testSecretResolver) ResolveSecret(name string) (string, bool, error) {
+	value, ok := r[name]
+	return value, ok, nil
+}
+
+func TestAgentInterpolate(t *testing.T) {
+	agent := entity.Agent{
+		Name: "tester",
+		Skills: []entity.AgentSkillUnion{
+			{
+				Type: entity.AgentSkillTypeMCP,
+				OfMCP: &entity.MCPAgentSkill{
+					Name: "github",
+					URL:  "https://${GITHUB_HOST:-api.github.com}/mcp",
+					Headers: map[string]string{
+						"Authorization": "Bearer ${GITHUB_TOKEN}",
+						"Accept":        "application/json",
+					},
+					Env: map[string]any{
+						"TOKEN":   "${GITHUB_TOKEN}",
+						"LITERAL": "$${NOT_A_VARIABLE}",
+					},
+				},
+			},
+			{
+				Type: entity.AgentSkillTypeNative,
+				OfNative: &entity.NativeAgentSkill{
+					Name: "get_weather",
+					Env: map[string]any{
+						"OPENWEATHER_API_KEY": "${OPENWEATHER_API_KEY}",
+						"feeds":               []any{"https://${FEED_HOST:-example.com}/rss", 42},
+					},
+				},
+			},
+		},
+	}
+
+	require.NoError(t, agent.Interpolate(testSecretResolver{
+		"GITHUB_TOKEN":        "ghp_secret",
+		"OPENWEATHER_API_KEY": "weather_secret",
+	}))
+
+	mcpSkill := agent.Skills[0].OfMCP
+	require.Equal(t, "https://api.github.com/mcp", mcpSkill.URL)
+	require.Equal(t, "Bearer ghp_secret", mcpSkill.Headers["Authorization"])
+	require.Equal(t, "ghp_secret", mcpSkill.Env["TOKEN"])
+	require.Equal(t, "${NOT_A_VARIABLE}", mcpSkill.Env["LITERAL"])
+
+	nativeSkill := agent.Skills[1].OfNative
+	require.Equal(t, "weather_secret", nativeSkill.Env["OPENWEATHER_API_KEY"])
+	require.Equal(t, []any{"https://example.com/rss", 42}, nativeSkill.Env["feeds"])
+
+	// Serialized agents show the fields as written in the agent file
+	data, err := json.Marshal(agent)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "ghp_secret")
+	require.NotContains(t, string(data), "weather_secret")
+	require.Contains(t, string(data), `"Bearer ${GITHUB_TOKEN}"`)
+	require.Contains(t, string(data), `"application/json"`)
+
+	var logs bytes.Buffer
+	slog.New(slog.NewTextHandler(&logs, nil)).Info("loaded agent", "agent", agent)
+	require.NotContains(t, logs.String(), "ghp_secret")
+	require.Contains(t, logs.String(), "GITHUB_TOKEN")
+
+	// Serialized agents can be loaded and interpolated again
+	var reloaded entity.Agent
+	require.NoError(t, json.Unmarshal(data, &reloaded))
+	require.NoError(t, reloaded.Interpolate(testSecretResolver{
+		"GITHUB_TOKEN":        "ghp_secret",
+		"OPENWEATHER_API_KEY": "weather_secret",
+	}))
+	require.Equal(t, "Bearer ghp_secret", reloaded.Skills[0].OfMCP.Headers["Authorization"])
+}
+
+func TestAgentInterpolateUndefinedVariable(t *testing.T) {
+	agent := entity.Agent{
+		Skills: []entity.AgentSkillUnion{
+			{
+				Type:  entity.AgentSkillTypeMCP,
+				OfMCP: &entity.MCPAgentSkill{Name: "github", Headers: map[string]string{"Authorization": "Bearer ${GITHUB_TOKEN}"}},
+			},
+		},
+	}
+	require.ErrorContains(t, agent.Interpolate(testSecretResolver{}), "variable GITHUB_TOKEN is not defined")
+
+	agent.Skills[0].OfMCP.Headers["Authorization"] = "Bearer ${GITHUB_TOKEN"
+	require.ErrorContains(t, agent.Interpolate(testSecretResolver{}), "unterminated variable")
+}
@@ -12,6 +12,11 @@ const (
 	AgentSkillTypeMCP    = "mcp"
 )
 
+const (
+	LLMSkillModeInstruction = "instruction"
+	LLMSkillModeGenerate    = "generate"
+)
+
 // AgentSkillUnion represents a unit of capability that an agent can perform.
 type AgentSkillUnion struct {
 	Type string `json:"type" jsonschema:"required,enum=llm,enum=mcp,enum=nativeTool"`
@@ -22,18 +27,41 @@ type AgentSkillUnion struct {
 }
 
 type MCPAgentSkill struct {
-	ID      string         `json:"id" jsonschema:"required,description=Field for unique identify to skill"`
-	Name    string         `json:"name" jsonschema_description:"name for MCP server"`
-	Tools   []string       `json:"tools,omitempty" jsonschema_description:"MCP tools name"`
-	Command string         `json:"command" jsonschema_description:"Command to run MCP server"`
-	Args    []string       `json:"args,omitempty" jsonschema_description:"Arguments to run MCP server"`
-	Env     map[string]any `json:"env,omitempty" jsonschema_description:"It can be environment variables for MCP or can be configuration for nativeTool"`
+	ID          string            `json:"id" jsonschema:"required,description=Field for unique identify to skill"`
+	Name        string            `json:"name" jsonschema_description:"name for MCP server"`
+	Tools       []string          `json:"tools,omitempty" jsonschema_description:"MCP tools name"`
+	ToolAliases map[string]string `json:"toolAliases,omitempty" jsonschema_description:"Custom tool names keyed by MCP tool name. Tools are exposed as <name>__<tool> by default"`
+	Command     string            `json:"command" jsonschema_description:"Command to run MCP server"`
+	Args        []string          `json:"args,omitempty" jsonschema_description:"Arguments to run MCP server"`
+	Env         map[string]any    `json:"env,omitempty" jsonschema_description:"It can be environment variables for MCP or can be configuration for nativeTool"`
 
 	// Remote MCP Support
 	URL       string                 `json:"url,omitempty" jsonschema_description:"URL for remote MCP server (SSE, OAuth-SSE, or Streamable)"`
 	Transport string                 `json:"transport,omitempty" jsonschema_description:"Transport type: stdio, sse, oauth-sse, http. Auto-detected if not specified"`
 	Headers   map[string]string      `json:"headers,omitempty" jsonschema_description:"HTTP headers for authentication (e.g., API keys)"`
 	OAuth     *AgentSkillOAuthConfig `json:"oauth,omitempty" jsonschema_description:"OAuth configuration for oauth-sse transport"`
+
+	// Tool result size control
+	MaxResultSize      int    `json:"maxResultSize,omitempty" jsonschema_description:"Maximum size in bytes of a tool result returned to the model. Overrides the global limit"`
+	ResultSummaryModel string `json:"resultSummaryModel,omitempty" jsonschema_description:"Model used to summarize over-limit tool results instead of truncating them"`
+
+	// Resilience
+	Timeout                 string `json:"timeout,omitempty" jsonschema_description:"Timeout for each call to the MCP server (e.g. 30s, 2m). Defaults to 60s"`
+	MaxRetries              int    `json:"maxRetries,omitempty" jsonschema_description:"Number of retries for failed calls of idempotent or read-only tools"`
+	RetryBackoff            string `json:"retryBackoff,omitempty" jsonschema_description:"Wait before the first retry, doubled for each further retry (e.g. 1s). Defaults to 500ms"`
+	CircuitBreakerThreshold int    `json:"circuitBreakerThreshold,omitempty" jsonschema_description:"Number of consecutive failed calls after which the MCP server is considered unhealthy. Defaults to 5"`
+	CircuitBreakerCooldown  string `json:"circuitBreakerCooldown,omitempty" jsonschema_description:"How long an unhealthy MCP server is skipped before it is tried again (e.g. 1m). Defaults to 30s"`
+
+	// Resources
+	IndexResources bool `json:"indexResources,omitempty" jsonschema_description:"Index the text and PDF resources of the MCP server into the knowledge base. Resources are re-indexed when the server reports changes"`
+
+	// Sampling
+	Sampling *AgentSkillSamplingConfig `json:"sampling,omitempty" jsonschema_description:"Lets the MCP server request completions from the agent's models (stdio servers only)"`
+
+	// Argument policies
+	Policies []AgentSkillToolPolicy `json:"policies,omitempty" jsonschema_description:"Restrictions on the arguments the model may pass to the tools of the skill"`
+
+	templates secretTemplates
 }
 
 type LLMAgentSkill struct {
@@ -41,6 +69,12 @@ type LLMAgentSkill struct {
 	Name        string `json:"name" jsonschema_description:"name for LLM tool or native tool. It can be also mcp server name"`
 	Description string `json:"description" jsonschema_description:"It uses only when type is nativeTool or llm. Use default description owned tool if empty and type is nativeTool"`
 	Instruction string `json:"instruction" jsonschema_description:"It uses only when type is llm."`
+
+	// Sub-generation
+	Mode         string         `json:"mode,omitempty" jsonschema:"enum=instruction,enum=generate,description=instruction returns the instruction to the calling model. generate runs the instruction over the tool input with its own model and returns the result. Defaults to instruction"`
+	Model        string         `json:"model,omitempty" jsonschema_description:"Model of the generation in generate mode, e.g. openai/gpt-5-mini"`
+	ModelConfig  map[string]any `json:"modelConfig,omitempty" jsonschema_description:"Model configuration of the generation in generate mode"`
+	OutputSchema map[string]any `json:"outputSchema,omitempty" jsonschema_description:"JSON schema of the result in generate mode. The result is plain text if empty"`
 }
 
 type NativeAgentSkill struct {
@@ -48,6 +82,33 @@ type NativeAgentSkill struct {
 	Name    string         `json:"name"`
 	Details string         `json:"details"`
 	Env     map[string]any `json:"env,omitempty" jsonschema_description:"It can be environment variables for MCP or can be configuration for nativeTool"`
+
+	// Tool result size control
+	MaxResultSize      int    `json:"maxResultSize,omitempty" jsonschema_description:"Maximum size in bytes of a tool result returned to the model. Overrides the global limit"`
+	ResultSummaryModel string `json:"resultSummaryModel,omitempty" jsonschema_description:"Model used to summarize over-limit tool results instead of truncating them"`
+
+	// Argument policies
+	Policies []AgentSkillToolPolicy `json:"policies,omitempty" jsonschema_description:"Restrictions on the arguments the model may pass to the tools of the skill"`
+
+	templates secretTemplates
+}
+
+// AgentSkillToolPolicy restricts the values of one argument of the tools of a skill.
+// Calls violating a policy are rejected before the tool runs and the violation is returned to the model.
+type AgentSkillToolPolicy struct {
+	Tool         string   `json:"tool,omitempty" jsonschema_description:"Name of the tool the policy applies to. For MCP skills this is the original MCP tool name. Applies to all tools of the skill if empty"`
+	Argument     string   `json:"argument" jsonschema:"required,description=Name of the argument. Nested arguments are addressed with dots, e.g. options.path"`
+	Allow        []string `json:"allow,omitempty" jsonschema_description:"Regular expressions of which the value must match at least one"`
+	Deny         []string `json:"deny,omitempty" jsonschema_description:"Regular expressions of which the value must match none"`
+	PathPrefixes []string `json:"pathPrefixes,omitempty" jsonschema_description:"Directories the value must be a path within, after resolving . and .. elements"`
+	Max          *float64 `json:"max,omitempty" jsonschema_description:"Maximum numeric value"`
+}
+
+// AgentSkillSamplingConfig represents the sampling configuration of an MCP skill
+type AgentSkillSamplingConfig struct {
+	Models         []string `json:"models" jsonschema:"required,description=Models the server may use, from most to least capable. The first one is the default"`
+	MaxTokens      int      `json:"maxTokens,omitempty" jsonschema_description:"Maximum number of output tokens per request"`
+	MaxTotalTokens int      `json:"maxTotalTokens,omitempty" jsonschema_description:"Maximum number of tokens the server may use in total"`
 }
 
 // AgentSkillOAuthConfig represents OAuth configuration for AgentSkill
@@ -0,0 +1,237 @@
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Schedule computes the activation times of a cron expression
+type Schedule interface {
+	// Next returns the first activation time strictly after t
+	Next(t time.Time) time.Time
+}
+
+type (
+	// SpecSchedule is a standard five field cron expression: minute, hour, day of month, month and day of week
+	SpecSchedule struct {
+		minute, hour, dom, month, dow uint64
+		// domStar and dowStar report whether the day fields are unrestricted. When both are restricted a day matches
+		// if either of them does, as in the standard cron
+		domStar, dowStar bool
+		location         *time.Location
+	}
+
+	// EverySchedule activates at a fixed interval, aligned to the start of the interval
+	EverySchedule struct {
+		Interval time.Duration
+	}
+)
+
+var (
+	_ Schedule = (*SpecSchedule)(nil)
+	_ Schedule = EverySchedule{}
+)
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteBounds = bounds{min: 0, max: 59}
+	hourBounds   = bounds{min: 0, max: 23}
+	domBounds    = bounds{min: 1, max: 31}
+	monthBounds  = bounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = bounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// Parse parses a five field cron expression, one of the descriptors @yearly, @monthly, @weekly, @daily and @hourly,
+// or "@every <duration>". The times of the expression are interpreted in location, which defaults to UTC
+func Parse(spec string, location *time.Location) (Schedule, error) {
+	if location == nil {
+		location = time.UTC
+	}
+
+	spec = strings.TrimSpace(spec)
+	if interval, ok := strings.CutPrefix(spec, "@every "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid interval of %q", spec)
+		}
+		if d < time.Minute {
+			return nil, errors.Errorf("interval of %q must be at least one minute", spec)
+		}
+		return EverySchedule{Interval: d}, nil
+	}
+	if expanded, ok := descriptors[strings.ToLower(spec)]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("invalid cron expression %q: expected 5 fields, got %d", spec, len(fields))
+	}
+
+	s := &SpecSchedule{location: location}
+	var err error
+	if s.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, errors.Wrapf(err, "invalid minute of %q", spec)
+	}
+	if s.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, errors.Wrapf(err, "invalid hour of %q", spec)
+	}
+	if s.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, errors.Wrapf(err, "invalid day of month of %q", spec)
+	}
+	if s.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, errors.Wrapf(err, "invalid month of %q", spec)
+	}
+	if s.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, errors.Wrapf(err, "invalid day of week of %q", spec)
+	}
+	// 7 is another name of Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*") || fields[2] == "?"
+	s.dowStar = strings.HasPrefix(fields[4], "*") || fields[4] == "?"
+
+	return s, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a bit set
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step %q", stepPart)
+			}
+		}
+
+		var start, end int
+		switch {
+		case rangePart == "*" || rangePart == "?":
+			start, end = b.min, b.max
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseValue(from, b); err != nil {
+				return 0, err
+			}
+			if end, err = parseValue(to, b); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, errors.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			var err error
+			if start, err = parseValue(rangePart, b); err != nil {
+				return 0, err
+			}
+			end = start
+			// "5/15" means from 5 to the maximum every 15
+			if hasStep {
+				end = b.max
+			}
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (int, error) {
+	if v, ok := b.names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.Errorf("invalid value %q", value)
+	}
+	if v < b.min || v > b.max {
+		return 0, errors.Errorf("value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// Next returns the first minute after t matching the expression. It returns the zero time if none exists
+// within five years, e.g. for February 30th
+func (s *SpecSchedule) Next(t time.Time) time.Time {
+	origLocation := t.Location()
+	t = t.In(s.location).Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+	for t.Year() <= yearLimit {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t.In(origLocation)
+	}
+	return time.Time{}
+}
+
+func (s *SpecSchedule) dayMatches(t time.Time) bool {
+	domMatch := s.dom&(1<<uint(t.Day())) != 0
+	dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the next multiple of the interval since the Unix epoch after t
+func (s EverySchedule) Next(t time.Time) time.Time {
+	return t.Truncate(s.Interval).Add(s.Interval)
+}
+
+// Between returns the activation times in (from, to], at most limit of them. The second result reports whether
+// activation times were left out because of the limit
+func Between(s Schedule, from, to time.Time, limit int) ([]time.Time, bool) {
+	var times []time.Time
+	for t := s.Next(from); !t.IsZero() && !t.After(to); t = s.Next(t) {
+		if len(times) == limit {
+			return times, true
+		}
+		times = append(times, t)
+	}
+	return times, false
+}
@@ -0,0 +1,102 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/internal/cron"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	from := time.Date(2024, time.January, 31, 10, 30, 15, 0, time.UTC) // Wednesday
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.January, 31, 10, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, time.January, 31, 10, 45, 0, 0, time.UTC)},
+		{"0 8 * * *", time.Date(2024, time.February, 1, 8, 0, 0, 0, time.UTC)},
+		{"0 9-17/4 * * mon-fri", time.Date(2024, time.January, 31, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * sun", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2024, time.February, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"30 6 1,15 * *", time.Date(2024, time.February, 1, 6, 30, 0, 0, time.UTC)},
+		// Both day fields restricted: either of them matches
+		{"0 0 15 * fri", time.Date(2024, time.February, 2, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, time.January, 31, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@every 20m", time.Date(2024, time.January, 31, 10, 40, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			schedule, err := cron.Parse(tt.spec, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, schedule.Next(from))
+		})
+	}
+}
+
+func TestNextInLocation(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	require.NoError(t, err)
+
+	schedule, err := cron.Parse("0 8 * * *", seoul)
+	require.NoError(t, err)
+
+	next := schedule.Next(time.Date(2024, time.January, 31, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2024, time.January, 31, 23, 0, 0, 0, time.UTC), next.UTC())
+	assert.Equal(t, time.UTC, next.Location())
+}
+
+func TestNextImpossible(t *testing.T) {
+	schedule, err := cron.Parse("0 0 30 feb *", nil)
+	require.NoError(t, err)
+	assert.True(t, schedule.Next(time.Now()).IsZero())
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * funday",
+		"@every 10s",
+		"@every soon",
+	} {
+		_, err := cron.Parse(spec, nil)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestBetween(t *testing.T) {
+	schedule, err := cron.Parse("0 * * * *", nil)
+	require.NoError(t, err)
+
+	from := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	times, truncated := cron.Between(schedule, from, from.Add(3*time.Hour), 10)
+	assert.False(t, truncated)
+	assert.Equal(t, []time.Time{
+		from.Add(time.Hour),
+		from.Add(2 * time.Hour),
+		from.Add(3 * time.Hour),
+	}, times)
+
+	times, truncated = cron.Between(schedule, from, from.Add(3*time.Hour), 2)
+	assert.True(t, truncated)
+	assert.Len(t, times, 2)
+
+	times, truncated = cron.Between(schedule, from, from.Add(30*time.Minute), 10)
+	assert.False(t, truncated)
+	assert.Empty(t, times)
+}
@@ -1,29 +1,41 @@
 package mcp
 
 import (
+	"context"
+
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
-	"github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-// DefineTool defines a tool function.
-func DefineTool(g *genkit.Genkit, client client.MCPClient, mcpTool mcp.Tool, cb func(ctx *ai.ToolContext, input any, output *mcp.CallToolResult) error) (ai.Tool, error) {
+// ToolCaller calls tools on an MCP server. It is satisfied by client.MCPClient.
+type ToolCaller interface {
+	CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+}
+
+// DefineTool defines a tool function registered under name that calls mcpTool on the server.
+func DefineTool(g *genkit.Genkit, client ToolCaller, name string, mcpTool mcp.Tool, cb func(ctx *ai.ToolContext, input any, output *mcp.CallToolResult) error) (ai.Tool, error) {
+	tool, err := NewTool(client, name, mcpTool, cb)
+	if err != nil {
+		return nil, err
+	}
+
+	genkit.RegisterAction(g, tool)
+	return tool, nil
+}
+
+// NewTool creates a tool named name that calls mcpTool on the server without registering it.
+func NewTool(client ToolCaller, name string, mcpTool mcp.Tool, cb func(ctx *ai.ToolContext, input any, output *mcp.CallToolResult) error) (ai.Tool, error) {
 	schema, err := makeInputSchema(mcpTool.InputSchema)
 	if err != nil {
 		return nil, err
 	}
 
-	tool := genkit.DefineToolWithInputSchema(
-		g,
-		mcpTool.Name,
+	tool := ai.NewToolWithInputSchema(
+		name,
 		mcpTool.Description,
 		schema,
 		func(ctx *ai.ToolContext, in any) (out *mcp.CallToolResult, err error) {
-			if err = client.Ping(ctx); err != nil {
-				return
-			}
-
 			req := mcp.CallToolRequest{
 				Request: mcp.Request{
 					Method: "tools/call",
@@ -42,7 +42,7 @@ func TestMCPToolCall(t *testing.T) {
 			break
 		}
 	}
-	tool, err := internalmcp.DefineTool(g, c, listDirTool, nil)
+	tool, err := internalmcp.DefineTool(g, c, listDirTool.Name, listDirTool, nil)
 	if err != nil {
 		t.Fatalf("failed to define tool: %v", err)
 	}
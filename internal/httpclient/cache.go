@@ -0,0 +1,179 @@
+package httpclient
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// CacheTransport answers GET requests from the responses of earlier identical requests for a TTL
+	CacheTransport struct {
+		base       http.RoundTripper
+		ttl        time.Duration
+		maxEntries int
+		now        func() time.Time
+
+		mtx     sync.Mutex
+		entries map[string]*list.Element
+		lru     *list.List
+	}
+
+	cacheEntry struct {
+		key       string
+		expiresAt time.Time
+		status    int
+		header    http.Header
+		body      []byte
+	}
+)
+
+const (
+	// CacheHeader is set to "hit" on responses served from the cache
+	CacheHeader = "X-Agentruntime-Cache"
+
+	// MaxCacheBodySize is the size of the largest body cached. Larger responses are passed through uncached
+	MaxCacheBodySize = 4 << 20
+)
+
+var _ http.RoundTripper = (*CacheTransport)(nil)
+
+func NewCacheTransport(base http.RoundTripper, ttl time.Duration, maxEntries int) *CacheTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &CacheTransport{
+		base:       base,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !isCacheable(req.Method, req.Header) {
+		return t.base.RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	if entry, ok := t.get(key); ok {
+		return entry.response(req), nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK || !isCacheable(http.MethodGet, resp.Header) ||
+		resp.Header.Get("Set-Cookie") != "" || resp.ContentLength > MaxCacheBodySize {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxCacheBodySize+1))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if len(body) > MaxCacheBodySize {
+		// The caller reads the part already read, then the rest of the body
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
+	}
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.put(&cacheEntry{
+		key:       key,
+		expiresAt: t.now().Add(t.ttl),
+		status:    resp.StatusCode,
+		header:    resp.Header.Clone(),
+		body:      body,
+	})
+	return resp, nil
+}
+
+func (t *CacheTransport) get(key string) (*cacheEntry, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	elem, ok := t.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !t.now().Before(entry.expiresAt) {
+		t.lru.Remove(elem)
+		delete(t.entries, key)
+		return nil, false
+	}
+	t.lru.MoveToFront(elem)
+	return entry, true
+}
+
+func (t *CacheTransport) put(entry *cacheEntry) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	if elem, ok := t.entries[entry.key]; ok {
+		t.lru.Remove(elem)
+	}
+	t.entries[entry.key] = t.lru.PushFront(entry)
+
+	for t.maxEntries > 0 && t.lru.Len() > t.maxEntries {
+		oldest := t.lru.Back()
+		t.lru.Remove(oldest)
+		delete(t.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	header := e.header.Clone()
+	header.Set(CacheHeader, "hit")
+	return &http.Response{
+		Status:        http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// isCacheable reports whether a GET exchange with the header may be cached. Conditional requests are
+// left to the server, so that callers doing their own revalidation see the real responses.
+func isCacheable(method string, header http.Header) bool {
+	if method != http.MethodGet {
+		return false
+	}
+	if header.Get("If-None-Match") != "" || header.Get("If-Modified-Since") != "" {
+		return false
+	}
+	cacheControl := strings.ToLower(header.Get("Cache-Control"))
+	return !strings.Contains(cacheControl, "no-store") && !strings.Contains(cacheControl, "no-cache")
+}
+
+// cacheKey identifies a request by its URL and all of its headers. Credentials may be sent in any header, like
+// Authorization, Cookie or X-Api-Key, so every header is hashed into the key and responses are never shared between
+// them.
+func cacheKey(req *http.Request) string {
+	h := sha256.New()
+	for _, name := range slices.Sorted(maps.Keys(req.Header)) {
+		for _, value := range req.Header[name] {
+			h.Write([]byte(name + ":" + value + "\n"))
+		}
+	}
+	return req.URL.String() + "#" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,235 @@
+package httpclient
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+type (
+	// CassetteTransport records HTTP interactions to a file and replays them, so that tests of tools
+	// calling external APIs are deterministic and run offline.
+	// Requests are matched by method, URL and a digest of the body. Credentials in the query are
+	// redacted before matching, and request headers are never recorded.
+	CassetteTransport struct {
+		base http.RoundTripper
+		path string
+		mode string
+
+		mtx          sync.Mutex
+		interactions []CassetteInteraction
+	}
+
+	CassetteInteraction struct {
+		Request  CassetteRequest  `json:"request"`
+		Response CassetteResponse `json:"response"`
+	}
+
+	CassetteRequest struct {
+		Method     string `json:"method"`
+		URL        string `json:"url"`
+		BodyDigest string `json:"bodyDigest,omitempty"`
+	}
+
+	CassetteResponse struct {
+		StatusCode int         `json:"statusCode"`
+		Header     http.Header `json:"header,omitempty"`
+		Body       string      `json:"body,omitempty"`
+		BodyBase64 string      `json:"bodyBase64,omitempty"`
+	}
+)
+
+var (
+	_ http.RoundTripper = (*CassetteTransport)(nil)
+
+	// SensitiveQueryParams are the query parameters redacted from recorded URLs
+	SensitiveQueryParams = []string{"appid", "api_key", "apikey", "key", "token", "access_token", "client_secret"}
+)
+
+// NewCassetteTransport loads the cassette at path. The file does not need to exist in record modes
+func NewCassetteTransport(base http.RoundTripper, path, mode string) (*CassetteTransport, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if mode == "" {
+		mode = config.CassetteModeReplayOrRecord
+	}
+	switch mode {
+	case config.CassetteModeRecord, config.CassetteModeReplay, config.CassetteModeReplayOrRecord:
+	default:
+		return nil, errors.Errorf("unknown cassette mode %s", mode)
+	}
+
+	t := &CassetteTransport{base: base, path: path, mode: mode}
+	if mode == config.CassetteModeRecord {
+		return t, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && mode == config.CassetteModeReplayOrRecord {
+		return t, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read cassette %s", path)
+	}
+	if err := json.Unmarshal(data, &t.interactions); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse cassette %s", path)
+	}
+	return t, nil
+}
+
+func (t *CassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cassetteReq, err := newCassetteRequest(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if t.mode != config.CassetteModeRecord {
+		if interaction, ok := t.find(cassetteReq); ok {
+			return interaction.Response.response(req)
+		}
+		if t.mode == config.CassetteModeReplay {
+			return nil, errors.Errorf("no recorded interaction for %s %s in cassette %s", cassetteReq.Method, cassetteReq.URL, t.path)
+		}
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	cassetteResp := CassetteResponse{StatusCode: resp.StatusCode, Header: resp.Header.Clone()}
+	cassetteResp.Header.Del("Set-Cookie")
+	if utf8.Valid(body) {
+		cassetteResp.Body = string(body)
+	} else {
+		cassetteResp.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+
+	if err := t.record(CassetteInteraction{Request: cassetteReq, Response: cassetteResp}); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *CassetteTransport) find(req CassetteRequest) (CassetteInteraction, bool) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for _, interaction := range t.interactions {
+		if interaction.Request == req {
+			return interaction, true
+		}
+	}
+	return CassetteInteraction{}, false
+}
+
+func (t *CassetteTransport) record(interaction CassetteInteraction) error {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	replaced := false
+	for i := range t.interactions {
+		if t.interactions[i].Request == interaction.Request {
+			t.interactions[i] = interaction
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		t.interactions = append(t.interactions, interaction)
+	}
+
+	data, err := json.MarshalIndent(t.interactions, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory of cassette %s", t.path)
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write cassette %s", t.path)
+	}
+	return errors.Wrapf(os.Rename(tmp, t.path), "failed to write cassette %s", t.path)
+}
+
+func newCassetteRequest(req *http.Request) (CassetteRequest, error) {
+	cassetteReq := CassetteRequest{
+		Method: req.Method,
+		URL:    redactURL(req.URL),
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return cassetteReq, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return cassetteReq, errors.Wrapf(err, "failed to read request body")
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	digest := sha256.Sum256(body)
+	cassetteReq.BodyDigest = hex.EncodeToString(digest[:])
+	return cassetteReq, nil
+}
+
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for name := range query {
+		for _, sensitive := range SensitiveQueryParams {
+			if strings.EqualFold(name, sensitive) {
+				query.Set(name, "REDACTED")
+			}
+		}
+	}
+	redacted.RawQuery = query.Encode()
+	redacted.User = nil
+	return redacted.String()
+}
+
+func (r CassetteResponse) response(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.BodyBase64); err != nil {
+			return nil, errors.Wrapf(err, "invalid recorded body of %s", req.URL)
+		}
+	}
+
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:        http.StatusText(r.StatusCode),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
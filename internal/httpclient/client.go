@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+// New creates an HTTP client from the configuration. The transport is wrapped by the response cache
+// and by the cassette when they are configured; cached responses are never recorded.
+func New(conf *config.HTTPConfig) (*http.Client, error) {
+	if conf == nil {
+		conf = config.NewHTTPConfig()
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.ProxyURL != "" {
+		proxyURL, err := url.Parse(conf.ProxyURL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid proxy url %s", conf.ProxyURL)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read ca file %s", conf.CAFile)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificates found in ca file %s", conf.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	var rt http.RoundTripper = transport
+	if conf.CassetteFile != "" {
+		cassette, err := NewCassetteTransport(rt, conf.CassetteFile, conf.CassetteMode)
+		if err != nil {
+			return nil, err
+		}
+		rt = cassette
+	}
+	if conf.CacheTTL > 0 {
+		rt = NewCacheTransport(rt, conf.CacheTTL, conf.CacheMaxEntries)
+	}
+
+	return &http.Client{
+		Transport: rt,
+		Timeout:   conf.Timeout,
+	}, nil
+}
@@ -0,0 +1,149 @@
+package httpclient_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/internal/httpclient"
+	"github.com/stretchr/testify/require"
+)
+
+func newCountingServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch r.URL.Path {
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/large":
+			// Streamed without a Content-Length
+			w.(http.Flusher).Flush()
+			_, _ = io.WriteString(w, strings.Repeat("x", httpclient.MaxCacheBodySize))
+		}
+		_, _ = io.WriteString(w, r.URL.Path+" "+r.Header.Get("Authorization")+" "+strconv.Itoa(int(n)))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func get(t *testing.T, client *http.Client, url string, authorization string) (string, *http.Response) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	return string(body), resp
+}
+
+func TestCacheTransport(t *testing.T) {
+	server, calls := newCountingServer(t)
+	client, err := httpclient.New(&config.HTTPConfig{CacheTTL: 100 * time.Millisecond, CacheMaxEntries: 2})
+	require.NoError(t, err)
+
+	first, _ := get(t, client, server.URL+"/feed", "")
+	second, resp := get(t, client, server.URL+"/feed", "")
+	require.Equal(t, first, second)
+	require.Equal(t, "hit", resp.Header.Get(httpclient.CacheHeader))
+	require.EqualValues(t, 1, calls.Load())
+
+	// Responses are not shared between credentials
+	withAuth, _ := get(t, client, server.URL+"/feed", "Bearer token")
+	require.NotEqual(t, first, withAuth)
+	require.EqualValues(t, 2, calls.Load())
+
+	// Neither are they between credentials sent in other headers
+	for _, header := range []string{"Cookie", "X-Api-Key"} {
+		for _, value := range []string{"a", "b"} {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/feed", nil)
+			require.NoError(t, err)
+			req.Header.Set(header, value)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			require.Empty(t, resp.Header.Get(httpclient.CacheHeader))
+		}
+	}
+	require.EqualValues(t, 6, calls.Load())
+
+	get(t, client, server.URL+"/no-store", "")
+	get(t, client, server.URL+"/no-store", "")
+	require.EqualValues(t, 8, calls.Load())
+
+	// Bodies above the size limit are passed through whole and not cached
+	large, _ := get(t, client, server.URL+"/large", "")
+	require.Len(t, large, httpclient.MaxCacheBodySize+len("/large  9"))
+	_, resp = get(t, client, server.URL+"/large", "")
+	require.Empty(t, resp.Header.Get(httpclient.CacheHeader))
+	require.EqualValues(t, 10, calls.Load())
+
+	time.Sleep(150 * time.Millisecond)
+	expired, resp := get(t, client, server.URL+"/feed", "")
+	require.NotEqual(t, first, expired)
+	require.Empty(t, resp.Header.Get(httpclient.CacheHeader))
+}
+
+func TestCassetteTransport(t *testing.T) {
+	server, calls := newCountingServer(t)
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+
+	recorder, err := httpclient.New(&config.HTTPConfig{CassetteFile: cassette, CassetteMode: config.CassetteModeRecord})
+	require.NoError(t, err)
+	recorded, _ := get(t, recorder, server.URL+"/feed?appid=secret-key&q=news", "")
+	require.EqualValues(t, 1, calls.Load())
+
+	data, err := os.ReadFile(cassette)
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "secret-key")
+
+	// Replays match the request whatever the credentials are and never reach the server
+	replayer, err := httpclient.New(&config.HTTPConfig{CassetteFile: cassette, CassetteMode: config.CassetteModeReplay})
+	require.NoError(t, err)
+	replayed, _ := get(t, replayer, server.URL+"/feed?appid=other-key&q=news", "")
+	require.Equal(t, recorded, replayed)
+	require.EqualValues(t, 1, calls.Load())
+
+	_, err = replayer.Get(server.URL + "/other")
+	require.ErrorContains(t, err, "no recorded interaction")
+
+	replayOrRecord, err := httpclient.New(&config.HTTPConfig{CassetteFile: cassette, CassetteMode: config.CassetteModeReplayOrRecord})
+	require.NoError(t, err)
+	get(t, replayOrRecord, server.URL+"/feed?appid=secret-key&q=news", "")
+	get(t, replayOrRecord, server.URL+"/other", "")
+	require.EqualValues(t, 2, calls.Load())
+
+	_, err = httpclient.New(&config.HTTPConfig{CassetteFile: filepath.Join(t.TempDir(), "missing.json"), CassetteMode: config.CassetteModeReplay})
+	require.Error(t, err)
+}
+
+func TestProxy(t *testing.T) {
+	var proxied atomic.Bool
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Store(true)
+		require.Equal(t, "http://upstream.example.com/feed", r.URL.String())
+		_, _ = io.WriteString(w, "via proxy")
+	}))
+	defer proxy.Close()
+
+	client, err := httpclient.New(&config.HTTPConfig{ProxyURL: proxy.URL})
+	require.NoError(t, err)
+	body, _ := get(t, client, "http://upstream.example.com/feed", "")
+	require.Equal(t, "via proxy", body)
+	require.True(t, proxied.Load())
+
+	_, err = httpclient.New(&config.HTTPConfig{ProxyURL: "://invalid"})
+	require.Error(t, err)
+}
@@ -0,0 +1,397 @@
+package knowledge
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	// MetadataKeyHeadingPath is the metadata key of the headings of the sections a chunk is in, from the top level
+	MetadataKeyHeadingPath = "heading_path"
+	// MetadataKeyTokenCount is the metadata key of the estimated number of tokens of a chunk
+	MetadataKeyTokenCount = "token_count"
+)
+
+type (
+	// Chunk is a part of a document small enough to be embedded and retrieved on its own
+	Chunk struct {
+		Text string
+		// HeadingPath are the headings of the sections the chunk is in, from the top level, if the document has any
+		HeadingPath []string
+		// Symbol is the name of the function, type or method of source code the chunk is in, if any
+		Symbol string
+		// StartLine and EndLine are the range of lines of source code of the chunk, from 1, or 0 for other text
+		StartLine, EndLine int
+	}
+
+	// Chunker splits the text of documents into chunks
+	Chunker interface {
+		Chunk(text string) []Chunk
+	}
+
+	// recursiveChunker splits text on paragraphs, then lines, sentences and words until the pieces fit
+	recursiveChunker struct {
+		size, overlap int
+	}
+
+	// sentenceChunker groups whole sentences into chunks
+	sentenceChunker struct {
+		size, overlap int
+	}
+
+	// markdownChunker splits markdown into its sections, and the sections too large into recursive chunks
+	markdownChunker struct {
+		size, overlap int
+	}
+
+	// tokenChunker splits text into windows of a fixed number of tokens
+	tokenChunker struct {
+		size, overlap int
+	}
+)
+
+var (
+	_ Chunker = (*recursiveChunker)(nil)
+	_ Chunker = (*sentenceChunker)(nil)
+	_ Chunker = (*markdownChunker)(nil)
+	_ Chunker = (*tokenChunker)(nil)
+)
+
+// recursiveSeparators are the boundaries the recursive chunker splits on, from the most to the least meaningful
+var recursiveSeparators = []string{"\n\n", "\n", ". ", " "}
+
+// NewRecursiveChunker creates a chunker which splits text on paragraphs, then on lines, sentences and words where
+// a paragraph has more than size tokens, and merges the pieces into chunks of up to size tokens, each starting
+// with up to overlap tokens of the end of the previous one
+func NewRecursiveChunker(size, overlap int) Chunker {
+	size, overlap = clampChunking(size, overlap)
+	return &recursiveChunker{size: size, overlap: overlap}
+}
+
+// NewSentenceChunker creates a chunker which groups whole sentences into chunks of up to size tokens, each starting
+// with the last sentences of the previous one, up to overlap tokens. Sentences longer than size are split on words
+func NewSentenceChunker(size, overlap int) Chunker {
+	size, overlap = clampChunking(size, overlap)
+	return &sentenceChunker{size: size, overlap: overlap}
+}
+
+// NewMarkdownChunker creates a chunker which splits markdown into a chunk per section, with the path of the
+// headings of the section. Sections of more than size tokens are split like the recursive chunker
+func NewMarkdownChunker(size, overlap int) Chunker {
+	size, overlap = clampChunking(size, overlap)
+	return &markdownChunker{size: size, overlap: overlap}
+}
+
+// NewTokenChunker creates a chunker which splits text into chunks of size tokens, each starting with the last
+// overlap tokens of the previous one
+func NewTokenChunker(size, overlap int) Chunker {
+	size, overlap = clampChunking(size, overlap)
+	return &tokenChunker{size: size, overlap: overlap}
+}
+
+// clampChunking keeps the size of the chunkers at least 1 token and the overlap less than the size, so that every
+// chunk makes progress. NewChunker rejects such configs instead
+func clampChunking(size, overlap int) (int, int) {
+	size = max(size, 1)
+	return size, min(max(overlap, 0), size-1)
+}
+
+// NewChunker creates the chunker of the chunking config
+func NewChunker(conf config.ChunkingConfig) (Chunker, error) {
+	if conf.Size <= 0 {
+		return nil, errors.Errorf("chunk size must be positive, got %d", conf.Size)
+	}
+	if conf.Overlap < 0 || conf.Overlap >= conf.Size {
+		return nil, errors.Errorf("chunk overlap must be at least 0 and less than the chunk size %d, got %d", conf.Size, conf.Overlap)
+	}
+
+	switch conf.Strategy {
+	case "", config.ChunkingStrategyRecursive:
+		return NewRecursiveChunker(conf.Size, conf.Overlap), nil
+	case config.ChunkingStrategySentence:
+		return NewSentenceChunker(conf.Size, conf.Overlap), nil
+	case config.ChunkingStrategyMarkdown:
+		return NewMarkdownChunker(conf.Size, conf.Overlap), nil
+	case config.ChunkingStrategyToken:
+		return NewTokenChunker(conf.Size, conf.Overlap), nil
+	case config.ChunkingStrategyCode:
+		return NewCodeChunker("", conf.Size), nil
+	default:
+		return nil, errors.Errorf("unknown chunking strategy %s", conf.Strategy)
+	}
+}
+
+// chunkerFor returns the chunker the config selects for the content type, or the one of the "*" content type. A
+// config without either uses the default chunking
+func chunkerFor(conf *config.KnowledgeConfig, contentType string) (Chunker, error) {
+	chunker, err := NewChunker(chunkingFor(conf, contentType))
+	return chunker, errors.Wrapf(err, "invalid chunking of %s", contentType)
+}
+
+// codeChunkerFor returns the chunker the config selects for source code, which splits on the symbols of the
+// language with the code strategy
+func codeChunkerFor(conf *config.KnowledgeConfig, language string) (Chunker, error) {
+	chunking := chunkingFor(conf, config.ChunkingContentTypeCode)
+	chunker, err := NewChunker(chunking)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid chunking of %s", config.ChunkingContentTypeCode)
+	}
+	if chunking.Strategy == config.ChunkingStrategyCode {
+		chunker = NewCodeChunker(language, chunking.Size)
+	}
+	return chunker, nil
+}
+
+// chunkingFor returns the chunking of the key in the config, or of the "*" key, falling back to the default
+// chunking
+func chunkingFor(conf *config.KnowledgeConfig, key string) config.ChunkingConfig {
+	var chunkings []map[string]config.ChunkingConfig
+	if conf != nil {
+		chunkings = append(chunkings, conf.Chunking)
+	}
+	chunkings = append(chunkings, config.NewKnowledgeConfig().Chunking)
+
+	for _, candidates := range chunkings {
+		if c, ok := candidates[key]; ok {
+			return c
+		}
+		if c, ok := candidates[config.ChunkingContentTypeDefault]; ok {
+			return c
+		}
+	}
+	return config.ChunkingConfig{}
+}
+
+// tokenSpan is the byte range of a token in a text
+type tokenSpan struct {
+	start, end int
+}
+
+// maxTokenRunes is the length of the pieces long words are counted in, as BPE tokenizers split rare words
+const maxTokenRunes = 6
+
+// tokenSpans returns the byte ranges of the tokens of the text, see EstimateTokens
+func tokenSpans(text string) []tokenSpan {
+	var spans []tokenSpan
+	wordStart, wordRunes := -1, 0
+	endWord := func(end int) {
+		if wordStart >= 0 {
+			spans = append(spans, tokenSpan{start: wordStart, end: end})
+			wordStart, wordRunes = -1, 0
+		}
+	}
+
+	for i, r := range text {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			endWord(i)
+			spans = append(spans, tokenSpan{start: i, end: i + utf8.RuneLen(r)})
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r):
+			if wordRunes == maxTokenRunes {
+				endWord(i)
+			}
+			if wordStart < 0 {
+				wordStart = i
+			}
+			wordRunes++
+		case unicode.IsSpace(r):
+			endWord(i)
+		default:
+			endWord(i)
+			spans = append(spans, tokenSpan{start: i, end: i + utf8.RuneLen(r)})
+		}
+	}
+	endWord(len(text))
+	return spans
+}
+
+// EstimateTokens returns the number of tokens of the text as the chunkers estimate it, without the vocabulary of a
+// model: words count as a token per started 6 letters or digits, and punctuation marks and CJK characters as a
+// token each. This is close to the counts of BPE tokenizers for English, and higher for most other languages, so
+// chunks stay within the context limits of models
+func EstimateTokens(text string) int {
+	return len(tokenSpans(text))
+}
+
+// Chunk implements Chunker.Chunk
+func (c *recursiveChunker) Chunk(text string) []Chunk {
+	return textChunks(mergePieces(splitRecursively(text, recursiveSeparators, c.size), c.size, c.overlap), nil)
+}
+
+// Chunk implements Chunker.Chunk
+func (c *sentenceChunker) Chunk(text string) []Chunk {
+	var pieces []string
+	for _, sentence := range splitSentences(text) {
+		pieces = append(pieces, splitRecursively(sentence, []string{" "}, c.size)...)
+	}
+	return textChunks(mergePieces(pieces, c.size, c.overlap), nil)
+}
+
+// Chunk implements Chunker.Chunk
+func (c *tokenChunker) Chunk(text string) []Chunk {
+	return textChunks(splitTokens(text, c.size, c.overlap), nil)
+}
+
+// markdownHeadingPattern matches an ATX heading, with its level and text
+var markdownHeadingPattern = regexp.MustCompile(`^(#{1,6})[ \t]+(.*?)[ \t#]*$`)
+
+// Chunk implements Chunker.Chunk
+func (c *markdownChunker) Chunk(text string) []Chunk {
+	var (
+		chunks   []Chunk
+		headings []string // by level, with empty strings for skipped levels
+		section  strings.Builder
+		fence    string
+	)
+	flush := func() {
+		var path []string
+		for _, heading := range headings {
+			if heading != "" {
+				path = append(path, heading)
+			}
+		}
+		pieces := mergePieces(splitRecursively(section.String(), recursiveSeparators, c.size), c.size, c.overlap)
+		chunks = append(chunks, textChunks(pieces, path)...)
+		section.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		// Lines starting with # in code blocks are not headings
+		if fence == "" && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			fence = trimmed[:3]
+		} else if fence != "" && strings.HasPrefix(trimmed, fence) {
+			fence = ""
+		} else if match := markdownHeadingPattern.FindStringSubmatch(strings.TrimRight(line, "\r\n")); fence == "" && match != nil {
+			flush()
+			level := len(match[1])
+			for len(headings) < level {
+				headings = append(headings, "")
+			}
+			headings = append(headings[:level-1], match[2])
+		}
+		section.WriteString(line)
+	}
+	flush()
+
+	return chunks
+}
+
+// textChunks returns the chunks of the non-blank texts, trimmed, with the heading path
+func textChunks(texts []string, headingPath []string) []Chunk {
+	var chunks []Chunk
+	for _, text := range texts {
+		if text = strings.TrimSpace(text); text != "" {
+			chunks = append(chunks, Chunk{Text: text, HeadingPath: headingPath})
+		}
+	}
+	return chunks
+}
+
+// splitRecursively splits the text on the first separator, and the pieces of more than size tokens on the next
+// separators, down to fixed token windows. Separators are kept at the end of the pieces
+func splitRecursively(text string, separators []string, size int) []string {
+	if EstimateTokens(text) <= size {
+		return []string{text}
+	}
+	if len(separators) == 0 {
+		return splitTokens(text, size, 0)
+	}
+
+	var pieces []string
+	for _, part := range strings.SplitAfter(text, separators[0]) {
+		if part == "" {
+			continue
+		}
+		pieces = append(pieces, splitRecursively(part, separators[1:], size)...)
+	}
+	return pieces
+}
+
+// splitTokens splits the text into windows of size tokens, each starting with the last overlap tokens of the
+// previous one
+func splitTokens(text string, size, overlap int) []string {
+	spans := tokenSpans(text)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	// Windows must move forward, whatever the size and overlap
+	size = max(size, 1)
+	step := max(size-overlap, 1)
+
+	var windows []string
+	for start := 0; ; start += step {
+		end := min(start+size, len(spans))
+		windows = append(windows, text[spans[start].start:spans[end-1].end])
+		if end == len(spans) {
+			return windows
+		}
+	}
+}
+
+// mergePieces joins consecutive pieces into chunks of up to size tokens. Each chunk starts with the last pieces of
+// the previous one, up to overlap tokens
+func mergePieces(pieces []string, size, overlap int) []string {
+	var (
+		chunks  []string
+		current []string
+		counts  []int
+		total   int
+	)
+	for _, piece := range pieces {
+		count := EstimateTokens(piece)
+		if total+count > size && len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, ""))
+			// Keep the end of the chunk as the overlap, leaving room for the piece
+			for len(current) > 0 && (total > overlap || total+count > size) {
+				total -= counts[0]
+				current, counts = current[1:], counts[1:]
+			}
+		}
+		current = append(current, piece)
+		counts = append(counts, count)
+		total += count
+	}
+	if len(current) > 0 {
+		chunks = append(chunks, strings.Join(current, ""))
+	}
+	return chunks
+}
+
+// splitSentences splits text after the punctuation ending a sentence and after blank lines, keeping the spaces at
+// the end of the sentences
+func splitSentences(text string) []string {
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		fullWidth := r == '。' || r == '！' || r == '？'
+		terminal := r == '.' || r == '!' || r == '?' || fullWidth
+		paragraph := r == '\n' && strings.HasPrefix(text[i:], "\n")
+		if !terminal && !paragraph {
+			continue
+		}
+
+		// Punctuation ends a sentence if a space follows it, like the ". " of "1.5" does not, except full width
+		// punctuation which is not followed by spaces
+		rest := strings.TrimLeftFunc(text[i:], unicode.IsSpace)
+		spaces := len(text[i:]) - len(rest)
+		if terminal && !fullWidth && spaces == 0 && rest != "" {
+			continue
+		}
+		i += spaces
+		sentences = append(sentences, text[start:i])
+		start = i
+	}
+	if start < len(text) {
+		sentences = append(sentences, text[start:])
+	}
+	return sentences
+}
@@ -0,0 +1,220 @@
+package knowledge_test
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+// longText returns paragraphs of numbered sentences
+func longText(paragraphs, sentences int) string {
+	var text strings.Builder
+	for p := 1; p <= paragraphs; p++ {
+		for s := 1; s <= sentences; s++ {
+			fmt.Fprintf(&text, "Paragraph %d sentence %d talks about the knowledge of agents. ", p, s)
+		}
+		text.WriteString("\n\n")
+	}
+	return strings.TrimSpace(text.String())
+}
+
+func chunkTexts(chunks []knowledge.Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+func TestEstimateTokens(t *testing.T) {
+	require.Equal(t, 0, knowledge.EstimateTokens("  \n"))
+	require.Equal(t, 5, knowledge.EstimateTokens("The cat sat down."))
+	require.Equal(t, 4, knowledge.EstimateTokens("internationalization"))
+	require.Equal(t, 3, knowledge.EstimateTokens("ERR-1042"))
+	require.Equal(t, 5, knowledge.EstimateTokens("知識ベース"))
+}
+
+func TestRecursiveChunker(t *testing.T) {
+	text := longText(6, 8)
+	chunks := knowledge.NewRecursiveChunker(100, 20).Chunk(text)
+	require.Greater(t, len(chunks), 4)
+	for i, chunk := range chunks {
+		require.LessOrEqual(t, knowledge.EstimateTokens(chunk.Text), 100)
+		require.Nil(t, chunk.HeadingPath)
+		if i > 0 {
+			// Chunks break between sentences, and start with the last sentence of the previous chunk
+			require.True(t, strings.HasPrefix(chunk.Text, "Paragraph"), chunk.Text)
+			firstSentence := chunk.Text[:strings.Index(chunk.Text, ". ")+1]
+			require.True(t, strings.HasSuffix(chunks[i-1].Text, firstSentence), firstSentence)
+		}
+	}
+	for _, sentence := range []string{"Paragraph 1 sentence 1 ", "Paragraph 6 sentence 8 "} {
+		require.Contains(t, strings.Join(chunkTexts(chunks), "\n"), sentence)
+	}
+
+	// Text that fits is one chunk, and a single long word is split on tokens
+	require.Equal(t, []string{"Short text."}, chunkTexts(knowledge.NewRecursiveChunker(100, 0).Chunk(" Short text.\n")))
+	chunks = knowledge.NewRecursiveChunker(2, 0).Chunk(strings.Repeat("a", 30))
+	require.Equal(t, []string{strings.Repeat("a", 12), strings.Repeat("a", 12), strings.Repeat("a", 6)}, chunkTexts(chunks))
+}
+
+func TestSentenceChunker(t *testing.T) {
+	text := "The first sentence is here. Is this the second one? Yes! Version 1.5 is not split.\n\nA new paragraph"
+	chunks := knowledge.NewSentenceChunker(13, 0).Chunk(text)
+	require.Equal(t, []string{
+		"The first sentence is here. Is this the second one?",
+		"Yes! Version 1.5 is not split.",
+		"A new paragraph",
+	}, chunkTexts(chunks))
+
+	// The overlap repeats whole sentences
+	chunks = knowledge.NewSentenceChunker(13, 6).Chunk(text)
+	require.Equal(t, []string{
+		"The first sentence is here. Is this the second one?",
+		"Is this the second one? Yes!",
+		"Yes! Version 1.5 is not split.",
+		"A new paragraph",
+	}, chunkTexts(chunks))
+}
+
+func TestMarkdownChunker(t *testing.T) {
+	text := `# Guide
+
+Introduction of the guide.
+
+## Install
+
+Run the installer.
+
+` + "```sh\n# not a heading\nmake install\n```" + `
+
+### Linux
+
+Use the package manager.
+
+## Usage
+
+` + longText(3, 4)
+
+	chunks := knowledge.NewMarkdownChunker(60, 0).Chunk(text)
+	require.GreaterOrEqual(t, len(chunks), 5)
+	require.Equal(t, "# Guide\n\nIntroduction of the guide.", chunks[0].Text)
+	require.Equal(t, []string{"Guide"}, chunks[0].HeadingPath)
+	require.Contains(t, chunks[1].Text, "# not a heading")
+	require.Equal(t, []string{"Guide", "Install"}, chunks[1].HeadingPath)
+	require.Equal(t, []string{"Guide", "Install", "Linux"}, chunks[2].HeadingPath)
+
+	// The long section is split, and all its chunks have its heading path
+	for _, chunk := range chunks[3:] {
+		require.Equal(t, []string{"Guide", "Usage"}, chunk.HeadingPath)
+		require.LessOrEqual(t, knowledge.EstimateTokens(chunk.Text), 60)
+	}
+	require.True(t, strings.HasPrefix(chunks[3].Text, "## Usage"))
+
+	// Text before the first heading has no heading path, and skipped levels are left out
+	chunks = knowledge.NewMarkdownChunker(60, 0).Chunk("Preamble\n\n### Deep heading ###\n\nBody")
+	require.Len(t, chunks, 2)
+	require.Nil(t, chunks[0].HeadingPath)
+	require.Equal(t, []string{"Deep heading"}, chunks[1].HeadingPath)
+}
+
+func TestTokenChunker(t *testing.T) {
+	chunks := knowledge.NewTokenChunker(4, 1).Chunk("one two three four five six seven eight nine ten")
+	require.Equal(t, []string{
+		"one two three four",
+		"four five six seven",
+		"seven eight nine ten",
+	}, chunkTexts(chunks))
+}
+
+func TestChunkers_InvalidSizes(t *testing.T) {
+	text := "one two three. four five six.\n\n# Seven\n\neight nine ten"
+
+	// Sizes below 1 token and overlaps of the whole chunk are clamped, so the chunkers neither panic nor loop
+	for _, size := range [][2]int{{0, 0}, {-1, -1}, {2, 2}, {2, 5}} {
+		for _, chunker := range []knowledge.Chunker{
+			knowledge.NewRecursiveChunker(size[0], size[1]),
+			knowledge.NewSentenceChunker(size[0], size[1]),
+			knowledge.NewMarkdownChunker(size[0], size[1]),
+			knowledge.NewTokenChunker(size[0], size[1]),
+		} {
+			require.NotEmpty(t, chunker.Chunk(text), "size %d overlap %d", size[0], size[1])
+		}
+	}
+
+	require.Equal(t, []string{"one", "two", "three"}, chunkTexts(knowledge.NewTokenChunker(0, 0).Chunk("one two three")))
+	require.Equal(t, []string{"one two", "two three"}, chunkTexts(knowledge.NewTokenChunker(2, 2).Chunk("one two three")))
+}
+
+func TestNewChunker(t *testing.T) {
+	for _, conf := range []config.ChunkingConfig{
+		{Strategy: config.ChunkingStrategyRecursive, Size: 10},
+		{Strategy: config.ChunkingStrategySentence, Size: 10, Overlap: 2},
+		{Strategy: config.ChunkingStrategyMarkdown, Size: 10},
+		{Strategy: config.ChunkingStrategyToken, Size: 10, Overlap: 9},
+	} {
+		_, err := knowledge.NewChunker(conf)
+		require.NoError(t, err)
+	}
+
+	for _, conf := range []config.ChunkingConfig{
+		{Strategy: "semantic", Size: 10},
+		{Strategy: config.ChunkingStrategyRecursive},
+		{Strategy: config.ChunkingStrategyRecursive, Size: 10, Overlap: 10},
+		{Strategy: config.ChunkingStrategyRecursive, Size: 10, Overlap: -1},
+	} {
+		_, err := knowledge.NewChunker(conf)
+		require.Error(t, err)
+	}
+}
+
+func TestProcessDocumentsByType_Chunking(t *testing.T) {
+	ctx := t.Context()
+	embedder := knowledge.NewHashEmbedder(32)
+	conf := config.NewKnowledgeConfig()
+	conf.Chunking["text/plain"] = config.ChunkingConfig{Strategy: config.ChunkingStrategyToken, Size: 50}
+	conf.Chunking["text/x-rst"] = config.ChunkingConfig{Strategy: config.ChunkingStrategySentence, Size: 30}
+
+	process := func(contentType, text string) []*knowledge.Document {
+		t.Helper()
+		documents, _, err := knowledge.ProcessDocumentsByType(ctx, nil, &knowledge.DocumentReader{
+			Content:     bytes.NewReader([]byte(text)),
+			ContentType: contentType,
+		}, slog.Default(), conf, embedder, 1)
+		require.NoError(t, err)
+		return documents
+	}
+
+	text := longText(2, 5)
+	documents := process("text/plain", text)
+	require.Len(t, documents, (knowledge.EstimateTokens(text)+49)/50)
+	require.Equal(t, 50, documents[0].Metadata[knowledge.MetadataKeyTokenCount])
+	require.Equal(t, 1, documents[0].Metadata["chunk_number"])
+	require.NotEmpty(t, documents[0].Embeddings)
+
+	for _, document := range process("text/x-rst", text) {
+		require.True(t, strings.HasSuffix(document.Content.Text, "."), document.Content.Text)
+	}
+
+	// Other content types are chunked like "*"
+	documents = process("application/x-unknown", text)
+	require.Len(t, documents, 1)
+
+	documents = process("text/markdown", "# Title\n\nBody\n\n## Part\n\nMore")
+	require.Len(t, documents, 2)
+	require.Equal(t, []string{"Title", "Part"}, documents[1].Metadata[knowledge.MetadataKeyHeadingPath])
+	require.Equal(t, "text/markdown", documents[1].Content.MIMEType)
+
+	conf.Chunking["text/plain"] = config.ChunkingConfig{Strategy: "semantic", Size: 50}
+	_, _, err := knowledge.ProcessDocumentsByType(ctx, nil, &knowledge.DocumentReader{
+		Content:     bytes.NewReader([]byte(text)),
+		ContentType: "text/plain",
+	}, slog.Default(), conf, embedder, 1)
+	require.ErrorContains(t, err, "invalid chunking of text/plain")
+}
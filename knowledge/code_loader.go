@@ -0,0 +1,564 @@
+package knowledge
+
+import (
+	"cmp"
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"log/slog"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+const (
+	SourceTypeCode = "code"
+
+	// MetadataKeySymbol is the metadata key of the function, type or method a chunk of source code is in, qualified
+	// by the types it is declared in, such as "Service.Search"
+	MetadataKeySymbol = "symbol"
+	// MetadataKeyFilePath is the metadata key of the path of the file of source code
+	MetadataKeyFilePath = "file_path"
+	// MetadataKeyLanguage is the metadata key of the programming language of source code
+	MetadataKeyLanguage = "language"
+	// MetadataKeyStartLine and MetadataKeyEndLine are the metadata keys of the range of lines of a chunk of source
+	// code, from 1, to cite it
+	MetadataKeyStartLine = "start_line"
+	MetadataKeyEndLine   = "end_line"
+
+	CodeLanguageGo = "go"
+)
+
+type (
+	// codeLanguage is a programming language the code loader recognizes, with the patterns of the lines declaring
+	// its symbols. The non-empty groups of a pattern are the name of the symbol, joined by dots
+	codeLanguage struct {
+		name           string
+		extensions     []string
+		contentTypes   []string
+		symbolPatterns []*regexp.Regexp
+	}
+
+	// codeChunker splits source code into a chunk per symbol, and the symbols too large into their nested symbols,
+	// down to windows of lines
+	codeChunker struct {
+		language *codeLanguage
+		size     int
+	}
+
+	// codeBoundary is the declaration of a symbol of source code
+	codeBoundary struct {
+		// start is the first line of the symbol with the comments above it, from 0
+		start int
+		// line is the line declaring the symbol, from 0
+		line   int
+		indent int
+		name   string
+	}
+)
+
+var _ Chunker = (*codeChunker)(nil)
+
+var (
+	// curlySymbolPatterns are the declarations of types and functions of Java, Kotlin, C#, Scala, Swift and PHP
+	curlySymbolPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*(?:@\w+(?:\([^)]*\))?\s+)*(?:(?:public|private|protected|internal|fileprivate|static|final|abstract|sealed|open|data|partial|inline|value|case|override)\s+)*(?:class|interface|enum|record|object|struct|trait|protocol|extension)\s+([A-Za-z_]\w*)`),
+		regexp.MustCompile(`^\s*(?:(?:public|private|protected|internal|fileprivate|static|final|abstract|override|open|suspend|inline|async|mutating)\s+)*(?:fun|func|def|function)\s+(?:<[^>]*>\s*)?(?:\w+\.)?([A-Za-z_]\w*)`),
+		// Methods of Java and C# have no keyword, but modifiers and a return type
+		regexp.MustCompile(`^\s+(?:(?:public|private|protected|internal|static|final|abstract|synchronized|override|virtual|async|native|sealed|extern|unsafe|new)\s+)+(?:<[^>]+>\s+)?(?:[\w<>\[\],.?]+\s+)?([A-Za-z_]\w*)\s*\(`),
+	}
+
+	javaScriptSymbolPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:default\s+)?(?:declare\s+)?(?:abstract\s+)?(?:async\s+)?(?:function\s*\*?|class|interface|enum|type|namespace)\s+([A-Za-z_$][\w$]*)`),
+		regexp.MustCompile(`^\s*(?:export\s+)?(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*(?::[^=]+)?=\s*(?:async\s+)?(?:function\b|\([^)]*\)\s*(?::[^=]+)?=>|[A-Za-z_$][\w$]*\s*=>)`),
+		regexp.MustCompile(`^\s+(?:(?:public|private|protected|static|async|readonly|override|get|set)\s+)*\*?([A-Za-z_$][\w$]*)\s*(?:<[^>]*>)?\([^)]*\)\s*(?::\s*[^{=;]+)?\{\s*$`),
+	}
+
+	// codeLanguages are the languages the code loader recognizes. Go is parsed with go/parser, and its patterns
+	// are only used for files which do not parse
+	codeLanguages = []*codeLanguage{
+		{
+			name:         CodeLanguageGo,
+			extensions:   []string{".go"},
+			contentTypes: []string{"text/x-go"},
+			symbolPatterns: []*regexp.Regexp{
+				regexp.MustCompile(`^func\s+(?:\(\s*(?:\w+\s+)?\*?(\w+)[^)]*\)\s*)?(\w+)`),
+				regexp.MustCompile(`^(?:type|var|const)\s+(\w+)`),
+			},
+		},
+		{
+			name:         "python",
+			extensions:   []string{".py", ".pyi"},
+			contentTypes: []string{"text/x-python", "text/x-python-script", "application/x-python"},
+			symbolPatterns: []*regexp.Regexp{
+				regexp.MustCompile(`^\s*(?:async\s+def|def|class)\s+([A-Za-z_]\w*)`),
+			},
+		},
+		{
+			name:           "javascript",
+			extensions:     []string{".js", ".jsx", ".mjs", ".cjs"},
+			contentTypes:   []string{"text/javascript", "application/javascript", "application/x-javascript"},
+			symbolPatterns: javaScriptSymbolPatterns,
+		},
+		{
+			name:           "typescript",
+			extensions:     []string{".ts", ".tsx", ".mts", ".cts"},
+			contentTypes:   []string{"text/typescript", "text/x-typescript", "application/typescript"},
+			symbolPatterns: javaScriptSymbolPatterns,
+		},
+		{
+			name:           "java",
+			extensions:     []string{".java"},
+			contentTypes:   []string{"text/x-java", "text/x-java-source"},
+			symbolPatterns: curlySymbolPatterns,
+		},
+		{
+			name:           "kotlin",
+			extensions:     []string{".kt", ".kts"},
+			contentTypes:   []string{"text/x-kotlin"},
+			symbolPatterns: curlySymbolPatterns,
+		},
+		{
+			name:           "csharp",
+			extensions:     []string{".cs"},
+			contentTypes:   []string{"text/x-csharp"},
+			symbolPatterns: curlySymbolPatterns,
+		},
+		{
+			name:           "scala",
+			extensions:     []string{".scala"},
+			contentTypes:   []string{"text/x-scala"},
+			symbolPatterns: curlySymbolPatterns,
+		},
+		{
+			name:           "swift",
+			extensions:     []string{".swift"},
+			contentTypes:   []string{"text/x-swift"},
+			symbolPatterns: curlySymbolPatterns,
+		},
+		{
+			name:           "php",
+			extensions:     []string{".php"},
+			contentTypes:   []string{"text/x-php", "application/x-httpd-php"},
+			symbolPatterns: curlySymbolPatterns,
+		},
+		{
+			name:         "rust",
+			extensions:   []string{".rs"},
+			contentTypes: []string{"text/x-rust"},
+			symbolPatterns: []*regexp.Regexp{
+				regexp.MustCompile(`^\s*(?:pub(?:\([^)]*\))?\s+)?(?:(?:async|const|unsafe|extern(?:\s+"[^"]*")?)\s+)*(?:fn|struct|enum|trait|mod|union|type)\s+([A-Za-z_]\w*)`),
+				regexp.MustCompile(`^\s*(?:unsafe\s+)?impl(?:\s*<[^>]*>)?\s+(?:[\w:<>, ]+?\s+for\s+)?([A-Za-z_][\w:]*)`),
+				regexp.MustCompile(`^\s*macro_rules!\s*([A-Za-z_]\w*)`),
+			},
+		},
+		{
+			name:         "c",
+			extensions:   []string{".c", ".h"},
+			contentTypes: []string{"text/x-c", "text/x-csrc", "text/x-chdr"},
+			symbolPatterns: []*regexp.Regexp{
+				regexp.MustCompile(`^(?:typedef\s+)?(?:struct|enum|union)\s+([A-Za-z_]\w*)[^;]*$`),
+				// Definitions of functions start at the first column, unlike the calls in their bodies
+				regexp.MustCompile(`^[A-Za-z_][\w*&\s]*?[\s*&]([A-Za-z_]\w*)\s*\([^;]*$`),
+			},
+		},
+		{
+			name:         "cpp",
+			extensions:   []string{".cc", ".cpp", ".cxx", ".hh", ".hpp", ".hxx"},
+			contentTypes: []string{"text/x-c++", "text/x-c++src", "text/x-c++hdr"},
+			symbolPatterns: []*regexp.Regexp{
+				regexp.MustCompile(`^\s*(?:template\s*<[^>]*>\s*)?(?:typedef\s+)?(?:struct|class|enum(?:\s+class)?|union|namespace)\s+([A-Za-z_]\w*)[^;]*$`),
+				regexp.MustCompile(`^[A-Za-z_][\w:<>,*&\s]*?[\s*&]([A-Za-z_][\w:~]*)\s*\([^;]*$`),
+			},
+		},
+		{
+			name:         "ruby",
+			extensions:   []string{".rb"},
+			contentTypes: []string{"text/x-ruby", "application/x-ruby"},
+			symbolPatterns: []*regexp.Regexp{
+				regexp.MustCompile(`^\s*(?:def\s+(?:self\.)?([\w?!=]+)|class\s+([\w:]+)|module\s+([\w:]+))`),
+			},
+		},
+		{
+			name:         "shell",
+			extensions:   []string{".sh", ".bash", ".zsh"},
+			contentTypes: []string{"text/x-shellscript", "application/x-sh"},
+			symbolPatterns: []*regexp.Regexp{
+				regexp.MustCompile(`^\s*function\s+([A-Za-z_][\w-]*)`),
+				regexp.MustCompile(`^\s*([A-Za-z_][\w-]*)\s*\(\)`),
+			},
+		},
+	}
+
+	// codeKeywords are words the symbol patterns match in statements, such as "if (ready) {", which are not
+	// symbols
+	codeKeywords = []string{"if", "else", "for", "foreach", "while", "do", "switch", "case", "catch", "return", "throw", "new", "sizeof", "elif", "with", "using", "lock", "fixed"}
+)
+
+// DetectCodeLanguage returns the programming language of source code of the content type, or of the extension of
+// the filename for plain text and content without a type. It returns "" for other content
+func DetectCodeLanguage(filename, contentType string) string {
+	if language := codeLanguageOf(filename, contentType); language != nil {
+		return language.name
+	}
+	return ""
+}
+
+// path returns the path of the document, its filename or else its ID
+func (r *DocumentReader) path() string {
+	return cmp.Or(r.Filename, r.ID)
+}
+
+func codeLanguageOf(filename, contentType string) *codeLanguage {
+	contentType, _, _ = strings.Cut(contentType, ";")
+	contentType = strings.TrimSpace(strings.ToLower(contentType))
+	for _, language := range codeLanguages {
+		if slices.Contains(language.contentTypes, contentType) {
+			return language
+		}
+	}
+
+	switch contentType {
+	case "", "text/plain", "application/octet-stream":
+	default:
+		return nil
+	}
+	extension := strings.ToLower(path.Ext(filename))
+	if extension == "" {
+		return nil
+	}
+	for _, language := range codeLanguages {
+		if slices.Contains(language.extensions, extension) {
+			return language
+		}
+	}
+	return nil
+}
+
+// ProcessDocumentsFromCode processes source code of the language, with a chunk per function, type or method, so
+// that symbols are not cut in half. Go is parsed with go/parser, other languages are split on the lines declaring
+// their symbols. Chunks have their symbol and range of lines in their metadata, with the language and file path
+// of the source, to cite them
+func ProcessDocumentsFromCode(
+	ctx context.Context,
+	reader io.Reader,
+	logger *slog.Logger,
+	config *config.KnowledgeConfig,
+	embedder Embedder,
+	language string,
+	filePath string,
+) ([]*Document, map[string]any, error) {
+	chunker, err := codeChunkerFor(config, language)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read source code")
+	}
+	// Lines are kept as they are, so that their numbers are those of the file
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if strings.TrimSpace(text) == "" {
+		return nil, nil, errors.New("empty source code")
+	}
+
+	documents, err := embedChunks(ctx, chunker.Chunk(text), "text/plain", "chunk_number", embedder)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to process source code")
+	}
+
+	metadata := map[string]any{
+		"source_type": SourceTypeCode,
+		"total_lines": strings.Count(strings.TrimRight(text, "\n"), "\n") + 1,
+		"chunk_count": len(documents),
+	}
+	setDocumentMetadata(documents, metadata, map[string]string{
+		MetadataKeyLanguage: language,
+		MetadataKeyFilePath: filePath,
+	})
+
+	logger.Info("Processed source code", "language", language, "file_path", filePath, "chunks", len(documents))
+	return documents, metadata, nil
+}
+
+// NewCodeChunker creates a chunker which splits source code of the language into a chunk per symbol: the
+// functions, types and methods, with the comments above them, and the code between them. Symbols of more than
+// size tokens are split into their nested symbols, such as the methods of a class, and then into windows of lines.
+// Code of an unknown language is split into windows of lines, preferably at blank lines. The size is at least 1 token
+func NewCodeChunker(language string, size int) Chunker {
+	size, _ = clampChunking(size, 0)
+
+	var lang *codeLanguage
+	for _, candidate := range codeLanguages {
+		if candidate.name == language {
+			lang = candidate
+		}
+	}
+	return &codeChunker{language: lang, size: size}
+}
+
+// Chunk implements Chunker.Chunk
+func (c *codeChunker) Chunk(text string) []Chunk {
+	lines := strings.Split(text, "\n")
+	var (
+		boundaries []codeBoundary
+		parsed     bool
+	)
+	if c.language != nil && c.language.name == CodeLanguageGo {
+		boundaries, parsed = goBoundaries(text)
+	}
+	if !parsed {
+		boundaries = c.boundaries(lines, 0, len(lines), -1)
+	}
+	return c.segments(lines, 0, len(lines), boundaries, "")
+}
+
+// segments returns the chunks of the lines from start to end: the code before the first boundary, in the symbol
+// of parent, and the symbols of the boundaries
+func (c *codeChunker) segments(lines []string, start, end int, boundaries []codeBoundary, parent string) []Chunk {
+	first := end
+	if len(boundaries) > 0 {
+		first = boundaries[0].start
+	}
+	chunks := c.segment(lines, start, first, parent, nil)
+	for i, boundary := range boundaries {
+		next := end
+		if i+1 < len(boundaries) {
+			next = boundaries[i+1].start
+		}
+		symbol := boundary.name
+		if parent != "" {
+			symbol = parent + "." + symbol
+		}
+		chunks = append(chunks, c.segment(lines, boundary.start, next, symbol, &boundary)...)
+	}
+	return chunks
+}
+
+// segment returns the lines from start to end as a chunk, or split on the symbols nested in the boundary if they
+// are more than the size of chunks
+func (c *codeChunker) segment(lines []string, start, end int, symbol string, boundary *codeBoundary) []Chunk {
+	start, end = trimBlankLines(lines, start, end)
+	if start >= end {
+		return nil
+	}
+	text := strings.Join(lines[start:end], "\n")
+	if EstimateTokens(text) <= c.size {
+		return []Chunk{{Text: text, Symbol: symbol, StartLine: start + 1, EndLine: end}}
+	}
+	if boundary != nil {
+		if nested := c.boundaries(lines, boundary.line+1, end, boundary.indent); len(nested) > 0 {
+			return c.segments(lines, start, end, nested, symbol)
+		}
+	}
+	return c.windows(lines, start, end, symbol)
+}
+
+// windows splits the lines from start to end into chunks of up to size tokens, ending at a blank line in the
+// second half of a window if there is one. Lines longer than size are split into windows of tokens
+func (c *codeChunker) windows(lines []string, start, end int, symbol string) []Chunk {
+	var chunks []Chunk
+	for start < end {
+		stop, tokens, blank := start, 0, -1
+		for ; stop < end; stop++ {
+			count := EstimateTokens(lines[stop])
+			if tokens+count > c.size && stop > start {
+				break
+			}
+			tokens += count
+			if strings.TrimSpace(lines[stop]) == "" {
+				blank = stop
+			}
+		}
+
+		switch {
+		case tokens > c.size:
+			for _, piece := range splitTokens(lines[start], c.size, 0) {
+				chunks = append(chunks, Chunk{Text: piece, Symbol: symbol, StartLine: start + 1, EndLine: start + 1})
+			}
+		default:
+			if stop < end && blank > start+(stop-start)/2 {
+				stop = blank
+			}
+			if first, last := trimBlankLines(lines, start, stop); first < last {
+				chunks = append(chunks, Chunk{Text: strings.Join(lines[first:last], "\n"), Symbol: symbol, StartLine: first + 1, EndLine: last})
+			}
+		}
+		start = stop
+	}
+	return chunks
+}
+
+// boundaries returns the declarations of symbols between the lines from and to which are the least indented, and
+// more than parentIndent, with the comments, decorators and attributes right above them
+func (c *codeChunker) boundaries(lines []string, from, to, parentIndent int) []codeBoundary {
+	if c.language == nil {
+		return nil
+	}
+
+	var found []codeBoundary
+	minIndent := -1
+	for i := from; i < to; i++ {
+		indent := indentWidth(lines[i])
+		if indent <= parentIndent || (minIndent >= 0 && indent > minIndent) {
+			continue
+		}
+		name, ok := c.language.symbolName(lines[i])
+		if !ok {
+			continue
+		}
+		if indent < minIndent {
+			found = found[:0]
+		}
+		minIndent = indent
+		found = append(found, codeBoundary{start: i, line: i, indent: indent, name: name})
+	}
+
+	lowest := from
+	for i := range found {
+		for found[i].start > lowest && isCodeCommentLine(lines[found[i].start-1]) {
+			found[i].start--
+		}
+		lowest = found[i].line + 1
+	}
+	return found
+}
+
+// symbolName returns the name of the symbol the line declares, if it does
+func (l *codeLanguage) symbolName(line string) (string, bool) {
+	for _, pattern := range l.symbolPatterns {
+		match := pattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		var names []string
+		for _, group := range match[1:] {
+			if group != "" {
+				names = append(names, group)
+			}
+		}
+		if len(names) == 0 || slices.Contains(codeKeywords, names[len(names)-1]) {
+			continue
+		}
+		return strings.Join(names, "."), true
+	}
+	return "", false
+}
+
+// goBoundaries returns the top-level declarations of Go source, except imports, which stay with the package clause.
+// It reports false if the source does not parse
+func goBoundaries(text string) ([]codeBoundary, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", text, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, false
+	}
+
+	var boundaries []codeBoundary
+	for _, decl := range file.Decls {
+		var (
+			name string
+			doc  *ast.CommentGroup
+		)
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			name, doc = decl.Name.Name, decl.Doc
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				name = goReceiverName(decl.Recv.List[0].Type) + "." + name
+			}
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			var names []string
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names = append(names, spec.Name.Name)
+				case *ast.ValueSpec:
+					for _, ident := range spec.Names {
+						names = append(names, ident.Name)
+					}
+				}
+			}
+			name, doc = strings.Join(names, ", "), decl.Doc
+		default:
+			continue
+		}
+
+		line := fset.Position(decl.Pos()).Line - 1
+		start := line
+		if doc != nil {
+			start = fset.Position(doc.Pos()).Line - 1
+		}
+		// Declarations on the line of the previous one are in its chunk
+		if len(boundaries) > 0 && start <= boundaries[len(boundaries)-1].line {
+			continue
+		}
+		boundaries = append(boundaries, codeBoundary{start: start, line: line, name: name})
+	}
+	return boundaries, true
+}
+
+// goReceiverName returns the name of the type of the receiver of a method, without its pointer and type parameters
+func goReceiverName(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return goReceiverName(expr.X)
+	case *ast.IndexExpr:
+		return goReceiverName(expr.X)
+	case *ast.IndexListExpr:
+		return goReceiverName(expr.X)
+	case *ast.ParenExpr:
+		return goReceiverName(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// isCodeCommentLine reports whether the line is a comment, a decorator or an attribute, which belong to the
+// declaration under them
+func isCodeCommentLine(line string) bool {
+	line = strings.TrimSpace(line)
+	for _, prefix := range []string{"//", "#", "/*", "*", "--", "@", "["} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// trimBlankLines returns the range of lines from start to end without its leading and trailing blank lines
+func trimBlankLines(lines []string, start, end int) (int, int) {
+	for start < end && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return start, end
+}
+
+// indentWidth returns the width of the indentation of the line, with tabs as 4 columns
+func indentWidth(line string) int {
+	width := 0
+	for _, r := range line {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 4
+		default:
+			return width
+		}
+	}
+	return width
+}
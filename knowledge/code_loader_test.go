@@ -0,0 +1,165 @@
+package knowledge_test
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+const testGoSource = `// Package store keeps the documents.
+package store
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNotFound is returned for missing documents
+var ErrNotFound = errors.New("not found")
+
+// Store keeps documents by ID
+type Store struct {
+	documents map[string]string
+}
+
+// Get returns the document of the ID
+func (s *Store) Get(ctx context.Context, id string) (string, error) {
+	document, ok := s.documents[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return document, nil
+}
+
+func New() *Store {
+	return &Store{documents: make(map[string]string)}
+}
+`
+
+func TestDetectCodeLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		filename, contentType, language string
+	}{
+		{"store/store.go", "text/plain", "go"},
+		{"app.py", "", "python"},
+		{"src/App.TSX", "application/octet-stream", "typescript"},
+		{"", "text/x-rust", "rust"},
+		{"", "text/javascript; charset=utf-8", "javascript"},
+		{"Main.java", "text/plain", "java"},
+		// Content types of documents take precedence over extensions
+		{"README.md", "text/markdown", ""},
+		{"page.go", "text/html", ""},
+		{"notes.txt", "text/plain", ""},
+		{"", "text/plain", ""},
+	} {
+		require.Equal(t, tc.language, knowledge.DetectCodeLanguage(tc.filename, tc.contentType), "%s %s", tc.filename, tc.contentType)
+	}
+}
+
+func TestProcessDocumentsByType_Code(t *testing.T) {
+	documents, metadata, err := knowledge.ProcessDocumentsByType(t.Context(), nil, &knowledge.DocumentReader{
+		Content:     strings.NewReader(testGoSource),
+		ContentType: "text/plain",
+		Filename:    "store/store.go",
+	}, slog.Default(), config.NewKnowledgeConfig(), knowledge.NewHashEmbedder(32), 1)
+	require.NoError(t, err)
+	require.Equal(t, knowledge.SourceTypeCode, metadata["source_type"])
+	require.Equal(t, 28, metadata["total_lines"])
+
+	// The package clause and imports are a chunk, and each declaration another, with its doc comment
+	var symbols []string
+	var lines [][2]int
+	for _, document := range documents {
+		symbol, _ := document.Metadata[knowledge.MetadataKeySymbol].(string)
+		symbols = append(symbols, symbol)
+		lines = append(lines, [2]int{document.Metadata[knowledge.MetadataKeyStartLine].(int), document.Metadata[knowledge.MetadataKeyEndLine].(int)})
+		require.Equal(t, "go", document.Metadata[knowledge.MetadataKeyLanguage])
+		require.Equal(t, "store/store.go", document.Metadata[knowledge.MetadataKeyFilePath])
+		require.NotEmpty(t, document.Embeddings)
+	}
+	require.Equal(t, []string{"", "ErrNotFound", "Store", "Store.Get", "New"}, symbols)
+	require.Equal(t, [][2]int{{1, 7}, {9, 10}, {12, 15}, {17, 24}, {26, 28}}, lines)
+	require.True(t, strings.HasPrefix(documents[3].Content.Text, "// Get returns the document of the ID\nfunc (s *Store) Get("))
+	require.True(t, strings.HasSuffix(documents[3].Content.Text, "\treturn document, nil\n}"))
+}
+
+func TestCodeChunker_NestedSymbols(t *testing.T) {
+	source := `import os
+
+
+class Cache:
+    """Caches files in memory."""
+
+    def __init__(self, root):
+        self.root = root
+        self.files = {}
+
+    @staticmethod
+    def key(path):
+        return os.path.normpath(path).lower().strip()
+
+    def read(self, path):
+        if path not in self.files:
+            with open(os.path.join(self.root, path)) as f:
+                self.files[path] = f.read()
+        return self.files[path]
+
+
+def main():
+    print(Cache(".").read("README.md"))
+`
+	chunks := knowledge.NewCodeChunker("python", 60).Chunk(source)
+
+	// The class is larger than the chunks, so it is split into its methods, with their decorators
+	var symbols []string
+	for _, chunk := range chunks {
+		symbols = append(symbols, chunk.Symbol)
+		require.LessOrEqual(t, knowledge.EstimateTokens(chunk.Text), 60)
+	}
+	require.Equal(t, []string{"", "Cache", "Cache.__init__", "Cache.key", "Cache.read", "main"}, symbols)
+	require.Equal(t, "class Cache:\n    \"\"\"Caches files in memory.\"\"\"", chunks[1].Text)
+	require.Equal(t, 11, chunks[3].StartLine)
+	require.True(t, strings.HasPrefix(chunks[3].Text, "    @staticmethod\n    def key(path):"))
+	require.Equal(t, [2]int{22, 23}, [2]int{chunks[5].StartLine, chunks[5].EndLine})
+}
+
+func TestCodeChunker_LargeSymbols(t *testing.T) {
+	var source strings.Builder
+	source.WriteString("package main\n\nfunc main() {\n")
+	for range 30 {
+		source.WriteString("\tfmt.Println(\"step\", 1)\n")
+	}
+	source.WriteString("}\n")
+
+	// Symbols without nested symbols are split into windows of lines
+	chunks := knowledge.NewCodeChunker("go", 40).Chunk(source.String())
+	require.Greater(t, len(chunks), 2)
+	next := 3
+	for _, chunk := range chunks[1:] {
+		require.Equal(t, "main", chunk.Symbol)
+		require.Equal(t, next, chunk.StartLine)
+		require.Equal(t, chunk.EndLine-chunk.StartLine+1, strings.Count(chunk.Text, "\n")+1)
+		require.LessOrEqual(t, knowledge.EstimateTokens(chunk.Text), 40)
+		next = chunk.EndLine + 1
+	}
+	require.Equal(t, 34, next-1)
+
+	// Go which does not parse is split on the lines declaring its symbols
+	chunks = knowledge.NewCodeChunker("go", 40).Chunk("package main\n\nfunc (s *Server) Start() {\n\ts.run(\n}\n\ntype Server struct{}\n")
+	require.Len(t, chunks, 3)
+	require.Equal(t, "Server.Start", chunks[1].Symbol)
+	require.Equal(t, "Server", chunks[2].Symbol)
+}
+
+func TestCodeChunker_InvalidSize(t *testing.T) {
+	// Sizes below 1 token are clamped, so every line becomes a chunk instead of the chunker panicking
+	for _, size := range []int{0, -1} {
+		chunks := knowledge.NewCodeChunker("go", size).Chunk("package main\n\nfunc main() {\n}\n")
+		require.NotEmpty(t, chunks)
+		require.Equal(t, "main", chunks[len(chunks)-1].Symbol)
+	}
+}
@@ -66,7 +66,7 @@ func ProcessKnowledgeFromMultipleDocuments(
 		}
 
 		// Track document type
-		sourceType := getSourceTypeFromContentType(docReader.ContentType)
+		sourceType := getSourceType(docReader)
 		documentTypes[sourceType]++
 
 		// Add documents with updated IDs and metadata
@@ -119,7 +119,8 @@ func ProcessKnowledgeFromMultipleDocuments(
 	return knowledge, nil
 }
 
-// ProcessDocumentsByType processes a single document based on its content type
+// ProcessDocumentsByType processes a single document based on its content type. Source code, by its content type or
+// the extension of its filename, is processed by ProcessDocumentsFromCode
 func ProcessDocumentsByType(
 	ctx context.Context,
 	g *genkit.Genkit,
@@ -129,6 +130,10 @@ func ProcessDocumentsByType(
 	embedder Embedder,
 	startIndex int,
 ) ([]*Document, map[string]any, error) {
+	if language := DetectCodeLanguage(docReader.path(), docReader.ContentType); language != "" {
+		return ProcessDocumentsFromCode(ctx, docReader.Content, logger, config, embedder, language, docReader.path())
+	}
+
 	switch docReader.ContentType {
 	case "application/pdf":
 		return ProcessDocumentsFromPDF(ctx, g, docReader.Content, logger, config, embedder)
@@ -139,16 +144,35 @@ func ProcessDocumentsByType(
 	case "application/json", "text/json":
 		return ProcessDocumentsFromJSON(ctx, docReader.Content, logger, embedder, startIndex)
 
-	case "text/plain":
-		return ProcessDocumentsFromText(ctx, docReader.Content, logger, embedder, startIndex)
+	case "text/html", "application/xhtml+xml":
+		return ProcessDocumentsFromHTML(ctx, docReader.Content, logger, config, embedder)
+
+	case MIMETypeDOCX:
+		return ProcessDocumentsFromDOCX(ctx, docReader.Content, logger, config, embedder)
+
+	case MIMETypeXLSX:
+		return ProcessDocumentsFromXLSX(ctx, docReader.Content, logger, embedder)
+
+	case MIMETypePPTX:
+		return ProcessDocumentsFromPPTX(ctx, docReader.Content, logger, embedder)
 
 	case "text/markdown":
-		return ProcessDocumentsFromMarkdown(ctx, docReader.Content, logger, embedder, startIndex)
+		chunker, err := chunkerFor(config, docReader.ContentType)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ProcessDocumentsFromMarkdownWithChunker(ctx, docReader.Content, logger, embedder, chunker)
 
 	default:
-		// Try to process as plain text for unknown types
-		logger.Warn("Unknown content type, processing as plain text", "content_type", docReader.ContentType)
-		return ProcessDocumentsFromText(ctx, docReader.Content, logger, embedder, startIndex)
+		if docReader.ContentType != "text/plain" {
+			// Try to process as plain text for unknown types
+			logger.Warn("Unknown content type, processing as plain text", "content_type", docReader.ContentType)
+		}
+		chunker, err := chunkerFor(config, docReader.ContentType)
+		if err != nil {
+			return nil, nil, err
+		}
+		return ProcessDocumentsFromTextWithChunker(ctx, docReader.Content, logger, embedder, chunker)
 	}
 }
 
@@ -361,13 +385,28 @@ func processJSONObject(
 	return documents, metadata, nil
 }
 
-// ProcessDocumentsFromText processes plain text content
+// ProcessDocumentsFromText processes plain text content with the default chunking of text
 func ProcessDocumentsFromText(
 	ctx context.Context,
 	reader io.Reader,
 	logger *slog.Logger,
 	embedder Embedder,
 	startIndex int,
+) ([]*Document, map[string]any, error) {
+	chunker, err := chunkerFor(nil, "text/plain")
+	if err != nil {
+		return nil, nil, err
+	}
+	return ProcessDocumentsFromTextWithChunker(ctx, reader, logger, embedder, chunker)
+}
+
+// ProcessDocumentsFromTextWithChunker processes plain text content split by the chunker
+func ProcessDocumentsFromTextWithChunker(
+	ctx context.Context,
+	reader io.Reader,
+	logger *slog.Logger,
+	embedder Embedder,
+	chunker Chunker,
 ) ([]*Document, map[string]any, error) {
 	data, err := io.ReadAll(reader)
 	if err != nil {
@@ -379,26 +418,9 @@ func ProcessDocumentsFromText(
 		return nil, nil, errors.New("empty text content")
 	}
 
-	// Split text into chunks (simple split by paragraphs)
-	chunks := splitTextIntoChunks(text, 1000) // 1000 character chunks
-
-	documents := make([]*Document, 0, len(chunks))
-	for i, chunk := range chunks {
-		if strings.TrimSpace(chunk) == "" {
-			continue
-		}
-
-		doc := &Document{
-			Content: Content{
-				Text:     chunk,
-				MIMEType: "text/plain",
-			},
-			EmbeddingText: chunk,
-			Metadata: map[string]any{
-				"chunk_number": i + 1,
-			},
-		}
-		documents = append(documents, doc)
+	documents, err := embedChunks(ctx, chunker.Chunk(text), "text/plain", "chunk_number", embedder)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to process text")
 	}
 
 	metadata := map[string]any{
@@ -407,41 +429,33 @@ func ProcessDocumentsFromText(
 		"chunk_count": len(documents),
 	}
 
-	if len(documents) == 0 {
-		return nil, nil, errors.New("no valid content found in text")
-	}
-
-	// Generate embeddings
-	embeddingTexts := make([]string, len(documents))
-	for i, doc := range documents {
-		embeddingTexts[i] = doc.EmbeddingText
-	}
-
-	embeddings, err := embedder.EmbedTexts(ctx, EmbeddingTaskTypeDocument, embeddingTexts...)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to generate embeddings for text")
-	}
-
-	if len(embeddings) != len(documents) {
-		return nil, nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(documents))
-	}
-
-	// Assign embeddings
-	for i := range documents {
-		documents[i].Embeddings = embeddings[i]
-	}
-
 	logger.Info("Processed text", "chunks", len(documents), "chars", len(text))
 	return documents, metadata, nil
 }
 
-// ProcessDocumentsFromMarkdown processes markdown content (similar to text but with markdown awareness)
+// ProcessDocumentsFromMarkdown processes markdown content with the default chunking of markdown, which splits it
+// into its sections
 func ProcessDocumentsFromMarkdown(
 	ctx context.Context,
 	reader io.Reader,
 	logger *slog.Logger,
 	embedder Embedder,
 	startIndex int,
+) ([]*Document, map[string]any, error) {
+	chunker, err := chunkerFor(nil, "text/markdown")
+	if err != nil {
+		return nil, nil, err
+	}
+	return ProcessDocumentsFromMarkdownWithChunker(ctx, reader, logger, embedder, chunker)
+}
+
+// ProcessDocumentsFromMarkdownWithChunker processes markdown content split by the chunker
+func ProcessDocumentsFromMarkdownWithChunker(
+	ctx context.Context,
+	reader io.Reader,
+	logger *slog.Logger,
+	embedder Embedder,
+	chunker Chunker,
 ) ([]*Document, map[string]any, error) {
 	data, err := io.ReadAll(reader)
 	if err != nil {
@@ -453,39 +467,61 @@ func ProcessDocumentsFromMarkdown(
 		return nil, nil, errors.New("empty markdown content")
 	}
 
-	// Split markdown by headers and sections
-	chunks := splitMarkdownIntoChunks(text)
+	documents, err := embedChunks(ctx, chunker.Chunk(text), "text/markdown", "section_number", embedder)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to process markdown")
+	}
 
+	metadata := map[string]any{
+		"source_type":   SourceTypeMarkdown,
+		"total_chars":   len(text),
+		"section_count": len(documents),
+	}
+
+	logger.Info("Processed markdown", "sections", len(documents), "chars", len(text))
+	return documents, metadata, nil
+}
+
+// embedChunks returns the documents of the chunks with their embeddings, numbered from 1 in the metadata key
+func embedChunks(ctx context.Context, chunks []Chunk, mimeType string, numberKey string, embedder Embedder) ([]*Document, error) {
 	documents := make([]*Document, 0, len(chunks))
 	for i, chunk := range chunks {
-		if strings.TrimSpace(chunk) == "" {
-			continue
+		metadata := map[string]any{
+			numberKey:             i + 1,
+			MetadataKeyTokenCount: EstimateTokens(chunk.Text),
 		}
-
-		doc := &Document{
+		if len(chunk.HeadingPath) > 0 {
+			metadata[MetadataKeyHeadingPath] = chunk.HeadingPath
+		}
+		if chunk.Symbol != "" {
+			metadata[MetadataKeySymbol] = chunk.Symbol
+		}
+		if chunk.StartLine > 0 {
+			metadata[MetadataKeyStartLine] = chunk.StartLine
+			metadata[MetadataKeyEndLine] = chunk.EndLine
+		}
+		documents = append(documents, &Document{
 			Content: Content{
-				Text:     chunk,
-				MIMEType: "text/markdown",
+				Text:     chunk.Text,
+				MIMEType: mimeType,
 			},
-			EmbeddingText: chunk,
-			Metadata: map[string]any{
-				"section_number": i + 1,
-			},
-		}
-		documents = append(documents, doc)
+			EmbeddingText: chunk.Text,
+			Metadata:      metadata,
+		})
 	}
 
-	metadata := map[string]any{
-		"source_type":   SourceTypeMarkdown,
-		"total_chars":   len(text),
-		"section_count": len(documents),
+	if len(documents) == 0 {
+		return nil, errors.New("no valid content found")
 	}
 
-	if len(documents) == 0 {
-		return nil, nil, errors.New("no valid content found in markdown")
+	if err := embedDocuments(ctx, documents, embedder); err != nil {
+		return nil, err
 	}
+	return documents, nil
+}
 
-	// Generate embeddings
+// embedDocuments sets the embeddings of the embedding texts of the documents
+func embedDocuments(ctx context.Context, documents []*Document, embedder Embedder) error {
 	embeddingTexts := make([]string, len(documents))
 	for i, doc := range documents {
 		embeddingTexts[i] = doc.EmbeddingText
@@ -493,26 +529,41 @@ func ProcessDocumentsFromMarkdown(
 
 	embeddings, err := embedder.EmbedTexts(ctx, EmbeddingTaskTypeDocument, embeddingTexts...)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to generate embeddings for markdown")
+		return errors.Wrap(err, "failed to generate embeddings")
 	}
 
 	if len(embeddings) != len(documents) {
-		return nil, nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(documents))
+		return errors.Errorf("embedding count mismatch: got %d, expected %d", len(embeddings), len(documents))
 	}
 
 	// Assign embeddings
 	for i := range documents {
 		documents[i].Embeddings = embeddings[i]
 	}
+	return nil
+}
 
-	logger.Info("Processed markdown", "sections", len(documents), "chars", len(text))
-	return documents, metadata, nil
+// setDocumentMetadata sets the non-empty values in the metadata of the source and of each of its documents
+func setDocumentMetadata(documents []*Document, metadata map[string]any, values map[string]string) {
+	for key, value := range values {
+		if value == "" {
+			continue
+		}
+		metadata[key] = value
+		for _, doc := range documents {
+			doc.Metadata[key] = value
+		}
+	}
 }
 
 // Helper functions
 
-func getSourceTypeFromContentType(contentType string) string {
-	switch contentType {
+func getSourceType(docReader *DocumentReader) string {
+	if DetectCodeLanguage(docReader.path(), docReader.ContentType) != "" {
+		return SourceTypeCode
+	}
+
+	switch docReader.ContentType {
 	case "application/pdf":
 		return SourceTypePDF
 	case "text/csv":
@@ -521,98 +572,17 @@ func getSourceTypeFromContentType(contentType string) string {
 		return SourceTypeJSON
 	case "text/markdown":
 		return SourceTypeMarkdown
+	case "text/html", "application/xhtml+xml":
+		return SourceTypeHTML
+	case MIMETypeDOCX:
+		return SourceTypeDOCX
+	case MIMETypeXLSX:
+		return SourceTypeXLSX
+	case MIMETypePPTX:
+		return SourceTypePPTX
 	case "text/plain":
 		return SourceTypeText
 	default:
 		return SourceTypeText
 	}
 }
-
-func splitTextIntoChunks(text string, maxChunkSize int) []string {
-	if len(text) <= maxChunkSize {
-		return []string{text}
-	}
-
-	chunks := make([]string, 0)
-	paragraphs := strings.Split(text, "\n\n")
-
-	currentChunk := ""
-	for _, paragraph := range paragraphs {
-		if len(currentChunk)+len(paragraph)+2 <= maxChunkSize {
-			if currentChunk != "" {
-				currentChunk += "\n\n"
-			}
-			currentChunk += paragraph
-		} else {
-			if currentChunk != "" {
-				chunks = append(chunks, currentChunk)
-			}
-			// If paragraph is too long, split it by sentences
-			if len(paragraph) > maxChunkSize {
-				sentences := strings.Split(paragraph, ". ")
-				currentChunk = ""
-				for _, sentence := range sentences {
-					if len(currentChunk)+len(sentence)+2 <= maxChunkSize {
-						if currentChunk != "" {
-							currentChunk += ". "
-						}
-						currentChunk += sentence
-					} else {
-						if currentChunk != "" {
-							chunks = append(chunks, currentChunk)
-						}
-						currentChunk = sentence
-					}
-				}
-			} else {
-				currentChunk = paragraph
-			}
-		}
-	}
-
-	if currentChunk != "" {
-		chunks = append(chunks, currentChunk)
-	}
-
-	return chunks
-}
-
-func splitMarkdownIntoChunks(text string) []string {
-	lines := strings.Split(text, "\n")
-	chunks := make([]string, 0)
-
-	currentChunk := ""
-	currentLevel := 0
-
-	for _, line := range lines {
-		// Check if this is a header
-		if strings.HasPrefix(line, "#") {
-			headerLevel := 0
-			for _, char := range line {
-				if char == '#' {
-					headerLevel++
-				} else {
-					break
-				}
-			}
-
-			// If we have a new section at same or higher level, start new chunk
-			if headerLevel <= currentLevel && currentChunk != "" {
-				chunks = append(chunks, strings.TrimSpace(currentChunk))
-				currentChunk = ""
-			}
-			currentLevel = headerLevel
-		}
-
-		if currentChunk != "" {
-			currentChunk += "\n"
-		}
-		currentChunk += line
-	}
-
-	if currentChunk != "" {
-		chunks = append(chunks, strings.TrimSpace(currentChunk))
-	}
-
-	return chunks
-}
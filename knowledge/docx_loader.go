@@ -0,0 +1,364 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+)
+
+// docxHeadingStylePattern matches the names of the built-in heading styles of Word, with their level
+var docxHeadingStylePattern = regexp.MustCompile(`(?i)^heading\s*([1-9])$`)
+
+type (
+	docxConverter struct {
+		// headingLevels are the heading levels of the paragraph styles, by style ID
+		headingLevels map[string]int
+		// orderedLists reports which levels of the numberings are numbered rather than bulleted, by numbering ID
+		orderedLists map[string]map[int]bool
+		// links are the URLs of the hyperlinks, by relationship ID
+		links map[string]string
+		// counters are the numbers of the next items of the numbered lists, by numbering ID and level
+		counters map[string][]int
+		// listIndents are the indents of the items of the current list, by level
+		listIndents []string
+	}
+
+	// docxBlock is a block of markdown of a document
+	docxBlock struct {
+		text string
+		// listItem blocks are joined to the adjacent list items without a blank line
+		listItem bool
+	}
+
+	// docxRun is text of a paragraph with its formatting
+	docxRun struct {
+		text         string
+		bold, italic bool
+		link         string
+	}
+)
+
+// ProcessDocumentsFromDOCX processes a Word document: its text is converted to markdown, with headings, lists and
+// tables, and chunked by the chunking the config selects for DOCX. The core properties of the document, such as its
+// title and author, are added to the metadata of the chunks
+func ProcessDocumentsFromDOCX(
+	ctx context.Context,
+	reader io.Reader,
+	logger *slog.Logger,
+	config *config.KnowledgeConfig,
+	embedder Embedder,
+) ([]*Document, map[string]any, error) {
+	chunker, err := chunkerFor(config, MIMETypeDOCX)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pkg, err := openOfficePackage(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	markdown, err := convertDOCX(pkg)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to convert DOCX")
+	}
+	if markdown == "" {
+		return nil, nil, errors.New("no content found in DOCX")
+	}
+
+	documents, err := embedChunks(ctx, chunker.Chunk(markdown), "text/markdown", "section_number", embedder)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to process DOCX")
+	}
+
+	metadata := map[string]any{
+		"source_type":   SourceTypeDOCX,
+		"total_chars":   len(markdown),
+		"section_count": len(documents),
+	}
+	setDocumentMetadata(documents, metadata, pkg.properties())
+
+	logger.Info("Processed DOCX", "sections", len(documents), "chars", len(markdown))
+	return documents, metadata, nil
+}
+
+// convertDOCX returns the body of the main document of the package as markdown
+func convertDOCX(pkg *officePackage) (string, error) {
+	name, err := pkg.mainPart("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+	document, err := pkg.parse(name)
+	if err != nil {
+		return "", err
+	}
+	relationships, err := pkg.relationships(name)
+	if err != nil {
+		return "", err
+	}
+
+	converter := &docxConverter{
+		headingLevels: make(map[string]int),
+		orderedLists:  make(map[string]map[int]bool),
+		links:         make(map[string]string),
+		counters:      make(map[string][]int),
+	}
+	for id, relationship := range relationships {
+		switch {
+		case strings.HasSuffix(relationship.Type, "/hyperlink") && relationship.External:
+			converter.links[id] = relationship.Target
+		case strings.HasSuffix(relationship.Type, "/styles"):
+			if styles, err := pkg.parse(relationship.Target); err == nil {
+				converter.readStyles(styles)
+			}
+		case strings.HasSuffix(relationship.Type, "/numbering"):
+			if numbering, err := pkg.parse(relationship.Target); err == nil {
+				converter.readNumbering(numbering)
+			}
+		}
+	}
+
+	var markdown strings.Builder
+	var previous *docxBlock
+	for _, block := range converter.blocks(document.child("body")) {
+		if previous != nil {
+			if previous.listItem && block.listItem {
+				markdown.WriteString("\n")
+			} else {
+				markdown.WriteString("\n\n")
+			}
+		}
+		markdown.WriteString(block.text)
+		previous = &block
+	}
+	return markdown.String(), nil
+}
+
+// readStyles reads the heading levels of the paragraph styles, from their names or outline levels
+func (c *docxConverter) readStyles(styles *xmlElement) {
+	for _, style := range styles.children("style") {
+		if style.attr("type") != "paragraph" {
+			continue
+		}
+		id := style.attr("styleId")
+		name := style.child("name").attr("val")
+		if match := docxHeadingStylePattern.FindStringSubmatch(name); match != nil {
+			c.headingLevels[id], _ = strconv.Atoi(match[1])
+		} else if strings.EqualFold(name, "title") {
+			c.headingLevels[id] = 1
+		} else if level, err := strconv.Atoi(style.path("pPr", "outlineLvl").attr("val")); err == nil && level < 6 {
+			c.headingLevels[id] = level + 1
+		}
+	}
+}
+
+// readNumbering reads which levels of the numberings are numbered, the others are bulleted
+func (c *docxConverter) readNumbering(numbering *xmlElement) {
+	abstracts := make(map[string]map[int]bool)
+	for _, abstract := range numbering.children("abstractNum") {
+		levels := make(map[int]bool)
+		for _, level := range abstract.children("lvl") {
+			ilvl, _ := strconv.Atoi(level.attr("ilvl"))
+			format := level.child("numFmt").attr("val")
+			levels[ilvl] = format != "" && format != "bullet" && format != "none"
+		}
+		abstracts[abstract.attr("abstractNumId")] = levels
+	}
+	for _, num := range numbering.children("num") {
+		c.orderedLists[num.attr("numId")] = abstracts[num.child("abstractNumId").attr("val")]
+	}
+}
+
+// blocks returns the blocks of the paragraphs and tables of the body, or of a content control in it
+func (c *docxConverter) blocks(body *xmlElement) []docxBlock {
+	var blocks []docxBlock
+	for _, element := range body.Children {
+		switch element.XMLName.Local {
+		case "p":
+			if block, ok := c.paragraph(element); ok {
+				blocks = append(blocks, block)
+			}
+		case "tbl":
+			c.listIndents = nil
+			if table := c.table(element); table != "" {
+				blocks = append(blocks, docxBlock{text: table})
+			}
+		case "sdt":
+			blocks = append(blocks, c.blocks(element.child("sdtContent"))...)
+		}
+	}
+	return blocks
+}
+
+// paragraph returns the block of a paragraph: a heading, a list item or text
+func (c *docxConverter) paragraph(p *xmlElement) (docxBlock, bool) {
+	properties := p.child("pPr")
+	text := formatParagraph(c.runs(p))
+	if text == "" {
+		return docxBlock{}, false
+	}
+
+	level, heading := c.headingLevels[properties.child("pStyle").attr("val")]
+	if outline, err := strconv.Atoi(properties.child("outlineLvl").attr("val")); err == nil && outline < 6 {
+		level, heading = outline+1, true
+	}
+	if heading {
+		c.listIndents = nil
+		return docxBlock{text: strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "\n", " ")}, true
+	}
+
+	numbering := properties.child("numPr")
+	numId := numbering.child("numId").attr("val")
+	if numbering == nil || numId == "" || numId == "0" {
+		c.listIndents = nil
+		return docxBlock{text: text}, true
+	}
+
+	ilvl, _ := strconv.Atoi(numbering.child("ilvl").attr("val"))
+	ilvl = min(max(ilvl, 0), 8)
+	counters := c.counters[numId]
+	for len(counters) <= ilvl {
+		counters = append(counters, 1)
+	}
+	// Items of a level restart the numbering of the levels under it
+	for i := ilvl + 1; i < len(counters); i++ {
+		counters[i] = 1
+	}
+	marker := "- "
+	if c.orderedLists[numId][ilvl] {
+		marker = fmt.Sprintf("%d. ", counters[ilvl])
+		counters[ilvl]++
+	}
+	c.counters[numId] = counters
+
+	// Nested items are indented to the text of the item they are nested in
+	for len(c.listIndents) < ilvl {
+		c.listIndents = append(c.listIndents, "  ")
+	}
+	indent := strings.Join(c.listIndents[:ilvl], "")
+	c.listIndents = append(c.listIndents[:ilvl], strings.Repeat(" ", len(marker)))
+
+	lines := strings.Split(text, "\n")
+	for i := range lines {
+		if i == 0 {
+			lines[i] = indent + marker + lines[i]
+		} else {
+			lines[i] = indent + strings.Repeat(" ", len(marker)) + lines[i]
+		}
+	}
+	return docxBlock{text: strings.Join(lines, "\n"), listItem: true}, true
+}
+
+// runs returns the inline markdown of the runs of a paragraph, with bold, italic and links
+func (c *docxConverter) runs(p *xmlElement) string {
+	var runs []docxRun
+	c.collectRuns(p, "", &runs)
+
+	// Adjacent runs of the same formatting are merged, so that formatting marks are not repeated between them
+	var merged []docxRun
+	for _, run := range runs {
+		if last := len(merged) - 1; last >= 0 && merged[last].bold == run.bold && merged[last].italic == run.italic && merged[last].link == run.link {
+			merged[last].text += run.text
+			continue
+		}
+		merged = append(merged, run)
+	}
+
+	var text strings.Builder
+	for i := 0; i < len(merged); i++ {
+		run := merged[i]
+		if run.link == "" {
+			text.WriteString(formatRun(run))
+			continue
+		}
+		// The runs of a link may be formatted differently
+		var link strings.Builder
+		for ; i < len(merged) && merged[i].link == run.link; i++ {
+			link.WriteString(formatRun(merged[i]))
+		}
+		i--
+		label := strings.TrimSpace(strings.ReplaceAll(link.String(), "\n", " "))
+		if label == "" {
+			continue
+		}
+		text.WriteString(fmt.Sprintf("[%s](%s)", label, strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(run.link)))
+	}
+	return text.String()
+}
+
+func (c *docxConverter) collectRuns(element *xmlElement, link string, runs *[]docxRun) {
+	for _, child := range element.Children {
+		switch child.XMLName.Local {
+		case "r":
+			properties := child.child("rPr")
+			run := docxRun{
+				bold:   properties.child("b").isOn(),
+				italic: properties.child("i").isOn(),
+				link:   link,
+			}
+			var text strings.Builder
+			for _, content := range child.Children {
+				switch content.XMLName.Local {
+				case "t":
+					text.WriteString(content.Text)
+				case "tab":
+					text.WriteString(" ")
+				case "br", "cr":
+					text.WriteString("\n")
+				case "noBreakHyphen":
+					text.WriteString("-")
+				}
+			}
+			run.text = text.String()
+			*runs = append(*runs, run)
+		case "hyperlink":
+			c.collectRuns(child, c.links[child.relationshipId()], runs)
+		case "pPr", "del", "moveFrom":
+		default:
+			// Runs are also in tracked insertions, fields, smart tags and content controls
+			c.collectRuns(child, link, runs)
+		}
+	}
+}
+
+// table returns a table as markdown, with the paragraphs of its cells joined
+func (c *docxConverter) table(tbl *xmlElement) string {
+	var rows [][]string
+	for _, tr := range tbl.children("tr") {
+		var row []string
+		empty := true
+		for _, tc := range tr.children("tc") {
+			var paragraphs []string
+			for _, p := range tc.descendants("p") {
+				if text := formatParagraph(c.runs(p)); text != "" {
+					paragraphs = append(paragraphs, text)
+				}
+			}
+			cell := strings.Join(paragraphs, " ")
+			empty = empty && cell == ""
+			row = append(row, cell)
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+	return markdownTable(rows)
+}
+
+// formatRun returns the text of a run with the marks of its formatting
+func formatRun(run docxRun) string {
+	text := run.text
+	if run.bold {
+		text = emphasize(text, "**")
+	}
+	if run.italic {
+		text = emphasize(text, "*")
+	}
+	return text
+}
@@ -2,9 +2,15 @@ package knowledge
 
 import (
 	_ "embed"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
+	"github.com/habiliai/agentruntime/config"
+	xgenkit "github.com/habiliai/agentruntime/internal/genkit"
 	"github.com/joho/godotenv"
 	"github.com/stretchr/testify/require"
 )
@@ -204,3 +210,101 @@ func TestEmbedder_EmbedImageFiles(t *testing.T) {
 		require.Len(t, embeddings[0], 768)
 	})
 }
+
+func TestHashEmbedder(t *testing.T) {
+	embedder := NewHashEmbedder(64)
+	require.Equal(t, 64, embedder.GetEmbedSize())
+
+	embeddings, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeDocument,
+		"The weather in Seoul is sunny",
+		"the WEATHER in seoul, is sunny!",
+		"Quarterly revenue grew by ten percent",
+	)
+	require.NoError(t, err)
+	require.Len(t, embeddings, 3)
+	require.Len(t, embeddings[0], 64)
+
+	// Case and punctuation are ignored, and the embeddings are deterministic
+	require.Equal(t, embeddings[0], embeddings[1])
+	again, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeQuery, "The weather in Seoul is sunny")
+	require.NoError(t, err)
+	require.Equal(t, embeddings[0], again[0])
+
+	query, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeQuery, "sunny weather")
+	require.NoError(t, err)
+	require.Greater(t, cosineSimilarity(query[0], embeddings[0]), cosineSimilarity(query[0], embeddings[2]))
+	require.InDelta(t, 1.0, cosineSimilarity(embeddings[0], embeddings[0]), 1e-5)
+
+	require.Equal(t, DefaultHashEmbedderDimension, NewHashEmbedder(0).GetEmbedSize())
+}
+
+func TestOpenAICompatibleEmbedder(t *testing.T) {
+	var received struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/embeddings", r.URL.Path)
+		authorization = r.Header.Get("Authorization")
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		// The embeddings are returned out of order
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1,0]},{"index":0,"embedding":[1,0,0]}]}`))
+	}))
+	defer server.Close()
+
+	embedder, err := NewEmbedderFromConfig(nil, &config.KnowledgeConfig{
+		EmbedderProvider:  config.EmbedderProviderOpenAICompatible,
+		EmbedderBaseURL:   server.URL + "/v1/",
+		EmbedderAPIKey:    "local-key",
+		EmbedderModel:     "nomic-embed-text",
+		EmbedderDimension: 3,
+	}, server.Client())
+	require.NoError(t, err)
+	require.Equal(t, 3, embedder.GetEmbedSize())
+
+	embeddings, err := embedder.EmbedTexts(t.Context(), EmbeddingTaskTypeDocument, "first", "second")
+	require.NoError(t, err)
+	require.Equal(t, [][]float32{{1, 0, 0}, {0, 1, 0}}, embeddings)
+	require.Equal(t, "nomic-embed-text", received.Model)
+	require.Equal(t, []string{"first", "second"}, received.Input)
+	require.Equal(t, "Bearer local-key", authorization)
+
+	// The size of the embeddings must match the dimension
+	mismatched, err := NewOpenAICompatibleEmbedder(server.Client(), server.URL+"/v1", "", "nomic-embed-text", 768)
+	require.NoError(t, err)
+	_, err = mismatched.EmbedTexts(t.Context(), EmbeddingTaskTypeDocument, "first", "second")
+	require.ErrorContains(t, err, "does not match the dimension")
+}
+
+func TestNewEmbedderFromConfig(t *testing.T) {
+	embedder, err := NewEmbedderFromConfig(nil, config.NewKnowledgeConfig(), nil)
+	require.NoError(t, err)
+	require.IsType(t, &NomicEmbedder{}, embedder)
+	_, err = asImageEmbedder(embedder)
+	require.NoError(t, err)
+
+	embedder, err = NewEmbedderFromConfig(nil, &config.KnowledgeConfig{EmbedderProvider: config.EmbedderProviderHash}, nil)
+	require.NoError(t, err)
+	_, err = asImageEmbedder(embedder)
+	require.ErrorContains(t, err, "does not embed images")
+
+	// The OpenAI embedders are only registered with an OpenAI API key
+	g := xgenkit.NewGenkit(t.Context(), &config.ModelConfig{}, slog.Default(), false)
+	_, err = NewEmbedderFromConfig(g, &config.KnowledgeConfig{EmbedderProvider: config.EmbedderProviderOpenAI}, nil)
+	require.ErrorContains(t, err, "embedder openai/text-embedding-3-small not found")
+
+	for name, conf := range map[string]*config.KnowledgeConfig{
+		"unknown provider":         {EmbedderProvider: "word2vec"},
+		"unknown nomic model":      {EmbedderProvider: config.EmbedderProviderNomic, EmbedderModel: "nomic-embed-text-v2"},
+		"compatible without model": {EmbedderProvider: config.EmbedderProviderOpenAICompatible, EmbedderBaseURL: "http://localhost:11434/v1", EmbedderDimension: 768},
+		"compatible without size":  {EmbedderProvider: config.EmbedderProviderOpenAICompatible, EmbedderBaseURL: "http://localhost:11434/v1", EmbedderModel: "nomic-embed-text"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewEmbedderFromConfig(nil, conf, nil)
+			require.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package knowledge
+
+import (
+	"cmp"
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter selects documents by their metadata. A filter is either a condition on a field, with exactly one of
+// Eq, In, Gt/Gte/Lt/Lte or Exists, or a combination of filters with And or Or:
+//
+//	{"and": [{"field": "source_type", "eq": "pdf"}, {"field": "page_number", "gte": 3, "lte": 10}]}
+//
+// Values are strings, numbers or booleans. A condition on a field holding a list matches if any of its items
+// matches. Ranges compare numbers with numbers and strings with strings, so ISO 8601 dates can be compared
+type Filter struct {
+	Field string `json:"field,omitempty"`
+
+	// Eq matches the field equal to the value
+	Eq any `json:"eq,omitempty"`
+	// In matches the field equal to any of the values
+	In []any `json:"in,omitempty"`
+	// Gt, Gte, Lt and Lte match the field in the range of the bounds that are set
+	Gt  any `json:"gt,omitempty"`
+	Gte any `json:"gte,omitempty"`
+	Lt  any `json:"lt,omitempty"`
+	Lte any `json:"lte,omitempty"`
+	// Exists matches the field set to a value other than null, or not set if false
+	Exists *bool `json:"exists,omitempty"`
+
+	// And matches the documents matching all the filters
+	And []Filter `json:"and,omitempty"`
+	// Or matches the documents matching any of the filters
+	Or []Filter `json:"or,omitempty"`
+}
+
+// FieldEq matches the field equal to value
+func FieldEq(field string, value any) Filter {
+	return Filter{Field: field, Eq: value}
+}
+
+// FieldIn matches the field equal to any of values
+func FieldIn(field string, values ...any) Filter {
+	return Filter{Field: field, In: values}
+}
+
+// FieldRange matches the field between gte and lte inclusive. A nil bound is open
+func FieldRange(field string, gte, lte any) Filter {
+	return Filter{Field: field, Gte: gte, Lte: lte}
+}
+
+// FieldExists matches the field set to a value other than null
+func FieldExists(field string) Filter {
+	exists := true
+	return Filter{Field: field, Exists: &exists}
+}
+
+// And matches the documents matching all of filters
+func And(filters ...Filter) Filter {
+	return Filter{And: filters}
+}
+
+// Or matches the documents matching any of filters
+func Or(filters ...Filter) Filter {
+	return Filter{Or: filters}
+}
+
+// ParseFilter parses a filter from its JSON form and validates it
+func ParseFilter(data []byte) (*Filter, error) {
+	var filter Filter
+	if err := json.Unmarshal(data, &filter); err != nil {
+		return nil, errors.Wrapf(err, "invalid filter")
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return &filter, nil
+}
+
+func (f *Filter) hasRange() bool {
+	return f.Gt != nil || f.Gte != nil || f.Lt != nil || f.Lte != nil
+}
+
+// rangeBounds returns the bounds of the range that are set
+func (f *Filter) rangeBounds() []any {
+	var bounds []any
+	for _, bound := range []any{f.Gt, f.Gte, f.Lt, f.Lte} {
+		if bound != nil {
+			bounds = append(bounds, bound)
+		}
+	}
+	return bounds
+}
+
+// Validate checks that the filter is well formed
+func (f *Filter) Validate() error {
+	kinds := 0
+	for _, set := range []bool{f.Eq != nil, f.In != nil, f.hasRange(), f.Exists != nil, f.And != nil, f.Or != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return errors.New("filter must have exactly one of eq, in, a range, exists, and, or")
+	}
+
+	switch {
+	case f.And != nil || f.Or != nil:
+		if f.Field != "" {
+			return errors.New("and and or filters do not take a field")
+		}
+		for i := range f.And {
+			if err := f.And[i].Validate(); err != nil {
+				return err
+			}
+		}
+		for i := range f.Or {
+			if err := f.Or[i].Validate(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if f.Field == "" {
+		return errors.New("filter field is required")
+	}
+	if strings.ContainsAny(f.Field, `"\`) {
+		return errors.Errorf("invalid filter field %s", f.Field)
+	}
+
+	switch {
+	case f.Eq != nil:
+		return validateFilterValue(f.Field, f.Eq)
+	case f.In != nil:
+		if len(f.In) == 0 {
+			return errors.Errorf("in filter on %s needs values", f.Field)
+		}
+		for _, value := range f.In {
+			if err := validateFilterValue(f.Field, value); err != nil {
+				return err
+			}
+		}
+	case f.hasRange():
+		numbers, strs := 0, 0
+		for _, bound := range f.rangeBounds() {
+			if _, ok := filterNumber(bound); ok {
+				numbers++
+			} else if _, ok := bound.(string); ok {
+				strs++
+			} else {
+				return errors.Errorf("range filter on %s takes numbers or strings, got %T", f.Field, bound)
+			}
+		}
+		if numbers > 0 && strs > 0 {
+			return errors.Errorf("range filter on %s mixes numbers and strings", f.Field)
+		}
+	}
+	return nil
+}
+
+func validateFilterValue(field string, value any) error {
+	switch value.(type) {
+	case string, bool:
+		return nil
+	}
+	if _, ok := filterNumber(value); ok {
+		return nil
+	}
+	return errors.Errorf("filter on %s takes strings, numbers or booleans, got %T", field, value)
+}
+
+// filterNumber returns the value as a float64 if it is a number
+func filterNumber(value any) (float64, bool) {
+	if n, ok := value.(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+// Matches reports whether the metadata matches the filter. A nil filter matches all metadata
+func (f *Filter) Matches(metadata map[string]any) bool {
+	if f == nil {
+		return true
+	}
+
+	switch {
+	case f.And != nil:
+		for i := range f.And {
+			if !f.And[i].Matches(metadata) {
+				return false
+			}
+		}
+		return true
+	case f.Or != nil:
+		for i := range f.Or {
+			if f.Or[i].Matches(metadata) {
+				return true
+			}
+		}
+		return false
+	}
+
+	value, ok := metadata[f.Field]
+	if f.Exists != nil {
+		return (ok && value != nil) == *f.Exists
+	}
+	if !ok || value == nil {
+		return false
+	}
+
+	// A list matches if any of its items does
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < v.Len(); i++ {
+			if f.matchesValue(v.Index(i).Interface()) {
+				return true
+			}
+		}
+		return false
+	}
+	return f.matchesValue(value)
+}
+
+func (f *Filter) matchesValue(value any) bool {
+	switch {
+	case f.Eq != nil:
+		return filterValuesEqual(value, f.Eq)
+	case f.In != nil:
+		for _, candidate := range f.In {
+			if filterValuesEqual(value, candidate) {
+				return true
+			}
+		}
+		return false
+	default:
+		return inFilterRange(value, f.Gt, 1, false) &&
+			inFilterRange(value, f.Gte, 1, true) &&
+			inFilterRange(value, f.Lt, -1, false) &&
+			inFilterRange(value, f.Lte, -1, true)
+	}
+}
+
+func filterValuesEqual(a, b any) bool {
+	if x, ok := filterNumber(a); ok {
+		y, ok := filterNumber(b)
+		return ok && x == y
+	}
+	return a == b
+}
+
+// inFilterRange reports whether value compares to bound with the sign, or equals it if orEqual
+func inFilterRange(value, bound any, sign int, orEqual bool) bool {
+	if bound == nil {
+		return true
+	}
+
+	var order int
+	if x, ok := filterNumber(value); ok {
+		y, ok := filterNumber(bound)
+		if !ok {
+			return false
+		}
+		order = cmp.Compare(x, y)
+	} else if x, ok := value.(string); ok {
+		y, ok := bound.(string)
+		if !ok {
+			return false
+		}
+		order = strings.Compare(x, y)
+	} else {
+		return false
+	}
+	return order == sign || (orEqual && order == 0)
+}
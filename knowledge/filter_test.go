@@ -0,0 +1,205 @@
+package knowledge_test
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFilter(t *testing.T) {
+	filter, err := knowledge.ParseFilter([]byte(`{"and": [{"field": "source_type", "eq": "pdf"}, {"field": "page_number", "gte": 3, "lte": 10}]}`))
+	require.NoError(t, err)
+	require.Len(t, filter.And, 2)
+	require.True(t, filter.Matches(map[string]any{"source_type": "pdf", "page_number": 3}))
+	require.False(t, filter.Matches(map[string]any{"source_type": "pdf", "page_number": 11}))
+
+	for name, data := range map[string]string{
+		"no condition":   `{"field": "source_type"}`,
+		"two conditions": `{"field": "source_type", "eq": "pdf", "in": ["md"]}`,
+		"no field":       `{"eq": "pdf"}`,
+		"and with field": `{"field": "source_type", "and": [{"field": "page_number", "eq": 1}]}`,
+		"empty in":       `{"field": "source_type", "in": []}`,
+		"object value":   `{"field": "source_type", "eq": {"a": 1}}`,
+		"mixed range":    `{"field": "page_number", "gte": 1, "lte": "z"}`,
+		"boolean range":  `{"field": "page_number", "gte": true}`,
+		"quoted field":   `{"field": "a\"b", "eq": 1}`,
+		"invalid nested": `{"or": [{"field": "source_type"}]}`,
+		"invalid json":   `{"field":`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := knowledge.ParseFilter([]byte(data))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestFilter_Matches(t *testing.T) {
+	metadata := map[string]any{
+		"source_type": "pdf",
+		"page_number": 4,
+		"score":       0.5,
+		"published":   "2024-03-01",
+		"draft":       false,
+		"tags":        []string{"billing", "faq"},
+		"reviewer":    nil,
+	}
+
+	notExists := false
+	for _, tt := range []struct {
+		name    string
+		filter  *knowledge.Filter
+		matches bool
+	}{
+		{name: "nil", filter: nil, matches: true},
+		{name: "eq", filter: &knowledge.Filter{Field: "source_type", Eq: "pdf"}, matches: true},
+		{name: "eq other", filter: &knowledge.Filter{Field: "source_type", Eq: "md"}, matches: false},
+		{name: "eq number of another type", filter: &knowledge.Filter{Field: "page_number", Eq: 4.0}, matches: true},
+		{name: "eq number as string", filter: &knowledge.Filter{Field: "page_number", Eq: "4"}, matches: false},
+		{name: "eq boolean", filter: &knowledge.Filter{Field: "draft", Eq: false}, matches: true},
+		{name: "in", filter: &knowledge.Filter{Field: "source_type", In: []any{"md", "pdf"}}, matches: true},
+		{name: "in list", filter: &knowledge.Filter{Field: "tags", In: []any{"faq", "legal"}}, matches: true},
+		{name: "eq list", filter: &knowledge.Filter{Field: "tags", Eq: "legal"}, matches: false},
+		{name: "range", filter: &knowledge.Filter{Field: "page_number", Gt: 3, Lte: 4}, matches: true},
+		{name: "range excluded bound", filter: &knowledge.Filter{Field: "page_number", Lt: 4}, matches: false},
+		{name: "range float", filter: &knowledge.Filter{Field: "score", Gte: 0.5}, matches: true},
+		{name: "range dates", filter: &knowledge.Filter{Field: "published", Gte: "2024-01-01", Lt: "2025-01-01"}, matches: true},
+		{name: "range of another type", filter: &knowledge.Filter{Field: "source_type", Gte: 1}, matches: false},
+		{name: "range missing", filter: &knowledge.Filter{Field: "chapter", Gte: 1}, matches: false},
+		{name: "exists", filter: &knowledge.Filter{Field: "draft", Exists: new(bool)}, matches: false},
+		{name: "exists null", filter: &knowledge.Filter{Field: "reviewer", Exists: &notExists}, matches: true},
+		{name: "and", filter: &knowledge.Filter{And: []knowledge.Filter{knowledge.FieldEq("source_type", "pdf"), knowledge.FieldRange("page_number", 5, nil)}}, matches: false},
+		{name: "or", filter: &knowledge.Filter{Or: []knowledge.Filter{knowledge.FieldEq("source_type", "md"), knowledge.FieldExists("tags")}}, matches: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.matches, tt.filter.Matches(metadata))
+		})
+	}
+}
+
+// newFilterTestKnowledge returns knowledge of the pages of two PDFs and of a markdown file, all mentioning invoices
+func newFilterTestKnowledge(t *testing.T, embedder knowledge.Embedder) *knowledge.Knowledge {
+	t.Helper()
+
+	kl := &knowledge.Knowledge{ID: "docs", Metadata: map[string]any{}}
+	for _, doc := range []struct {
+		id       string
+		metadata map[string]any
+	}{
+		{id: "guide-1", metadata: map[string]any{"source_type": "pdf", "source": "guide.pdf", "page_number": 1, "tags": []any{"billing"}}},
+		{id: "guide-2", metadata: map[string]any{"source_type": "pdf", "source": "guide.pdf", "page_number": 2, "tags": []any{"billing", "faq"}}},
+		{id: "guide-3", metadata: map[string]any{"source_type": "pdf", "source": "guide.pdf", "page_number": 3, "draft": true}},
+		{id: "terms-1", metadata: map[string]any{"source_type": "pdf", "source": "terms.pdf", "page_number": 1, "draft": false}},
+		{id: "notes", metadata: map[string]any{"source_type": "md", "source": "notes.md", "tags": []any{"faq"}}},
+	} {
+		text := "How invoices are paid, section " + doc.id
+		embeddings, err := embedder.EmbedTexts(context.Background(), knowledge.EmbeddingTaskTypeDocument, text)
+		require.NoError(t, err)
+		kl.Documents = append(kl.Documents, &knowledge.Document{
+			ID:            doc.id,
+			Content:       knowledge.Content{MIMEType: "text/plain", Text: text},
+			EmbeddingText: text,
+			Embeddings:    embeddings[0],
+			Metadata:      doc.metadata,
+		})
+	}
+	return kl
+}
+
+func TestStore_SearchWithFilter(t *testing.T) {
+	embedder := knowledge.NewHashEmbedder(64)
+
+	for name, newStore := range map[string]func(t *testing.T) knowledge.Store{
+		"memory": func(t *testing.T) knowledge.Store {
+			return knowledge.NewInMemoryStore()
+		},
+		"sqlite": func(t *testing.T) knowledge.Store {
+			store, err := knowledge.NewSqliteStore(filepath.Join(t.TempDir(), "knowledge.db"), embedder.GetEmbedSize())
+			require.NoError(t, err)
+			return store
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			defer store.Close()
+			require.NoError(t, store.Store(ctx, newFilterTestKnowledge(t, embedder)))
+
+			queryEmbeddings, err := embedder.EmbedTexts(ctx, knowledge.EmbeddingTaskTypeQuery, "invoices")
+			require.NoError(t, err)
+
+			notExists := false
+			for _, tt := range []struct {
+				name   string
+				filter knowledge.Filter
+				ids    []string
+			}{
+				{name: "eq", filter: knowledge.FieldEq("source_type", "md"), ids: []string{"notes"}},
+				{name: "in", filter: knowledge.FieldIn("source", "terms.pdf", "notes.md"), ids: []string{"notes", "terms-1"}},
+				{name: "range", filter: knowledge.FieldRange("page_number", 2, 3), ids: []string{"guide-2", "guide-3"}},
+				{name: "open range", filter: knowledge.Filter{Field: "page_number", Lt: 2}, ids: []string{"guide-1", "terms-1"}},
+				{name: "list", filter: knowledge.FieldEq("tags", "faq"), ids: []string{"guide-2", "notes"}},
+				{name: "boolean", filter: knowledge.FieldEq("draft", true), ids: []string{"guide-3"}},
+				{name: "exists", filter: knowledge.FieldExists("draft"), ids: []string{"guide-3", "terms-1"}},
+				{name: "not exists", filter: knowledge.Filter{Field: "page_number", Exists: &notExists}, ids: []string{"notes"}},
+				{name: "type mismatch", filter: knowledge.FieldEq("page_number", "1"), ids: nil},
+				{
+					name:   "and",
+					filter: knowledge.And(knowledge.FieldEq("source", "guide.pdf"), knowledge.FieldRange("page_number", nil, 2)),
+					ids:    []string{"guide-1", "guide-2"},
+				},
+				{
+					name:   "or",
+					filter: knowledge.Or(knowledge.FieldEq("source_type", "md"), knowledge.FieldEq("draft", false)),
+					ids:    []string{"notes", "terms-1"},
+				},
+			} {
+				t.Run(tt.name, func(t *testing.T) {
+					results, err := store.Search(ctx, queryEmbeddings[0], 10, nil, &tt.filter)
+					require.NoError(t, err)
+					require.ElementsMatch(t, tt.ids, resultIds(results))
+
+					results, err = store.(knowledge.KeywordSearcher).KeywordSearch(ctx, "invoices", 10, nil, &tt.filter)
+					require.NoError(t, err)
+					require.ElementsMatch(t, tt.ids, resultIds(results))
+				})
+			}
+
+			// The filter applies within the allowed knowledge
+			filter := knowledge.FieldEq("source_type", "md")
+			results, err := store.Search(ctx, queryEmbeddings[0], 10, []string{"other"}, &filter)
+			require.NoError(t, err)
+			require.Empty(t, results)
+		})
+	}
+}
+
+func TestRetrieveRelevantKnowledge_WithFilter(t *testing.T) {
+	ctx := context.Background()
+	embedder := knowledge.NewHashEmbedder(64)
+
+	conf := config.NewKnowledgeConfig()
+	conf.RerankEnabled = false
+	conf.SearchMode = config.SearchModeHybrid
+
+	store := knowledge.NewInMemoryStore()
+	require.NoError(t, store.Store(ctx, newFilterTestKnowledge(t, embedder)))
+	service, err := knowledge.NewServiceWithStore(ctx, conf, &config.ModelConfig{}, slog.Default(), store, knowledge.WithEmbedder(embedder))
+	require.NoError(t, err)
+
+	filter := knowledge.And(knowledge.FieldEq("source", "guide.pdf"), knowledge.FieldRange("page_number", 2, nil))
+	results, err := service.RetrieveRelevantKnowledge(ctx, "invoices", 10, nil, knowledge.WithFilter(&filter))
+	require.NoError(t, err)
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	require.ElementsMatch(t, []string{"guide-2", "guide-3"}, ids)
+
+	_, err = service.RetrieveRelevantKnowledge(ctx, "invoices", 10, nil, knowledge.WithFilter(&knowledge.Filter{Field: "source"}))
+	require.ErrorContains(t, err, "invalid filter")
+}
@@ -0,0 +1,61 @@
+package knowledge
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFuseRankings(t *testing.T) {
+	ranking := func(ids ...string) []KnowledgeSearchResult {
+		results := make([]KnowledgeSearchResult, len(ids))
+		for i, id := range ids {
+			results[i] = KnowledgeSearchResult{Document: &Document{ID: id}, Score: float32(100 - i)}
+		}
+		return results
+	}
+
+	// b is second in both rankings, which beats being first in one only
+	fused := fuseRankings(60,
+		rankedList{results: ranking("a", "b", "c"), weight: 1},
+		rankedList{results: ranking("d", "b", "a"), weight: 1},
+	)
+	ids := make([]string, len(fused))
+	for i, result := range fused {
+		ids[i] = result.ID
+	}
+	require.Equal(t, []string{"a", "b", "d", "c"}, ids)
+	require.InDelta(t, 1.0/61+1.0/63, fused[0].Score, 1e-6)
+
+	// Weights favor a ranking
+	fused = fuseRankings(60,
+		rankedList{results: ranking("a", "b"), weight: 1},
+		rankedList{results: ranking("b", "a"), weight: 2},
+	)
+	require.Equal(t, "b", fused[0].ID)
+
+	require.Empty(t, fuseRankings(60, rankedList{weight: 1}, rankedList{weight: 1}))
+}
+
+func TestBM25FromMatchInfo(t *testing.T) {
+	// Two phrases and two columns over 10 rows: the second phrase is absent from the row
+	values := []uint32{
+		2, 2, 10, // p, c, n
+		0, 8, // a
+		0, 4, // l
+		0, 0, 0, 2, 5, 3, // x of the first phrase
+		0, 0, 0, 0, 4, 2, // x of the second phrase
+	}
+	matchInfo := make([]byte, 0, len(values)*4)
+	for _, v := range values {
+		matchInfo = binary.NativeEndian.AppendUint32(matchInfo, v)
+	}
+
+	score, err := bm25FromMatchInfo(matchInfo)
+	require.NoError(t, err)
+	require.InDelta(t, bm25(2, 4, 8, 3, 10), score, 1e-9)
+
+	_, err = bm25FromMatchInfo(matchInfo[:20])
+	require.Error(t, err)
+}
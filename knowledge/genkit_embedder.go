@@ -0,0 +1,107 @@
+package knowledge
+
+import (
+	"context"
+	"math"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/pkg/errors"
+)
+
+// genkitEmbedderSizes are the sizes of the embedding models of the genkit plugins
+var genkitEmbedderSizes = map[string]int{
+	"openai/text-embedding-3-small": 1536,
+	"openai/text-embedding-3-large": 3072,
+	"openai/text-embedding-ada-002": 1536,
+}
+
+// GenkitEmbedder implements Embedder with an embedding model registered in genkit
+type GenkitEmbedder struct {
+	genkit    *genkit.Genkit
+	name      string
+	embedder  ai.Embedder
+	dimension int
+}
+
+var _ Embedder = (*GenkitEmbedder)(nil)
+
+// NewGenkitEmbedder creates an embedder with the genkit embedder name, such as "openai/text-embedding-3-small".
+// A dimension of zero is the size of the model. A smaller dimension truncates and normalizes the embeddings,
+// which keeps them meaningful for models trained for it like text-embedding-3
+func NewGenkitEmbedder(g *genkit.Genkit, name string, dimension int) (Embedder, error) {
+	embedder := genkit.LookupEmbedder(g, name)
+	if embedder == nil {
+		return nil, errors.Errorf("embedder %s not found, check that the API key of its provider is set", name)
+	}
+
+	modelSize := genkitEmbedderSizes[name]
+	switch {
+	case dimension < 0:
+		return nil, errors.Errorf("invalid embedding dimension %d", dimension)
+	case dimension == 0 && modelSize == 0:
+		return nil, errors.Errorf("unknown size of embedder %s, set the embedding dimension", name)
+	case dimension == 0:
+		dimension = modelSize
+	case modelSize > 0 && dimension > modelSize:
+		return nil, errors.Errorf("embedding dimension %d exceeds the size %d of embedder %s", dimension, modelSize, name)
+	}
+
+	return &GenkitEmbedder{
+		genkit:    g,
+		name:      name,
+		embedder:  embedder,
+		dimension: dimension,
+	}, nil
+}
+
+func (e *GenkitEmbedder) EmbedTexts(ctx context.Context, _ EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	resp, err := genkit.Embed(ctx, e.genkit, ai.WithTextDocs(texts...), ai.WithEmbedder(e.embedder))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to embed texts")
+	}
+	if len(resp.Embeddings) != len(texts) {
+		return nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(resp.Embeddings), len(texts))
+	}
+
+	embeddings := make([][]float32, len(resp.Embeddings))
+	for i, embedding := range resp.Embeddings {
+		switch {
+		case len(embedding.Embedding) == e.dimension:
+			embeddings[i] = embedding.Embedding
+		case len(embedding.Embedding) > e.dimension:
+			embeddings[i] = normalize(embedding.Embedding[:e.dimension])
+		default:
+			return nil, errors.Errorf("embedding size %d is smaller than the dimension %d", len(embedding.Embedding), e.dimension)
+		}
+	}
+	return embeddings, nil
+}
+
+func (e *GenkitEmbedder) EmbedderID() string {
+	return e.name
+}
+
+func (e *GenkitEmbedder) GetEmbedSize() int {
+	return e.dimension
+}
+
+// normalize scales the vector to unit length in place and returns it. The zero vector is left as is
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	if sum == 0 {
+		return vector
+	}
+	norm := float32(math.Sqrt(sum))
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector
+}
@@ -0,0 +1,63 @@
+package knowledge
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+	"unicode"
+)
+
+// DefaultHashEmbedderDimension is the size of the embeddings of NewHashEmbedder(0)
+const DefaultHashEmbedderDimension = 256
+
+// HashEmbedder implements Embedder without a model by hashing the words of the texts into the dimensions of
+// the embedding. Texts sharing words get similar embeddings, which is enough for offline tests of indexing and
+// search, but not for semantic search
+type HashEmbedder struct {
+	dimension int
+}
+
+var _ Embedder = (*HashEmbedder)(nil)
+
+// NewHashEmbedder creates a hashing embedder. A dimension of zero is DefaultHashEmbedderDimension
+func NewHashEmbedder(dimension int) Embedder {
+	if dimension <= 0 {
+		dimension = DefaultHashEmbedderDimension
+	}
+	return &HashEmbedder{dimension: dimension}
+}
+
+func (e *HashEmbedder) EmbedTexts(_ context.Context, _ EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = e.embed(text)
+	}
+	return embeddings, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	embedding := make([]float32, e.dimension)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(word))
+		sum := h.Sum64()
+		// The top bit signs the word, so that collisions cancel out rather than add up
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		embedding[sum%uint64(e.dimension)] += sign
+	}
+	return normalize(embedding)
+}
+
+func (e *HashEmbedder) EmbedderID() string {
+	return "hash"
+}
+
+func (e *HashEmbedder) GetEmbedSize() int {
+	return e.dimension
+}
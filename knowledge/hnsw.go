@@ -0,0 +1,384 @@
+package knowledge
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+const (
+	// DefaultHNSWM is the default number of neighbors of the nodes of an HNSW index
+	DefaultHNSWM = 16
+	// DefaultHNSWEfConstruction is the default number of candidate neighbors searched when inserting in an HNSW index
+	DefaultHNSWEfConstruction = 200
+	// DefaultHNSWEfSearch is the default number of candidates searched by a query of an HNSW index
+	DefaultHNSWEfSearch = 64
+)
+
+// hnswIndex is a hierarchical navigable small world graph of the embeddings of documents, which finds their
+// approximate nearest neighbors by cosine similarity in logarithmic time (Malkov and Yashunin, 2016)
+type hnswIndex struct {
+	// m is the number of neighbors of a node on the upper levels, and half the number on level 0
+	m int
+	// efConstruction is the number of candidate neighbors searched when inserting a node. Higher values build a
+	// better graph, more slowly
+	efConstruction int
+	// efSearch is the number of candidates searched by a query. Higher values find more of the nearest
+	// neighbors, more slowly
+	efSearch    int
+	levelFactor float64
+	rng         *rand.Rand
+
+	// nodes are indexed by node ID. Removed nodes are nil until the index is compacted
+	nodes    []*hnswNode
+	nodeIds  map[*Document]int32
+	entry    int32
+	maxLevel int
+	removed  int
+}
+
+type hnswNode struct {
+	knowledgeId string
+	doc         *Document
+	// vector is the normalized embedding of the document, so that the dot product is the cosine similarity
+	vector []float32
+	// neighbors are the node IDs of the neighbors of the node on each of its levels
+	neighbors [][]int32
+}
+
+// hnswCandidate is a node found by a search with its similarity to the query
+type hnswCandidate struct {
+	id         int32
+	similarity float32
+}
+
+// hnswQueue is a priority queue of candidates, either the nearest or the farthest first
+type hnswQueue struct {
+	items        []hnswCandidate
+	nearestFirst bool
+}
+
+func (q *hnswQueue) Len() int { return len(q.items) }
+func (q *hnswQueue) Less(i, j int) bool {
+	if q.nearestFirst {
+		return q.items[i].similarity > q.items[j].similarity
+	}
+	return q.items[i].similarity < q.items[j].similarity
+}
+func (q *hnswQueue) Swap(i, j int)      { q.items[i], q.items[j] = q.items[j], q.items[i] }
+func (q *hnswQueue) Push(x any)         { q.items = append(q.items, x.(hnswCandidate)) }
+func (q *hnswQueue) top() hnswCandidate { return q.items[0] }
+func (q *hnswQueue) Pop() any {
+	item := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return item
+}
+
+// newHNSWIndex creates an empty HNSW index, with the default value of the parameters that are not positive
+func newHNSWIndex(m, efConstruction, efSearch int) *hnswIndex {
+	if m <= 1 {
+		m = DefaultHNSWM
+	}
+	if efConstruction <= 0 {
+		efConstruction = DefaultHNSWEfConstruction
+	}
+	if efSearch <= 0 {
+		efSearch = DefaultHNSWEfSearch
+	}
+	return &hnswIndex{
+		m:              m,
+		efConstruction: efConstruction,
+		efSearch:       efSearch,
+		levelFactor:    1 / math.Log(float64(m)),
+		// A fixed seed builds the same graph from the same insertions
+		rng:     rand.New(rand.NewSource(1)),
+		nodeIds: make(map[*Document]int32),
+		entry:   -1,
+	}
+}
+
+// len returns the number of indexed documents
+func (h *hnswIndex) len() int {
+	return len(h.nodeIds)
+}
+
+// add inserts the document in the index, if it has embeddings
+func (h *hnswIndex) add(knowledgeId string, doc *Document) {
+	if len(doc.Embeddings) == 0 {
+		return
+	}
+	if _, exists := h.nodeIds[doc]; exists {
+		h.remove(doc)
+	}
+
+	level := int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelFactor))
+	id := int32(len(h.nodes))
+	h.nodes = append(h.nodes, &hnswNode{
+		knowledgeId: knowledgeId,
+		doc:         doc,
+		vector:      normalize(slices.Clone(doc.Embeddings)),
+		neighbors:   make([][]int32, level+1),
+	})
+	h.nodeIds[doc] = id
+	h.link(id)
+}
+
+// link connects the node to its nearest neighbors on each of its levels
+func (h *hnswIndex) link(id int32) {
+	node := h.nodes[id]
+	level := len(node.neighbors) - 1
+	if h.entry < 0 {
+		h.entry, h.maxLevel = id, level
+		return
+	}
+
+	entries := []hnswCandidate{{id: h.entry, similarity: dotProduct(node.vector, h.nodes[h.entry].vector)}}
+	for l := h.maxLevel; l > level; l-- {
+		entries = h.searchLayer(node.vector, entries, 1, l, nil)
+	}
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		found := h.searchLayer(node.vector, entries, h.efConstruction, l, nil)
+		node.neighbors[l] = h.selectNeighbors(found, h.m)
+		for _, neighbor := range node.neighbors[l] {
+			h.connect(neighbor, id, l)
+		}
+		if len(found) > 0 {
+			entries = found
+		}
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = id, level
+	}
+}
+
+// connect adds a neighbor to the node on the level, keeping the best neighbors if the node has too many
+func (h *hnswIndex) connect(id, neighbor int32, level int) {
+	node := h.nodes[id]
+	node.neighbors[level] = append(node.neighbors[level], neighbor)
+	if len(node.neighbors[level]) > h.maxConnections(level) {
+		node.neighbors[level] = h.selectNeighbors(h.candidates(node.vector, node.neighbors[level]), h.maxConnections(level))
+	}
+}
+
+// maxConnections returns the maximum number of neighbors of a node on the level
+func (h *hnswIndex) maxConnections(level int) int {
+	if level == 0 {
+		return 2 * h.m
+	}
+	return h.m
+}
+
+// candidates returns the live nodes among the IDs with their similarity to the vector, the nearest first
+func (h *hnswIndex) candidates(vector []float32, ids []int32) []hnswCandidate {
+	candidates := make([]hnswCandidate, 0, len(ids))
+	for _, id := range ids {
+		if h.nodes[id] != nil {
+			candidates = append(candidates, hnswCandidate{id: id, similarity: dotProduct(vector, h.nodes[id].vector)})
+		}
+	}
+	slices.SortFunc(candidates, compareSimilarity)
+	return candidates
+}
+
+// selectNeighbors picks up to max neighbors among the candidates, sorted the nearest first, with the heuristic of
+// the paper: a candidate nearer to a selected neighbor than to the node is skipped, so that the neighbors point
+// in diverse directions and the graph stays connected across clusters
+func (h *hnswIndex) selectNeighbors(candidates []hnswCandidate, max int) []int32 {
+	selected := make([]int32, 0, max)
+	for _, candidate := range candidates {
+		if len(selected) >= max {
+			break
+		}
+		vector := h.nodes[candidate.id].vector
+		diverse := true
+		for _, id := range selected {
+			if dotProduct(vector, h.nodes[id].vector) > candidate.similarity {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, candidate.id)
+		}
+	}
+	return selected
+}
+
+// searchLayer returns the ef nodes of the level nearest to the query found from the entries, the nearest first.
+// Nodes not allowed are traversed but not returned; a nil allowed allows every node
+func (h *hnswIndex) searchLayer(query []float32, entries []hnswCandidate, ef, level int, allowed func(*hnswNode) bool) []hnswCandidate {
+	visited := make([]uint64, (len(h.nodes)+63)/64)
+	candidates := &hnswQueue{nearestFirst: true}
+	results := &hnswQueue{}
+	for _, entry := range entries {
+		visited[entry.id/64] |= 1 << (entry.id % 64)
+		heap.Push(candidates, entry)
+		if allowed == nil || allowed(h.nodes[entry.id]) {
+			heap.Push(results, entry)
+		}
+	}
+	for results.Len() > ef {
+		heap.Pop(results)
+	}
+
+	for candidates.Len() > 0 {
+		candidate := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && candidate.similarity < results.top().similarity {
+			break
+		}
+		neighbors := h.nodes[candidate.id].neighbors
+		if level >= len(neighbors) {
+			continue
+		}
+		for _, id := range neighbors[level] {
+			if visited[id/64]&(1<<(id%64)) != 0 {
+				continue
+			}
+			visited[id/64] |= 1 << (id % 64)
+
+			// Neighbors removed since they were linked are skipped
+			node := h.nodes[id]
+			if node == nil {
+				continue
+			}
+			similarity := dotProduct(query, node.vector)
+			if results.Len() < ef || similarity > results.top().similarity {
+				heap.Push(candidates, hnswCandidate{id: id, similarity: similarity})
+				if allowed == nil || allowed(node) {
+					heap.Push(results, hnswCandidate{id: id, similarity: similarity})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+
+	slices.SortFunc(results.items, compareSimilarity)
+	return results.items
+}
+
+// search returns up to limit allowed documents the most similar to the query, the most similar first. A nil
+// allowed allows every document
+func (h *hnswIndex) search(query []float32, limit int, allowed func(knowledgeId string, doc *Document) bool) []hnswCandidate {
+	if h.entry < 0 || limit <= 0 {
+		return nil
+	}
+
+	vector := normalize(slices.Clone(query))
+	entries := []hnswCandidate{{id: h.entry, similarity: dotProduct(vector, h.nodes[h.entry].vector)}}
+	for l := h.maxLevel; l > 0; l-- {
+		entries = h.searchLayer(vector, entries, 1, l, nil)
+	}
+	var allowedNode func(*hnswNode) bool
+	if allowed != nil {
+		allowedNode = func(node *hnswNode) bool {
+			return allowed(node.knowledgeId, node.doc)
+		}
+	}
+	found := h.searchLayer(vector, entries, max(h.efSearch, limit), 0, allowedNode)
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found
+}
+
+// remove deletes the document from the index and reconnects its neighbors to each other
+func (h *hnswIndex) remove(doc *Document) {
+	id, exists := h.nodeIds[doc]
+	if !exists {
+		return
+	}
+	delete(h.nodeIds, doc)
+	node := h.nodes[id]
+	h.nodes[id] = nil
+	h.removed++
+
+	for level, neighbors := range node.neighbors {
+		for _, neighborId := range neighbors {
+			neighbor := h.nodes[neighborId]
+			if neighbor == nil || level >= len(neighbor.neighbors) {
+				continue
+			}
+			ids := slices.DeleteFunc(slices.Clone(neighbor.neighbors[level]), func(id int32) bool {
+				return h.nodes[id] == nil
+			})
+			for _, id := range neighbors {
+				if id != neighborId && h.nodes[id] != nil && !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+			}
+			neighbor.neighbors[level] = h.selectNeighbors(h.candidates(neighbor.vector, ids), h.maxConnections(level))
+		}
+	}
+
+	if h.entry == id {
+		h.entry, h.maxLevel = -1, 0
+		for id, node := range h.nodes {
+			if node != nil && (h.entry < 0 || len(node.neighbors)-1 > h.maxLevel) {
+				h.entry, h.maxLevel = int32(id), len(node.neighbors)-1
+			}
+		}
+	}
+
+	// Drop the removed nodes once they outnumber the live ones
+	if h.removed > len(h.nodeIds) && h.removed >= 64 {
+		h.compact()
+	}
+}
+
+// compact renumbers the live nodes, dropping the removed ones and the links to them
+func (h *hnswIndex) compact() {
+	renumbered := make([]int32, len(h.nodes))
+	nodes := make([]*hnswNode, 0, len(h.nodeIds))
+	for id, node := range h.nodes {
+		renumbered[id] = -1
+		if node != nil {
+			renumbered[id] = int32(len(nodes))
+			nodes = append(nodes, node)
+		}
+	}
+
+	for id, node := range nodes {
+		h.nodeIds[node.doc] = int32(id)
+		for level, neighbors := range node.neighbors {
+			kept := neighbors[:0]
+			for _, neighbor := range neighbors {
+				if renumbered[neighbor] >= 0 {
+					kept = append(kept, renumbered[neighbor])
+				}
+			}
+			node.neighbors[level] = kept
+		}
+	}
+	if h.entry >= 0 {
+		h.entry = renumbered[h.entry]
+	}
+	h.nodes = nodes
+	h.removed = 0
+}
+
+func compareSimilarity(a, b hnswCandidate) int {
+	switch {
+	case a.similarity > b.similarity:
+		return -1
+	case a.similarity < b.similarity:
+		return 1
+	default:
+		return int(a.id - b.id)
+	}
+}
+
+// dotProduct returns the dot product of vectors of the same dimension, and 0 for vectors of different dimensions
+// like cosineSimilarity
+func dotProduct(a, b []float32) float32 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
@@ -0,0 +1,249 @@
+package knowledge_test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+// randomEmbeddings returns n embeddings around a few centers, like the embeddings of documents on a few topics
+func randomEmbeddings(rng *rand.Rand, n, dim int) [][]float32 {
+	centers := make([][]float32, 16)
+	for i := range centers {
+		centers[i] = make([]float32, dim)
+		for j := range centers[i] {
+			centers[i][j] = float32(rng.NormFloat64())
+		}
+	}
+
+	embeddings := make([][]float32, n)
+	for i := range embeddings {
+		center := centers[rng.Intn(len(centers))]
+		embeddings[i] = make([]float32, dim)
+		for j := range embeddings[i] {
+			embeddings[i][j] = center[j] + float32(rng.NormFloat64())*0.5
+		}
+	}
+	return embeddings
+}
+
+// newANNTestKnowledge returns knowledge of documents with the embeddings, split between two knowledge IDs
+func newANNTestKnowledge(embeddings [][]float32) []*knowledge.Knowledge {
+	knowledges := []*knowledge.Knowledge{{ID: "even"}, {ID: "odd"}}
+	for i, embedding := range embeddings {
+		kl := knowledges[i%2]
+		kl.Documents = append(kl.Documents, &knowledge.Document{
+			ID:         fmt.Sprintf("doc-%d", i),
+			Content:    knowledge.Content{MIMEType: "text/plain", Text: fmt.Sprintf("document %d", i)},
+			Embeddings: embedding,
+			Metadata:   map[string]any{"bucket": i % 10},
+		})
+	}
+	return knowledges
+}
+
+// recall returns the fraction of the expected results found
+func recall(expected, found []knowledge.KnowledgeSearchResult) float64 {
+	ids := make(map[string]bool, len(found))
+	for _, result := range found {
+		ids[result.ID] = true
+	}
+	hits := 0
+	for _, result := range expected {
+		if ids[result.ID] {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(expected))
+}
+
+func TestInMemoryStore_HNSWIndex(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(42))
+	embeddings := randomEmbeddings(rng, 2000, 32)
+	queries := randomEmbeddings(rng, 50, 32)
+
+	flat := knowledge.NewInMemoryStore()
+	hnsw := knowledge.NewInMemoryStore(knowledge.WithHNSWIndex(16, 100, 64))
+	for _, kl := range newANNTestKnowledge(embeddings) {
+		require.NoError(t, flat.Store(ctx, kl))
+		require.NoError(t, hnsw.Store(ctx, kl))
+	}
+
+	checkRecall := func(t *testing.T, allowedKnowledgeIds []string, filter *knowledge.Filter) {
+		t.Helper()
+
+		var total float64
+		for _, query := range queries {
+			expected, err := flat.Search(ctx, query, 10, allowedKnowledgeIds, filter)
+			require.NoError(t, err)
+			found, err := hnsw.Search(ctx, query, 10, allowedKnowledgeIds, filter)
+			require.NoError(t, err)
+			require.Len(t, found, len(expected))
+			for i := 1; i < len(found); i++ {
+				require.GreaterOrEqual(t, found[i-1].Score, found[i].Score)
+			}
+			for _, result := range found {
+				if len(allowedKnowledgeIds) > 0 {
+					require.Contains(t, allowedKnowledgeIds, result.Metadata["knowledge_id"])
+				}
+				require.True(t, filter.Matches(result.Metadata))
+				require.Nil(t, result.Embeddings)
+			}
+			total += recall(expected, found)
+		}
+		require.GreaterOrEqual(t, total/float64(len(queries)), 0.9)
+	}
+
+	t.Run("all", func(t *testing.T) {
+		checkRecall(t, nil, nil)
+	})
+	t.Run("allowed knowledge", func(t *testing.T) {
+		checkRecall(t, []string{"odd"}, nil)
+	})
+	t.Run("filter", func(t *testing.T) {
+		filter := knowledge.FieldIn("bucket", 1, 2)
+		checkRecall(t, nil, &filter)
+	})
+
+	t.Run("incremental updates", func(t *testing.T) {
+		// Replace half of the even documents, and delete the other half and the odd documents
+		replaced := randomEmbeddings(rng, 500, 32)
+		var documents []*knowledge.Document
+		var deleted []string
+		for i, embedding := range replaced {
+			documents = append(documents, &knowledge.Document{
+				ID:         fmt.Sprintf("doc-%d", i*2),
+				Content:    knowledge.Content{MIMEType: "text/plain", Text: fmt.Sprintf("replaced %d", i)},
+				Embeddings: embedding,
+			})
+		}
+		for i := 1000; i < 2000; i += 2 {
+			deleted = append(deleted, fmt.Sprintf("doc-%d", i))
+		}
+		for _, store := range []knowledge.Store{flat, hnsw} {
+			require.NoError(t, store.UpdateDocuments(ctx, "even", knowledge.EmbeddingModel{}, documents, deleted))
+			require.NoError(t, store.DeleteKnowledgeById(ctx, "odd"))
+		}
+
+		checkRecall(t, nil, nil)
+		for _, query := range queries {
+			found, err := hnsw.Search(ctx, query, 10, []string{"odd"}, nil)
+			require.NoError(t, err)
+			require.Empty(t, found)
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "knowledge.snapshot")
+		require.NoError(t, hnsw.SaveSnapshot(path))
+
+		before := make([][]knowledge.KnowledgeSearchResult, len(queries))
+		for i, query := range queries {
+			var err error
+			before[i], err = hnsw.Search(ctx, query, 10, nil, nil)
+			require.NoError(t, err)
+		}
+
+		// The same graph is searched after a reload
+		reloaded := knowledge.NewInMemoryStore(knowledge.WithHNSWIndex(16, 100, 64))
+		require.NoError(t, reloaded.LoadSnapshot(path))
+		for i, query := range queries {
+			after, err := reloaded.Search(ctx, query, 10, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, resultIds(before[i]), resultIds(after))
+		}
+
+		kl, err := reloaded.GetKnowledgeById(ctx, "even")
+		require.NoError(t, err)
+		require.Len(t, kl.Documents, 500)
+		require.Equal(t, "replaced 0", kl.Documents[0].Content.Text)
+
+		// Other parameters rebuild the graph, and a flat store ignores it
+		for _, store := range []*knowledge.InMemoryStore{
+			knowledge.NewInMemoryStore(knowledge.WithHNSWIndex(8, 50, 64)),
+			knowledge.NewInMemoryStore(),
+		} {
+			require.NoError(t, store.LoadSnapshot(path))
+			var total float64
+			for i, query := range queries {
+				after, err := store.Search(ctx, query, 10, nil, nil)
+				require.NoError(t, err)
+				total += recall(before[i], after)
+			}
+			require.GreaterOrEqual(t, total/float64(len(queries)), 0.9)
+		}
+	})
+}
+
+func TestNewInMemoryStoreFromConfig(t *testing.T) {
+	ctx := context.Background()
+	conf := config.NewKnowledgeConfig()
+	conf.VectorIndex = config.VectorIndexHNSW
+	conf.InMemorySnapshotPath = filepath.Join(t.TempDir(), "knowledge.snapshot")
+
+	store, err := knowledge.NewInMemoryStoreFromConfig(conf)
+	require.NoError(t, err)
+	require.NoError(t, store.Store(ctx, newANNTestKnowledge(randomEmbeddings(rand.New(rand.NewSource(1)), 100, 16))[0]))
+	require.NoError(t, store.Close())
+	require.NoError(t, store.Close())
+
+	// The store closed twice was saved once, with its documents
+	store, err = knowledge.NewInMemoryStoreFromConfig(conf)
+	require.NoError(t, err)
+	kl, err := store.GetKnowledgeById(ctx, "even")
+	require.NoError(t, err)
+	require.Len(t, kl.Documents, 50)
+
+	conf.VectorIndex = "lsh"
+	_, err = knowledge.NewInMemoryStoreFromConfig(conf)
+	require.ErrorContains(t, err, "unknown vector index")
+}
+
+func BenchmarkInMemoryStore_Search(b *testing.B) {
+	ctx := context.Background()
+	for _, n := range []int{1000, 10000, 50000} {
+		rng := rand.New(rand.NewSource(42))
+		knowledges := newANNTestKnowledge(randomEmbeddings(rng, n, 128))
+		queries := randomEmbeddings(rng, 100, 128)
+
+		for _, name := range []string{"flat", "hnsw"} {
+			// The stores are filled once, not on every run of the benchmark
+			store := knowledge.NewInMemoryStore()
+			if name == "hnsw" {
+				store = knowledge.NewInMemoryStore(knowledge.WithHNSWIndex(0, 0, 0))
+			}
+			for _, kl := range knowledges {
+				require.NoError(b, store.Store(ctx, kl))
+			}
+
+			b.Run(fmt.Sprintf("%s/%d", name, n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := store.Search(ctx, queries[i%len(queries)], 10, nil, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkInMemoryStore_StoreHNSW(b *testing.B) {
+	ctx := context.Background()
+	knowledges := newANNTestKnowledge(randomEmbeddings(rand.New(rand.NewSource(42)), 10000, 128))
+
+	for i := 0; i < b.N; i++ {
+		store := knowledge.NewInMemoryStore(knowledge.WithHNSWIndex(0, 0, 0))
+		for _, kl := range knowledges {
+			if err := store.Store(ctx, kl); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
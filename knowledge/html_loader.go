@@ -0,0 +1,665 @@
+package knowledge
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	SourceTypeHTML = "html"
+
+	// MetadataKeyTitle is the metadata key of the title of an HTML page
+	MetadataKeyTitle = "title"
+	// MetadataKeyCanonicalURL is the metadata key of the canonical URL of an HTML page
+	MetadataKeyCanonicalURL = "canonical_url"
+	// MetadataKeyDescription is the metadata key of the meta description of an HTML page
+	MetadataKeyDescription = "description"
+)
+
+// HTMLPage is the main content of an HTML page as markdown, without its navigation, scripts and other boilerplate
+type HTMLPage struct {
+	Title        string
+	CanonicalURL string
+	Description  string
+	// Markdown is the main content of the page, with its headings, lists, tables and links
+	Markdown string
+}
+
+var (
+	// unlikelyContentPattern matches the classes and IDs of elements which are rarely content, like readability
+	unlikelyContentPattern = regexp.MustCompile(`(?i)-ad-|banner|breadcrumb|combx|comment|community|cookie|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|modal|newsletter|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skip|skyscraper|social|sponsor|subscribe|supplemental|toolbar`)
+	// maybeContentPattern matches the classes and IDs of elements kept although they match unlikelyContentPattern
+	maybeContentPattern = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	// boilerplateRoles are the ARIA roles of elements which are not content
+	boilerplateRoles = map[string]bool{
+		"navigation": true, "banner": true, "contentinfo": true, "complementary": true, "search": true,
+		"dialog": true, "alertdialog": true, "menu": true, "menubar": true, "toolbar": true,
+	}
+	// boilerplateElements are removed wherever they are
+	boilerplateElements = map[atom.Atom]bool{
+		atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true, atom.Iframe: true,
+		atom.Svg: true, atom.Canvas: true, atom.Object: true, atom.Embed: true, atom.Form: true,
+		atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Nav: true,
+		atom.Aside: true, atom.Dialog: true, atom.Menu: true, atom.Head: true,
+	}
+	// blockElements are the elements converted to markdown blocks rather than inline text
+	blockElements = map[atom.Atom]bool{
+		atom.Html: true, atom.Body: true, atom.Main: true, atom.Article: true, atom.Section: true, atom.Div: true,
+		atom.Header: true, atom.Footer: true, atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true,
+		atom.H4: true, atom.H5: true, atom.H6: true, atom.Ul: true, atom.Ol: true, atom.Li: true,
+		atom.Table: true, atom.Pre: true, atom.Blockquote: true, atom.Hr: true, atom.Dl: true, atom.Dt: true,
+		atom.Dd: true, atom.Figure: true, atom.Figcaption: true, atom.Address: true, atom.Details: true,
+		atom.Summary: true, atom.Fieldset: true, atom.Caption: true,
+	}
+	spacesPattern = regexp.MustCompile(`[ \t\r\n\f]+`)
+)
+
+// ProcessDocumentsFromHTML processes an HTML page: its main content is converted to markdown and chunked like
+// markdown, by the chunking the config selects for "text/html". The title, canonical URL and meta description of
+// the page are added to the metadata of the chunks
+func ProcessDocumentsFromHTML(
+	ctx context.Context,
+	reader io.Reader,
+	logger *slog.Logger,
+	config *config.KnowledgeConfig,
+	embedder Embedder,
+) ([]*Document, map[string]any, error) {
+	chunker, err := chunkerFor(config, "text/html")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	page, err := ParseHTMLPage(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if page.Markdown == "" {
+		return nil, nil, errors.New("no content found in HTML")
+	}
+
+	documents, err := embedChunks(ctx, chunker.Chunk(page.Markdown), "text/markdown", "section_number", embedder)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to process HTML")
+	}
+
+	metadata := map[string]any{
+		"source_type":   SourceTypeHTML,
+		"total_chars":   len(page.Markdown),
+		"section_count": len(documents),
+	}
+	setDocumentMetadata(documents, metadata, map[string]string{
+		MetadataKeyTitle:        page.Title,
+		MetadataKeyCanonicalURL: page.CanonicalURL,
+		MetadataKeyDescription:  page.Description,
+	})
+
+	logger.Info("Processed HTML", "title", page.Title, "sections", len(documents), "chars", len(page.Markdown))
+	return documents, metadata, nil
+}
+
+// ParseHTMLPage reads an HTML page, in the encoding its meta tags declare or UTF-8, and returns its main content as
+// markdown. Like readability, it removes scripts, navigation, hidden elements and the elements whose classes look
+// like boilerplate, then keeps the article, the main element or the element with the most paragraphs of text, and
+// drops the lists of links in it. Relative links are resolved against the base or canonical URL of the page
+func ParseHTMLPage(reader io.Reader) (*HTMLPage, error) {
+	reader, err := charset.NewReader(reader, "text/html")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to detect the encoding of HTML")
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse HTML")
+	}
+
+	page := &HTMLPage{}
+	var base *url.URL
+	for n := range doc.Descendants() {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		switch n.DataAtom {
+		case atom.Title:
+			if page.Title == "" {
+				page.Title = collapseSpaces(textContent(n))
+			}
+		case atom.Base:
+			if href, err := url.Parse(attr(n, "href")); err == nil && href.IsAbs() && base == nil {
+				base = href
+			}
+		case atom.Link:
+			if hasToken(attr(n, "rel"), "canonical") && page.CanonicalURL == "" {
+				page.CanonicalURL = strings.TrimSpace(attr(n, "href"))
+			}
+		case atom.Meta:
+			content := collapseSpaces(attr(n, "content"))
+			switch strings.ToLower(cmp.Or(attr(n, "name"), attr(n, "property"))) {
+			case "description":
+				page.Description = content
+			case "og:description":
+				page.Description = cmp.Or(page.Description, content)
+			case "og:title":
+				page.Title = cmp.Or(page.Title, content)
+			case "og:url":
+				page.CanonicalURL = cmp.Or(page.CanonicalURL, content)
+			}
+		}
+	}
+	if canonical, err := url.Parse(page.CanonicalURL); err == nil && page.CanonicalURL != "" {
+		if base != nil {
+			canonical = base.ResolveReference(canonical)
+			page.CanonicalURL = canonical.String()
+		}
+		if base == nil && canonical.IsAbs() {
+			base = canonical
+		}
+	}
+
+	removeBoilerplate(doc, false)
+	root := findContentRoot(doc)
+	if root == nil {
+		return page, nil
+	}
+	removeLinkLists(root)
+
+	converter := &markdownConverter{base: base}
+	blocks := converter.blocks(root)
+	// The title is the top heading of pages whose content has none, so that their sections have a heading path
+	if page.Title != "" && len(blocks) > 0 && !hasDescendant(root, atom.H1) {
+		blocks = append([]string{"# " + page.Title}, blocks...)
+	}
+	page.Markdown = strings.Join(blocks, "\n\n")
+	return page, nil
+}
+
+// removeBoilerplate removes the children of n which are not content. Headers and footers are only removed outside
+// articles, where they are the banner and footer of the site
+func removeBoilerplate(n *html.Node, inArticle bool) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type != html.ElementNode:
+		case isBoilerplate(c, inArticle):
+			n.RemoveChild(c)
+		default:
+			removeBoilerplate(c, inArticle || c.DataAtom == atom.Article || c.DataAtom == atom.Main)
+		}
+		c = next
+	}
+}
+
+func isBoilerplate(n *html.Node, inArticle bool) bool {
+	if boilerplateElements[n.DataAtom] {
+		return true
+	}
+	if !inArticle && (n.DataAtom == atom.Header || n.DataAtom == atom.Footer) {
+		return true
+	}
+	if hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" || boilerplateRoles[attr(n, "role")] {
+		return true
+	}
+	if style := strings.ReplaceAll(attr(n, "style"), " ", ""); strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden") {
+		return true
+	}
+	switch n.DataAtom {
+	case atom.Html, atom.Body, atom.Main, atom.Article, atom.A, atom.Table, atom.Tbody, atom.Thead, atom.Tr, atom.Td, atom.Th:
+		return false
+	}
+	classAndId := attr(n, "class") + " " + attr(n, "id")
+	return unlikelyContentPattern.MatchString(classAndId) && !maybeContentPattern.MatchString(classAndId)
+}
+
+// findContentRoot returns the element of the main content of the page: its only article, its main element, or the
+// element whose paragraphs score best, by their length and commas, less the fraction of their text in links
+func findContentRoot(doc *html.Node) *html.Node {
+	var articles, mains []*html.Node
+	var body *html.Node
+	for n := range doc.Descendants() {
+		switch {
+		case n.Type != html.ElementNode:
+		case n.DataAtom == atom.Article:
+			articles = append(articles, n)
+		case n.DataAtom == atom.Main || attr(n, "role") == "main":
+			mains = append(mains, n)
+		case n.DataAtom == atom.Body:
+			body = n
+		}
+	}
+	if len(articles) == 1 {
+		return articles[0]
+	}
+	if len(mains) == 1 {
+		return mains[0]
+	}
+
+	scores := make(map[*html.Node]float64)
+	for n := range doc.Descendants() {
+		if n.Type != html.ElementNode || (n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td && n.DataAtom != atom.Blockquote) {
+			continue
+		}
+		text := collapseSpaces(textContent(n))
+		length := utf8.RuneCountInString(text)
+		if length < 25 {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(length)/100, 3)
+		if parent := n.Parent; parent != nil {
+			scores[parent] += score
+			if grandparent := parent.Parent; grandparent != nil {
+				scores[grandparent] += score / 2
+			}
+		}
+	}
+
+	var (
+		root      *html.Node
+		bestScore float64
+	)
+	for n := range doc.Descendants() {
+		if scores[n] == 0 {
+			continue
+		}
+		if score := scores[n] * (1 - linkDensity(n)); score > bestScore {
+			root, bestScore = n, score
+		}
+	}
+	if root == nil {
+		return body
+	}
+	// The content is split into siblings, such as the sections of an article, when they score close to the best
+	if parent := root.Parent; parent != nil {
+		for sibling := parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+			if sibling != root && scores[sibling]*(1-linkDensity(sibling)) >= bestScore/5 {
+				return parent
+			}
+		}
+	}
+	return root
+}
+
+// removeLinkLists removes the lists and containers under n whose text is mostly links, such as tables of contents
+// and lists of related pages
+func removeLinkLists(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.ElementNode {
+			switch c.DataAtom {
+			case atom.Ul, atom.Ol, atom.Dl, atom.Div, atom.Section, atom.Table:
+				if linkDensity(c) > 0.5 {
+					n.RemoveChild(c)
+					break
+				}
+				removeLinkLists(c)
+			default:
+				removeLinkLists(c)
+			}
+		}
+		c = next
+	}
+}
+
+// linkDensity returns the fraction of the text of n in links
+func linkDensity(n *html.Node) float64 {
+	length := utf8.RuneCountInString(collapseSpaces(textContent(n)))
+	if length == 0 {
+		return 0
+	}
+	linkLength := 0
+	for c := range n.Descendants() {
+		if c.Type == html.ElementNode && c.DataAtom == atom.A {
+			linkLength += utf8.RuneCountInString(collapseSpaces(textContent(c)))
+		}
+	}
+	return min(float64(linkLength)/float64(length), 1)
+}
+
+// markdownConverter converts HTML elements to markdown
+type markdownConverter struct {
+	// base is the URL relative links are resolved against, if known
+	base *url.URL
+}
+
+// blocks returns the markdown blocks of the children of n. Runs of text and inline elements between block
+// elements are paragraphs
+func (m *markdownConverter) blocks(n *html.Node) []string {
+	var (
+		blocks    []string
+		paragraph strings.Builder
+	)
+	flush := func() {
+		if text := formatParagraph(paragraph.String()); text != "" {
+			blocks = append(blocks, text)
+		}
+		paragraph.Reset()
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && blockElements[c.DataAtom] {
+			flush()
+			blocks = append(blocks, m.block(c)...)
+		} else {
+			paragraph.WriteString(m.inline(c))
+		}
+	}
+	flush()
+	return blocks
+}
+
+// block returns the markdown blocks of the block element n
+func (m *markdownConverter) block(n *html.Node) []string {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		text := strings.ReplaceAll(formatParagraph(m.inlineChildren(n)), "\n", " ")
+		if text == "" {
+			return nil
+		}
+		level := int(n.Data[1] - '0')
+		return []string{strings.Repeat("#", level) + " " + text}
+
+	case atom.Ul, atom.Ol:
+		if list := m.list(n); list != "" {
+			return []string{list}
+		}
+		return nil
+
+	case atom.Table:
+		if table := m.table(n); table != "" {
+			return []string{table}
+		}
+		return nil
+
+	case atom.Pre:
+		code := strings.Trim(textContent(n), "\n")
+		if strings.TrimSpace(code) == "" {
+			return nil
+		}
+		language := ""
+		for c := range n.Descendants() {
+			if c.Type == html.ElementNode {
+				for _, class := range strings.Fields(attr(c, "class")) {
+					if lang, ok := strings.CutPrefix(class, "language-"); ok && language == "" {
+						language = lang
+					}
+				}
+			}
+		}
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return []string{fence + language + "\n" + code + "\n" + fence}
+
+	case atom.Blockquote:
+		blocks := m.blocks(n)
+		if len(blocks) == 0 {
+			return nil
+		}
+		lines := strings.Split(strings.Join(blocks, "\n\n"), "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight("> "+line, " ")
+		}
+		return []string{strings.Join(lines, "\n")}
+
+	case atom.Hr:
+		return []string{"---"}
+
+	case atom.Dt:
+		if text := strings.ReplaceAll(formatParagraph(m.inlineChildren(n)), "\n", " "); text != "" {
+			return []string{"**" + text + "**"}
+		}
+		return nil
+
+	default:
+		return m.blocks(n)
+	}
+}
+
+// list returns the markdown of a list, with its nested lists indented under their items
+func (m *markdownConverter) list(n *html.Node) string {
+	var items []string
+	number := 1
+	if start := attr(n, "start"); start != "" {
+		fmt.Sscanf(start, "%d", &number)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || c.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		blocks := m.blocks(c)
+		if len(blocks) == 0 {
+			continue
+		}
+		indent := strings.Repeat(" ", len(marker))
+		lines := strings.Split(strings.Join(blocks, "\n"), "\n")
+		for i, line := range lines {
+			if i == 0 {
+				lines[i] = marker + line
+			} else if line != "" {
+				lines[i] = indent + line
+			}
+		}
+		items = append(items, strings.Join(lines, "\n"))
+	}
+	return strings.Join(items, "\n")
+}
+
+// table returns the markdown of a table, with its first row as the header
+func (m *markdownConverter) table(n *html.Node) string {
+	var rows [][]string
+	var visit func(*html.Node)
+	visit = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode || c.DataAtom == atom.Table {
+				continue
+			}
+			if c.DataAtom != atom.Tr {
+				visit(c)
+				continue
+			}
+			var row []string
+			for cell := c.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					row = append(row, formatParagraph(m.inlineChildren(cell)))
+				}
+			}
+			if len(row) > 0 {
+				rows = append(rows, row)
+			}
+		}
+	}
+	visit(n)
+	return markdownTable(rows)
+}
+
+// markdownTable returns the markdown table of the rows of inline markdown cells, with the first row as the header
+func markdownTable(rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+
+	var table strings.Builder
+	writeRow := func(row []string) {
+		table.WriteString("|")
+		for i := 0; i < columns; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = strings.ReplaceAll(strings.ReplaceAll(row[i], "\n", " "), "|", `\|`)
+			}
+			table.WriteString(" " + cell + " |")
+		}
+		table.WriteString("\n")
+	}
+	writeRow(rows[0])
+	writeRow(strings.Split(strings.Repeat("---,", columns-1)+"---", ","))
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+	return strings.TrimSuffix(table.String(), "\n")
+}
+
+// inline returns the markdown of n as inline text, with its whitespace collapsed and line breaks as newlines
+func (m *markdownConverter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return spacesPattern.ReplaceAllString(n.Data, " ")
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return "\n"
+	case atom.Img:
+		return ""
+	case atom.A:
+		text := strings.TrimSpace(strings.ReplaceAll(m.inlineChildren(n), "\n", " "))
+		href := m.resolve(attr(n, "href"))
+		if text == "" || href == "" {
+			return text
+		}
+		return fmt.Sprintf("[%s](%s)", text, href)
+	case atom.Code, atom.Kbd, atom.Samp:
+		if code := collapseSpaces(textContent(n)); code != "" {
+			return "`" + code + "`"
+		}
+		return ""
+	case atom.Strong, atom.B:
+		return emphasize(m.inlineChildren(n), "**")
+	case atom.Em, atom.I:
+		return emphasize(m.inlineChildren(n), "*")
+	}
+	if blockElements[n.DataAtom] {
+		// Block elements in inline elements are separated by spaces
+		return " " + m.inlineChildren(n) + " "
+	}
+	return m.inlineChildren(n)
+}
+
+func (m *markdownConverter) inlineChildren(n *html.Node) string {
+	var text strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		text.WriteString(m.inline(c))
+	}
+	return text.String()
+}
+
+// resolve returns the href resolved against the base URL, or "" for anchors in the page and scripts
+func (m *markdownConverter) resolve(href string) string {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return ""
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return href
+	}
+	if m.base != nil {
+		u = m.base.ResolveReference(u)
+	}
+	return strings.NewReplacer("(", "%28", ")", "%29", " ", "%20").Replace(u.String())
+}
+
+// emphasize wraps the text in the marker, leaving its surrounding spaces outside
+func emphasize(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	start := strings.Index(text, trimmed)
+	return text[:start] + marker + trimmed + marker + text[start+len(trimmed):]
+}
+
+// formatParagraph trims the lines of inline markdown, collapses their spaces and escapes the # starting a line,
+// which would make it a heading
+func formatParagraph(text string) string {
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		line = collapseSpaces(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			line = `\` + line
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func collapseSpaces(text string) string {
+	return strings.TrimSpace(spacesPattern.ReplaceAllString(text, " "))
+}
+
+// textContent returns the text of n and its descendants
+func textContent(n *html.Node) string {
+	var text strings.Builder
+	for c := range n.Descendants() {
+		if c.Type == html.TextNode {
+			text.WriteString(c.Data)
+		}
+	}
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	return text.String()
+}
+
+func hasDescendant(n *html.Node, a atom.Atom) bool {
+	for c := range n.Descendants() {
+		if c.Type == html.ElementNode && c.DataAtom == a {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasToken reports whether the space separated list of tokens has the token, ignoring case
+func hasToken(tokens, token string) bool {
+	for _, t := range strings.Fields(tokens) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package knowledge_test
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+const testHTMLPage = `<!DOCTYPE html>
+<html>
+<head>
+  <title>Deploying Agents | Docs</title>
+  <meta name="description" content="How to deploy agents  to production.">
+  <link rel="canonical" href="https://docs.example.com/guides/deploy">
+  <style>body { color: red; }</style>
+  <script>console.log("tracking");</script>
+</head>
+<body>
+  <header class="site-header"><a href="/">Home</a> <a href="/blog">Blog</a></header>
+  <nav><ul><li><a href="/guides">Guides</a></li><li><a href="/api">API</a></li></ul></nav>
+  <div class="cookie-banner">We use cookies.</div>
+  <article>
+    <h1>Deploying   Agents</h1>
+    <p>Agents run as a <strong>single binary</strong>, configured with a YAML file. See the
+      <a href="../reference/config">configuration reference</a> for every option.</p>
+    <h2>Requirements</h2>
+    <ul>
+      <li>An API key of a model provider</li>
+      <li>A store for knowledge:
+        <ol><li>SQLite, the default</li><li>In memory</li></ol>
+      </li>
+    </ul>
+    <h2>Ports</h2>
+    <table>
+      <tr><th>Port</th><th>Use</th></tr>
+      <tr><td>8080</td><td>HTTP | API</td></tr>
+      <tr><td>9090</td><td>Metrics</td></tr>
+    </table>
+    <pre><code class="language-sh">agentruntime serve \
+  --port 8080</code></pre>
+    <div style="display: none">Hidden text</div>
+    <div class="related-posts"><a href="/a">Related one</a> <a href="/b">Related two</a></div>
+  </article>
+  <aside>Popular posts</aside>
+  <footer>Copyright 2025</footer>
+</body>
+</html>`
+
+func TestParseHTMLPage(t *testing.T) {
+	page, err := knowledge.ParseHTMLPage(strings.NewReader(testHTMLPage))
+	require.NoError(t, err)
+	require.Equal(t, "Deploying Agents | Docs", page.Title)
+	require.Equal(t, "https://docs.example.com/guides/deploy", page.CanonicalURL)
+	require.Equal(t, "How to deploy agents to production.", page.Description)
+
+	require.Equal(t, "# Deploying Agents\n\n"+
+		"Agents run as a **single binary**, configured with a YAML file. See the "+
+		"[configuration reference](https://docs.example.com/reference/config) for every option.\n\n"+
+		"## Requirements\n\n"+
+		"- An API key of a model provider\n"+
+		"- A store for knowledge:\n"+
+		"  1. SQLite, the default\n"+
+		"  2. In memory\n\n"+
+		"## Ports\n\n"+
+		"| Port | Use |\n"+
+		"| --- | --- |\n"+
+		"| 8080 | HTTP \\| API |\n"+
+		"| 9090 | Metrics |\n\n"+
+		"```sh\nagentruntime serve \\\n  --port 8080\n```", page.Markdown)
+}
+
+func TestParseHTMLPage_WithoutArticle(t *testing.T) {
+	// The content is found by the length of its paragraphs, and the title heads pages without a top heading
+	page, err := knowledge.ParseHTMLPage(strings.NewReader(`<html><head>
+<meta property="og:title" content="Release notes">
+<meta property="og:description" content="What changed.">
+<base href="https://example.com/releases/">
+</head><body>
+<div id="menu"><a href="/">Home</a></div>
+<div id="sidebar"><p>Subscribe to the newsletter for updates, news and more.</p></div>
+<div id="wrapper"><div class="post">
+<h2>Version 1.2</h2>
+<p>Knowledge can now be searched by keywords, with BM25 ranking, and merged with vector search.</p>
+<p>Snapshots of the in-memory store make restarts faster, as the index is not rebuilt. See <a href="v1.2">details</a>.</p>
+<div class="toc"><a href="#a">One</a> <a href="#b">Two</a> <a href="#c">Three</a></div>
+</div></div>
+</body></html>`))
+	require.NoError(t, err)
+	require.Equal(t, "Release notes", page.Title)
+	require.Equal(t, "What changed.", page.Description)
+	require.Empty(t, page.CanonicalURL)
+	require.Equal(t, "# Release notes\n\n"+
+		"## Version 1.2\n\n"+
+		"Knowledge can now be searched by keywords, with BM25 ranking, and merged with vector search.\n\n"+
+		"Snapshots of the in-memory store make restarts faster, as the index is not rebuilt. See "+
+		"[details](https://example.com/releases/v1.2).", page.Markdown)
+}
+
+func TestProcessDocumentsByType_HTML(t *testing.T) {
+	ctx := t.Context()
+	conf := config.NewKnowledgeConfig()
+
+	documents, metadata, err := knowledge.ProcessDocumentsByType(ctx, nil, &knowledge.DocumentReader{
+		Content:     bytes.NewReader([]byte(testHTMLPage)),
+		ContentType: "text/html",
+	}, slog.Default(), conf, knowledge.NewHashEmbedder(32), 1)
+	require.NoError(t, err)
+	require.Equal(t, knowledge.SourceTypeHTML, metadata["source_type"])
+
+	// Chunks are the sections of the markdown, with the metadata of the page
+	require.Len(t, documents, 3)
+	require.Equal(t, []string{"Deploying Agents", "Ports"}, documents[2].Metadata[knowledge.MetadataKeyHeadingPath])
+	for _, document := range documents {
+		require.Equal(t, "text/markdown", document.Content.MIMEType)
+		require.NotContains(t, document.Content.Text, "cookies")
+		require.Equal(t, "Deploying Agents | Docs", document.Metadata[knowledge.MetadataKeyTitle])
+		require.Equal(t, "https://docs.example.com/guides/deploy", document.Metadata[knowledge.MetadataKeyCanonicalURL])
+		require.Equal(t, "How to deploy agents to production.", document.Metadata[knowledge.MetadataKeyDescription])
+		require.NotEmpty(t, document.Embeddings)
+	}
+
+	_, _, err = knowledge.ProcessDocumentsByType(ctx, nil, &knowledge.DocumentReader{
+		Content:     strings.NewReader("<html><body><nav><a href='/'>Home</a></nav></body></html>"),
+		ContentType: "text/html",
+	}, slog.Default(), conf, knowledge.NewHashEmbedder(32), 1)
+	require.ErrorContains(t, err, "no content found in HTML")
+}
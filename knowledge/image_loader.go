@@ -24,21 +24,21 @@ const (
 	SourceTypeImage = "image"
 )
 
-// IndexKnowledgeFromImages processes image files and creates searchable knowledge from images
+// IndexKnowledgeFromImages processes image files and creates searchable knowledge from images. The knowledge
+// stored before is replaced, and the images that did not change keep their embeddings
 func (s *service) IndexKnowledgeFromImages(ctx context.Context, id string, input iter.Seq2[*ImageReader, error], metadata map[string]any) (*Knowledge, error) {
-	// First, delete existing knowledge for this ID
-	if id != "" {
-		if err := s.DeleteKnowledge(ctx, id); err != nil {
-			return nil, errors.Wrapf(err, "failed to delete existing knowledge")
-		}
+	embedder, err := s.embedderFor(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-
-	knowledge, err := ProcessKnowledgeFromMultipleImages(ctx, s.genkit, id, input, s.logger, s.config, s.embedder, metadata)
+	knowledge, err := ProcessKnowledgeFromMultipleImages(ctx, s.genkit, id, input, s.logger, s.config, embedder.withImages(), metadata)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to process knowledge from images")
 	}
+	embedder.setContentHashes(knowledge.Documents)
+	knowledge.Embedding = s.embeddingModel()
 
-	// Store all items
+	// Store all items, replacing the documents stored before at once
 	if err := s.store.Store(ctx, knowledge); err != nil {
 		return nil, errors.Wrapf(err, "failed to store knowledge")
 	}
@@ -133,7 +133,11 @@ func ProcessKnowledgeFromMultipleImages(
 		imageData[i] = imgBytes
 	}
 
-	embeddings, err := embedder.EmbedImageFiles(ctx, "image/jpeg", imageData...)
+	imageEmbedder, err := asImageEmbedder(embedder)
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := imageEmbedder.EmbedImageFiles(ctx, "image/jpeg", imageData...)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to generate vision embeddings")
 	}
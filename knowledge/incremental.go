@@ -0,0 +1,281 @@
+package knowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"iter"
+	"log/slog"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/samber/lo"
+)
+
+// reusingEmbedder embeds the contents of documents with its embedder, except the contents whose embeddings are
+// already stored in the knowledge by the same embedder, which are reused. It remembers the content hashes of the
+// embeddings it returns
+type reusingEmbedder struct {
+	Embedder
+
+	store       Store
+	knowledgeId string
+	logger      *slog.Logger
+	// reuse is false if the stored embeddings of the knowledge come from another embedding model
+	reuse bool
+
+	// embedded are the content hashes of the texts and images it returned embeddings of
+	embedded map[string]bool
+}
+
+// reusingImageEmbedder is a reusingEmbedder of an ImageEmbedder
+type reusingImageEmbedder struct {
+	*reusingEmbedder
+
+	imageEmbedder ImageEmbedder
+}
+
+var (
+	_ Embedder      = (*reusingEmbedder)(nil)
+	_ ImageEmbedder = (*reusingImageEmbedder)(nil)
+)
+
+// textContentHash identifies a text embedded for a document
+func textContentHash(text string) string {
+	sum := sha256.Sum256([]byte("text:" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// imageContentHash identifies an image embedded for a document
+func imageContentHash(data []byte) string {
+	h := sha256.New()
+	h.Write([]byte("image:"))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// embedderFor returns the embedder indexing documents in the knowledge
+func (s *service) embedderFor(ctx context.Context, knowledgeId string) (*reusingEmbedder, error) {
+	models, err := s.store.GetEmbeddingModels(ctx, []string{knowledgeId})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get embedding model of knowledge %s", knowledgeId)
+	}
+
+	return &reusingEmbedder{
+		Embedder:    s.embedder,
+		store:       s.store,
+		knowledgeId: knowledgeId,
+		logger:      s.logger,
+		reuse:       models[knowledgeId] == s.embeddingModel(),
+		embedded:    make(map[string]bool),
+	}, nil
+}
+
+// withImages returns the embedder with the image methods of its embedder, if it embeds images
+func (e *reusingEmbedder) withImages() Embedder {
+	if imageEmbedder, ok := e.Embedder.(ImageEmbedder); ok {
+		return &reusingImageEmbedder{reusingEmbedder: e, imageEmbedder: imageEmbedder}
+	}
+	return e
+}
+
+// EmbedTexts implements Embedder.EmbedTexts, reusing the stored embeddings of documents
+func (e *reusingEmbedder) EmbedTexts(ctx context.Context, taskType EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	if taskType != EmbeddingTaskTypeDocument {
+		return e.Embedder.EmbedTexts(ctx, taskType, texts...)
+	}
+
+	hashes := lo.Map(texts, func(text string, _ int) string {
+		return textContentHash(text)
+	})
+	return e.embed(ctx, hashes, func(missing []int) ([][]float32, error) {
+		return e.Embedder.EmbedTexts(ctx, taskType, lo.Map(missing, func(i int, _ int) string {
+			return texts[i]
+		})...)
+	})
+}
+
+// EmbedImageUrls implements ImageEmbedder.EmbedImageUrls. The images of URLs may change, so they are always embedded
+func (e *reusingImageEmbedder) EmbedImageUrls(ctx context.Context, imageUrls ...string) ([][]float32, error) {
+	return e.imageEmbedder.EmbedImageUrls(ctx, imageUrls...)
+}
+
+// EmbedImageFiles implements ImageEmbedder.EmbedImageFiles, reusing the stored embeddings of documents
+func (e *reusingImageEmbedder) EmbedImageFiles(ctx context.Context, mimeType string, imageFiles ...[]byte) ([][]float32, error) {
+	hashes := lo.Map(imageFiles, func(data []byte, _ int) string {
+		return imageContentHash(data)
+	})
+	return e.embed(ctx, hashes, func(missing []int) ([][]float32, error) {
+		return e.imageEmbedder.EmbedImageFiles(ctx, mimeType, lo.Map(missing, func(i int, _ int) []byte {
+			return imageFiles[i]
+		})...)
+	})
+}
+
+// embed returns the embeddings of the contents of hashes, the stored ones and the ones embedMissing computes from
+// the indices of the others
+func (e *reusingEmbedder) embed(ctx context.Context, hashes []string, embedMissing func(missing []int) ([][]float32, error)) ([][]float32, error) {
+	stored := map[string][]float32{}
+	if e.reuse {
+		var err error
+		if stored, err = e.store.GetEmbeddingsByContentHash(ctx, e.knowledgeId, lo.Uniq(hashes)); err != nil {
+			return nil, errors.Wrapf(err, "failed to get stored embeddings")
+		}
+	}
+
+	embeddings := make([][]float32, len(hashes))
+	var missing []int
+	for i, hash := range hashes {
+		if embedding, ok := stored[hash]; ok {
+			embeddings[i] = embedding
+		} else {
+			missing = append(missing, i)
+		}
+	}
+
+	if len(missing) > 0 {
+		embedded, err := embedMissing(missing)
+		if err != nil {
+			return nil, err
+		}
+		if len(embedded) != len(missing) {
+			return nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(embedded), len(missing))
+		}
+		for j, i := range missing {
+			embeddings[i] = embedded[j]
+		}
+	}
+
+	for _, hash := range hashes {
+		e.embedded[hash] = true
+	}
+	e.logger.Debug("embedded documents", "knowledge_id", e.knowledgeId, "reused", len(hashes)-len(missing), "embedded", len(missing))
+
+	return embeddings, nil
+}
+
+// setContentHashes sets the content hash of the documents embedded by the embedder: the hash of their image if
+// the embedder embedded it, or else the hash of their embedding text if the embedder embedded it
+func (e *reusingEmbedder) setContentHashes(documents []*Document) {
+	for _, doc := range documents {
+		if len(doc.Embeddings) == 0 {
+			continue
+		}
+		if doc.Content.Type() == ContentTypeImage {
+			if image, err := base64.StdEncoding.DecodeString(doc.Content.Image); err == nil {
+				if hash := imageContentHash(image); e.embedded[hash] {
+					doc.ContentHash = hash
+					continue
+				}
+			}
+		}
+		if hash := textContentHash(doc.EmbeddingText); e.embedded[hash] {
+			doc.ContentHash = hash
+		}
+	}
+}
+
+// UpsertDocuments implements Service.UpsertDocuments
+func (s *service) UpsertDocuments(ctx context.Context, knowledgeId string, inputs iter.Seq2[*DocumentReader, error]) ([]*Document, error) {
+	if knowledgeId == "" {
+		return nil, errors.New("knowledge ID is required")
+	}
+
+	model := s.embeddingModel()
+	models, err := s.store.GetEmbeddingModels(ctx, []string{knowledgeId})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get embedding model of knowledge %s", knowledgeId)
+	}
+	if stored, ok := models[knowledgeId]; ok && !stored.IsZero() && stored != model {
+		return nil, errors.Errorf("knowledge %s is embedded with %s, not %s, re-embed it before adding documents", knowledgeId, stored, model)
+	}
+
+	embedder, err := s.embedderFor(ctx, knowledgeId)
+	if err != nil {
+		return nil, err
+	}
+	documentEmbedder := embedder.withImages()
+	var (
+		documents   []*Document
+		documentIds []string
+	)
+	for input, err := range inputs {
+		if err != nil {
+			return nil, err
+		}
+		if input.ID == "" {
+			return nil, errors.New("document ID is required to upsert documents")
+		}
+		if slices.Contains(documentIds, input.ID) {
+			return nil, errors.Errorf("duplicate document ID %s", input.ID)
+		}
+		documentIds = append(documentIds, input.ID)
+
+		chunks, docMetadata, err := ProcessDocumentsByType(ctx, s.genkit, input, s.logger, s.config, documentEmbedder, 1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to process document %s", input.ID)
+		}
+
+		sourceType := getSourceType(input)
+		for i, chunk := range chunks {
+			chunk.ID = fmt.Sprintf("%s_%s_%d", knowledgeId, input.ID, i+1)
+			if chunk.Metadata == nil {
+				chunk.Metadata = make(map[string]any)
+			}
+			chunk.Metadata[MetadataKeyDocumentID] = input.ID
+			chunk.Metadata["source_content_type"] = input.ContentType
+			chunk.Metadata["source_type"] = sourceType
+			for k, v := range docMetadata {
+				if _, exists := chunk.Metadata[k]; !exists {
+					chunk.Metadata[k] = v
+				}
+			}
+		}
+		embedder.setContentHashes(chunks)
+		documents = append(documents, chunks...)
+	}
+
+	// The chunks of the previous versions of the documents are replaced, however many there were
+	staleIds, err := s.documentChunkIds(ctx, knowledgeId, documentIds)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.UpdateDocuments(ctx, knowledgeId, model, documents, staleIds); err != nil {
+		return nil, errors.Wrapf(err, "failed to update documents")
+	}
+
+	return documents, nil
+}
+
+// DeleteDocuments implements Service.DeleteDocuments
+func (s *service) DeleteDocuments(ctx context.Context, knowledgeId string, documentIds ...string) error {
+	chunkIds, err := s.documentChunkIds(ctx, knowledgeId, documentIds)
+	if err != nil {
+		return err
+	}
+	if len(chunkIds) == 0 {
+		return nil
+	}
+	return errors.Wrapf(s.store.UpdateDocuments(ctx, knowledgeId, EmbeddingModel{}, nil, chunkIds), "failed to delete documents")
+}
+
+// documentChunkIds returns the IDs of the stored chunks of the documents of the knowledge
+func (s *service) documentChunkIds(ctx context.Context, knowledgeId string, documentIds []string) ([]string, error) {
+	knowledge, err := s.store.GetKnowledgeById(ctx, knowledgeId)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get knowledge")
+	}
+	if knowledge == nil {
+		return nil, nil
+	}
+
+	var chunkIds []string
+	for _, doc := range knowledge.Documents {
+		if documentId, ok := doc.Metadata[MetadataKeyDocumentID].(string); ok && slices.Contains(documentIds, documentId) {
+			chunkIds = append(chunkIds, doc.ID)
+		}
+	}
+	return chunkIds, nil
+}
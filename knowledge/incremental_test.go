@@ -0,0 +1,217 @@
+package knowledge_test
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+// countingEmbedder counts the texts its embedder embeds for documents
+type countingEmbedder struct {
+	knowledge.Embedder
+	embedded int
+}
+
+func (e *countingEmbedder) EmbedTexts(ctx context.Context, taskType knowledge.EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	if taskType == knowledge.EmbeddingTaskTypeDocument {
+		e.embedded += len(texts)
+	}
+	return e.Embedder.EmbedTexts(ctx, taskType, texts...)
+}
+
+func textDocuments(docs ...*knowledge.DocumentReader) func(yield func(*knowledge.DocumentReader, error) bool) {
+	return func(yield func(*knowledge.DocumentReader, error) bool) {
+		for _, doc := range docs {
+			if !yield(doc, nil) {
+				return
+			}
+		}
+	}
+}
+
+func textDocument(id, text string) *knowledge.DocumentReader {
+	return &knowledge.DocumentReader{ID: id, Content: strings.NewReader(text), ContentType: "text/plain"}
+}
+
+func newIncrementalTestService(t *testing.T, store knowledge.Store) (knowledge.Service, *countingEmbedder) {
+	t.Helper()
+
+	conf := config.NewKnowledgeConfig()
+	conf.RerankEnabled = false
+	embedder := &countingEmbedder{Embedder: knowledge.NewHashEmbedder(64)}
+	service, err := knowledge.NewServiceWithStore(context.Background(), conf, &config.ModelConfig{}, slog.Default(), store, knowledge.WithEmbedder(embedder))
+	require.NoError(t, err)
+	return service, embedder
+}
+
+func newIncrementalTestStores() map[string]func(t *testing.T) knowledge.Store {
+	return map[string]func(t *testing.T) knowledge.Store{
+		"memory": func(t *testing.T) knowledge.Store {
+			return knowledge.NewInMemoryStore()
+		},
+		"sqlite": func(t *testing.T) knowledge.Store {
+			store, err := knowledge.NewSqliteStore(filepath.Join(t.TempDir(), "knowledge.db"), 64)
+			require.NoError(t, err)
+			return store
+		},
+	}
+}
+
+func storedDocumentIds(t *testing.T, store knowledge.Store, knowledgeId string) []string {
+	t.Helper()
+
+	kl, err := store.GetKnowledgeById(context.Background(), knowledgeId)
+	require.NoError(t, err)
+	if kl == nil {
+		return nil
+	}
+	ids := make([]string, len(kl.Documents))
+	for i, doc := range kl.Documents {
+		ids[i] = doc.ID
+	}
+	return ids
+}
+
+func TestUpsertDocuments(t *testing.T) {
+	for name, newStore := range newIncrementalTestStores() {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			defer store.Close()
+			service, embedder := newIncrementalTestService(t, store)
+
+			docs, err := service.UpsertDocuments(ctx, "manual", textDocuments(
+				textDocument("install", "Run the installer and accept the license"),
+				textDocument("billing", "Invoices are sent on the first day of the month"),
+				textDocument("support", "Write to the support team for help"),
+			))
+			require.NoError(t, err)
+			require.Len(t, docs, 3)
+			require.Equal(t, 3, embedder.embedded)
+			require.Equal(t, "install", docs[0].Metadata[knowledge.MetadataKeyDocumentID])
+			require.NotEmpty(t, docs[0].ContentHash)
+			require.ElementsMatch(t, []string{"manual_install_1", "manual_billing_1", "manual_support_1"}, storedDocumentIds(t, store, "manual"))
+
+			// Only the changed document is embedded again
+			embedder.embedded = 0
+			_, err = service.UpsertDocuments(ctx, "manual", textDocuments(
+				textDocument("billing", "Invoices are sent on the last day of the month"),
+				textDocument("install", "Run the installer and accept the license"),
+			))
+			require.NoError(t, err)
+			require.Equal(t, 1, embedder.embedded)
+			require.ElementsMatch(t, []string{"manual_install_1", "manual_billing_1", "manual_support_1"}, storedDocumentIds(t, store, "manual"))
+
+			results, err := service.RetrieveRelevantKnowledge(ctx, "invoices last day", 1, []string{"manual"}, knowledge.WithSearchMode(config.SearchModeKeyword))
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Contains(t, results[0].Content.Text, "last day")
+
+			results, err = service.RetrieveRelevantKnowledge(ctx, "first", 5, []string{"manual"}, knowledge.WithSearchMode(config.SearchModeKeyword))
+			require.NoError(t, err)
+			require.Empty(t, results)
+
+			// The reused embeddings are still searched
+			results, err = service.RetrieveRelevantKnowledge(ctx, "Run the installer and accept the license", 1, []string{"manual"}, knowledge.WithSearchMode(config.SearchModeVector))
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Equal(t, "manual_install_1", results[0].ID)
+
+			require.NoError(t, service.DeleteDocuments(ctx, "manual", "support", "unknown"))
+			require.ElementsMatch(t, []string{"manual_install_1", "manual_billing_1"}, storedDocumentIds(t, store, "manual"))
+
+			_, err = service.UpsertDocuments(ctx, "manual", textDocuments(textDocument("", "No ID")))
+			require.ErrorContains(t, err, "document ID is required")
+
+			_, err = service.UpsertDocuments(ctx, "manual", textDocuments(textDocument("faq", "One"), textDocument("faq", "Two")))
+			require.ErrorContains(t, err, "duplicate document ID")
+			require.ElementsMatch(t, []string{"manual_install_1", "manual_billing_1"}, storedDocumentIds(t, store, "manual"))
+		})
+	}
+}
+
+func TestUpsertDocuments_Unchanged(t *testing.T) {
+	for name, newStore := range newIncrementalTestStores() {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			defer store.Close()
+			service, embedder := newIncrementalTestService(t, store)
+
+			guide := strings.Repeat("# Install\n\nRun the installer and accept the license.\n\n# Billing\n\nInvoices are monthly.\n\n", 40)
+			upsert := func() []*knowledge.Document {
+				docs, err := service.UpsertDocuments(ctx, "manual", textDocuments(
+					&knowledge.DocumentReader{ID: "guide", Content: strings.NewReader(guide), ContentType: "text/markdown"},
+					textDocument("support", "Write to the support team for help"),
+				))
+				require.NoError(t, err)
+				return docs
+			}
+
+			docs := upsert()
+			require.Greater(t, len(docs), 2)
+			require.Positive(t, embedder.embedded)
+
+			// Every chunk records the hash of the content it was embedded from, so nothing is embedded again
+			kl, err := store.GetKnowledgeById(ctx, "manual")
+			require.NoError(t, err)
+			for _, doc := range kl.Documents {
+				require.NotEmpty(t, doc.ContentHash, doc.ID)
+			}
+
+			embedder.embedded = 0
+			require.Len(t, upsert(), len(docs))
+			require.Zero(t, embedder.embedded)
+		})
+	}
+}
+
+func TestIndexKnowledge_ReusesEmbeddings(t *testing.T) {
+	for name, newStore := range newIncrementalTestStores() {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			defer store.Close()
+			service, embedder := newIncrementalTestService(t, store)
+
+			texts := []string{"Paris is the capital of France", "Berlin is the capital of Germany", "Rome is the capital of Italy"}
+			documents := func(texts ...string) func(yield func(*knowledge.DocumentReader, error) bool) {
+				docs := make([]*knowledge.DocumentReader, len(texts))
+				for i, text := range texts {
+					docs[i] = &knowledge.DocumentReader{Content: strings.NewReader(text), ContentType: "text/plain"}
+				}
+				return textDocuments(docs...)
+			}
+
+			_, err := service.IndexKnowledgeFromDocuments(ctx, "capitals", documents(texts...))
+			require.NoError(t, err)
+			require.Equal(t, 3, embedder.embedded)
+
+			embedder.embedded = 0
+			_, err = service.IndexKnowledgeFromDocuments(ctx, "capitals", documents(texts...))
+			require.NoError(t, err)
+			require.Equal(t, 0, embedder.embedded)
+
+			// A removed document is not kept around
+			embedder.embedded = 0
+			kl, err := service.IndexKnowledgeFromDocuments(ctx, "capitals", documents(texts[0], "Madrid is the capital of Spain"))
+			require.NoError(t, err)
+			require.Equal(t, 1, embedder.embedded)
+			require.Len(t, storedDocumentIds(t, store, "capitals"), 2)
+			require.ElementsMatch(t, storedDocumentIds(t, store, "capitals"), []string{kl.Documents[0].ID, kl.Documents[1].ID})
+
+			embedder.embedded = 0
+			_, err = service.IndexKnowledgeFromMap(ctx, "cities", []map[string]any{{"name": "Lyon"}, {"name": "Munich"}})
+			require.NoError(t, err)
+			_, err = service.IndexKnowledgeFromMap(ctx, "cities", []map[string]any{{"name": "Lyon"}, {"name": "Milan"}})
+			require.NoError(t, err)
+			require.Equal(t, 3, embedder.embedded)
+		})
+	}
+}
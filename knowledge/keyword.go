@@ -0,0 +1,167 @@
+package knowledge
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// KeywordSearcher is implemented by stores that also search their documents by keywords
+type KeywordSearcher interface {
+	// KeywordSearch ranks the documents matching any word of the query by BM25, best first. The score of the
+	// results is the BM25 score, which is only comparable between results of the same query. Documents are
+	// restricted like in Store.Search
+	KeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error)
+}
+
+const (
+	// bm25K1 and bm25B are the usual BM25 parameters, also used by SQLite FTS5
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// tokenize splits text into lower case words, with the same rules as the unicode61 tokenizer of SQLite: any
+// character that is not a letter or a number separates words, so "ERR-1042" is "err" and "1042"
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// keywordText is the text of the document indexed for keyword search
+func keywordText(doc *Document) string {
+	if doc.EmbeddingText != "" {
+		return doc.EmbeddingText
+	}
+	return doc.Content.Text
+}
+
+// bm25 scores a term occurring tf times in a document of docLen words, when df of the n documents averaging
+// avgDocLen words contain it
+func bm25(tf, docLen, avgDocLen float64, df, n int) float64 {
+	idf := math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+	norm := 1 - bm25B
+	if avgDocLen > 0 {
+		norm += bm25B * docLen / avgDocLen
+	}
+	return idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
+
+// invertedIndex is the BM25 index of the documents of an InMemoryStore
+type invertedIndex struct {
+	postings  map[string]map[*Document]int // term -> document -> term frequency
+	lengths   map[*Document]int
+	totalLen  int
+	knowledge map[*Document]string
+}
+
+func newInvertedIndex() *invertedIndex {
+	return &invertedIndex{
+		postings:  make(map[string]map[*Document]int),
+		lengths:   make(map[*Document]int),
+		knowledge: make(map[*Document]string),
+	}
+}
+
+func (idx *invertedIndex) add(knowledgeId string, doc *Document) {
+	terms := tokenize(keywordText(doc))
+	for _, term := range terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[*Document]int)
+		}
+		idx.postings[term][doc]++
+	}
+	idx.lengths[doc] = len(terms)
+	idx.totalLen += len(terms)
+	idx.knowledge[doc] = knowledgeId
+}
+
+func (idx *invertedIndex) remove(doc *Document) {
+	length, ok := idx.lengths[doc]
+	if !ok {
+		return
+	}
+	for _, term := range tokenize(keywordText(doc)) {
+		delete(idx.postings[term], doc)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.lengths, doc)
+	delete(idx.knowledge, doc)
+	idx.totalLen -= length
+}
+
+// search returns the BM25 scores of the documents matching any term of the query
+func (idx *invertedIndex) search(query string, allowed func(knowledgeId string, doc *Document) bool) map[*Document]float64 {
+	n := len(idx.lengths)
+	if n == 0 {
+		return nil
+	}
+	avgDocLen := float64(idx.totalLen) / float64(n)
+
+	scores := make(map[*Document]float64)
+	seen := make(map[string]bool)
+	for _, term := range tokenize(query) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+
+		postings := idx.postings[term]
+		for doc, tf := range postings {
+			if !allowed(idx.knowledge[doc], doc) {
+				continue
+			}
+			scores[doc] += bm25(float64(tf), float64(idx.lengths[doc]), avgDocLen, len(postings), n)
+		}
+	}
+	return scores
+}
+
+// rankedList is a ranking of search results, best first, with the weight of the ranking in the fusion
+type rankedList struct {
+	results []KnowledgeSearchResult
+	weight  float64
+}
+
+// fuseRankings merges rankings with reciprocal rank fusion: a document scores the sum of weight / (k + rank)
+// over the rankings it appears in, with ranks starting at 1. Only the ranks matter, so rankings of scores that
+// are not comparable, like cosine similarity and BM25, can be merged
+func fuseRankings(k float64, lists ...rankedList) []KnowledgeSearchResult {
+	type fused struct {
+		result KnowledgeSearchResult
+		score  float64
+		order  int
+	}
+
+	byId := make(map[string]*fused)
+	var all []*fused
+	for _, list := range lists {
+		for rank, result := range list.results {
+			f, ok := byId[result.ID]
+			if !ok {
+				f = &fused{result: result, order: len(all)}
+				byId[result.ID] = f
+				all = append(all, f)
+			}
+			f.score += list.weight / (k + float64(rank+1))
+		}
+	}
+
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].order < all[j].order
+	})
+
+	results := make([]KnowledgeSearchResult, len(all))
+	for i, f := range all {
+		results[i] = f.result
+		results[i].Score = float32(f.score)
+	}
+	return results
+}
@@ -0,0 +1,205 @@
+package knowledge_test
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+var keywordTestTexts = map[string]string{
+	"doc-quota":    "Error ERR-1042 occurs when the disk quota of the account is exceeded",
+	"doc-disk":     "Storage problems: the disk is full and writes to the disk fail",
+	"doc-sku":      "Product SKU AB-7731 is a wireless keyboard with a numeric pad",
+	"doc-shipping": "Keyboards and mice ship within two days",
+}
+
+func newKeywordTestKnowledge(t *testing.T, embedder knowledge.Embedder) []*knowledge.Knowledge {
+	t.Helper()
+
+	var knowledges []*knowledge.Knowledge
+	for _, group := range []struct {
+		id   string
+		docs []string
+	}{
+		{id: "support", docs: []string{"doc-quota", "doc-disk"}},
+		{id: "catalog", docs: []string{"doc-sku", "doc-shipping"}},
+	} {
+		kl := &knowledge.Knowledge{ID: group.id, Metadata: map[string]any{}}
+		for _, id := range group.docs {
+			embeddings, err := embedder.EmbedTexts(context.Background(), knowledge.EmbeddingTaskTypeDocument, keywordTestTexts[id])
+			require.NoError(t, err)
+			kl.Documents = append(kl.Documents, &knowledge.Document{
+				ID:            id,
+				Content:       knowledge.Content{MIMEType: "text/plain", Text: keywordTestTexts[id]},
+				EmbeddingText: keywordTestTexts[id],
+				Embeddings:    embeddings[0],
+				Metadata:      map[string]any{},
+			})
+		}
+		knowledges = append(knowledges, kl)
+	}
+	return knowledges
+}
+
+func resultIds(results []knowledge.KnowledgeSearchResult) []string {
+	ids := make([]string, len(results))
+	for i, result := range results {
+		ids[i] = result.ID
+	}
+	return ids
+}
+
+func TestKeywordSearch(t *testing.T) {
+	embedder := knowledge.NewHashEmbedder(64)
+
+	for name, newStore := range map[string]func(t *testing.T) knowledge.Store{
+		"memory": func(t *testing.T) knowledge.Store {
+			return knowledge.NewInMemoryStore()
+		},
+		"sqlite": func(t *testing.T) knowledge.Store {
+			store, err := knowledge.NewSqliteStore(filepath.Join(t.TempDir(), "knowledge.db"), embedder.GetEmbedSize())
+			require.NoError(t, err)
+			return store
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			defer store.Close()
+			for _, kl := range newKeywordTestKnowledge(t, embedder) {
+				require.NoError(t, store.Store(ctx, kl))
+			}
+			searcher := store.(knowledge.KeywordSearcher)
+
+			// Identifiers are matched exactly, whatever their case and punctuation
+			results, err := searcher.KeywordSearch(ctx, "what does err-1042 mean?", 10, nil, nil)
+			require.NoError(t, err)
+			require.NotEmpty(t, results)
+			require.Equal(t, "doc-quota", results[0].ID)
+			require.Greater(t, results[0].Score, float32(0))
+			require.Equal(t, keywordTestTexts["doc-quota"], results[0].Content.Text)
+
+			results, err = searcher.KeywordSearch(ctx, "AB-7731", 10, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"doc-sku"}, resultIds(results))
+
+			// The document repeating the rarer word ranks first
+			results, err = searcher.KeywordSearch(ctx, "disk", 10, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"doc-disk", "doc-quota"}, resultIds(results))
+
+			results, err = searcher.KeywordSearch(ctx, "disk", 1, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"doc-disk"}, resultIds(results))
+
+			results, err = searcher.KeywordSearch(ctx, "disk keyboards", 10, []string{"catalog"}, nil)
+			require.NoError(t, err)
+			require.Equal(t, []string{"doc-shipping"}, resultIds(results))
+
+			results, err = searcher.KeywordSearch(ctx, "\"OR* -(", 10, nil, nil)
+			require.NoError(t, err)
+			require.Empty(t, results)
+
+			// Deleted knowledge is no longer found
+			require.NoError(t, store.DeleteKnowledgeById(ctx, "support"))
+			results, err = searcher.KeywordSearch(ctx, "disk", 10, nil, nil)
+			require.NoError(t, err)
+			require.Empty(t, results)
+		})
+	}
+}
+
+// vectorOnlyStore hides the keyword search of its store
+type vectorOnlyStore struct {
+	store knowledge.Store
+}
+
+func (s vectorOnlyStore) Store(ctx context.Context, kl *knowledge.Knowledge) error {
+	return s.store.Store(ctx, kl)
+}
+
+func (s vectorOnlyStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *knowledge.Filter) ([]knowledge.KnowledgeSearchResult, error) {
+	return s.store.Search(ctx, queryEmbedding, limit, allowedKnowledgeIds, filter)
+}
+
+func (s vectorOnlyStore) UpdateDocuments(ctx context.Context, knowledgeId string, model knowledge.EmbeddingModel, documents []*knowledge.Document, deletedDocumentIds []string) error {
+	return s.store.UpdateDocuments(ctx, knowledgeId, model, documents, deletedDocumentIds)
+}
+
+func (s vectorOnlyStore) UpdateEmbeddings(ctx context.Context, knowledgeId string, model knowledge.EmbeddingModel, embeddings map[string][]float32) error {
+	return s.store.UpdateEmbeddings(ctx, knowledgeId, model, embeddings)
+}
+
+func (s vectorOnlyStore) GetEmbeddingModels(ctx context.Context, knowledgeIds []string) (map[string]knowledge.EmbeddingModel, error) {
+	return s.store.GetEmbeddingModels(ctx, knowledgeIds)
+}
+
+func (s vectorOnlyStore) GetEmbeddingsByContentHash(ctx context.Context, knowledgeId string, contentHashes []string) (map[string][]float32, error) {
+	return s.store.GetEmbeddingsByContentHash(ctx, knowledgeId, contentHashes)
+}
+
+func (s vectorOnlyStore) GetKnowledgeById(ctx context.Context, knowledgeId string) (*knowledge.Knowledge, error) {
+	return s.store.GetKnowledgeById(ctx, knowledgeId)
+}
+
+func (s vectorOnlyStore) DeleteKnowledgeById(ctx context.Context, knowledgeId string) error {
+	return s.store.DeleteKnowledgeById(ctx, knowledgeId)
+}
+
+func (s vectorOnlyStore) Close() error {
+	return s.store.Close()
+}
+
+func TestRetrieveRelevantKnowledge_SearchModes(t *testing.T) {
+	ctx := context.Background()
+	embedder := knowledge.NewHashEmbedder(64)
+
+	conf := config.NewKnowledgeConfig()
+	conf.RerankEnabled = false
+	conf.SearchMode = config.SearchModeHybrid
+
+	store := knowledge.NewInMemoryStore()
+	for _, kl := range newKeywordTestKnowledge(t, embedder) {
+		require.NoError(t, store.Store(ctx, kl))
+	}
+	service, err := knowledge.NewServiceWithStore(ctx, conf, &config.ModelConfig{}, slog.Default(), store, knowledge.WithEmbedder(embedder))
+	require.NoError(t, err)
+
+	for _, mode := range []string{"", config.SearchModeVector, config.SearchModeKeyword, config.SearchModeHybrid} {
+		t.Run("mode "+mode, func(t *testing.T) {
+			var opts []knowledge.RetrieveOption
+			if mode != "" {
+				opts = append(opts, knowledge.WithSearchMode(mode))
+			}
+			results, err := service.RetrieveRelevantKnowledge(ctx, "ERR-1042 disk quota", 2, nil, opts...)
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			require.Equal(t, "doc-quota", results[0].ID)
+			require.GreaterOrEqual(t, results[0].Score, results[1].Score)
+		})
+	}
+
+	// Hybrid search finds the documents of either ranking
+	results, err := service.RetrieveRelevantKnowledge(ctx, "SKU AB-7731", 4, []string{"catalog"})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "doc-sku", results[0].ID)
+
+	_, err = service.RetrieveRelevantKnowledge(ctx, "disk", 2, nil, knowledge.WithSearchMode("fuzzy"))
+	require.ErrorContains(t, err, "unknown search mode")
+
+	vectorOnly, err := knowledge.NewServiceWithStore(ctx, conf, &config.ModelConfig{}, slog.Default(), vectorOnlyStore{store}, knowledge.WithEmbedder(embedder))
+	require.NoError(t, err)
+	_, err = vectorOnly.RetrieveRelevantKnowledge(ctx, "disk", 2, nil, knowledge.WithSearchMode(config.SearchModeKeyword))
+	require.ErrorContains(t, err, "does not support keyword search")
+
+	// Hybrid search falls back to vector search
+	results, err = vectorOnly.RetrieveRelevantKnowledge(ctx, "disk", 2, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+}
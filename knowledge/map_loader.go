@@ -10,20 +10,15 @@ import (
 	"github.com/pkg/errors"
 )
 
-// IndexKnowledge indexes knowledge documents for an agent
+// IndexKnowledge indexes knowledge documents for an agent. The knowledge stored before is replaced, and the
+// items that did not change keep their embeddings
 func (s *service) IndexKnowledgeFromMap(ctx context.Context, id string, input []map[string]any) (*Knowledge, error) {
-	// First, delete existing knowledge for this agent
-	if id != "" {
-		if err := s.DeleteKnowledge(ctx, id); err != nil {
-			return nil, errors.Wrapf(err, "failed to delete existing knowledge")
-		}
-	}
-
 	knowledge := &Knowledge{
 		ID: id,
 		Metadata: map[string]any{
 			MetadataKeySourceType: SourceTypeMap,
 		},
+		Embedding: s.embeddingModel(),
 	}
 
 	// Process knowledge into text chunks
@@ -39,7 +34,11 @@ func (s *service) IndexKnowledgeFromMap(ctx context.Context, id string, input []
 	}
 
 	// Generate embeddings
-	embeddings, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeDocument, gog.Map(knowledge.Documents, func(d *Document) string {
+	embedder, err := s.embedderFor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := embedder.EmbedTexts(ctx, EmbeddingTaskTypeDocument, gog.Map(knowledge.Documents, func(d *Document) string {
 		return d.EmbeddingText
 	})...)
 	if err != nil {
@@ -54,8 +53,9 @@ func (s *service) IndexKnowledgeFromMap(ctx context.Context, id string, input []
 	for i := range knowledge.Documents {
 		knowledge.Documents[i].Embeddings = embeddings[i]
 	}
+	embedder.setContentHashes(knowledge.Documents)
 
-	// Store all items
+	// Store all items, replacing the documents stored before at once
 	if err := s.store.Store(ctx, knowledge); err != nil {
 		return nil, errors.Wrapf(err, "failed to store knowledge")
 	}
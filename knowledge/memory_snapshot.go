@@ -0,0 +1,280 @@
+package knowledge
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// memorySnapshotVersion is the version of the snapshot format of InMemoryStore
+const memorySnapshotVersion = 1
+
+type (
+	// memorySnapshot is the JSON file of a snapshot of an InMemoryStore
+	memorySnapshot struct {
+		Version    int                        `json:"version"`
+		Knowledges []*memorySnapshotKnowledge `json:"knowledges"`
+		// Index is the HNSW graph of the store, if it has one
+		Index *hnswSnapshot `json:"index,omitempty"`
+	}
+
+	memorySnapshotKnowledge struct {
+		ID        string                    `json:"id"`
+		Metadata  map[string]any            `json:"metadata"`
+		Embedding EmbeddingModel            `json:"embedding"`
+		Documents []*memorySnapshotDocument `json:"documents"`
+	}
+
+	memorySnapshotDocument struct {
+		ID      string  `json:"id"`
+		Content Content `json:"content"`
+		// Embeddings are the little-endian float32 values of the embeddings, much smaller than JSON numbers
+		Embeddings    []byte         `json:"embeddings,omitempty"`
+		EmbeddingText string         `json:"embeddingText"`
+		Metadata      map[string]any `json:"metadata"`
+		ContentHash   string         `json:"contentHash,omitempty"`
+	}
+
+	hnswSnapshot struct {
+		M              int                `json:"m"`
+		EfConstruction int                `json:"efConstruction"`
+		Entry          int32              `json:"entry"`
+		Nodes          []hnswSnapshotNode `json:"nodes"`
+	}
+
+	hnswSnapshotNode struct {
+		KnowledgeID string    `json:"knowledgeId"`
+		DocumentID  string    `json:"documentId"`
+		Neighbors   [][]int32 `json:"neighbors"`
+	}
+)
+
+// SaveSnapshot saves the knowledge of the store and its HNSW graph to the file, replacing it atomically
+func (i *InMemoryStore) SaveSnapshot(path string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.saveSnapshot(path)
+}
+
+func (i *InMemoryStore) saveSnapshot(path string) error {
+	snapshot := memorySnapshot{Version: memorySnapshotVersion}
+
+	ids := make([]string, 0, len(i.knowledges))
+	for id := range i.knowledges {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		knowledge := i.knowledges[id]
+		snapshotKnowledge := &memorySnapshotKnowledge{
+			ID:        knowledge.ID,
+			Metadata:  knowledge.Metadata,
+			Embedding: knowledge.Embedding,
+			Documents: make([]*memorySnapshotDocument, len(knowledge.Documents)),
+		}
+		for idx, doc := range knowledge.Documents {
+			snapshotKnowledge.Documents[idx] = &memorySnapshotDocument{
+				ID:            doc.ID,
+				Content:       doc.Content,
+				Embeddings:    encodeEmbeddings(doc.Embeddings),
+				EmbeddingText: doc.EmbeddingText,
+				Metadata:      doc.Metadata,
+				ContentHash:   doc.ContentHash,
+			}
+		}
+		snapshot.Knowledges = append(snapshot.Knowledges, snapshotKnowledge)
+	}
+
+	if i.vectorIndex != nil {
+		// The removed nodes are dropped so that the node IDs of the snapshot are the positions of its nodes
+		i.vectorIndex.compact()
+		index := &hnswSnapshot{
+			M:              i.vectorIndex.m,
+			EfConstruction: i.vectorIndex.efConstruction,
+			Entry:          i.vectorIndex.entry,
+			Nodes:          make([]hnswSnapshotNode, len(i.vectorIndex.nodes)),
+		}
+		for id, node := range i.vectorIndex.nodes {
+			index.Nodes[id] = hnswSnapshotNode{
+				KnowledgeID: node.knowledgeId,
+				DocumentID:  node.doc.ID,
+				Neighbors:   node.neighbors,
+			}
+		}
+		snapshot.Index = index
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode snapshot")
+	}
+
+	// Write to a temporary file renamed over the snapshot, so that a crash never leaves a partial snapshot
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create snapshot directory")
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to create snapshot file")
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed to write snapshot")
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write snapshot")
+	}
+	return errors.Wrapf(os.Rename(tmp.Name(), path), "failed to save snapshot")
+}
+
+// LoadSnapshot replaces the knowledge of the store with the one saved to the file by SaveSnapshot. The HNSW graph
+// of the snapshot is reused if it was built with the same parameters as the index of the store, and rebuilt
+// otherwise
+func (i *InMemoryStore) LoadSnapshot(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read snapshot")
+	}
+	var snapshot memorySnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return errors.Wrapf(err, "failed to decode snapshot %s", path)
+	}
+	if snapshot.Version != memorySnapshotVersion {
+		return errors.Errorf("unsupported snapshot version %d of %s, expected %d", snapshot.Version, path, memorySnapshotVersion)
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.knowledges = make(map[string]*Knowledge, len(snapshot.Knowledges))
+	i.index = newInvertedIndex()
+	documents := make(map[[2]string]*Document)
+	for _, snapshotKnowledge := range snapshot.Knowledges {
+		knowledge := &Knowledge{
+			ID:        snapshotKnowledge.ID,
+			Metadata:  snapshotKnowledge.Metadata,
+			Embedding: snapshotKnowledge.Embedding,
+			Documents: make([]*Document, len(snapshotKnowledge.Documents)),
+		}
+		for idx, snapshotDoc := range snapshotKnowledge.Documents {
+			embeddings, err := decodeEmbeddings(snapshotDoc.Embeddings)
+			if err != nil {
+				return errors.Wrapf(err, "invalid embeddings of document %s in snapshot %s", snapshotDoc.ID, path)
+			}
+			doc := copyStoredDocument(knowledge.ID, &Document{
+				ID:            snapshotDoc.ID,
+				Content:       snapshotDoc.Content,
+				Embeddings:    embeddings,
+				EmbeddingText: snapshotDoc.EmbeddingText,
+				Metadata:      snapshotDoc.Metadata,
+				ContentHash:   snapshotDoc.ContentHash,
+			})
+			knowledge.Documents[idx] = doc
+			documents[[2]string{knowledge.ID, doc.ID}] = doc
+			i.index.add(knowledge.ID, doc)
+		}
+		i.knowledges[knowledge.ID] = knowledge
+	}
+
+	if i.vectorIndex == nil {
+		return nil
+	}
+	index := newHNSWIndex(i.vectorIndex.m, i.vectorIndex.efConstruction, i.vectorIndex.efSearch)
+	if !index.restore(snapshot.Index, documents) {
+		for _, knowledge := range snapshot.Knowledges {
+			for _, doc := range knowledge.Documents {
+				index.add(knowledge.ID, documents[[2]string{knowledge.ID, doc.ID}])
+			}
+		}
+	}
+	i.vectorIndex = index
+	return nil
+}
+
+// restore rebuilds the graph of the snapshot over the documents, keyed by knowledge and document ID. It returns
+// false, leaving the index empty, if the snapshot has no graph, was built with other parameters or does not match
+// the documents
+func (h *hnswIndex) restore(snapshot *hnswSnapshot, documents map[[2]string]*Document) bool {
+	if snapshot == nil || snapshot.M != h.m || snapshot.EfConstruction != h.efConstruction {
+		return false
+	}
+
+	indexed := 0
+	for _, doc := range documents {
+		if len(doc.Embeddings) > 0 {
+			indexed++
+		}
+	}
+	if len(snapshot.Nodes) != indexed || snapshot.Entry >= int32(len(snapshot.Nodes)) || (indexed > 0 && snapshot.Entry < 0) {
+		return false
+	}
+
+	nodes := make([]*hnswNode, len(snapshot.Nodes))
+	nodeIds := make(map[*Document]int32, len(snapshot.Nodes))
+	maxLevel := 0
+	for id, snapshotNode := range snapshot.Nodes {
+		doc, ok := documents[[2]string{snapshotNode.KnowledgeID, snapshotNode.DocumentID}]
+		if !ok || len(doc.Embeddings) == 0 || len(snapshotNode.Neighbors) == 0 {
+			return false
+		}
+		if _, duplicate := nodeIds[doc]; duplicate {
+			return false
+		}
+		for _, neighbors := range snapshotNode.Neighbors {
+			for _, neighbor := range neighbors {
+				if neighbor < 0 || neighbor >= int32(len(snapshot.Nodes)) {
+					return false
+				}
+			}
+		}
+		nodes[id] = &hnswNode{
+			knowledgeId: snapshotNode.KnowledgeID,
+			doc:         doc,
+			vector:      normalize(slices.Clone(doc.Embeddings)),
+			neighbors:   snapshotNode.Neighbors,
+		}
+		nodeIds[doc] = int32(id)
+		maxLevel = max(maxLevel, len(snapshotNode.Neighbors)-1)
+	}
+
+	h.nodes, h.nodeIds, h.entry, h.maxLevel = nodes, nodeIds, snapshot.Entry, maxLevel
+	if len(nodes) == 0 {
+		h.entry = -1
+	}
+	return true
+}
+
+// encodeEmbeddings returns the little-endian float32 values of the embeddings
+func encodeEmbeddings(embeddings []float32) []byte {
+	if len(embeddings) == 0 {
+		return nil
+	}
+	data := make([]byte, 0, len(embeddings)*4)
+	for _, v := range embeddings {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+	return data
+}
+
+// decodeEmbeddings returns the embeddings of encodeEmbeddings
+func decodeEmbeddings(data []byte) ([]float32, error) {
+	if len(data)%4 != 0 {
+		return nil, errors.Errorf("embeddings of %d bytes are not float32 values", len(data))
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	embeddings := make([]float32, len(data)/4)
+	for i := range embeddings {
+		embeddings[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return embeddings, nil
+}
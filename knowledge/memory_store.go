@@ -3,23 +3,82 @@ package knowledge
 import (
 	"context"
 	"math"
+	"os"
 	"slices"
 	"sort"
 	"sync"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/pkg/errors"
 )
 
 type (
 	InMemoryStore struct {
 		mu         sync.RWMutex
 		knowledges map[string]*Knowledge // key: knowledge ID
+		index      *invertedIndex
+		// vectorIndex is the HNSW index of the embeddings, or nil to compare the query with every document
+		vectorIndex *hnswIndex
+		// snapshotPath is the file the store is saved to when it is closed, if any
+		snapshotPath string
 	}
+
+	InMemoryStoreOption func(s *InMemoryStore)
 )
 
+// WithHNSWIndex searches the embeddings with an HNSW index instead of comparing the query with every document, which
+// is faster for tens of thousands of documents but may miss some of the nearest ones. m is the number of neighbors
+// of the nodes of the graph, efConstruction the number of candidates searched when inserting a document and
+// efSearch the number of candidates searched by a query: higher values find more of the nearest documents, more
+// slowly. Parameters that are not positive take their default value
+func WithHNSWIndex(m, efConstruction, efSearch int) InMemoryStoreOption {
+	return func(s *InMemoryStore) {
+		s.vectorIndex = newHNSWIndex(m, efConstruction, efSearch)
+	}
+}
+
+// WithSnapshotPath saves a snapshot of the store to the file when it is closed, see SaveSnapshot
+func WithSnapshotPath(path string) InMemoryStoreOption {
+	return func(s *InMemoryStore) {
+		s.snapshotPath = path
+	}
+}
+
 // NewInMemoryStore creates a new in-memory knowledge store
-func NewInMemoryStore() *InMemoryStore {
-	return &InMemoryStore{
+func NewInMemoryStore(opts ...InMemoryStoreOption) *InMemoryStore {
+	s := &InMemoryStore{
 		knowledges: make(map[string]*Knowledge),
+		index:      newInvertedIndex(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// NewInMemoryStoreFromConfig creates an in-memory knowledge store with the vector index of the config, loading the
+// snapshot of the config if it exists
+func NewInMemoryStoreFromConfig(conf *config.KnowledgeConfig) (*InMemoryStore, error) {
+	var opts []InMemoryStoreOption
+	switch conf.VectorIndex {
+	case "", config.VectorIndexFlat:
+	case config.VectorIndexHNSW:
+		opts = append(opts, WithHNSWIndex(conf.HNSWM, conf.HNSWEfConstruction, conf.HNSWEfSearch))
+	default:
+		return nil, errors.Errorf("unknown vector index %s", conf.VectorIndex)
+	}
+
+	if conf.InMemorySnapshotPath == "" {
+		return NewInMemoryStore(opts...), nil
+	}
+	s := NewInMemoryStore(append(opts, WithSnapshotPath(conf.InMemorySnapshotPath))...)
+	if _, err := os.Stat(conf.InMemorySnapshotPath); os.IsNotExist(err) {
+		return s, nil
+	}
+	if err := s.LoadSnapshot(conf.InMemorySnapshotPath); err != nil {
+		return nil, err
 	}
+	return s, nil
 }
 
 // Store implements Store.Store
@@ -32,6 +91,14 @@ func (i *InMemoryStore) Store(ctx context.Context, knowledge *Knowledge) error {
 		ID:        knowledge.ID,
 		Metadata:  copyMap(knowledge.Metadata),
 		Documents: make([]*Document, len(knowledge.Documents)),
+		Embedding: knowledge.Embedding,
+	}
+
+	// Replace the documents of a knowledge stored before in the indexes
+	if previous, exists := i.knowledges[knowledge.ID]; exists {
+		for _, doc := range previous.Documents {
+			i.unindex(doc)
+		}
 	}
 
 	// Store knowledge
@@ -39,29 +106,154 @@ func (i *InMemoryStore) Store(ctx context.Context, knowledge *Knowledge) error {
 
 	// Store documents
 	for idx, doc := range knowledge.Documents {
-		// Deep copy document
-		storedDoc := &Document{
-			ID:            doc.ID,
-			Content:       doc.Content, // Contents are immutable, so shallow copy is ok
-			Embeddings:    copyFloat32Slice(doc.Embeddings),
-			EmbeddingText: doc.EmbeddingText,
-			Metadata:      copyMap(doc.Metadata),
-		}
+		storedDoc := copyStoredDocument(knowledge.ID, doc)
+		storedKnowledge.Documents[idx] = storedDoc
+		i.addToIndexes(knowledge.ID, storedDoc)
+	}
+
+	return nil
+}
 
-		// Add knowledge ID to document metadata for reference
-		if storedDoc.Metadata == nil {
-			storedDoc.Metadata = make(map[string]any)
+// addToIndexes adds a stored document to the keyword and vector indexes
+func (i *InMemoryStore) addToIndexes(knowledgeId string, doc *Document) {
+	i.index.add(knowledgeId, doc)
+	if i.vectorIndex != nil {
+		i.vectorIndex.add(knowledgeId, doc)
+	}
+}
+
+// unindex removes a stored document from the keyword and vector indexes
+func (i *InMemoryStore) unindex(doc *Document) {
+	i.index.remove(doc)
+	if i.vectorIndex != nil {
+		i.vectorIndex.remove(doc)
+	}
+}
+
+// copyStoredDocument deep copies a document to store it in the knowledge
+func copyStoredDocument(knowledgeId string, doc *Document) *Document {
+	storedDoc := &Document{
+		ID:            doc.ID,
+		Content:       doc.Content, // Contents are immutable, so shallow copy is ok
+		Embeddings:    copyFloat32Slice(doc.Embeddings),
+		EmbeddingText: doc.EmbeddingText,
+		Metadata:      copyMap(doc.Metadata),
+		ContentHash:   doc.ContentHash,
+	}
+
+	// Add knowledge ID to document metadata for reference
+	if storedDoc.Metadata == nil {
+		storedDoc.Metadata = make(map[string]any)
+	}
+	storedDoc.Metadata["knowledge_id"] = knowledgeId
+
+	return storedDoc
+}
+
+// UpdateDocuments implements Store.UpdateDocuments
+func (i *InMemoryStore) UpdateDocuments(ctx context.Context, knowledgeId string, model EmbeddingModel, documents []*Document, deletedDocumentIds []string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	knowledge, exists := i.knowledges[knowledgeId]
+	if !exists {
+		knowledge = &Knowledge{ID: knowledgeId, Metadata: make(map[string]any)}
+		i.knowledges[knowledgeId] = knowledge
+	}
+	if !model.IsZero() {
+		knowledge.Embedding = model
+	}
+
+	replaced := make(map[string]bool, len(documents)+len(deletedDocumentIds))
+	for _, id := range deletedDocumentIds {
+		replaced[id] = true
+	}
+	for _, doc := range documents {
+		replaced[doc.ID] = true
+	}
+
+	kept := make([]*Document, 0, len(knowledge.Documents)+len(documents))
+	for _, doc := range knowledge.Documents {
+		if replaced[doc.ID] {
+			i.unindex(doc)
+			continue
 		}
-		storedDoc.Metadata["knowledge_id"] = knowledge.ID
+		kept = append(kept, doc)
+	}
+	for _, doc := range documents {
+		storedDoc := copyStoredDocument(knowledgeId, doc)
+		kept = append(kept, storedDoc)
+		i.addToIndexes(knowledgeId, storedDoc)
+	}
+	knowledge.Documents = kept
 
-		storedKnowledge.Documents[idx] = storedDoc
+	return nil
+}
+
+// UpdateEmbeddings implements Store.UpdateEmbeddings
+func (i *InMemoryStore) UpdateEmbeddings(ctx context.Context, knowledgeId string, model EmbeddingModel, embeddings map[string][]float32) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	knowledge, exists := i.knowledges[knowledgeId]
+	if !exists {
+		return errors.Errorf("knowledge %s not found", knowledgeId)
 	}
 
+	for _, doc := range knowledge.Documents {
+		if embedding, ok := embeddings[doc.ID]; ok {
+			doc.Embeddings = copyFloat32Slice(embedding)
+			if i.vectorIndex != nil {
+				i.vectorIndex.add(knowledgeId, doc)
+			}
+		}
+	}
+	knowledge.Embedding = model
+
 	return nil
 }
 
+// GetEmbeddingModels implements Store.GetEmbeddingModels
+func (i *InMemoryStore) GetEmbeddingModels(ctx context.Context, knowledgeIds []string) (map[string]EmbeddingModel, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	models := make(map[string]EmbeddingModel)
+	for id, knowledge := range i.knowledges {
+		if len(knowledgeIds) == 0 || slices.Contains(knowledgeIds, id) {
+			models[id] = knowledge.Embedding
+		}
+	}
+	return models, nil
+}
+
+// GetEmbeddingsByContentHash implements Store.GetEmbeddingsByContentHash
+func (i *InMemoryStore) GetEmbeddingsByContentHash(ctx context.Context, knowledgeId string, contentHashes []string) (map[string][]float32, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	embeddings := make(map[string][]float32)
+	knowledge, exists := i.knowledges[knowledgeId]
+	if !exists {
+		return embeddings, nil
+	}
+
+	wanted := make(map[string]bool, len(contentHashes))
+	for _, hash := range contentHashes {
+		wanted[hash] = true
+	}
+	for _, doc := range knowledge.Documents {
+		if !wanted[doc.ContentHash] || len(doc.Embeddings) == 0 {
+			continue
+		}
+		embeddings[doc.ContentHash] = copyFloat32Slice(doc.Embeddings)
+	}
+
+	return embeddings, nil
+}
+
 // Search implements Store.Search
-func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string) ([]KnowledgeSearchResult, error) {
+func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 
@@ -69,19 +261,33 @@ func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, li
 		return []KnowledgeSearchResult{}, nil
 	}
 
-	// Calculate cosine similarity for all documents with embeddings
 	type scoredDoc struct {
 		doc   *Document
 		score float32
 	}
 
 	var scoredDocs []scoredDoc
+	if i.vectorIndex != nil {
+		found := i.vectorIndex.search(queryEmbedding, limit, func(knowledgeId string, doc *Document) bool {
+			return (len(allowedKnowledgeIds) == 0 || slices.Contains(allowedKnowledgeIds, knowledgeId)) && filter.Matches(doc.Metadata)
+		})
+		results := make([]KnowledgeSearchResult, len(found))
+		for idx, candidate := range found {
+			results[idx] = KnowledgeSearchResult{
+				Document: copyResultDocument(i.vectorIndex.nodes[candidate.id].doc),
+				Score:    candidate.similarity,
+			}
+		}
+		return results, nil
+	}
+
+	// Calculate cosine similarity for all documents with embeddings
 	for _, kl := range i.knowledges {
 		if len(allowedKnowledgeIds) > 0 && !slices.Contains(allowedKnowledgeIds, kl.ID) {
 			continue
 		}
 		for _, doc := range kl.Documents {
-			if len(doc.Embeddings) == 0 {
+			if len(doc.Embeddings) == 0 || !filter.Matches(doc.Metadata) {
 				continue
 			}
 
@@ -107,17 +313,8 @@ func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, li
 	// Convert to search results
 	results := make([]KnowledgeSearchResult, len(scoredDocs))
 	for i, sd := range scoredDocs {
-		// Deep copy document for result
-		resultDoc := &Document{
-			ID:            sd.doc.ID,
-			Content:       sd.doc.Content,
-			Embeddings:    nil, // Don't include embeddings in search results
-			EmbeddingText: sd.doc.EmbeddingText,
-			Metadata:      copyMap(sd.doc.Metadata),
-		}
-
 		results[i] = KnowledgeSearchResult{
-			Document: resultDoc,
+			Document: copyResultDocument(sd.doc),
 			Score:    sd.score,
 		}
 	}
@@ -125,6 +322,55 @@ func (i *InMemoryStore) Search(ctx context.Context, queryEmbedding []float32, li
 	return results, nil
 }
 
+// KeywordSearch implements KeywordSearcher.KeywordSearch with BM25 over an inverted index of the documents
+func (i *InMemoryStore) KeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	scores := i.index.search(query, func(knowledgeId string, doc *Document) bool {
+		return (len(allowedKnowledgeIds) == 0 || slices.Contains(allowedKnowledgeIds, knowledgeId)) && filter.Matches(doc.Metadata)
+	})
+
+	results := make([]KnowledgeSearchResult, 0, len(scores))
+	for doc, score := range scores {
+		results = append(results, KnowledgeSearchResult{
+			Document: doc,
+			Score:    float32(score),
+		})
+	}
+
+	// Sort by score descending, and by ID for a stable order of equal scores
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+
+	// Limit results
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	for idx := range results {
+		results[idx].Document = copyResultDocument(results[idx].Document)
+	}
+
+	return results, nil
+}
+
+// copyResultDocument deep copies a stored document for a search result, without its embeddings
+func copyResultDocument(doc *Document) *Document {
+	return &Document{
+		ID:            doc.ID,
+		Content:       doc.Content,
+		Embeddings:    nil, // Don't include embeddings in search results
+		EmbeddingText: doc.EmbeddingText,
+		Metadata:      copyMap(doc.Metadata),
+		ContentHash:   doc.ContentHash,
+	}
+}
+
 // GetKnowledgeById implements Store.GetKnowledgeById
 func (i *InMemoryStore) GetKnowledgeById(ctx context.Context, knowledgeId string) (*Knowledge, error) {
 	i.mu.RLock()
@@ -140,6 +386,7 @@ func (i *InMemoryStore) GetKnowledgeById(ctx context.Context, knowledgeId string
 		ID:        knowledge.ID,
 		Metadata:  copyMap(knowledge.Metadata),
 		Documents: make([]*Document, len(knowledge.Documents)),
+		Embedding: knowledge.Embedding,
 	}
 
 	// Deep copy documents
@@ -150,6 +397,7 @@ func (i *InMemoryStore) GetKnowledgeById(ctx context.Context, knowledgeId string
 			Embeddings:    nil, // Don't include embeddings in get results
 			EmbeddingText: doc.EmbeddingText,
 			Metadata:      copyMap(doc.Metadata),
+			ContentHash:   doc.ContentHash,
 		}
 	}
 
@@ -161,23 +409,40 @@ func (i *InMemoryStore) DeleteKnowledgeById(ctx context.Context, knowledgeId str
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
-	if _, exists := i.knowledges[knowledgeId]; !exists {
+	knowledge, exists := i.knowledges[knowledgeId]
+	if !exists {
 		return nil // Not an error if knowledge doesn't exist
 	}
 
+	for _, doc := range knowledge.Documents {
+		i.unindex(doc)
+	}
+
 	// Delete knowledge
 	delete(i.knowledges, knowledgeId)
 
 	return nil
 }
 
-// Close implements Store.Close
+// Close implements Store.Close, saving the store to its snapshot file if it has one
 func (i *InMemoryStore) Close() error {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
+	if i.snapshotPath != "" {
+		if err := i.saveSnapshot(i.snapshotPath); err != nil {
+			return err
+		}
+		// A closed store is empty, which must not overwrite the snapshot if it is closed again
+		i.snapshotPath = ""
+	}
+
 	// Clear all data
 	i.knowledges = make(map[string]*Knowledge)
+	i.index = newInvertedIndex()
+	if i.vectorIndex != nil {
+		i.vectorIndex = newHNSWIndex(i.vectorIndex.m, i.vectorIndex.efConstruction, i.vectorIndex.efSearch)
+	}
 
 	return nil
 }
@@ -227,5 +492,6 @@ func copyFloat32Slice(s []float32) []float32 {
 }
 
 var (
-	_ Store = (*InMemoryStore)(nil)
+	_ Store           = (*InMemoryStore)(nil)
+	_ KeywordSearcher = (*InMemoryStore)(nil)
 )
@@ -0,0 +1,278 @@
+package knowledge
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	MIMETypeDOCX = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
+	MIMETypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	MIMETypePPTX = "application/vnd.openxmlformats-officedocument.presentationml.presentation"
+
+	SourceTypeDOCX = "docx"
+	SourceTypeXLSX = "xlsx"
+	SourceTypePPTX = "pptx"
+)
+
+// maxOfficePartSize is the maximum uncompressed size of a part of an Office file, so that a small zip file cannot
+// expand into all the memory
+const maxOfficePartSize = 256 << 20
+
+// officeProperties maps the elements of the core properties of Office files to their metadata keys
+var officeProperties = map[string]string{
+	"title":          MetadataKeyTitle,
+	"subject":        "subject",
+	"creator":        "author",
+	"keywords":       "keywords",
+	"description":    MetadataKeyDescription,
+	"category":       "category",
+	"lastModifiedBy": "last_modified_by",
+	"created":        "created",
+	"modified":       "modified",
+}
+
+type (
+	// officePackage is an Office Open XML file: a zip file of XML parts linked by relationships
+	officePackage struct {
+		files map[string]*zip.File
+	}
+
+	// officeRelationship is a link from a part to another part, or to an external URL
+	officeRelationship struct {
+		Type string
+		// Target is the name of the part in the package, or the URL of external targets
+		Target   string
+		External bool
+	}
+
+	// xmlElement is an element of an XML part, with its children in document order
+	xmlElement struct {
+		XMLName  xml.Name
+		Attrs    []xml.Attr    `xml:",any,attr"`
+		Text     string        `xml:",chardata"`
+		Children []*xmlElement `xml:",any"`
+	}
+)
+
+func openOfficePackage(reader io.Reader) (*officePackage, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read Office file")
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open Office file")
+	}
+
+	pkg := &officePackage{files: make(map[string]*zip.File, len(zipReader.File))}
+	for _, file := range zipReader.File {
+		pkg.files[strings.TrimPrefix(file.Name, "/")] = file
+	}
+	return pkg, nil
+}
+
+// parse returns the root element of the XML part
+func (p *officePackage) parse(name string) (*xmlElement, error) {
+	file, ok := p.files[name]
+	if !ok {
+		return nil, errors.Errorf("missing part %s", name)
+	}
+	if file.UncompressedSize64 > maxOfficePartSize {
+		return nil, errors.Errorf("part %s is larger than %d bytes", name, maxOfficePartSize)
+	}
+	rc, err := file.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open part %s", name)
+	}
+	defer rc.Close()
+
+	var root xmlElement
+	if err := xml.NewDecoder(io.LimitReader(rc, maxOfficePartSize)).Decode(&root); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse part %s", name)
+	}
+	return &root, nil
+}
+
+// relationships returns the relationships of the part by ID, or of the package with an empty part name
+func (p *officePackage) relationships(part string) (map[string]officeRelationship, error) {
+	dir, base := path.Split(part)
+	name := dir + "_rels/" + base + ".rels"
+	if _, ok := p.files[name]; !ok {
+		return map[string]officeRelationship{}, nil
+	}
+	root, err := p.parse(name)
+	if err != nil {
+		return nil, err
+	}
+
+	relationships := make(map[string]officeRelationship)
+	for _, rel := range root.children("Relationship") {
+		relationship := officeRelationship{
+			Type:     rel.attr("Type"),
+			Target:   rel.attr("Target"),
+			External: rel.attr("TargetMode") == "External",
+		}
+		if !relationship.External {
+			if strings.HasPrefix(relationship.Target, "/") {
+				relationship.Target = strings.TrimPrefix(relationship.Target, "/")
+			} else {
+				relationship.Target = path.Join(dir, relationship.Target)
+			}
+		}
+		relationships[rel.attr("Id")] = relationship
+	}
+	return relationships, nil
+}
+
+// related returns the target of the first relationship of the part of the type, whose URI ends with typeSuffix
+func (p *officePackage) related(part, typeSuffix string) (string, error) {
+	relationships, err := p.relationships(part)
+	if err != nil {
+		return "", err
+	}
+	for _, relationship := range relationships {
+		if strings.HasSuffix(relationship.Type, typeSuffix) && !relationship.External {
+			return relationship.Target, nil
+		}
+	}
+	return "", nil
+}
+
+// mainPart returns the name of the main part of the package, such as word/document.xml
+func (p *officePackage) mainPart(defaultName string) (string, error) {
+	name, err := p.related("", "/officeDocument")
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = defaultName
+	}
+	return name, nil
+}
+
+// properties returns the core properties of the package, such as its title and author, by metadata key
+func (p *officePackage) properties() map[string]string {
+	properties := make(map[string]string)
+	name, err := p.related("", "/core-properties")
+	if err != nil || name == "" {
+		name = "docProps/core.xml"
+	}
+	if _, ok := p.files[name]; !ok {
+		return properties
+	}
+	root, err := p.parse(name)
+	if err != nil {
+		return properties
+	}
+	for _, property := range root.Children {
+		if key, ok := officeProperties[property.XMLName.Local]; ok {
+			properties[key] = collapseSpaces(property.Text)
+		}
+	}
+	return properties
+}
+
+// attr returns the value of the attribute of the local name, in any namespace
+func (e *xmlElement) attr(local string) string {
+	if e == nil {
+		return ""
+	}
+	for _, a := range e.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// relationshipId returns the r:id attribute of the element, the ID of a relationship of its part. Elements such as
+// slide IDs also have an id attribute without a namespace
+func (e *xmlElement) relationshipId() string {
+	if e == nil {
+		return ""
+	}
+	for _, a := range e.Attrs {
+		if a.Name.Local == "id" && a.Name.Space != "" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// child returns the first child of the local name, or nil
+func (e *xmlElement) child(local string) *xmlElement {
+	if e == nil {
+		return nil
+	}
+	for _, c := range e.Children {
+		if c.XMLName.Local == local {
+			return c
+		}
+	}
+	return nil
+}
+
+// children returns the children of the local name
+func (e *xmlElement) children(local string) []*xmlElement {
+	if e == nil {
+		return nil
+	}
+	var children []*xmlElement
+	for _, c := range e.Children {
+		if c.XMLName.Local == local {
+			children = append(children, c)
+		}
+	}
+	return children
+}
+
+// path returns the descendant at the path of local names, or nil
+func (e *xmlElement) path(locals ...string) *xmlElement {
+	for _, local := range locals {
+		e = e.child(local)
+	}
+	return e
+}
+
+// descendants returns the descendants of the local name, in document order, without looking into them
+func (e *xmlElement) descendants(local string) []*xmlElement {
+	if e == nil {
+		return nil
+	}
+	var descendants []*xmlElement
+	for _, c := range e.Children {
+		if c.XMLName.Local == local {
+			descendants = append(descendants, c)
+		} else {
+			descendants = append(descendants, c.descendants(local)...)
+		}
+	}
+	return descendants
+}
+
+// textOrEmpty returns the text of the element, or "" if it is nil
+func (e *xmlElement) textOrEmpty() string {
+	if e == nil {
+		return ""
+	}
+	return e.Text
+}
+
+// isOn reports whether a toggle property such as <w:b/> is set: present, without a false value
+func (e *xmlElement) isOn() bool {
+	if e == nil {
+		return false
+	}
+	switch e.attr("val") {
+	case "0", "false", "off", "none":
+		return false
+	}
+	return true
+}
@@ -0,0 +1,249 @@
+package knowledge_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testCoreProperties = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:dcterms="http://purl.org/dc/terms/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+  <dc:title>Onboarding</dc:title>
+  <dc:creator>Jane Doe</dc:creator>
+  <cp:keywords>hr, onboarding</cp:keywords>
+  <dcterms:created xsi:type="dcterms:W3CDTF">2025-01-02T03:04:05Z</dcterms:created>
+</cp:coreProperties>`
+
+	testPackageRelationships = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="%s"/>
+  <Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+)
+
+// officeFile returns a zip file of the parts, with the package relationships to the main part and core properties
+func officeFile(t *testing.T, mainPart string, parts map[string]string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	parts["_rels/.rels"] = strings.Replace(testPackageRelationships, "%s", mainPart, 1)
+	parts["docProps/core.xml"] = testCoreProperties
+	for name, content := range parts {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func processOfficeFile(t *testing.T, contentType string, data []byte) ([]*knowledge.Document, map[string]any) {
+	t.Helper()
+
+	documents, metadata, err := knowledge.ProcessDocumentsByType(t.Context(), nil, &knowledge.DocumentReader{
+		Content:     bytes.NewReader(data),
+		ContentType: contentType,
+	}, slog.Default(), config.NewKnowledgeConfig(), knowledge.NewHashEmbedder(32), 1)
+	require.NoError(t, err)
+	for _, document := range documents {
+		require.NotEmpty(t, document.Embeddings)
+		require.Equal(t, "Onboarding", document.Metadata[knowledge.MetadataKeyTitle])
+		require.Equal(t, "Jane Doe", document.Metadata["author"])
+		require.Equal(t, "2025-01-02T03:04:05Z", document.Metadata["created"])
+	}
+	require.Equal(t, "hr, onboarding", metadata["keywords"])
+	return documents, metadata
+}
+
+func TestProcessDocumentsFromDOCX(t *testing.T) {
+	const ns = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+	data := officeFile(t, "word/document.xml", map[string]string{
+		"word/document.xml": `<w:document ` + ns + `><w:body>
+  <w:p><w:pPr><w:pStyle w:val="Titre1"/></w:pPr><w:r><w:t>Welcome</w:t></w:r></w:p>
+  <w:p><w:r><w:t xml:space="preserve">Read the </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>whole</w:t></w:r><w:r><w:rPr><w:b w:val="0"/></w:rPr><w:t xml:space="preserve"> guide at </w:t></w:r><w:hyperlink r:id="rId9"><w:r><w:t>the wiki</w:t></w:r></w:hyperlink><w:r><w:t>.</w:t></w:r></w:p>
+  <w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>First week</w:t></w:r></w:p>
+  <w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Get a laptop</w:t></w:r></w:p>
+  <w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Install the tools</w:t></w:r></w:p>
+  <w:p><w:pPr><w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Join the chat</w:t></w:r></w:p>
+  <w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>Meet the team</w:t></w:r></w:p>
+  <w:p><w:pPr><w:numPr><w:ilvl w:val="0"/><w:numId w:val="2"/></w:numPr></w:pPr><w:r><w:t>Badges</w:t></w:r><w:del><w:r><w:delText>Keys</w:delText></w:r></w:del></w:p>
+  <w:p/>
+  <w:tbl>
+    <w:tr><w:tc><w:p><w:r><w:t>Day</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Topic</w:t></w:r></w:p></w:tc></w:tr>
+    <w:tr><w:tc><w:p><w:r><w:t>Monday</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Setup</w:t></w:r></w:p><w:p><w:r><w:t>and access</w:t></w:r></w:p></w:tc></w:tr>
+  </w:tbl>
+  <w:sectPr/>
+</w:body></w:document>`,
+		"word/_rels/document.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+  <Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>
+  <Relationship Id="rId9" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="https://wiki.example.com/onboarding" TargetMode="External"/>
+</Relationships>`,
+		// Heading styles are found by their names, whatever their IDs in the language of the document
+		"word/styles.xml": `<w:styles ` + ns + `>
+  <w:style w:type="paragraph" w:styleId="Titre1"><w:name w:val="heading 1"/></w:style>
+  <w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/></w:style>
+</w:styles>`,
+		"word/numbering.xml": `<w:numbering ` + ns + `>
+  <w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:numFmt w:val="decimal"/></w:lvl><w:lvl w:ilvl="1"><w:numFmt w:val="bullet"/></w:lvl></w:abstractNum>
+  <w:abstractNum w:abstractNumId="1"><w:lvl w:ilvl="0"><w:numFmt w:val="bullet"/></w:lvl></w:abstractNum>
+  <w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+  <w:num w:numId="2"><w:abstractNumId w:val="1"/></w:num>
+</w:numbering>`,
+	})
+
+	documents, metadata := processOfficeFile(t, knowledge.MIMETypeDOCX, data)
+	require.Equal(t, knowledge.SourceTypeDOCX, metadata["source_type"])
+	require.Len(t, documents, 2)
+	require.Equal(t, "# Welcome\n\nRead the **whole** guide at [the wiki](https://wiki.example.com/onboarding).", documents[0].Content.Text)
+	require.Equal(t, "## First week\n\n"+
+		"1. Get a laptop\n"+
+		"   - Install the tools\n"+
+		"   - Join the chat\n"+
+		"2. Meet the team\n"+
+		"- Badges\n\n"+
+		"| Day | Topic |\n"+
+		"| --- | --- |\n"+
+		"| Monday | Setup and access |", documents[1].Content.Text)
+	require.Equal(t, []string{"Welcome", "First week"}, documents[1].Metadata[knowledge.MetadataKeyHeadingPath])
+	require.Equal(t, "text/markdown", documents[1].Content.MIMEType)
+}
+
+func TestProcessDocumentsFromXLSX(t *testing.T) {
+	const ns = `xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+	data := officeFile(t, "xl/workbook.xml", map[string]string{
+		"xl/workbook.xml": `<workbook ` + ns + `><sheets>
+  <sheet name="People" sheetId="1" r:id="rId1"/>
+  <sheet name="Lookup" sheetId="2" state="hidden" r:id="rId2"/>
+  <sheet name="Rooms" sheetId="3" r:id="rId3"/>
+</sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+  <Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>
+  <Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet3.xml"/>
+  <Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/sharedStrings" Target="sharedStrings.xml"/>
+  <Relationship Id="rId5" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<sst ` + ns + `>
+  <si><t>Name</t></si><si><t>Start</t></si><si><t>Remote</t></si><si><r><t>Ada </t></r><r><t>Lovelace</t></r></si>
+</sst>`,
+		"xl/styles.xml": `<styleSheet ` + ns + `>
+  <numFmts><numFmt numFmtId="164" formatCode="yyyy\-mm\-dd;@"/></numFmts>
+  <cellXfs><xf numFmtId="0"/><xf numFmtId="164"/><xf numFmtId="14"/></cellXfs>
+</styleSheet>`,
+		// The header is the first row with values, and cells are placed by their references
+		"xl/worksheets/sheet1.xml": `<worksheet ` + ns + `><sheetData>
+  <row r="2"><c r="A2" t="s"><v>0</v></c><c r="B2" t="s"><v>1</v></c><c r="C2" t="s"><v>2</v></c></row>
+  <row r="3"><c r="A3" t="s"><v>3</v></c><c r="B3" s="1"><v>45658</v></c><c r="C3" t="b"><v>1</v></c><c r="E3"><v>0.1</v></c></row>
+  <row r="4"><c r="A4" t="inlineStr"><is><t>Alan Turing</t></is></c><c r="B4" s="2"><v>45689.5</v></c></row>
+  <row r="5"><c r="A5"/></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet2.xml": `<worksheet ` + ns + `><sheetData>
+  <row r="1"><c r="A1" t="inlineStr"><is><t>Secret</t></is></c></row>
+  <row r="2"><c r="A2" t="inlineStr"><is><t>Hidden</t></is></c></row>
+</sheetData></worksheet>`,
+		"xl/worksheets/sheet3.xml": `<worksheet ` + ns + `><sheetData>
+  <row r="1"><c r="A1" t="inlineStr"><is><t>Room</t></is></c><c r="B1" t="inlineStr"><is><t>Seats</t></is></c></row>
+  <row r="2"><c r="A2" t="inlineStr"><is><t>Atlas</t></is></c><c r="B2"><v>12</v></c></row>
+</sheetData></worksheet>`,
+	})
+
+	documents, metadata := processOfficeFile(t, knowledge.MIMETypeXLSX, data)
+	require.Equal(t, knowledge.SourceTypeXLSX, metadata["source_type"])
+	require.Equal(t, []string{"People", "Rooms"}, metadata["sheets"])
+	require.Len(t, documents, 3)
+
+	require.Equal(t, "Sheet: People | Name: Ada Lovelace | Start: 2025-01-01 | Remote: TRUE | Column E: 0.1", documents[0].Content.Text)
+	require.Equal(t, "People", documents[0].Metadata["sheet_name"])
+	require.Equal(t, 1, documents[0].Metadata["sheet_number"])
+	require.Equal(t, 3, documents[0].Metadata["row_number"])
+	require.Equal(t, map[string]string{"Name": "Ada Lovelace", "Start": "2025-01-01", "Remote": "TRUE", "Column E": "0.1"}, documents[0].Metadata["row_data"])
+
+	// Built-in date formats show the date only
+	require.Equal(t, "Sheet: People | Name: Alan Turing | Start: 2025-02-01", documents[1].Content.Text)
+
+	require.Equal(t, "Sheet: Rooms | Room: Atlas | Seats: 12", documents[2].Content.Text)
+	require.Equal(t, 2, documents[2].Metadata["sheet_number"])
+}
+
+func TestProcessDocumentsFromPPTX(t *testing.T) {
+	const ns = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"`
+	shape := func(placeholder, paragraphs string) string {
+		return `<p:sp><p:nvSpPr><p:cNvPr id="1" name="Shape"/><p:cNvSpPr/><p:nvPr>` + placeholder + `</p:nvPr></p:nvSpPr>` +
+			`<p:txBody><a:bodyPr/>` + paragraphs + `</p:txBody></p:sp>`
+	}
+	data := officeFile(t, "ppt/presentation.xml", map[string]string{
+		"ppt/presentation.xml": `<p:presentation ` + ns + `><p:sldIdLst>
+  <p:sldId id="256" r:id="rId2"/><p:sldId id="257" r:id="rId3"/><p:sldId id="258" r:id="rId4"/>
+</p:sldIdLst></p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide1.xml"/>
+  <Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide2.xml"/>
+  <Relationship Id="rId4" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/slide" Target="slides/slide3.xml"/>
+</Relationships>`,
+		"ppt/slides/slide1.xml": `<p:sld ` + ns + `><p:cSld><p:spTree>` +
+			shape(`<p:ph type="ctrTitle"/>`, `<a:p><a:r><a:t>Onboarding</a:t></a:r></a:p>`) +
+			shape(`<p:ph type="subTitle" idx="1"/>`, `<a:p><a:r><a:t>Your first </a:t></a:r><a:r><a:t>week</a:t></a:r></a:p>`) +
+			shape(`<p:ph type="sldNum" idx="12"/>`, `<a:p><a:fld type="slidenum"><a:t>1</a:t></a:fld></a:p>`) +
+			`</p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/slide2.xml": `<p:sld ` + ns + `><p:cSld><p:spTree>` +
+			shape(`<p:ph type="title"/>`, `<a:p><a:r><a:t>Schedule</a:t></a:r></a:p>`) +
+			shape(`<p:ph idx="1"/>`, `<a:p><a:r><a:t>Monday: setup</a:t></a:r></a:p><a:p><a:pPr lvl="1"/><a:r><a:t>Laptop and accounts</a:t></a:r></a:p>`) +
+			`<p:graphicFrame><a:graphic><a:graphicData><a:tbl>
+  <a:tr><a:tc><a:txBody><a:p><a:r><a:t>Day</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:p><a:r><a:t>Room</a:t></a:r></a:p></a:txBody></a:tc></a:tr>
+  <a:tr><a:tc><a:txBody><a:p><a:r><a:t>Tuesday</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:p><a:r><a:t>Atlas</a:t></a:r></a:p></a:txBody></a:tc></a:tr>
+</a:tbl></a:graphicData></a:graphic></p:graphicFrame>` +
+			`</p:spTree></p:cSld></p:sld>`,
+		"ppt/slides/_rels/slide2.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/notesSlide" Target="../notesSlides/notesSlide1.xml"/>
+</Relationships>`,
+		"ppt/notesSlides/notesSlide1.xml": `<p:notes ` + ns + `><p:cSld><p:spTree>` +
+			shape(`<p:ph type="sldImg"/>`, ``) +
+			shape(`<p:ph type="body" idx="1"/>`, `<a:p><a:r><a:t>Remind them to bring an ID.</a:t></a:r></a:p>`) +
+			`</p:spTree></p:cSld></p:notes>`,
+		// Slides without text have no document
+		"ppt/slides/slide3.xml": `<p:sld ` + ns + `><p:cSld><p:spTree></p:spTree></p:cSld></p:sld>`,
+	})
+
+	documents, metadata := processOfficeFile(t, knowledge.MIMETypePPTX, data)
+	require.Equal(t, knowledge.SourceTypePPTX, metadata["source_type"])
+	require.Equal(t, 3, metadata["total_slides"])
+	require.Len(t, documents, 2)
+
+	require.Equal(t, "# Onboarding\n\nYour first week", documents[0].Content.Text)
+	require.Equal(t, 1, documents[0].Metadata["slide_number"])
+	require.Equal(t, "Onboarding", documents[0].Metadata["slide_title"])
+
+	require.Equal(t, "# Schedule\n\n"+
+		"- Monday: setup\n"+
+		"  - Laptop and accounts\n\n"+
+		"| Day | Room |\n"+
+		"| --- | --- |\n"+
+		"| Tuesday | Atlas |\n\n"+
+		"## Speaker notes\n\n"+
+		"Remind them to bring an ID.", documents[1].Content.Text)
+	require.Equal(t, 2, documents[1].Metadata["slide_number"])
+}
+
+func TestProcessDocumentsFromOffice_Invalid(t *testing.T) {
+	_, _, err := knowledge.ProcessDocumentsByType(t.Context(), nil, &knowledge.DocumentReader{
+		Content:     strings.NewReader("not a zip file"),
+		ContentType: knowledge.MIMETypeDOCX,
+	}, slog.Default(), config.NewKnowledgeConfig(), knowledge.NewHashEmbedder(32), 1)
+	require.ErrorContains(t, err, "failed to open Office file")
+
+	_, _, err = knowledge.ProcessDocumentsByType(t.Context(), nil, &knowledge.DocumentReader{
+		Content:     bytes.NewReader(officeFile(t, "xl/workbook.xml", map[string]string{})),
+		ContentType: knowledge.MIMETypeXLSX,
+	}, slog.Default(), config.NewKnowledgeConfig(), knowledge.NewHashEmbedder(32), 1)
+	require.ErrorContains(t, err, "missing part xl/workbook.xml")
+}
@@ -0,0 +1,123 @@
+package knowledge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// OpenAICompatibleEmbedder implements Embedder with an OpenAI compatible /v1/embeddings endpoint, such as a
+// local Ollama, vLLM or LM Studio server
+type OpenAICompatibleEmbedder struct {
+	client    *http.Client
+	endpoint  string
+	apiKey    string
+	model     string
+	dimension int
+}
+
+var _ Embedder = (*OpenAICompatibleEmbedder)(nil)
+
+// NewOpenAICompatibleEmbedder creates an embedder sending its requests to baseURL + "/embeddings", with apiKey
+// as bearer token if set. The dimension must be the size of the embeddings of the model
+func NewOpenAICompatibleEmbedder(client *http.Client, baseURL, apiKey, model string, dimension int) (Embedder, error) {
+	if baseURL == "" {
+		return nil, errors.New("base URL of the embedding endpoint is required")
+	}
+	if model == "" {
+		return nil, errors.New("embedding model is required")
+	}
+	if dimension <= 0 {
+		return nil, errors.Errorf("embedding dimension of model %s is required", model)
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &OpenAICompatibleEmbedder{
+		client:    client,
+		endpoint:  strings.TrimSuffix(baseURL, "/") + "/embeddings",
+		apiKey:    apiKey,
+		model:     model,
+		dimension: dimension,
+	}, nil
+}
+
+func (e *OpenAICompatibleEmbedder) EmbedTexts(ctx context.Context, _ EmbeddingTaskType, texts ...string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	var requestBody bytes.Buffer
+	if err := json.NewEncoder(&requestBody).Encode(struct {
+		Model          string   `json:"model"`
+		Input          []string `json:"input"`
+		EncodingFormat string   `json:"encoding_format"`
+	}{
+		Model:          e.model,
+		Input:          texts,
+		EncodingFormat: "float",
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to encode request body")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, &requestBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create request")
+	}
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, errors.Errorf("failed to embed texts: HTTP %d - %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode response")
+	}
+	if len(response.Data) != len(texts) {
+		return nil, errors.Errorf("embedding count mismatch: got %d, expected %d", len(response.Data), len(texts))
+	}
+
+	// The data is ordered by index, which servers are not required to follow
+	embeddings := make([][]float32, len(texts))
+	for _, data := range response.Data {
+		if data.Index < 0 || data.Index >= len(texts) || embeddings[data.Index] != nil {
+			return nil, errors.Errorf("invalid embedding index %d", data.Index)
+		}
+		if len(data.Embedding) != e.dimension {
+			return nil, errors.Errorf("embedding size %d of model %s does not match the dimension %d", len(data.Embedding), e.model, e.dimension)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+	return embeddings, nil
+}
+
+func (e *OpenAICompatibleEmbedder) EmbedderID() string {
+	return "openai-compatible/" + e.model
+}
+
+func (e *OpenAICompatibleEmbedder) GetEmbedSize() int {
+	return e.dimension
+}
@@ -261,7 +261,11 @@ func ProcessDocumentsFromPDF(
 				}
 				images = append(images, img)
 			}
-			embeddings, err := embedder.EmbedImageFiles(ctx, "image/jpeg", images...)
+			imageEmbedder, err := asImageEmbedder(embedder)
+			if err != nil {
+				return nil, nil, err
+			}
+			embeddings, err := imageEmbedder.EmbedImageFiles(ctx, "image/jpeg", images...)
 			if err != nil {
 				return nil, nil, errors.Wrapf(err, "failed to generate image embeddings - check your API configuration")
 			}
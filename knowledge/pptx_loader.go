@@ -0,0 +1,199 @@
+package knowledge
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pptxIgnoredPlaceholders are the placeholders repeated on every slide, without content of their own
+var pptxIgnoredPlaceholders = map[string]bool{"dt": true, "ftr": true, "sldNum": true, "sldImg": true, "hdr": true}
+
+// ProcessDocumentsFromPPTX processes a PowerPoint presentation, with a document per slide of its title, text,
+// tables and speaker notes as markdown. Documents have the number and title of their slide in their metadata, and
+// the core properties of the presentation
+func ProcessDocumentsFromPPTX(
+	ctx context.Context,
+	reader io.Reader,
+	logger *slog.Logger,
+	embedder Embedder,
+) ([]*Document, map[string]any, error) {
+	pkg, err := openOfficePackage(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	name, err := pkg.mainPart("ppt/presentation.xml")
+	if err != nil {
+		return nil, nil, err
+	}
+	presentation, err := pkg.parse(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	relationships, err := pkg.relationships(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	slideIds := presentation.path("sldIdLst").children("sldId")
+	documents := make([]*Document, 0, len(slideIds))
+	for i, slideId := range slideIds {
+		relationship, ok := relationships[slideId.relationshipId()]
+		if !ok || relationship.External {
+			continue
+		}
+		slide, err := pkg.parse(relationship.Target)
+		if err != nil {
+			return nil, nil, err
+		}
+		title, blocks := pptxShapes(slide.path("cSld", "spTree"), true)
+
+		notesPart, err := pkg.related(relationship.Target, "/notesSlide")
+		if err != nil {
+			return nil, nil, err
+		}
+		var notes []string
+		if notesPart != "" {
+			notesSlide, err := pkg.parse(notesPart)
+			if err != nil {
+				return nil, nil, err
+			}
+			// Notes are in a body placeholder too, but are written as text
+			_, notes = pptxShapes(notesSlide.path("cSld", "spTree"), false)
+		}
+
+		var text []string
+		if title != "" {
+			text = append(text, "# "+title)
+		}
+		text = append(text, blocks...)
+		if len(notes) > 0 {
+			text = append(text, "## Speaker notes")
+			text = append(text, notes...)
+		}
+		if len(blocks) == 0 && len(notes) == 0 && title == "" {
+			continue
+		}
+
+		content := strings.Join(text, "\n\n")
+		metadata := map[string]any{
+			"slide_number":        i + 1,
+			"total_slides":        len(slideIds),
+			MetadataKeyTokenCount: EstimateTokens(content),
+		}
+		if title != "" {
+			metadata["slide_title"] = title
+		}
+		documents = append(documents, &Document{
+			Content: Content{
+				Text:     content,
+				MIMEType: "text/markdown",
+			},
+			EmbeddingText: content,
+			Metadata:      metadata,
+		})
+	}
+
+	if len(documents) == 0 {
+		return nil, nil, errors.New("no slides with text found in PPTX")
+	}
+	if err := embedDocuments(ctx, documents, embedder); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to process PPTX")
+	}
+
+	metadata := map[string]any{
+		"source_type":  SourceTypePPTX,
+		"total_slides": len(slideIds),
+	}
+	setDocumentMetadata(documents, metadata, pkg.properties())
+
+	logger.Info("Processed PPTX", "slides", len(documents))
+	return documents, metadata, nil
+}
+
+// pptxShapes returns the title of the shapes of a slide and the markdown blocks of the others, in order. The
+// paragraphs of body placeholders are list items with bodyBullets
+func pptxShapes(tree *xmlElement, bodyBullets bool) (string, []string) {
+	var (
+		title  string
+		blocks []string
+	)
+	for _, shape := range tree.Children {
+		switch shape.XMLName.Local {
+		case "sp":
+			placeholder := shape.path("nvSpPr", "nvPr", "ph")
+			placeholderType := placeholder.attr("type")
+			if pptxIgnoredPlaceholders[placeholderType] {
+				continue
+			}
+			// Text of body placeholders, which have no type or the body type, is bulleted
+			bulleted := bodyBullets && placeholder != nil && (placeholderType == "" || placeholderType == "body" || placeholderType == "obj")
+			lines := pptxParagraphs(shape.child("txBody"), bulleted)
+			if len(lines) == 0 {
+				continue
+			}
+			if (placeholderType == "title" || placeholderType == "ctrTitle") && title == "" {
+				title = strings.Join(lines, " ")
+				continue
+			}
+			blocks = append(blocks, strings.Join(lines, "\n"))
+		case "grpSp":
+			groupTitle, groupBlocks := pptxShapes(shape, bodyBullets)
+			if title == "" {
+				title = groupTitle
+			} else if groupTitle != "" {
+				groupBlocks = append([]string{groupTitle}, groupBlocks...)
+			}
+			blocks = append(blocks, groupBlocks...)
+		case "graphicFrame":
+			for _, tbl := range shape.descendants("tbl") {
+				var rows [][]string
+				for _, tr := range tbl.children("tr") {
+					var row []string
+					for _, tc := range tr.children("tc") {
+						row = append(row, strings.Join(pptxParagraphs(tc.child("txBody"), false), " "))
+					}
+					rows = append(rows, row)
+				}
+				if table := markdownTable(rows); table != "" {
+					blocks = append(blocks, table)
+				}
+			}
+		}
+	}
+	return title, blocks
+}
+
+// pptxParagraphs returns the lines of the paragraphs of a text body, as list items if they are bulleted
+func pptxParagraphs(body *xmlElement, bulleted bool) []string {
+	var lines []string
+	for _, p := range body.children("p") {
+		var text strings.Builder
+		for _, run := range p.Children {
+			switch run.XMLName.Local {
+			case "r", "fld":
+				text.WriteString(run.child("t").textOrEmpty())
+			case "br":
+				text.WriteString("\n")
+			}
+		}
+		paragraph := strings.ReplaceAll(formatParagraph(text.String()), "\n", " ")
+		if paragraph == "" {
+			continue
+		}
+
+		properties := p.child("pPr")
+		switch {
+		case properties.child("buNone") != nil:
+		case bulleted || properties.child("buChar") != nil || properties.child("buAutoNum") != nil:
+			level, _ := strconv.Atoi(properties.attr("lvl"))
+			paragraph = strings.Repeat("  ", min(max(level, 0), 8)) + "- " + strings.TrimPrefix(paragraph, `\`)
+		}
+		lines = append(lines, paragraph)
+	}
+	return lines
+}
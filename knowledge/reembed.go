@@ -0,0 +1,113 @@
+package knowledge
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// reembedBatchSize is the number of texts or images embedded per request when re-embedding knowledge
+const reembedBatchSize = 64
+
+// ReembedKnowledge implements Service.ReembedKnowledge
+func (s *service) ReembedKnowledge(ctx context.Context, knowledgeIds ...string) ([]string, error) {
+	models, err := s.store.GetEmbeddingModels(ctx, knowledgeIds)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get embedding models")
+	}
+
+	model := s.embeddingModel()
+	var outdated []string
+	for id, stored := range models {
+		if stored != model {
+			outdated = append(outdated, id)
+		}
+	}
+	sort.Strings(outdated)
+
+	reembedded := make([]string, 0, len(outdated))
+	for _, id := range outdated {
+		if err := s.reembed(ctx, id, model); err != nil {
+			return reembedded, errors.Wrapf(err, "failed to re-embed knowledge %s", id)
+		}
+		s.logger.Info("re-embedded knowledge", "knowledge_id", id, "from", models[id].String(), "to", model.String())
+		reembedded = append(reembedded, id)
+	}
+	return reembedded, nil
+}
+
+// reembed computes the embeddings of the documents of the knowledge from what they were embedded from: the image
+// of the documents whose content hash is the one of their image, and the embedding text of the others
+func (s *service) reembed(ctx context.Context, knowledgeId string, model EmbeddingModel) error {
+	knowledge, err := s.store.GetKnowledgeById(ctx, knowledgeId)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get knowledge")
+	} else if knowledge == nil {
+		return errors.Errorf("knowledge %s not found", knowledgeId)
+	}
+
+	_, embedsImages := s.embedder.(ImageEmbedder)
+
+	var (
+		textIds, imageIds []string
+		texts             []string
+		images            [][]byte
+	)
+	for _, doc := range knowledge.Documents {
+		if doc.Content.Type() == ContentTypeImage {
+			image, err := base64.StdEncoding.DecodeString(doc.Content.Image)
+			if err != nil {
+				return errors.Wrapf(err, "failed to decode image of document %s", doc.ID)
+			}
+			// Documents stored before content hashes were recorded are embedded from their image if possible
+			if doc.ContentHash == imageContentHash(image) || (doc.ContentHash == "" && embedsImages) {
+				imageIds = append(imageIds, doc.ID)
+				images = append(images, image)
+				continue
+			}
+		}
+		if doc.EmbeddingText != "" {
+			textIds = append(textIds, doc.ID)
+			texts = append(texts, doc.EmbeddingText)
+		}
+	}
+
+	embeddings := make(map[string][]float32, len(knowledge.Documents))
+	for start := 0; start < len(texts); start += reembedBatchSize {
+		end := min(start+reembedBatchSize, len(texts))
+		batch, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeDocument, texts[start:end]...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to embed texts")
+		}
+		if len(batch) != end-start {
+			return errors.Errorf("embedding count mismatch: got %d, expected %d", len(batch), end-start)
+		}
+		for i, embedding := range batch {
+			embeddings[textIds[start+i]] = embedding
+		}
+	}
+
+	if len(images) > 0 {
+		imageEmbedder, err := asImageEmbedder(s.embedder)
+		if err != nil {
+			return err
+		}
+		for start := 0; start < len(images); start += reembedBatchSize {
+			end := min(start+reembedBatchSize, len(images))
+			batch, err := imageEmbedder.EmbedImageFiles(ctx, "image/jpeg", images[start:end]...)
+			if err != nil {
+				return errors.Wrapf(err, "failed to embed images")
+			}
+			if len(batch) != end-start {
+				return errors.Errorf("embedding count mismatch: got %d, expected %d", len(batch), end-start)
+			}
+			for i, embedding := range batch {
+				embeddings[imageIds[start+i]] = embedding
+			}
+		}
+	}
+
+	return s.store.UpdateEmbeddings(ctx, knowledgeId, model, embeddings)
+}
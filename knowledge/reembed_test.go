@@ -0,0 +1,122 @@
+package knowledge_test
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedderID(t *testing.T) {
+	require.Equal(t, "hash", knowledge.NewHashEmbedder(64).EmbedderID())
+	require.Equal(t, "nomic/"+knowledge.NomicTextEmbedderModel, knowledge.NewEmbedder("").EmbedderID())
+
+	embedder, err := knowledge.NewOpenAICompatibleEmbedder(nil, "http://localhost:11434/v1", "", "nomic-embed-text", 768)
+	require.NoError(t, err)
+	require.Equal(t, "openai-compatible/nomic-embed-text", embedder.EmbedderID())
+}
+
+func TestReembedKnowledge(t *testing.T) {
+	ctx := context.Background()
+	conf := config.NewKnowledgeConfig()
+	conf.RerankEnabled = false
+	newService := func(t *testing.T, store knowledge.Store, dimension int) knowledge.Service {
+		service, err := knowledge.NewServiceWithStore(ctx, conf, &config.ModelConfig{}, slog.Default(), store, knowledge.WithEmbedder(knowledge.NewHashEmbedder(dimension)))
+		require.NoError(t, err)
+		return service
+	}
+
+	for _, name := range []string{"memory", "sqlite"} {
+		t.Run(name, func(t *testing.T) {
+			// open returns the store of the test, reopening the sqlite store with the dimension of the next embedder
+			var store knowledge.Store
+			path := filepath.Join(t.TempDir(), "knowledge.db")
+			open := func(dimension int) knowledge.Store {
+				if name == "memory" {
+					if store == nil {
+						store = knowledge.NewInMemoryStore()
+					}
+					return store
+				}
+				var opts []knowledge.SqliteStoreOption
+				if store != nil {
+					require.NoError(t, store.Close())
+
+					// The vectors of the previous embedder are only dropped on request
+					_, err := knowledge.NewSqliteStore(path, dimension)
+					require.ErrorContains(t, err, fmt.Sprintf("have 32 dimensions but the embedder has %d", dimension))
+					opts = append(opts, knowledge.WithVectorTableRebuild())
+				}
+				var err error
+				store, err = knowledge.NewSqliteStore(path, dimension, opts...)
+				require.NoError(t, err)
+				return store
+			}
+			defer func() { store.Close() }()
+
+			old := newService(t, open(32), 32)
+			_, err := old.IndexKnowledgeFromDocuments(ctx, "capitals", textDocuments(
+				textDocument("", "Paris is the capital of France"),
+				textDocument("", "Berlin is the capital of Germany"),
+			))
+			require.NoError(t, err)
+			_, err = old.UpsertDocuments(ctx, "manual", textDocuments(textDocument("install", "Run the installer")))
+			require.NoError(t, err)
+
+			kl, err := store.GetKnowledgeById(ctx, "capitals")
+			require.NoError(t, err)
+			require.Equal(t, knowledge.EmbeddingModel{EmbedderID: "hash", Dimension: 32}, kl.Embedding)
+
+			// The knowledge of the previous embedder is only searched by keywords
+			service := newService(t, open(64), 64)
+			_, err = service.RetrieveRelevantKnowledge(ctx, "capital of France", 1, []string{"capitals"}, knowledge.WithSearchMode(config.SearchModeVector))
+			require.ErrorContains(t, err, "re-embed it")
+			results, err := service.RetrieveRelevantKnowledge(ctx, "capital of France", 1, []string{"capitals"}, knowledge.WithSearchMode(config.SearchModeKeyword))
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+
+			_, err = service.UpsertDocuments(ctx, "manual", textDocuments(textDocument("billing", "Invoices are monthly")))
+			require.ErrorContains(t, err, "re-embed it before adding documents")
+
+			reembedded, err := service.ReembedKnowledge(ctx, "capitals")
+			require.NoError(t, err)
+			require.Equal(t, []string{"capitals"}, reembedded)
+
+			results, err = service.RetrieveRelevantKnowledge(ctx, "capital of France", 1, []string{"capitals"}, knowledge.WithSearchMode(config.SearchModeVector))
+			require.NoError(t, err)
+			require.Len(t, results, 1)
+			require.Contains(t, results[0].Content.Text, "France")
+
+			kl, err = store.GetKnowledgeById(ctx, "capitals")
+			require.NoError(t, err)
+			require.Equal(t, knowledge.EmbeddingModel{EmbedderID: "hash", Dimension: 64}, kl.Embedding)
+			hashes := make([]string, len(kl.Documents))
+			for i, doc := range kl.Documents {
+				hashes[i] = doc.ContentHash
+			}
+			embeddings, err := store.GetEmbeddingsByContentHash(ctx, "capitals", hashes)
+			require.NoError(t, err)
+			require.Len(t, embeddings, 2)
+			for _, embedding := range embeddings {
+				require.Len(t, embedding, 64)
+			}
+
+			// The remaining knowledge is re-embedded, and knowledge already embedded with the embedder is not
+			reembedded, err = service.ReembedKnowledge(ctx)
+			require.NoError(t, err)
+			require.Equal(t, []string{"manual"}, reembedded)
+			reembedded, err = service.ReembedKnowledge(ctx)
+			require.NoError(t, err)
+			require.Empty(t, reembedded)
+
+			_, err = service.UpsertDocuments(ctx, "manual", textDocuments(textDocument("billing", "Invoices are monthly")))
+			require.NoError(t, err)
+			require.ElementsMatch(t, []string{"manual_install_1", "manual_billing_1"}, storedDocumentIds(t, store, "manual"))
+		})
+	}
+}
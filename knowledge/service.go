@@ -1,22 +1,32 @@
 package knowledge
 
 import (
+	"cmp"
 	"context"
+	"fmt"
 	"io"
 	"iter"
 	"log/slog"
+	"net/http"
 	"sort"
 
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/habiliai/agentruntime/config"
 	xgenkit "github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/internal/httpclient"
 	"github.com/pkg/errors"
 )
 
 type (
 	DocumentReader struct {
+		// ID identifies the document in its knowledge, to replace or delete it with UpsertDocuments and
+		// DeleteDocuments. It is required by UpsertDocuments only
+		ID          string
 		Content     io.Reader
-		ContentType string // text/plain, text/markdown, text/csv, text/json, application/pdf
+		ContentType string // text/plain, text/markdown, text/html, text/csv, text/json, application/pdf, DOCX, XLSX and PPTX, and source code such as text/x-go
+		// Filename is the path of the document, such as its path in a repository. Plain text with the extension of
+		// a programming language is processed as source code. ID is used as the path if Filename is empty
+		Filename string
 	}
 
 	ImageReader struct {
@@ -30,7 +40,16 @@ type (
 		IndexKnowledgeFromMap(ctx context.Context, id string, input []map[string]any) (*Knowledge, error)
 		IndexKnowledgeFromDocuments(ctx context.Context, id string, inputs iter.Seq2[*DocumentReader, error]) (*Knowledge, error)
 		IndexKnowledgeFromImages(ctx context.Context, id string, input iter.Seq2[*ImageReader, error], metadata map[string]any) (*Knowledge, error)
-		RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string) ([]*KnowledgeSearchResult, error)
+		// UpsertDocuments adds the documents to the knowledge, replacing the chunks of the documents of the same
+		// IDs, and returns their chunks. Chunks whose content did not change keep their stored embeddings
+		UpsertDocuments(ctx context.Context, knowledgeId string, inputs iter.Seq2[*DocumentReader, error]) ([]*Document, error)
+		// DeleteDocuments removes the chunks of the documents from the knowledge
+		DeleteDocuments(ctx context.Context, knowledgeId string, documentIds ...string) error
+		// ReembedKnowledge computes again, from their stored text and images, the embeddings of the knowledge of
+		// knowledgeIds, or of all the knowledge if there are none, that is embedded with another embedding
+		// model than the embedder of the service. It returns the IDs of the re-embedded knowledge
+		ReembedKnowledge(ctx context.Context, knowledgeIds ...string) ([]string, error)
+		RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, opts ...RetrieveOption) ([]*KnowledgeSearchResult, error)
 		DeleteKnowledge(ctx context.Context, knowledgeId string) error
 		Close() error
 		GetKnowledge(ctx context.Context, knowledgeId string) (*Knowledge, error)
@@ -45,6 +64,17 @@ type (
 		queryRewriter QueryRewriter
 		config        *config.KnowledgeConfig
 		logger        *slog.Logger
+		httpClient    *http.Client
+	}
+
+	ServiceOption func(s *service)
+
+	// RetrieveOption changes how RetrieveRelevantKnowledge searches
+	RetrieveOption func(o *retrieveOptions)
+
+	retrieveOptions struct {
+		searchMode string
+		filter     *Filter
 	}
 )
 
@@ -52,9 +82,42 @@ var (
 	_ Service = (*service)(nil)
 )
 
-// NewService creates a new knowledge service with default SQLite-based storage
-func NewService(ctx context.Context, modelConfig *config.ModelConfig, conf *config.KnowledgeConfig, logger *slog.Logger) (Service, error) {
-	return NewServiceWithStore(ctx, conf, modelConfig, logger, NewInMemoryStore())
+// WithHTTPClient sets the HTTP client the embedder sends its requests with
+func WithHTTPClient(client *http.Client) ServiceOption {
+	return func(s *service) {
+		s.httpClient = client
+	}
+}
+
+// WithEmbedder sets the embedder, instead of the one of the EmbedderProvider of the configuration
+func WithEmbedder(embedder Embedder) ServiceOption {
+	return func(s *service) {
+		s.embedder = embedder
+	}
+}
+
+// WithSearchMode searches with the mode, one of config.SearchModeVector, config.SearchModeKeyword or
+// config.SearchModeHybrid, instead of the SearchMode of the configuration
+func WithSearchMode(mode string) RetrieveOption {
+	return func(o *retrieveOptions) {
+		o.searchMode = mode
+	}
+}
+
+// WithFilter only retrieves the documents whose metadata matches the filter
+func WithFilter(filter *Filter) RetrieveOption {
+	return func(o *retrieveOptions) {
+		o.filter = filter
+	}
+}
+
+// NewService creates a new knowledge service with an in-memory store configured by the config
+func NewService(ctx context.Context, modelConfig *config.ModelConfig, conf *config.KnowledgeConfig, logger *slog.Logger, opts ...ServiceOption) (Service, error) {
+	store, err := NewInMemoryStoreFromConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	return NewServiceWithStore(ctx, conf, modelConfig, logger, store, opts...)
 }
 
 // NewServiceWithStore creates a new knowledge service with a custom knowledge store
@@ -64,11 +127,34 @@ func NewServiceWithStore(
 	modelConfig *config.ModelConfig,
 	logger *slog.Logger,
 	store Store,
+	opts ...ServiceOption,
 ) (Service, error) {
 	genkit := xgenkit.NewGenkit(ctx, modelConfig, logger, modelConfig.TraceVerbose)
 
+	s := &service{
+		genkit: genkit,
+		store:  store,
+		config: conf,
+		logger: logger,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.httpClient == nil {
+		var err error
+		if s.httpClient, err = httpclient.New(config.NewHTTPConfig()); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create embedder for RAG functionality
-	embedder := NewEmbedder(conf.NomicAPIKey)
+	if s.embedder == nil {
+		embedder, err := NewEmbedderFromConfig(genkit, conf, s.httpClient)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create embedder")
+		}
+		s.embedder = embedder
+	}
 
 	// Create reranker if enabled
 	var reranker Reranker
@@ -94,15 +180,9 @@ func NewServiceWithStore(
 		queryRewriter = NewNoOpQueryRewriter()
 	}
 
-	return &service{
-		genkit:        genkit,
-		store:         store,
-		embedder:      embedder,
-		reranker:      reranker,
-		queryRewriter: queryRewriter,
-		config:        conf,
-		logger:        logger,
-	}, nil
+	s.reranker = reranker
+	s.queryRewriter = queryRewriter
+	return s, nil
 }
 
 func (s *service) GetKnowledge(ctx context.Context, knowledgeId string) (*Knowledge, error) {
@@ -117,7 +197,42 @@ func (s *service) Close() error {
 }
 
 // RetrieveRelevantKnowledge retrieves relevant knowledge chunks based on query
-func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string) ([]*KnowledgeSearchResult, error) {
+func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, opts ...RetrieveOption) ([]*KnowledgeSearchResult, error) {
+	options := retrieveOptions{searchMode: s.config.SearchMode}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	searchMode := options.searchMode
+	switch searchMode {
+	case "":
+		searchMode = config.SearchModeVector
+	case config.SearchModeVector, config.SearchModeKeyword, config.SearchModeHybrid:
+	default:
+		return nil, errors.Errorf("unknown search mode %s", searchMode)
+	}
+	if options.filter != nil {
+		if err := options.filter.Validate(); err != nil {
+			return nil, errors.Wrapf(err, "invalid filter")
+		}
+	}
+
+	keywordSearcher, ok := s.store.(KeywordSearcher)
+	if !ok && searchMode != config.SearchModeVector {
+		if searchMode == config.SearchModeKeyword {
+			return nil, errors.Errorf("knowledge store %T does not support keyword search", s.store)
+		}
+		s.logger.Warn("knowledge store does not support keyword search, using vector search", slog.String("store", fmt.Sprintf("%T", s.store)))
+		searchMode = config.SearchModeVector
+	}
+
+	// Query embeddings cannot be compared to the embeddings of another model
+	if searchMode != config.SearchModeKeyword {
+		if err := s.checkEmbeddingModels(ctx, allowedKnowledgeIds); err != nil {
+			return nil, err
+		}
+	}
+
 	// Apply query rewriting
 	queries, err := s.queryRewriter.Rewrite(ctx, query)
 	if err != nil {
@@ -137,28 +252,45 @@ func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, l
 	uniqueResults := make(map[string]KnowledgeSearchResult) // Use map to track unique results by ID
 
 	for i, q := range queries {
-		// Generate embedding for this query
-		embeddings, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeQuery, q)
-		if err != nil {
-			s.logger.Warn("failed to generate embedding for rewritten query",
-				slog.String("query", q),
-				slog.String("error", err.Error()))
-			continue // Skip this query rather than using empty embedding
+		var vectorResults, keywordResults []KnowledgeSearchResult
+		if searchMode != config.SearchModeKeyword {
+			vectorResults, err = s.vectorSearch(ctx, q, retrievalLimit, allowedKnowledgeIds, options.filter)
+			if err != nil {
+				s.logger.Warn("vector search failed for rewritten query",
+					slog.String("query", q),
+					slog.String("error", err.Error()))
+				if searchMode == config.SearchModeVector {
+					continue
+				}
+			}
 		}
-
-		if len(embeddings) == 0 {
-			continue // Skip if no embeddings returned
+		if searchMode != config.SearchModeVector {
+			keywordResults, err = keywordSearcher.KeywordSearch(ctx, q, retrievalLimit, allowedKnowledgeIds, options.filter)
+			if err != nil {
+				s.logger.Warn("keyword search failed for rewritten query",
+					slog.String("query", q),
+					slog.String("error", err.Error()))
+				if searchMode == config.SearchModeKeyword {
+					continue
+				}
+			}
 		}
 
-		queryEmbedding := embeddings[0]
-
-		// Search for relevant knowledge
-		searchResults, err := s.store.Search(ctx, queryEmbedding, retrievalLimit, allowedKnowledgeIds)
-		if err != nil {
-			s.logger.Warn("search failed for rewritten query",
-				slog.String("query", q),
-				slog.String("error", err.Error()))
-			continue
+		var searchResults []KnowledgeSearchResult
+		switch searchMode {
+		case config.SearchModeVector:
+			searchResults = vectorResults
+		case config.SearchModeKeyword:
+			searchResults = keywordResults
+		case config.SearchModeHybrid:
+			searchResults = fuseRankings(
+				float64(cmp.Or(s.config.RRFK, 60)),
+				rankedList{results: vectorResults, weight: cmp.Or(s.config.HybridVectorWeight, 1.0)},
+				rankedList{results: keywordResults, weight: cmp.Or(s.config.HybridKeywordWeight, 1.0)},
+			)
+			if len(searchResults) > retrievalLimit {
+				searchResults = searchResults[:retrievalLimit]
+			}
 		}
 
 		// Apply score weighting based on query type
@@ -215,21 +347,61 @@ func (s *service) RetrieveRelevantKnowledge(ctx context.Context, query string, l
 	return candidates, nil
 }
 
-// IndexKnowledgeFromDocuments processes multiple documents with different types and merges them into a single Knowledge object
-func (s *service) IndexKnowledgeFromDocuments(ctx context.Context, id string, inputs iter.Seq2[*DocumentReader, error]) (*Knowledge, error) {
-	// First, delete existing knowledge for this ID
-	if id != "" {
-		if err := s.DeleteKnowledge(ctx, id); err != nil {
-			return nil, errors.Wrapf(err, "failed to delete existing knowledge")
+// embeddingModel is the embedding model of the embedder of the service
+func (s *service) embeddingModel() EmbeddingModel {
+	return EmbeddingModel{EmbedderID: s.embedder.EmbedderID(), Dimension: s.embedder.GetEmbedSize()}
+}
+
+// checkEmbeddingModels refuses to search knowledge embedded with another embedding model than the embedder of the
+// service. Knowledge of an unknown embedding model, stored before it was recorded, is searched
+func (s *service) checkEmbeddingModels(ctx context.Context, knowledgeIds []string) error {
+	models, err := s.store.GetEmbeddingModels(ctx, knowledgeIds)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get embedding models")
+	}
+
+	model := s.embeddingModel()
+	ids := make([]string, 0, len(models))
+	for id := range models {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if stored := models[id]; !stored.IsZero() && stored != model {
+			return errors.Errorf("knowledge %s is embedded with %s but queries are embedded with %s, re-embed it with ReembedKnowledge or search it by keywords", id, stored, model)
 		}
 	}
+	return nil
+}
+
+// vectorSearch searches the store with the embedding of the query
+func (s *service) vectorSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	embeddings, err := s.embedder.EmbedTexts(ctx, EmbeddingTaskTypeQuery, query)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to generate embedding")
+	}
+	if len(embeddings) == 0 {
+		return nil, errors.New("no embedding returned")
+	}
+
+	return s.store.Search(ctx, embeddings[0], limit, allowedKnowledgeIds, filter)
+}
 
-	knowledge, err := ProcessKnowledgeFromMultipleDocuments(ctx, s.genkit, id, inputs, s.logger, s.config, s.embedder)
+// IndexKnowledgeFromDocuments processes multiple documents with different types and merges them into a single Knowledge object
+// The knowledge stored before is replaced, and the chunks whose content did not change keep their embeddings
+func (s *service) IndexKnowledgeFromDocuments(ctx context.Context, id string, inputs iter.Seq2[*DocumentReader, error]) (*Knowledge, error) {
+	embedder, err := s.embedderFor(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	knowledge, err := ProcessKnowledgeFromMultipleDocuments(ctx, s.genkit, id, inputs, s.logger, s.config, embedder.withImages())
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to process knowledge from documents")
 	}
+	embedder.setContentHashes(knowledge.Documents)
+	knowledge.Embedding = s.embeddingModel()
 
-	// Store all items
+	// Store all items, replacing the documents stored before at once
 	if err := s.store.Store(ctx, knowledge); err != nil {
 		return nil, errors.Wrapf(err, "failed to store knowledge")
 	}
@@ -4,23 +4,52 @@ package knowledge
 
 import (
 	"context"
+	"encoding/binary"
 	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	sqlite_vec "github.com/asg017/sqlite-vec-go-bindings/cgo"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/samber/lo"
 	"gorm.io/datatypes"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-// SqliteStore implements Store using SQLite with sqlite-vec extension
-type SqliteStore struct {
-	db     *gorm.DB
-	vecDim int
+type (
+	// SqliteStore implements Store using SQLite with sqlite-vec extension, and KeywordSearcher with full-text search
+	SqliteStore struct {
+		db     *gorm.DB
+		vecDim int
+		// ftsModule is the full-text search module of the keyword index, fts5 if SQLite was built with it or fts4
+		ftsModule string
+		// rebuildVectorTable allows the vector table of another dimension to be dropped and created again
+		rebuildVectorTable bool
+	}
+
+	SqliteStoreOption func(s *SqliteStore)
+)
+
+// WithVectorTableRebuild drops the stored vectors when they have another dimension than the store, instead of
+// refusing to open it. The knowledge keeps its embedding model, so that it is not searched by vectors until
+// ReembedKnowledge computes its vectors again from the stored documents
+func WithVectorTableRebuild() SqliteStoreOption {
+	return func(s *SqliteStore) {
+		s.rebuildVectorTable = true
+	}
 }
 
+var (
+	_ Store           = (*SqliteStore)(nil)
+	_ KeywordSearcher = (*SqliteStore)(nil)
+)
+
 // KnowledgeRecord represents the database structure for knowledge items
 type SqliteKnowledgeRecord struct {
 	ID        string `gorm:"primaryKey"`
@@ -29,6 +58,10 @@ type SqliteKnowledgeRecord struct {
 
 	Metadata datatypes.JSONType[map[string]any]
 
+	// EmbedderID and EmbeddingDimension are the EmbeddingModel of the knowledge
+	EmbedderID         string
+	EmbeddingDimension int
+
 	Documents []*SqliteDocumentRecord `gorm:"foreignKey:KnowledgeRecordID"`
 }
 
@@ -45,6 +78,7 @@ type SqliteDocumentRecord struct {
 	Content       datatypes.JSONType[Content]
 	EmbeddingText string
 	Metadata      datatypes.JSONType[map[string]any]
+	ContentHash   string `gorm:"index"`
 
 	KnowledgeRecordID string
 	KnowledgeRecord   *SqliteKnowledgeRecord `gorm:"foreignKey:KnowledgeRecordID"`
@@ -54,8 +88,9 @@ func (SqliteDocumentRecord) TableName() string {
 	return "documents"
 }
 
-// NewSqliteStore creates a new SQLite-based knowledge store
-func NewSqliteStore(dbPath string, dimension int) (*SqliteStore, error) {
+// NewSqliteStore creates a new SQLite-based knowledge store. It fails if the stored vectors have another dimension,
+// unless WithVectorTableRebuild is given
+func NewSqliteStore(dbPath string, dimension int, opts ...SqliteStoreOption) (*SqliteStore, error) {
 	// Initialize sqlite-vec extension
 	sqlite_vec.Auto()
 
@@ -72,6 +107,9 @@ func NewSqliteStore(dbPath string, dimension int) (*SqliteStore, error) {
 		db:     db,
 		vecDim: dimension,
 	}
+	for _, opt := range opts {
+		opt(store)
+	}
 
 	// Auto-migrate the knowledge table
 	if err := db.AutoMigrate(&SqliteKnowledgeRecord{}, &SqliteDocumentRecord{}); err != nil {
@@ -83,9 +121,17 @@ func NewSqliteStore(dbPath string, dimension int) (*SqliteStore, error) {
 		return nil, err
 	}
 
+	// Create keyword table
+	if err := store.createKeywordTable(); err != nil {
+		return nil, err
+	}
+
 	return store, nil
 }
 
+// vectorDimensionPattern finds the dimension in the SQL of the vector table
+var vectorDimensionPattern = regexp.MustCompile(`float\[(\d+)\]`)
+
 // createVectorTable creates the sqlite-vec virtual table
 func (s *SqliteStore) createVectorTable() error {
 	// Verify sqlite-vec is loaded
@@ -95,6 +141,33 @@ func (s *SqliteStore) createVectorTable() error {
 		return errors.Wrapf(err, "sqlite-vec extension not properly loaded")
 	}
 
+	// The vectors of another dimension were computed by another embedder and cannot be searched anymore. They are
+	// only dropped on request, and the knowledge of an unknown embedding model is recorded with the dimension of
+	// the dropped vectors, so that its search is refused until ReembedKnowledge computes its vectors again
+	var existingSQL string
+	if err := s.db.Raw("SELECT COALESCE(MAX(sql), '') FROM sqlite_master WHERE type = 'table' AND name = 'document_vectors'").Row().Scan(&existingSQL); err != nil {
+		return errors.Wrapf(err, "failed to get document_vectors table")
+	}
+	if match := vectorDimensionPattern.FindStringSubmatch(existingSQL); match != nil && match[1] != strconv.Itoa(s.vecDim) {
+		if !s.rebuildVectorTable {
+			return errors.Errorf("the vectors of the store have %s dimensions but the embedder has %d, re-embed the knowledge with the knowledge reembed command", match[1], s.vecDim)
+		}
+		dimension, _ := strconv.Atoi(match[1])
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&SqliteKnowledgeRecord{}).
+				Where("embedder_id = '' AND embedding_dimension = 0").
+				Update("embedding_dimension", dimension).Error; err != nil {
+				return errors.Wrapf(err, "failed to record the embedding dimension of knowledge")
+			}
+			if err := tx.Exec("DROP TABLE document_vectors").Error; err != nil {
+				return errors.Wrapf(err, "failed to drop document_vectors table of dimension %d", dimension)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
 	// Create virtual table for vectors
 	createTableSQL := fmt.Sprintf(`
 		CREATE VIRTUAL TABLE IF NOT EXISTS document_vectors USING vec0(
@@ -110,11 +183,47 @@ func (s *SqliteStore) createVectorTable() error {
 	return nil
 }
 
+// createKeywordTable creates the full-text search table of the keyword search. FTS5 is only available when
+// go-sqlite3 is built with the sqlite_fts5 tag, so FTS4 is used otherwise, with BM25 computed from its matchinfo
+func (s *SqliteStore) createKeywordTable() error {
+	var existingSQL string
+	if err := s.db.Raw("SELECT COALESCE(MAX(sql), '') FROM sqlite_master WHERE type = 'table' AND name = 'document_fts'").Row().Scan(&existingSQL); err != nil {
+		return errors.Wrapf(err, "failed to look up document_fts table")
+	}
+
+	switch {
+	case strings.Contains(strings.ToLower(existingSQL), "fts5"):
+		s.ftsModule = "fts5"
+		return nil
+	case existingSQL != "":
+		s.ftsModule = "fts4"
+		return nil
+	}
+
+	if err := s.db.Exec("CREATE VIRTUAL TABLE document_fts USING fts5(document_id UNINDEXED, text, tokenize = 'unicode61')").Error; err == nil {
+		s.ftsModule = "fts5"
+	} else if err := s.db.Exec("CREATE VIRTUAL TABLE document_fts USING fts4(document_id, text, notindexed=document_id, tokenize=unicode61)").Error; err == nil {
+		s.ftsModule = "fts4"
+	} else {
+		return errors.Wrapf(err, "failed to create document_fts table")
+	}
+
+	// Index the documents stored before the keyword search existed
+	if err := s.db.Exec("INSERT INTO document_fts (document_id, text) SELECT id, embedding_text FROM documents").Error; err != nil {
+		return errors.Wrapf(err, "failed to index existing documents")
+	}
+
+	return nil
+}
+
 // Store implements Store.Store
 func (s *SqliteStore) Store(ctx context.Context, knowledge *Knowledge) error {
 	if len(knowledge.Documents) == 0 {
 		return nil
 	}
+	if err := s.checkDimension(knowledge.Documents); err != nil {
+		return err
+	}
 
 	// Begin transaction
 	tx := s.db.WithContext(ctx)
@@ -123,86 +232,300 @@ func (s *SqliteStore) Store(ctx context.Context, knowledge *Knowledge) error {
 			knowledge.ID = uuid.NewString()
 		}
 		record := SqliteKnowledgeRecord{
-			ID:        knowledge.ID,
-			Metadata:  datatypes.NewJSONType(knowledge.Metadata),
-			Documents: make([]*SqliteDocumentRecord, 0, len(knowledge.Documents)),
+			ID:                 knowledge.ID,
+			Metadata:           datatypes.NewJSONType(knowledge.Metadata),
+			EmbedderID:         knowledge.Embedding.EmbedderID,
+			EmbeddingDimension: knowledge.Embedding.Dimension,
+			Documents:          make([]*SqliteDocumentRecord, 0, len(knowledge.Documents)),
 		}
 
 		if err := tx.Save(&record).Error; err != nil {
 			return errors.Wrapf(err, "failed to save knowledge record")
 		}
 
+		documentIds := make([]string, 0, len(knowledge.Documents))
 		for _, item := range knowledge.Documents {
-			if item.ID == "" {
-				item.ID = uuid.NewString()
+			if err := saveDocument(tx, knowledge.ID, item); err != nil {
+				return err
 			}
+			documentIds = append(documentIds, item.ID)
+		}
 
-			// Create or update knowledge record
-			docRecord := SqliteDocumentRecord{
-				ID:                item.ID,
-				EmbeddingText:     item.EmbeddingText,
-				Metadata:          datatypes.NewJSONType(item.Metadata),
-				KnowledgeRecordID: knowledge.ID, // Set the foreign key
-				Content:           datatypes.NewJSONType(item.Content),
+		// Remove the documents stored before that are not part of the knowledge anymore
+		var staleIds []string
+		if err := tx.Model(&SqliteDocumentRecord{}).
+			Where("knowledge_record_id = ? AND id NOT IN ?", knowledge.ID, documentIds).
+			Pluck("id", &staleIds).Error; err != nil {
+			return errors.Wrapf(err, "failed to get stale documents")
+		}
+		if err := deleteDocuments(tx, staleIds); err != nil {
+			return err
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateDocuments implements Store.UpdateDocuments
+func (s *SqliteStore) UpdateDocuments(ctx context.Context, knowledgeId string, model EmbeddingModel, documents []*Document, deletedDocumentIds []string) error {
+	if err := s.checkDimension(documents); err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		record := SqliteKnowledgeRecord{
+			ID:       knowledgeId,
+			Metadata: datatypes.NewJSONType(map[string]any{}),
+		}
+		if err := tx.FirstOrCreate(&record, "id = ?", knowledgeId).Error; err != nil {
+			return errors.Wrapf(err, "failed to get knowledge record")
+		}
+		if !model.IsZero() {
+			if err := tx.Model(&record).Updates(map[string]any{
+				"embedder_id":         model.EmbedderID,
+				"embedding_dimension": model.Dimension,
+			}).Error; err != nil {
+				return errors.Wrapf(err, "failed to update embedding model")
 			}
+		}
 
-			// Use Save to create or update
-			if err := tx.Save(&docRecord).Error; err != nil {
-				return errors.Wrapf(err, "failed to save document record")
+		// Only the documents of the knowledge are deleted
+		var ids []string
+		if len(deletedDocumentIds) > 0 {
+			if err := tx.Model(&SqliteDocumentRecord{}).
+				Where("knowledge_record_id = ? AND id IN ?", knowledgeId, deletedDocumentIds).
+				Pluck("id", &ids).Error; err != nil {
+				return errors.Wrapf(err, "failed to get deleted documents")
 			}
+		}
+		if err := deleteDocuments(tx, ids); err != nil {
+			return err
+		}
 
-			// Store embedding in vector table
-			if len(item.Embeddings) > 0 {
-				// Delete existing vector (if updating)
-				if err := tx.Exec("DELETE FROM document_vectors WHERE document_id = ?", item.ID).Error; err != nil {
-					return errors.Wrapf(err, "failed to delete existing vector")
-				}
-
-				// Serialize embedding
-				serializedEmbedding, err := sqlite_vec.SerializeFloat32(item.Embeddings)
-				if err != nil {
-					return errors.Wrapf(err, "failed to serialize embedding")
-				}
-
-				// Insert new vector
-				insertSQL := "INSERT INTO document_vectors (document_id, embedding) VALUES (?, ?)"
-				if err := tx.Exec(insertSQL, item.ID, serializedEmbedding).Error; err != nil {
-					return errors.Wrapf(err, "failed to insert knowledge vector")
-				}
+		for _, item := range documents {
+			if err := saveDocument(tx, knowledgeId, item); err != nil {
+				return err
 			}
 		}
+		return nil
+	})
+}
+
+// UpdateEmbeddings implements Store.UpdateEmbeddings
+func (s *SqliteStore) UpdateEmbeddings(ctx context.Context, knowledgeId string, model EmbeddingModel, embeddings map[string][]float32) error {
+	if model.Dimension != s.vecDim {
+		return errors.Errorf("embeddings of %s do not fit the %d dimensions of the store", model, s.vecDim)
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var documentIds []string
+		if err := tx.Model(&SqliteDocumentRecord{}).Where("knowledge_record_id = ?", knowledgeId).Pluck("id", &documentIds).Error; err != nil {
+			return errors.Wrapf(err, "failed to get documents of knowledge %s", knowledgeId)
+		}
 
+		for _, id := range documentIds {
+			embedding, ok := embeddings[id]
+			if !ok {
+				continue
+			}
+			if len(embedding) != s.vecDim {
+				return errors.Errorf("embedding of document %s has %d dimensions, expected %d", id, len(embedding), s.vecDim)
+			}
+			serializedEmbedding, err := sqlite_vec.SerializeFloat32(embedding)
+			if err != nil {
+				return errors.Wrapf(err, "failed to serialize embedding")
+			}
+			if err := tx.Exec("DELETE FROM document_vectors WHERE document_id = ?", id).Error; err != nil {
+				return errors.Wrapf(err, "failed to delete existing vector")
+			}
+			if err := tx.Exec("INSERT INTO document_vectors (document_id, embedding) VALUES (?, ?)", id, serializedEmbedding).Error; err != nil {
+				return errors.Wrapf(err, "failed to insert knowledge vector")
+			}
+		}
+
+		if err := tx.Model(&SqliteKnowledgeRecord{}).Where("id = ?", knowledgeId).Updates(map[string]any{
+			"embedder_id":         model.EmbedderID,
+			"embedding_dimension": model.Dimension,
+		}).Error; err != nil {
+			return errors.Wrapf(err, "failed to update embedding model")
+		}
 		return nil
-	}); err != nil {
-		return err
+	})
+}
+
+// GetEmbeddingModels implements Store.GetEmbeddingModels
+func (s *SqliteStore) GetEmbeddingModels(ctx context.Context, knowledgeIds []string) (map[string]EmbeddingModel, error) {
+	query := s.db.WithContext(ctx).Model(&SqliteKnowledgeRecord{}).Select("id", "embedder_id", "embedding_dimension")
+	if len(knowledgeIds) > 0 {
+		query = query.Where("id IN ?", knowledgeIds)
+	}
+
+	var records []SqliteKnowledgeRecord
+	if err := query.Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to get embedding models")
 	}
 
+	models := make(map[string]EmbeddingModel, len(records))
+	for _, record := range records {
+		models[record.ID] = EmbeddingModel{EmbedderID: record.EmbedderID, Dimension: record.EmbeddingDimension}
+	}
+	return models, nil
+}
+
+// checkDimension checks that the embeddings of the documents fit the vector table
+func (s *SqliteStore) checkDimension(documents []*Document) error {
+	for _, doc := range documents {
+		if len(doc.Embeddings) > 0 && len(doc.Embeddings) != s.vecDim {
+			return errors.Errorf("embedding of document %s has %d dimensions, but the store has %d", doc.ID, len(doc.Embeddings), s.vecDim)
+		}
+	}
 	return nil
 }
 
-// Search implements Store.Search
-func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string) ([]KnowledgeSearchResult, error) {
-	var allowedDocumentIds []string
+// saveDocument creates or updates the document with its keywords and embeddings
+func saveDocument(tx *gorm.DB, knowledgeId string, item *Document) error {
+	if item.ID == "" {
+		item.ID = uuid.NewString()
+	}
 
-	// Get document IDs from allowed knowledge IDs
-	if len(allowedKnowledgeIds) > 0 {
-		if err := s.db.WithContext(ctx).
-			Model(&SqliteDocumentRecord{}).
-			Where("knowledge_record_id IN ?", allowedKnowledgeIds).
-			Pluck("id", &allowedDocumentIds).Error; err != nil {
-			return nil, errors.Wrapf(err, "failed to get document IDs from knowledge IDs")
+	// Create or update knowledge record
+	docRecord := SqliteDocumentRecord{
+		ID:                item.ID,
+		EmbeddingText:     item.EmbeddingText,
+		Metadata:          datatypes.NewJSONType(item.Metadata),
+		ContentHash:       item.ContentHash,
+		KnowledgeRecordID: knowledgeId, // Set the foreign key
+		Content:           datatypes.NewJSONType(item.Content),
+	}
+
+	// Use Save to create or update
+	if err := tx.Save(&docRecord).Error; err != nil {
+		return errors.Wrapf(err, "failed to save document record")
+	}
+
+	// Store text in keyword table
+	if err := tx.Exec("DELETE FROM document_fts WHERE document_id = ?", item.ID).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete existing keywords")
+	}
+	if err := tx.Exec("INSERT INTO document_fts (document_id, text) VALUES (?, ?)", item.ID, keywordText(item)).Error; err != nil {
+		return errors.Wrapf(err, "failed to insert document keywords")
+	}
+
+	// Store embedding in vector table
+	if len(item.Embeddings) > 0 {
+		// Delete existing vector (if updating)
+		if err := tx.Exec("DELETE FROM document_vectors WHERE document_id = ?", item.ID).Error; err != nil {
+			return errors.Wrapf(err, "failed to delete existing vector")
+		}
+
+		// Serialize embedding
+		serializedEmbedding, err := sqlite_vec.SerializeFloat32(item.Embeddings)
+		if err != nil {
+			return errors.Wrapf(err, "failed to serialize embedding")
 		}
 
-		// If no documents found for the allowed knowledge IDs, return empty results
-		if len(allowedDocumentIds) == 0 {
-			return []KnowledgeSearchResult{}, nil
+		// Insert new vector
+		insertSQL := "INSERT INTO document_vectors (document_id, embedding) VALUES (?, ?)"
+		if err := tx.Exec(insertSQL, item.ID, serializedEmbedding).Error; err != nil {
+			return errors.Wrapf(err, "failed to insert knowledge vector")
 		}
 	}
 
+	return nil
+}
+
+// deleteDocuments deletes the documents with their vectors and keywords
+func deleteDocuments(tx *gorm.DB, documentIds []string) error {
+	if len(documentIds) == 0 {
+		return nil
+	}
+
+	// Delete from vector table
+	if err := tx.Exec("DELETE FROM document_vectors WHERE document_id IN ?", documentIds).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete vectors")
+	}
+
+	// Delete from keyword table
+	if err := tx.Exec("DELETE FROM document_fts WHERE document_id IN ?", documentIds).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete keywords")
+	}
+
+	// Delete from knowledge table
+	if err := tx.Delete(&SqliteDocumentRecord{}, "id IN ?", documentIds).Error; err != nil {
+		return errors.Wrapf(err, "failed to delete knowledge records")
+	}
+
+	return nil
+}
+
+// GetEmbeddingsByContentHash implements Store.GetEmbeddingsByContentHash
+func (s *SqliteStore) GetEmbeddingsByContentHash(ctx context.Context, knowledgeId string, contentHashes []string) (map[string][]float32, error) {
+	embeddings := make(map[string][]float32)
+	if len(contentHashes) == 0 {
+		return embeddings, nil
+	}
+
+	rows, err := s.db.WithContext(ctx).Raw(`
+		SELECT documents.content_hash, document_vectors.embedding
+		FROM documents
+		JOIN document_vectors ON document_vectors.document_id = documents.id
+		WHERE documents.knowledge_record_id = ? AND documents.content_hash IN ?
+	`, knowledgeId, contentHashes).Rows()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to query embeddings")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			hash string
+			blob []byte
+		)
+		if err := rows.Scan(&hash, &blob); err != nil {
+			return nil, errors.Wrapf(err, "failed to scan embedding row")
+		}
+		if len(blob)%4 != 0 {
+			return nil, errors.Errorf("invalid embedding of %d bytes", len(blob))
+		}
+
+		// sqlite-vec stores the vectors as little endian float32
+		embedding := make([]float32, len(blob)/4)
+		for i := range embedding {
+			embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[i*4:]))
+		}
+		embeddings[hash] = embedding
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read embeddings")
+	}
+
+	return embeddings, nil
+}
+
+// Search implements Store.Search
+func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	// Get document IDs from allowed knowledge IDs and the filter
+	allowedDocumentIds, restricted, err := s.allowedDocumentIds(ctx, allowedKnowledgeIds, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// If no documents found for the allowed knowledge IDs, return empty results
+	if restricted && len(allowedDocumentIds) == 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+
 	// Validate embedding
 	if len(queryEmbedding) == 0 {
 		return []KnowledgeSearchResult{}, nil
 	}
+	if len(queryEmbedding) != s.vecDim {
+		return nil, errors.Errorf("query embedding has %d dimensions, but the store has %d", len(queryEmbedding), s.vecDim)
+	}
 
 	// Serialize query embedding
 	serializedQuery, err := sqlite_vec.SerializeFloat32(queryEmbedding)
@@ -215,15 +538,15 @@ func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limi
 	var args []interface{}
 
 	if len(allowedDocumentIds) > 0 {
-		// Filter by allowed document IDs if specified
+		// Filter by allowed document IDs if specified. The number of neighbors is set with k rather than LIMIT,
+		// which vec0 does not see when a single allowed ID turns the IN into a primary key lookup
 		searchSQL = `
 			SELECT document_id, distance
 			FROM document_vectors
-			WHERE embedding MATCH ? AND document_id IN ?
+			WHERE embedding MATCH ? AND k = ? AND document_id IN ?
 			ORDER BY distance
-			LIMIT ?
 		`
-		args = []interface{}{serializedQuery, allowedDocumentIds, limit * 2}
+		args = []interface{}{serializedQuery, limit * 2, allowedDocumentIds}
 	} else {
 		// No filtering - search all documents
 		searchSQL = `
@@ -297,6 +620,11 @@ func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limi
 		})
 	}
 
+	// The records are not fetched in the order of the distances
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+
 	// Limit results
 	if len(results) > limit {
 		results = results[:limit]
@@ -305,10 +633,286 @@ func (s *SqliteStore) Search(ctx context.Context, queryEmbedding []float32, limi
 	return results, nil
 }
 
+// KeywordSearch implements KeywordSearcher.KeywordSearch with the full-text search table
+func (s *SqliteStore) KeywordSearch(ctx context.Context, query string, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error) {
+	// Every word is quoted, so that the query cannot use the operators of the full-text query syntax
+	terms := lo.Uniq(tokenize(query))
+	if len(terms) == 0 || limit <= 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+	match := `"` + strings.Join(terms, `" OR "`) + `"`
+
+	allowedDocumentIds, restricted, err := s.allowedDocumentIds(ctx, allowedKnowledgeIds, filter)
+	if err != nil {
+		return nil, err
+	}
+	if restricted && len(allowedDocumentIds) == 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+
+	var scores map[string]float64
+	if s.ftsModule == "fts5" {
+		scores, err = s.keywordScoresFTS5(ctx, match, limit, allowedDocumentIds)
+	} else {
+		scores, err = s.keywordScoresFTS4(ctx, match, allowedDocumentIds)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(scores) == 0 {
+		return []KnowledgeSearchResult{}, nil
+	}
+
+	var records []SqliteDocumentRecord
+	if err := s.db.WithContext(ctx).Where("id IN ?", lo.Keys(scores)).Find(&records).Error; err != nil {
+		return nil, errors.Wrapf(err, "failed to fetch knowledge records")
+	}
+
+	results := make([]KnowledgeSearchResult, 0, len(records))
+	for _, record := range records {
+		metadata := record.Metadata.Data()
+		if metadata == nil {
+			metadata = map[string]any{
+				"knowledge_id": record.KnowledgeRecordID,
+			}
+		}
+
+		results = append(results, KnowledgeSearchResult{
+			Document: &Document{
+				ID:            record.ID,
+				Content:       record.Content.Data(),
+				Metadata:      metadata,
+				EmbeddingText: record.EmbeddingText,
+			},
+			Score: float32(scores[record.ID]),
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	return results, nil
+}
+
+// allowedDocumentIds returns the IDs of the documents of allowedKnowledgeIds matching the filter. restricted is
+// false if all the documents are allowed
+func (s *SqliteStore) allowedDocumentIds(ctx context.Context, allowedKnowledgeIds []string, filter *Filter) (ids []string, restricted bool, err error) {
+	if len(allowedKnowledgeIds) == 0 && filter == nil {
+		return nil, false, nil
+	}
+
+	query := s.db.WithContext(ctx).Model(&SqliteDocumentRecord{})
+	if len(allowedKnowledgeIds) > 0 {
+		query = query.Where("knowledge_record_id IN ?", allowedKnowledgeIds)
+	}
+	if filter != nil {
+		if err := filter.Validate(); err != nil {
+			return nil, false, err
+		}
+		condition, args := filterSQL(filter)
+		query = query.Where(condition, args...)
+	}
+	if err := query.Pluck("id", &ids).Error; err != nil {
+		return nil, false, errors.Wrapf(err, "failed to get allowed document IDs")
+	}
+	return ids, true, nil
+}
+
+// filterSQL translates the filter into a condition on the metadata column of the documents. Conditions on a field
+// go through json_each, which yields the field itself if it is not a list, and compare values of the same JSON
+// type only, like Filter.Matches
+func filterSQL(f *Filter) (string, []any) {
+	switch {
+	case f.And != nil || f.Or != nil:
+		filters, operator, empty := f.And, " AND ", "1"
+		if f.Or != nil {
+			filters, operator, empty = f.Or, " OR ", "0"
+		}
+		if len(filters) == 0 {
+			return empty, nil
+		}
+		conditions := make([]string, len(filters))
+		var args []any
+		for i := range filters {
+			condition, conditionArgs := filterSQL(&filters[i])
+			conditions[i] = "(" + condition + ")"
+			args = append(args, conditionArgs...)
+		}
+		return strings.Join(conditions, operator), args
+	}
+
+	path := `$."` + f.Field + `"`
+	if f.Exists != nil {
+		operator := "!="
+		if !*f.Exists {
+			operator = "="
+		}
+		return "COALESCE(json_type(metadata, ?), 'null') " + operator + " 'null'", []any{path}
+	}
+
+	var (
+		conditions []string
+		args       = []any{path}
+	)
+	switch {
+	case f.Eq != nil || f.In != nil:
+		values := f.In
+		if f.Eq != nil {
+			values = []any{f.Eq}
+		}
+		for _, value := range values {
+			conditions = append(conditions, "("+jsonTypeCondition(value)+" AND value = ?)")
+			args = append(args, filterSQLValue(value))
+		}
+		return "EXISTS (SELECT 1 FROM json_each(metadata, ?) WHERE " + strings.Join(conditions, " OR ") + ")", args
+	default:
+		conditions = append(conditions, jsonTypeCondition(f.rangeBounds()[0]))
+		for _, bound := range []struct {
+			operator string
+			value    any
+		}{{">", f.Gt}, {">=", f.Gte}, {"<", f.Lt}, {"<=", f.Lte}} {
+			if bound.value != nil {
+				conditions = append(conditions, "value "+bound.operator+" ?")
+				args = append(args, filterSQLValue(bound.value))
+			}
+		}
+		return "EXISTS (SELECT 1 FROM json_each(metadata, ?) WHERE " + strings.Join(conditions, " AND ") + ")", args
+	}
+}
+
+// jsonTypeCondition restricts json_each to the values of the JSON type of value
+func jsonTypeCondition(value any) string {
+	if _, ok := value.(bool); ok {
+		return "type IN ('true', 'false')"
+	}
+	if _, ok := filterNumber(value); ok {
+		return "type IN ('integer', 'real')"
+	}
+	return "type = 'text'"
+}
+
+// filterSQLValue converts a filter value to the value json_each yields for it
+func filterSQLValue(value any) any {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	if n, ok := filterNumber(value); ok {
+		return n
+	}
+	return value
+}
+
+// keywordScoresFTS5 ranks the matching documents with the bm25 function of FTS5, which is lower for better matches
+func (s *SqliteStore) keywordScoresFTS5(ctx context.Context, match string, limit int, allowedDocumentIds []string) (map[string]float64, error) {
+	searchSQL := "SELECT document_id, bm25(document_fts) AS rank FROM document_fts WHERE document_fts MATCH ?"
+	args := []interface{}{match}
+	if len(allowedDocumentIds) > 0 {
+		searchSQL += " AND document_id IN ?"
+		args = append(args, allowedDocumentIds)
+	}
+	searchSQL += " ORDER BY rank LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := s.db.WithContext(ctx).Raw(searchSQL, args...).Rows()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to execute keyword search query")
+	}
+	defer rows.Close()
+
+	scores := make(map[string]float64)
+	for rows.Next() {
+		var (
+			id   string
+			rank float64
+		)
+		if err := rows.Scan(&id, &rank); err != nil {
+			return nil, errors.Wrapf(err, "failed to scan result row")
+		}
+		scores[id] = -rank
+	}
+	return scores, rows.Err()
+}
+
+// keywordScoresFTS4 computes the BM25 scores of all the matching documents from the matchinfo of FTS4
+func (s *SqliteStore) keywordScoresFTS4(ctx context.Context, match string, allowedDocumentIds []string) (map[string]float64, error) {
+	searchSQL := "SELECT document_id, matchinfo(document_fts, 'pcnalx') FROM document_fts WHERE document_fts MATCH ?"
+	args := []interface{}{match}
+	if len(allowedDocumentIds) > 0 {
+		searchSQL += " AND document_id IN ?"
+		args = append(args, allowedDocumentIds)
+	}
+
+	rows, err := s.db.WithContext(ctx).Raw(searchSQL, args...).Rows()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to execute keyword search query")
+	}
+	defer rows.Close()
+
+	scores := make(map[string]float64)
+	for rows.Next() {
+		var (
+			id        string
+			matchInfo []byte
+		)
+		if err := rows.Scan(&id, &matchInfo); err != nil {
+			return nil, errors.Wrapf(err, "failed to scan result row")
+		}
+		score, err := bm25FromMatchInfo(matchInfo)
+		if err != nil {
+			return nil, err
+		}
+		scores[id] = score
+	}
+	return scores, rows.Err()
+}
+
+// bm25FromMatchInfo computes the BM25 score of the text column from a matchinfo 'pcnalx' blob, an array of
+// native endian uint32: the phrase count p, the column count c, the row count n, the average token count of
+// each column, the token count of each column in the row, then for each phrase and column the hits in the row,
+// the hits in all rows and the rows with hits
+func bm25FromMatchInfo(matchInfo []byte) (float64, error) {
+	values := make([]uint32, len(matchInfo)/4)
+	for i := range values {
+		values[i] = binary.NativeEndian.Uint32(matchInfo[i*4:])
+	}
+	if len(values) < 3 {
+		return 0, errors.New("invalid matchinfo")
+	}
+	p, c, n := int(values[0]), int(values[1]), int(values[2])
+	if len(values) != 3+2*c+3*p*c {
+		return 0, errors.New("invalid matchinfo")
+	}
+
+	const textColumn = 1
+	avgDocLen := float64(values[3+textColumn])
+	docLen := float64(values[3+c+textColumn])
+
+	var score float64
+	for phrase := 0; phrase < p; phrase++ {
+		x := 3 + 2*c + 3*(phrase*c+textColumn)
+		if tf := values[x]; tf > 0 {
+			score += bm25(float64(tf), docLen, avgDocLen, int(values[x+2]), n)
+		}
+	}
+	return score, nil
+}
+
 // GetKnowledgeById implements Store.GetKnowledgeById
 func (s *SqliteStore) GetKnowledgeById(ctx context.Context, knowledgeId string) (*Knowledge, error) {
 	var record SqliteKnowledgeRecord
-	if err := s.db.WithContext(ctx).Preload("Documents").First(&record, "id = ?", knowledgeId).Error; err != nil {
+	if err := s.db.WithContext(ctx).Preload("Documents").First(&record, "id = ?", knowledgeId).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil // Return nil, nil for not found, like the in-memory store
+	} else if err != nil {
 		return nil, errors.Wrapf(err, "failed to fetch knowledge records")
 	}
 
@@ -316,6 +920,7 @@ func (s *SqliteStore) GetKnowledgeById(ctx context.Context, knowledgeId string)
 		ID:        record.ID,
 		Metadata:  record.Metadata.Data(),
 		Documents: make([]*Document, 0, len(record.Documents)),
+		Embedding: EmbeddingModel{EmbedderID: record.EmbedderID, Dimension: record.EmbeddingDimension},
 	}
 
 	for _, document := range record.Documents {
@@ -332,6 +937,7 @@ func (s *SqliteStore) GetKnowledgeById(ctx context.Context, knowledgeId string)
 			Content:       document.Content.Data(),
 			Metadata:      metadata,
 			EmbeddingText: document.EmbeddingText,
+			ContentHash:   document.ContentHash,
 		})
 	}
 
@@ -347,16 +953,8 @@ func (s *SqliteStore) DeleteKnowledgeById(ctx context.Context, knowledgeId strin
 			return errors.Wrapf(err, "failed to get knowledge record")
 		}
 
-		if len(documentIds) > 0 {
-			// Delete from vector table
-			if err := tx.Exec("DELETE FROM document_vectors WHERE document_id IN ?", documentIds).Error; err != nil {
-				return errors.Wrapf(err, "failed to delete vectors")
-			}
-
-			// Delete from knowledge table
-			if err := tx.Delete(&SqliteDocumentRecord{}, "id IN ?", documentIds).Error; err != nil {
-				return errors.Wrapf(err, "failed to delete knowledge records")
-			}
+		if err := deleteDocuments(tx, documentIds); err != nil {
+			return err
 		}
 
 		if err := tx.Delete(&SqliteKnowledgeRecord{}, "id = ?", knowledgeId).Error; err != nil {
@@ -6,12 +6,30 @@ import (
 
 // Store defines the interface for complete knowledge storage operations
 type Store interface {
-	// Store stores or updates knowledge items with their embeddings
+	// Store stores or updates knowledge items with their embeddings, replacing the documents stored before
 	// This should be atomic - either all items are stored or none
 	Store(ctx context.Context, knowledge *Knowledge) error
 
-	// Search performs semantic search and returns matching results
-	Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string) ([]KnowledgeSearchResult, error)
+	// UpdateDocuments removes the documents of deletedDocumentIds from the knowledge and stores documents in it,
+	// replacing the documents of the same IDs. The knowledge is created if it does not exist. The embedding model
+	// of the knowledge is set to model unless it is zero. This should be atomic like Store
+	UpdateDocuments(ctx context.Context, knowledgeId string, model EmbeddingModel, documents []*Document, deletedDocumentIds []string) error
+
+	// UpdateEmbeddings replaces the embeddings of the documents of the knowledge, by document ID, and sets the
+	// embedding model of the knowledge to model. This should be atomic like Store
+	UpdateEmbeddings(ctx context.Context, knowledgeId string, model EmbeddingModel, embeddings map[string][]float32) error
+
+	// GetEmbeddingModels returns the embedding models of the knowledge of knowledgeIds, or of all the knowledge
+	// if there are none, by knowledge ID
+	GetEmbeddingModels(ctx context.Context, knowledgeIds []string) (map[string]EmbeddingModel, error)
+
+	// GetEmbeddingsByContentHash returns the embeddings stored in the knowledge for the content hashes, by hash.
+	// Hashes without stored embeddings are left out
+	GetEmbeddingsByContentHash(ctx context.Context, knowledgeId string, contentHashes []string) (map[string][]float32, error)
+
+	// Search performs semantic search and returns matching results. Only the documents of allowedKnowledgeIds,
+	// if any, whose metadata matches filter, if not nil, are searched
+	Search(ctx context.Context, queryEmbedding []float32, limit int, allowedKnowledgeIds []string, filter *Filter) ([]KnowledgeSearchResult, error)
 
 	// GetKnowledgeById retrieves all knowledge items for a specific agent
 	GetKnowledgeById(ctx context.Context, knowledgeId string) (*Knowledge, error)
@@ -12,6 +12,15 @@ type (
 		ID        string         `json:"id"`
 		Metadata  map[string]any `json:"metadata"`
 		Documents []*Document    `json:"documents"`
+		// Embedding is the embedding model of the embeddings of the documents
+		Embedding EmbeddingModel `json:"embedding"`
+	}
+
+	// EmbeddingModel identifies the embedder that computed embeddings. The zero value is unknown, for knowledge
+	// stored before it was recorded
+	EmbeddingModel struct {
+		EmbedderID string `json:"embedderId,omitempty"`
+		Dimension  int    `json:"dimension,omitempty"`
 	}
 
 	Document struct {
@@ -20,6 +29,9 @@ type (
 		Embeddings    []float32      `json:"embeddings"`
 		EmbeddingText string         `json:"embeddingText"`
 		Metadata      map[string]any `json:"metadata"`
+		// ContentHash identifies the content the embeddings were computed from, so that re-indexing an unchanged
+		// document reuses its stored embeddings
+		ContentHash string `json:"contentHash,omitempty"`
 	}
 
 	KnowledgeSearchResult struct {
@@ -47,6 +59,8 @@ const (
 	MetadataKeySourceURL      = "source_url"
 	MetadataKeySourceFilename = "source_filename"
 	MetadataKeySourceType     = "source_type"
+	// MetadataKeyDocumentID is the DocumentReader.ID of the source of a chunk
+	MetadataKeyDocumentID = "document_id"
 
 	ContentTypeText  ContentType = "text"
 	ContentTypeImage ContentType = "image"
@@ -71,6 +85,15 @@ func (d *Document) ToDoc() (*ai.Document, error) {
 	return doc, nil
 }
 
+// IsZero reports whether the embedding model is unknown
+func (m EmbeddingModel) IsZero() bool {
+	return m == EmbeddingModel{}
+}
+
+func (m EmbeddingModel) String() string {
+	return fmt.Sprintf("%s (%d dimensions)", m.EmbedderID, m.Dimension)
+}
+
 func (c *Content) Type() ContentType {
 	switch c.MIMEType {
 	case "plain/text", "text/plain", "text/markdown":
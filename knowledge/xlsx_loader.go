@@ -0,0 +1,344 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// xlsxFormatLiteralPattern matches the quoted text, escaped characters and bracketed colors and conditions of
+// number formats, which are not date and time placeholders
+var xlsxFormatLiteralPattern = regexp.MustCompile(`"[^"]*"|\\.|\[[^\]]*\]`)
+
+type (
+	// xlsxWorkbook reads the cells of the sheets of a workbook
+	xlsxWorkbook struct {
+		sharedStrings []string
+		// cellFormats are the kinds of values of the cell styles, by style index
+		cellFormats []xlsxValueFormat
+		date1904    bool
+	}
+
+	// xlsxValueFormat is the kind of the values of numeric cells
+	xlsxValueFormat int
+
+	// xlsxRow is a row of a sheet with its number in the sheet
+	xlsxRow struct {
+		number int
+		cells  []string
+	}
+)
+
+const (
+	xlsxNumber xlsxValueFormat = iota
+	xlsxDate
+	xlsxTime
+	xlsxDateTime
+)
+
+// ProcessDocumentsFromXLSX processes an Excel workbook like CSV files, with a document per row of each visible
+// sheet. The first non-empty row of a sheet is its header, and rows are described by the header of each of their
+// cells. Documents have the name and number of their sheet in their metadata, so the rows of a sheet can be
+// filtered together, and the core properties of the workbook
+func ProcessDocumentsFromXLSX(
+	ctx context.Context,
+	reader io.Reader,
+	logger *slog.Logger,
+	embedder Embedder,
+) ([]*Document, map[string]any, error) {
+	pkg, err := openOfficePackage(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	name, err := pkg.mainPart("xl/workbook.xml")
+	if err != nil {
+		return nil, nil, err
+	}
+	workbookPart, err := pkg.parse(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	relationships, err := pkg.relationships(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workbook := &xlsxWorkbook{}
+	switch workbookPart.child("workbookPr").attr("date1904") {
+	case "1", "true":
+		workbook.date1904 = true
+	}
+	for _, relationship := range relationships {
+		switch {
+		case strings.HasSuffix(relationship.Type, "/sharedStrings"):
+			sharedStrings, err := pkg.parse(relationship.Target)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, si := range sharedStrings.children("si") {
+				workbook.sharedStrings = append(workbook.sharedStrings, xlsxText(si))
+			}
+		case strings.HasSuffix(relationship.Type, "/styles"):
+			if styles, err := pkg.parse(relationship.Target); err == nil {
+				workbook.readStyles(styles)
+			}
+		}
+	}
+
+	documents := make([]*Document, 0)
+	var sheetNames []string
+	for _, sheet := range workbookPart.path("sheets").children("sheet") {
+		if state := sheet.attr("state"); state == "hidden" || state == "veryHidden" {
+			continue
+		}
+		relationship, ok := relationships[sheet.relationshipId()]
+		if !ok || relationship.External {
+			continue
+		}
+		sheetPart, err := pkg.parse(relationship.Target)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		sheetName := sheet.attr("name")
+		sheetNames = append(sheetNames, sheetName)
+		rows := workbook.rows(sheetPart)
+		if len(rows) == 0 {
+			continue
+		}
+
+		// Columns without a header are named by their letters
+		headers := rows[0].cells
+		for i, header := range headers {
+			if header == "" {
+				headers[i] = "Column " + xlsxColumnName(i)
+			}
+		}
+		for _, row := range rows[1:] {
+			textParts := []string{"Sheet: " + sheetName}
+			rowData := make(map[string]string)
+			for i, value := range row.cells {
+				header := "Column " + xlsxColumnName(i)
+				if i < len(headers) {
+					header = headers[i]
+				}
+				if value != "" {
+					rowData[header] = value
+					textParts = append(textParts, fmt.Sprintf("%s: %s", header, value))
+				}
+			}
+
+			content := strings.Join(textParts, " | ")
+			documents = append(documents, &Document{
+				Content: Content{
+					Text:     content,
+					MIMEType: "text/plain",
+				},
+				EmbeddingText: content,
+				Metadata: map[string]any{
+					"sheet_name":   sheetName,
+					"sheet_number": len(sheetNames),
+					"row_number":   row.number,
+					"row_data":     rowData,
+				},
+			})
+		}
+	}
+
+	if len(documents) == 0 {
+		return nil, nil, errors.New("no valid rows found in XLSX")
+	}
+	if err := embedDocuments(ctx, documents, embedder); err != nil {
+		return nil, nil, errors.Wrap(err, "failed to process XLSX")
+	}
+
+	metadata := map[string]any{
+		"source_type": SourceTypeXLSX,
+		"total_rows":  len(documents),
+		"sheets":      sheetNames,
+	}
+	setDocumentMetadata(documents, metadata, pkg.properties())
+
+	logger.Info("Processed XLSX", "rows", len(documents), "sheets", len(sheetNames))
+	return documents, metadata, nil
+}
+
+// readStyles reads which cell styles format numbers as dates or times
+func (w *xlsxWorkbook) readStyles(styles *xmlElement) {
+	customFormats := make(map[string]string)
+	for _, numFmt := range styles.path("numFmts").children("numFmt") {
+		customFormats[numFmt.attr("numFmtId")] = numFmt.attr("formatCode")
+	}
+	for _, xf := range styles.path("cellXfs").children("xf") {
+		id := xf.attr("numFmtId")
+		format := xlsxNumber
+		if code, ok := customFormats[id]; ok {
+			format = xlsxFormatOfCode(code)
+		} else {
+			switch n, _ := strconv.Atoi(id); {
+			case n >= 14 && n <= 17:
+				format = xlsxDate
+			case (n >= 18 && n <= 21) || (n >= 45 && n <= 47):
+				format = xlsxTime
+			case n == 22:
+				format = xlsxDateTime
+			}
+		}
+		w.cellFormats = append(w.cellFormats, format)
+	}
+}
+
+// xlsxFormatOfCode returns the kind of values of a custom number format
+func xlsxFormatOfCode(code string) xlsxValueFormat {
+	code = strings.ToLower(xlsxFormatLiteralPattern.ReplaceAllString(code, ""))
+	date := strings.ContainsAny(code, "yd")
+	clock := strings.ContainsAny(code, "hs")
+	switch {
+	case date && clock:
+		return xlsxDateTime
+	case date:
+		return xlsxDate
+	case clock:
+		return xlsxTime
+	}
+	return xlsxNumber
+}
+
+// rows returns the rows of the sheet with a value, with their cells by column
+func (w *xlsxWorkbook) rows(sheet *xmlElement) []xlsxRow {
+	var rows []xlsxRow
+	for _, row := range sheet.path("sheetData").children("row") {
+		number, err := strconv.Atoi(row.attr("r"))
+		if err != nil {
+			number = len(rows) + 1
+			if len(rows) > 0 {
+				number = rows[len(rows)-1].number + 1
+			}
+		}
+
+		var cells []string
+		empty := true
+		for _, c := range row.children("c") {
+			column, ok := xlsxColumnIndex(c.attr("r"))
+			if !ok {
+				column = len(cells)
+			}
+			value := strings.TrimSpace(w.value(c))
+			if value == "" {
+				continue
+			}
+			for len(cells) <= column {
+				cells = append(cells, "")
+			}
+			cells[column] = value
+			empty = false
+		}
+		if !empty {
+			rows = append(rows, xlsxRow{number: number, cells: cells})
+		}
+	}
+	return rows
+}
+
+// value returns the value of a cell as text
+func (w *xlsxWorkbook) value(c *xmlElement) string {
+	v := c.child("v")
+	switch c.attr("t") {
+	case "s":
+		if i, err := strconv.Atoi(strings.TrimSpace(v.textOrEmpty())); err == nil && i >= 0 && i < len(w.sharedStrings) {
+			return w.sharedStrings[i]
+		}
+		return ""
+	case "inlineStr":
+		return xlsxText(c.child("is"))
+	case "b":
+		if strings.TrimSpace(v.textOrEmpty()) == "1" {
+			return "TRUE"
+		}
+		return "FALSE"
+	case "str", "e", "d":
+		return v.textOrEmpty()
+	}
+
+	raw := strings.TrimSpace(v.textOrEmpty())
+	number, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return raw
+	}
+	format := xlsxNumber
+	if style, err := strconv.Atoi(c.attr("s")); err == nil && style >= 0 && style < len(w.cellFormats) {
+		format = w.cellFormats[style]
+	}
+	if format == xlsxNumber {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+
+	// Dates are numbers of days since the epoch of the workbook
+	epoch := time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+	if w.date1904 {
+		epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+	} else if number < 60 {
+		// Excel counts February 29, 1900, which did not exist
+		epoch = epoch.AddDate(0, 0, 1)
+	}
+	days := math.Floor(number)
+	seconds := math.Round((number - days) * 86400)
+	t := epoch.AddDate(0, 0, int(days)).Add(time.Duration(seconds) * time.Second)
+	switch format {
+	case xlsxDate:
+		return t.Format(time.DateOnly)
+	case xlsxTime:
+		return t.Format(time.TimeOnly)
+	default:
+		return t.Format(time.DateTime)
+	}
+}
+
+// xlsxText returns the text of a rich text string, without its phonetic guides
+func xlsxText(si *xmlElement) string {
+	if si == nil {
+		return ""
+	}
+	if t := si.child("t"); t != nil {
+		return t.Text
+	}
+	var text strings.Builder
+	for _, r := range si.children("r") {
+		text.WriteString(r.child("t").textOrEmpty())
+	}
+	return text.String()
+}
+
+// xlsxColumnIndex returns the index of the column of a cell reference such as "B3"
+func xlsxColumnIndex(ref string) (int, bool) {
+	index := 0
+	letters := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		index = index*26 + int(r-'A'+1)
+		letters++
+	}
+	if letters == 0 || letters > 3 {
+		return 0, false
+	}
+	return index - 1, true
+}
+
+// xlsxColumnName returns the letters of the column of the index, such as "AA" for 26
+func xlsxColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
@@ -0,0 +1,288 @@
+package agentruntime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/habiliai/agentruntime/audit"
+	"github.com/habiliai/agentruntime/engine"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/knowledge"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pkg/errors"
+)
+
+type (
+	// MCPServerOptions selects what an agent exposes when it is served as an MCP server
+	MCPServerOptions struct {
+		// ExportNativeTools re-exports the tools of the agent's native skills as MCP tools
+		ExportNativeTools bool
+		// ExportKnowledge exposes the agent's knowledge as MCP resources and adds a knowledge_search tool
+		ExportKnowledge bool
+	}
+
+	mcpChatMessage struct {
+		User string `json:"user"`
+		Text string `json:"text"`
+	}
+)
+
+const (
+	MCPChatToolName            = "chat"
+	MCPKnowledgeSearchToolName = "knowledge_search"
+	mcpChatDefaultUser         = "USER"
+)
+
+// mcpSessionCallData keeps the tool calls of every MCP session, so that read_tool_result pages the results condensed
+// by the earlier calls of the same session
+type mcpSessionCallData struct {
+	mtx    sync.Mutex
+	stores map[string]*tool.CallDataStore
+}
+
+// withStore returns ctx recording tool calls to the store of its session. Transports without sessions share one store
+func (c *mcpSessionCallData) withStore(ctx context.Context) context.Context {
+	var sessionID string
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		sessionID = session.SessionID()
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	store, ok := c.stores[sessionID]
+	if !ok {
+		store = &tool.CallDataStore{}
+		c.stores[sessionID] = store
+	}
+	return tool.WithCallDataStore(ctx, store)
+}
+
+func (c *mcpSessionCallData) remove(_ context.Context, session server.ClientSession) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.stores, session.SessionID())
+}
+
+// NewMCPServer creates an MCP server exposing the agent's Run as the chat tool
+func (r *AgentRuntime) NewMCPServer(ctx context.Context, opts MCPServerOptions) (*server.MCPServer, error) {
+	callData := &mcpSessionCallData{stores: make(map[string]*tool.CallDataStore)}
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(callData.remove)
+
+	s := server.NewMCPServer(
+		r.agent.Name,
+		Version,
+		server.WithToolCapabilities(false),
+		server.WithResourceCapabilities(false, false),
+		server.WithInstructions(r.agent.Description),
+		server.WithHooks(hooks),
+	)
+
+	r.addMCPChatTool(s)
+	toolNames := map[string]bool{MCPChatToolName: true}
+
+	if opts.ExportNativeTools {
+		var readToolResult ai.Tool
+		for _, skill := range r.agent.Skills {
+			if skill.Type != entity.AgentSkillTypeNative {
+				continue
+			}
+			tools, err := r.toolManager.GetToolsBySkill(ctx, skill)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get tools of skill %s", skill.OfNative.Name)
+			}
+			for _, t := range tools {
+				// read_tool_result is exported once after the tools whose results it pages
+				if t.Name() == tool.ReadToolResultToolName {
+					readToolResult = t
+					continue
+				}
+				if err := r.addMCPExportedTool(s, t, callData, toolNames); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if readToolResult != nil {
+			if err := r.addMCPExportedTool(s, readToolResult, callData, toolNames); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if opts.ExportKnowledge {
+		if err := r.addMCPKnowledge(ctx, s, !toolNames[MCPKnowledgeSearchToolName]); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// addMCPExportedTool exports t as an MCP tool, unless a tool of the same name is already exported
+func (r *AgentRuntime) addMCPExportedTool(s *server.MCPServer, t ai.Tool, callData *mcpSessionCallData, toolNames map[string]bool) error {
+	definition := t.Definition()
+	if toolNames[definition.Name] {
+		return nil
+	}
+	schema, err := json.Marshal(definition.InputSchema)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal input schema of tool %s", definition.Name)
+	}
+	s.AddTool(mcp.NewToolWithRawSchema(definition.Name, definition.Description, schema), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx = audit.WithRunInfo(callData.withStore(ctx), audit.RunInfo{Agent: r.agent.Name})
+		out, err := t.RunRaw(ctx, req.GetArguments())
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return newMCPToolResultJSON(out)
+	})
+	toolNames[definition.Name] = true
+	return nil
+}
+
+func (r *AgentRuntime) addMCPChatTool(s *server.MCPServer) {
+	chatTool := mcp.NewTool(
+		MCPChatToolName,
+		mcp.WithDescription(fmt.Sprintf("Chat with %s. %s", r.agent.Name, r.agent.Description)),
+		mcp.WithString("message", mcp.Required(), mcp.Description("Message to send to the agent")),
+		mcp.WithString("user", mcp.Description("Name of the user sending the message, defaults to USER")),
+		mcp.WithArray("history", mcp.Description("Previous messages of the conversation, oldest first"), mcp.Items(map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"user": map[string]any{"type": "string", "description": "Name of the user or agent who sent the message"},
+				"text": map[string]any{"type": "string", "description": "Text of the message"},
+			},
+			"required": []string{"user", "text"},
+		})),
+		mcp.WithString("instruction", mcp.Description("Instruction of the conversation thread")),
+	)
+
+	s.AddTool(chatTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		message, err := req.RequireString("message")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		user := req.GetString("user", mcpChatDefaultUser)
+
+		var history []mcpChatMessage
+		if raw, ok := req.GetArguments()["history"]; ok {
+			data, err := json.Marshal(raw)
+			if err == nil {
+				err = json.Unmarshal(data, &history)
+			}
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("invalid history: %v", err)), nil
+			}
+		}
+
+		runReq := engine.RunRequest{
+			ThreadInstruction: req.GetString("instruction", ""),
+			Participant: []engine.Participant{
+				{Name: user},
+				{Name: r.agent.Name, Role: r.agent.Role, Description: r.agent.Description},
+			},
+		}
+		for _, m := range history {
+			runReq.History = append(runReq.History, engine.Conversation{User: m.User, Text: m.Text})
+		}
+		runReq.History = append(runReq.History, engine.Conversation{User: user, Text: message})
+
+		resp, err := r.Run(ctx, runReq, nil)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("failed to run agent: %v", err)), nil
+		}
+		return mcp.NewToolResultText(resp.Text()), nil
+	})
+}
+
+// addMCPKnowledge exposes the text documents of the agent's knowledge as resources
+func (r *AgentRuntime) addMCPKnowledge(ctx context.Context, s *server.MCPServer, withSearchTool bool) error {
+	knowledgeId := fmt.Sprintf("%s-knowledge", r.agent.Name)
+
+	if withSearchTool {
+		searchTool := mcp.NewTool(
+			MCPKnowledgeSearchToolName,
+			mcp.WithDescription(fmt.Sprintf("Search the knowledge base of %s", r.agent.Name)),
+			mcp.WithString("query", mcp.Required(), mcp.Description("The search query to find relevant information")),
+			mcp.WithNumber("limit", mcp.Description("The maximum number of results to return, defaults to 5")),
+			mcp.WithObject("filter", mcp.Description(`Optional filter on the metadata of the documents, e.g. {"field": "source_type", "eq": "pdf"}, {"field": "page_number", "gte": 3, "lte": 10}, or {"and": [...]} and {"or": [...]} combining filters`)),
+		)
+		s.AddTool(searchTool, func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			query, err := req.RequireString("query")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			var opts []knowledge.RetrieveOption
+			if filter, ok := req.GetArguments()["filter"]; ok && filter != nil {
+				data, err := json.Marshal(filter)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				parsed, err := knowledge.ParseFilter(data)
+				if err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				opts = append(opts, knowledge.WithFilter(parsed))
+			}
+			results, err := r.knowledgeService.RetrieveRelevantKnowledge(ctx, query, req.GetInt("limit", 5), []string{knowledgeId}, opts...)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			output := make([]tool.Knowledge, 0, len(results))
+			for _, res := range results {
+				if res.Content.Text == "" {
+					continue
+				}
+				output = append(output, tool.Knowledge{ID: res.ID, Score: float64(res.Score), Context: res.Content.Text})
+			}
+			return newMCPToolResultJSON(map[string]any{"output": output})
+		})
+	}
+
+	if len(r.agent.Knowledge) == 0 {
+		return nil
+	}
+	knowledge, err := r.knowledgeService.GetKnowledge(ctx, knowledgeId)
+	if err != nil {
+		r.logger.Warn("failed to get knowledge of agent, serving without knowledge resources", "agent", r.agent.Name, "error", err)
+		return nil
+	} else if knowledge == nil {
+		return nil
+	}
+
+	for _, doc := range knowledge.Documents {
+		if doc.Content.Text == "" {
+			continue
+		}
+		uri := fmt.Sprintf("knowledge://%s/%s", knowledgeId, doc.ID)
+		mimeType := doc.Content.MIMEType
+		if mimeType == "" {
+			mimeType = "text/plain"
+		}
+		text := doc.Content.Text
+		s.AddResource(
+			mcp.NewResource(uri, doc.ID, mcp.WithMIMEType(mimeType)),
+			func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+				return []mcp.ResourceContents{
+					mcp.TextResourceContents{URI: uri, MIMEType: mimeType, Text: text},
+				}, nil
+			},
+		)
+	}
+
+	return nil
+}
+
+func newMCPToolResultJSON(out any) (*mcp.CallToolResult, error) {
+	data, err := json.Marshal(out)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal tool result")
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
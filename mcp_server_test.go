@@ -0,0 +1,141 @@
+package agentruntime_test
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime"
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/httpclient"
+	"github.com/habiliai/agentruntime/tool"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentRuntimeMCPServer(t *testing.T) {
+	ctx := context.Background()
+
+	runtime, err := agentruntime.NewAgentRuntime(ctx, agentruntime.WithAgent(entity.Agent{
+		Name:        "Tester",
+		Description: "A test agent",
+		ModelName:   "openai/gpt-5-mini",
+		Skills: []entity.AgentSkillUnion{
+			{Type: entity.AgentSkillTypeNative, OfNative: &entity.NativeAgentSkill{Name: "get_weather"}},
+		},
+	}))
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	s, err := runtime.NewMCPServer(ctx, agentruntime.MCPServerOptions{
+		ExportNativeTools: true,
+		ExportKnowledge:   true,
+	})
+	require.NoError(t, err)
+
+	client, err := mcpclient.NewInProcessClient(s)
+	require.NoError(t, err)
+	defer client.Close()
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initResult, err := client.Initialize(ctx, initRequest)
+	require.NoError(t, err)
+	require.Equal(t, "Tester", initResult.ServerInfo.Name)
+
+	tools, err := client.ListTools(ctx, mcp.ListToolsRequest{})
+	require.NoError(t, err)
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	require.Contains(t, names, agentruntime.MCPChatToolName)
+	require.Contains(t, names, "get_weather")
+	require.Contains(t, names, agentruntime.MCPKnowledgeSearchToolName)
+
+	callRequest := mcp.CallToolRequest{}
+	callRequest.Params.Name = agentruntime.MCPChatToolName
+	callRequest.Params.Arguments = map[string]any{}
+	result, err := client.CallTool(ctx, callRequest)
+	require.NoError(t, err)
+	require.True(t, result.IsError)
+}
+
+func TestAgentRuntimeMCPServer_PagesCondensedResults(t *testing.T) {
+	ctx := context.Background()
+
+	client, err := httpclient.New(&config.HTTPConfig{
+		CassetteFile: "tool/testdata/get_weather.cassette.json",
+		CassetteMode: config.CassetteModeReplay,
+	})
+	require.NoError(t, err)
+
+	runtime, err := agentruntime.NewAgentRuntime(
+		ctx,
+		agentruntime.WithAgent(entity.Agent{
+			Name:      "Tester",
+			ModelName: "openai/gpt-5-mini",
+			Skills: []entity.AgentSkillUnion{
+				{Type: entity.AgentSkillTypeNative, OfNative: &entity.NativeAgentSkill{
+					Name: "get_weather",
+					Env:  map[string]any{"OPENWEATHER_API_KEY": "test-api-key"},
+				}},
+			},
+		}),
+		agentruntime.WithToolConfig(&config.ToolConfig{MaxResultSize: 64}),
+		agentruntime.WithHTTPClient(client),
+	)
+	require.NoError(t, err)
+	defer runtime.Close()
+
+	s, err := runtime.NewMCPServer(ctx, agentruntime.MCPServerOptions{ExportNativeTools: true})
+	require.NoError(t, err)
+
+	mcpClient, err := mcpclient.NewInProcessClient(s)
+	require.NoError(t, err)
+	defer mcpClient.Close()
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	_, err = mcpClient.Initialize(ctx, initRequest)
+	require.NoError(t, err)
+
+	call := func(name string, arguments map[string]any) map[string]any {
+		req := mcp.CallToolRequest{}
+		req.Params.Name = name
+		req.Params.Arguments = arguments
+		result, err := mcpClient.CallTool(ctx, req)
+		require.NoError(t, err)
+		require.False(t, result.IsError)
+		require.Len(t, result.Content, 1)
+
+		var out map[string]any
+		require.NoError(t, json.Unmarshal([]byte(result.Content[0].(mcp.TextContent).Text), &out))
+		return out
+	}
+
+	// The oversized result is condensed, and its call ID is known to read_tool_result in later calls
+	condensed := call("get_weather", map[string]any{"location": "Seoul", "date": "2023-10-01"})
+	require.Contains(t, condensed["notice"], tool.ReadToolResultToolName)
+	callID, _ := condensed["call_id"].(string)
+	require.NotEmpty(t, callID)
+
+	var content strings.Builder
+	offset := 0.0
+	for {
+		page := call(tool.ReadToolResultToolName, map[string]any{"call_id": callID, "offset": offset})
+		require.Empty(t, page["error"])
+		content.WriteString(page["content"].(string))
+		if hasMore, _ := page["has_more"].(bool); !hasMore {
+			break
+		}
+		offset = page["next_offset"].(float64)
+	}
+
+	var weather tool.GetWeatherResponse
+	require.NoError(t, json.Unmarshal([]byte(content.String()), &weather))
+	require.Equal(t, 24.8, weather.Temperature.Max)
+}
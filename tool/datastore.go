@@ -2,14 +2,19 @@ package tool
 
 import (
 	"context"
+	"fmt"
 	"sync"
 )
 
 type (
 	CallData struct {
+		ID        string `json:"id"`
 		Name      string `json:"name"`
 		Arguments any    `json:"request"`
 		Result    any    `json:"result"`
+
+		// pageSize is the size of the pages read_tool_result reads the result in, set by the manager of the tool
+		pageSize int
 	}
 	CallDataStore struct {
 		callData []CallData
@@ -23,10 +28,18 @@ var (
 )
 
 func WithEmptyCallDataStore(ctx context.Context) context.Context {
-	return context.WithValue(ctx, callDataStoreContextKey, &CallDataStore{})
+	return WithCallDataStore(ctx, &CallDataStore{})
+}
+
+// WithCallDataStore records the tool calls made with ctx to store, so that calls made with different contexts
+// sharing the store can read each other's results
+func WithCallDataStore(ctx context.Context, store *CallDataStore) context.Context {
+	return context.WithValue(ctx, callDataStoreContextKey, store)
 }
 
-func appendCallData(ctx context.Context, callData CallData) {
+// appendCallData records a tool call and returns the ID assigned to it.
+// It returns an empty ID when ctx carries no call data store.
+func appendCallData(ctx context.Context, callData CallData) string {
 	lockCallDataStoreContext.Lock()
 	defer lockCallDataStoreContext.Unlock()
 
@@ -37,10 +50,13 @@ func appendCallData(ctx context.Context, callData CallData) {
 		}
 	}
 	if store == nil {
-		return
+		return ""
 	}
 
+	callData.ID = fmt.Sprintf("call_%d", len(store.callData)+1)
 	store.callData = append(store.callData, callData)
+
+	return callData.ID
 }
 
 func GetCallData(ctx context.Context) []CallData {
@@ -51,3 +67,16 @@ func GetCallData(ctx context.Context) []CallData {
 
 	return store.callData
 }
+
+func getCallDataById(ctx context.Context, id string) (CallData, bool) {
+	lockCallDataStoreContext.Lock()
+	defer lockCallDataStoreContext.Unlock()
+
+	for _, callData := range GetCallData(ctx) {
+		if callData.ID == id {
+			return callData, true
+		}
+	}
+
+	return CallData{}, false
+}
@@ -55,7 +55,7 @@ type (
 )
 
 // getCoordinates converts city name to latitude/longitude coordinates
-func getCoordinates(apiKey string, city string) (float64, float64, error) {
+func getCoordinates(ctx context.Context, client *http.Client, apiKey string, city string) (float64, float64, error) {
 	baseURL := "http://api.openweathermap.org/geo/1.0/direct"
 	params := url.Values{}
 	params.Set("q", city)
@@ -64,7 +64,11 @@ func getCoordinates(apiKey string, city string) (float64, float64, error) {
 
 	reqURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
 
-	resp, err := http.Get(reqURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -87,7 +91,7 @@ func getCoordinates(apiKey string, city string) (float64, float64, error) {
 }
 
 // getWeatherSummary calls `/onecall/day_summary` API to get weather summary for a specific date
-func getWeatherSummary(apiKey string, date string, latitude, longitude float64, unit, lang string) (*GetWeatherResponse, error) {
+func getWeatherSummary(ctx context.Context, client *http.Client, apiKey string, date string, latitude, longitude float64, unit, lang string) (*GetWeatherResponse, error) {
 	baseURL := "https://api.openweathermap.org/data/3.0/onecall/day_summary"
 	params := url.Values{}
 	params.Set("lat", fmt.Sprintf("%f", latitude))
@@ -99,7 +103,11 @@ func getWeatherSummary(apiKey string, date string, latitude, longitude float64,
 
 	reqURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
 
-	resp, err := http.Get(reqURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -128,12 +136,12 @@ func (m *manager) GetWeather(ctx context.Context, req *GetWeatherRequest, apiKey
 	}
 	m.logger.Debug("get_weather", "location", req.Location, "date", req.Date)
 
-	latitude, longitude, err := getCoordinates(apiKey, req.Location)
+	latitude, longitude, err := getCoordinates(ctx, m.httpClient, apiKey, req.Location)
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to convert coordinates")
 	}
 
-	weatherSummary, err := getWeatherSummary(apiKey, req.Date, latitude, longitude, "metric", "en")
+	weatherSummary, err := getWeatherSummary(ctx, m.httpClient, apiKey, req.Date, latitude, longitude, "metric", "en")
 	if err != nil {
 		return nil, errors.Wrapf(err, "error occurred while fetching weather information")
 	}
@@ -0,0 +1,56 @@
+package tool_test
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/internal/httpclient"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/mitchellh/mapstructure"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetWeatherReplay(t *testing.T) {
+	ctx := tool.WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	client, err := httpclient.New(&config.HTTPConfig{
+		CassetteFile: "testdata/get_weather.cassette.json",
+		CassetteMode: config.CassetteModeReplay,
+	})
+	require.NoError(t, err)
+
+	toolManager, err := tool.NewToolManager(ctx, []entity.AgentSkillUnion{
+		{
+			Type: entity.AgentSkillTypeNative,
+			OfNative: &entity.NativeAgentSkill{
+				Name: "get_weather",
+				Env:  map[string]any{"OPENWEATHER_API_KEY": "test-api-key"},
+			},
+		},
+	}, slog.Default(), g, nil, nil, nil, tool.WithHTTPClient(client))
+	require.NoError(t, err)
+	defer toolManager.Close()
+
+	res, err := toolManager.GetTool("get_weather").RunRaw(ctx, map[string]any{
+		"location": "Seoul",
+		"date":     "2023-10-01",
+	})
+	require.NoError(t, err)
+
+	var weatherSummary tool.GetWeatherResponse
+	require.NoError(t, mapstructure.Decode(res, &weatherSummary))
+	require.Equal(t, 24.8, weatherSummary.Temperature.Max)
+	require.Equal(t, 4.1, weatherSummary.Wind.Max.Speed)
+
+	// Requests that were not recorded fail instead of reaching the network
+	_, err = toolManager.GetTool("get_weather").RunRaw(ctx, map[string]any{
+		"location": "Busan",
+		"date":     "2023-10-01",
+	})
+	require.ErrorContains(t, err, "no recorded interaction")
+}
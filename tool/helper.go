@@ -1,33 +1,110 @@
 package tool
 
 import (
+	"context"
+	"reflect"
+
 	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core"
 	"github.com/firebase/genkit/go/genkit"
 	"github.com/habiliai/agentruntime/entity"
+	"github.com/pkg/errors"
 )
 
-func registerLocalTool[In any, Out any](m *manager, name, description string, skill *entity.NativeAgentSkill, fn func(ctx *Context, input In) (Out, error)) ai.Tool {
+// localToolSettings are the result limit and policies a local tool is registered with. Tools are registered once,
+// so every skill using a tool must have the same settings
+type localToolSettings struct {
+	limit    resultLimit
+	policies []entity.AgentSkillToolPolicy
+}
+
+func registerLocalTool[In any, Out any](m *manager, name, description string, skill *entity.NativeAgentSkill, fn func(ctx *Context, input In) (Out, error)) (ai.Tool, error) {
+	settings := localToolSettings{limit: m.newResultLimit(0, "")}
+	var policies []toolPolicy
+	if skill != nil {
+		settings.limit = m.newResultLimit(skill.MaxResultSize, skill.ResultSummaryModel)
+
+		compiled, err := compileToolPolicies(skill.Policies)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid policies of skill %s", skill.Name)
+		}
+		policies = toolPoliciesFor(compiled, name)
+		for _, policy := range skill.Policies {
+			if policy.Tool == "" || policy.Tool == name {
+				settings.policies = append(settings.policies, policy)
+			}
+		}
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
 	if existingTool := genkit.LookupTool(m.genkit, name); existingTool != nil {
-		return existingTool
+		if registered, ok := m.localToolSettings[name]; ok && !reflect.DeepEqual(registered, settings) {
+			return nil, errors.Errorf("tool %s is already registered by another skill with a different result limit or policies", name)
+		}
+		return existingTool, nil
 	}
 
-	return genkit.DefineTool(
-		m.genkit,
+	var out Out
+	tool, err := m.registerGuardedTool(ai.NewTool(
 		name,
 		description,
-		func(ctx *ai.ToolContext, input In) (Out, error) {
-			out, err := fn(&Context{
+		limitToolResult(m, name, settings.limit, func(ctx *ai.ToolContext, input In) (Out, error) {
+			return fn(&Context{
 				Context: ctx,
 				skill:   skill,
 			}, input)
-			if err == nil {
-				appendCallData(ctx, CallData{
-					Name:      name,
-					Arguments: input,
-					Result:    out,
-				})
-			}
+		}),
+	), "", policies, limitedOutputSchema(out, settings.limit))
+	if err != nil {
+		return nil, err
+	}
+	m.localToolSettings[name] = settings
+	return tool, nil
+}
+
+// withToolContext adapts fn, which only needs a context.Context, to a tool function
+func withToolContext[In any, Out any](fn func(ctx context.Context, input In) (Out, error)) func(ctx *Context, input In) (Out, error) {
+	return func(ctx *Context, input In) (Out, error) {
+		return fn(ctx, input)
+	}
+}
+
+// limitedOutputSchema returns the output schema of tools returning out through limitToolResult.
+// Results are declared as any to be condensed, but the tools keep the output schema of their results.
+func limitedOutputSchema(out any, limit resultLimit) map[string]any {
+	outputSchema := core.InferSchemaMap(out)
+	if limit.enabled() && outputSchema != nil {
+		outputSchema = map[string]any{"anyOf": []any{outputSchema, core.InferSchemaMap(LimitedToolResult{})}}
+	}
+	return outputSchema
+}
+
+// limitToolResult records every call of fn in the call data and condenses results exceeding limit.
+// The output is declared as any so that over-limit results can be replaced by a LimitedToolResult.
+func limitToolResult[In any, Out any](m *manager, name string, limit resultLimit, fn ai.ToolFunc[In, Out]) ai.ToolFunc[In, any] {
+	return func(ctx *ai.ToolContext, input In) (any, error) {
+		out, err := fn(ctx, input)
+		if err != nil {
 			return out, err
-		},
-	)
+		}
+
+		callID := appendCallData(ctx, CallData{
+			Name:      name,
+			Arguments: input,
+			Result:    out,
+			pageSize:  m.resultPageSize(),
+		})
+
+		condensed, err := m.condenseToolResult(ctx, limit, callID, name, input, out)
+		if err != nil {
+			return nil, err
+		}
+		if condensed != nil {
+			return condensed, nil
+		}
+
+		return out, nil
+	}
 }
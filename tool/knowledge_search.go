@@ -1,10 +1,13 @@
 package tool
 
 import (
+	"encoding/json"
 	"fmt"
+	"slices"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/knowledge"
 )
 
 type Knowledge struct {
@@ -19,6 +22,16 @@ func (m *manager) registerKnowledgeSearchTool(skill *entity.NativeAgentSkill) er
 	if !ok {
 		allowedKnowledgeIds = nil
 	}
+	// The indexed resources of the agent's MCP skills stay searchable when the knowledge is restricted
+	if allowedKnowledgeIds != nil {
+		allowedKnowledgeIds = append(slices.Clone(allowedKnowledgeIds), m.mcpResourcesKnowledgeIDs...)
+	}
+
+	// The search mode of the knowledge configuration can be overridden per agent
+	var retrieveOptions []knowledge.RetrieveOption
+	if searchMode, ok := skill.Env["search_mode"].(string); ok && searchMode != "" {
+		retrieveOptions = append(retrieveOptions, knowledge.WithSearchMode(searchMode))
+	}
 
 	return registerNativeTool(
 		m,
@@ -55,11 +68,18 @@ Error handling:
 - When an error occurs, try rephrasing the query or waiting before retry
 - The tool will still return a response (not throw an error) to allow graceful handling
 
-The search uses semantic similarity, so exact keyword matches are not required. Results are ranked by relevance and include context about when and where the information was stored.`,
+The search uses semantic similarity, so exact keyword matches are not required. Results are ranked by relevance and include context about when and where the information was stored.
+
+Filtering:
+- Use the optional filter to only search documents whose metadata matches, such as source_type, source_filename or page_number
+- A condition is {"field": name} with one of "eq": value, "in": [values], "gt"/"gte"/"lt"/"lte": bound, or "exists": true
+- Conditions combine with {"and": [filters]} and {"or": [filters]}
+- Example: {"and": [{"field": "source_type", "eq": "pdf"}, {"field": "page_number", "lte": 10}]}`,
 		skill,
 		func(ctx *Context, input struct {
-			Query string `json:"query" jsonschema:"description=The search query to find relevant information"`
-			Limit *int   `json:"limit,omitempty" jsonschema:"description=The maximum number of results to return,default=5"`
+			Query  string         `json:"query" jsonschema:"description=The search query to find relevant information"`
+			Limit  *int           `json:"limit,omitempty" jsonschema:"description=The maximum number of results to return,default=5"`
+			Filter map[string]any `json:"filter,omitempty" jsonschema:"description=Optional filter on the metadata of the documents"`
 		}) (reply struct {
 			Output []Knowledge `json:"output,omitempty" jsonschema:"description=List of search results with relevant knowledge"`
 			Error  string      `json:"error,omitempty" jsonschema:"description=Error message if the search fails"`
@@ -70,8 +90,22 @@ The search uses semantic similarity, so exact keyword matches are not required.
 				limit = *input.Limit
 			}
 
+			opts := retrieveOptions
+			if len(input.Filter) > 0 {
+				data, err := json.Marshal(input.Filter)
+				if err != nil {
+					return reply, err
+				}
+				filter, err := knowledge.ParseFilter(data)
+				if err != nil {
+					reply.Error = err.Error()
+					return reply, nil
+				}
+				opts = append(slices.Clone(opts), knowledge.WithFilter(filter))
+			}
+
 			// Retrieve relevant knowledge
-			results, err := m.knowledgeService.RetrieveRelevantKnowledge(ctx, input.Query, limit, allowedKnowledgeIds)
+			results, err := m.knowledgeService.RetrieveRelevantKnowledge(ctx, input.Query, limit, allowedKnowledgeIds, opts...)
 			if err != nil {
 				reply.Error = err.Error()
 				return reply, nil
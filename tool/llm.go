@@ -3,10 +3,14 @@ package tool
 import (
 	"context"
 	"slices"
+	"strings"
 
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
 	"github.com/gosimple/slug"
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
 )
 
 type (
@@ -14,10 +18,18 @@ type (
 	LLMToolResponse struct {
 		Instruction string `json:"additional_important_instruction" jsonschema:"description=Additional important instruction to the LLM"`
 	}
+
+	LLMGenerateToolRequest struct {
+		Input string `json:"input" jsonschema:"required,description=Input the instruction of the tool is applied to"`
+	}
+	LLMGenerateToolResponse struct {
+		Output any    `json:"output" jsonschema:"description=Result of the generation, text or JSON matching the output schema of the tool"`
+		Model  string `json:"model" jsonschema:"description=Model that generated the result"`
+	}
 )
 
-func (m *manager) registerLLMTool(_ context.Context, name, description, instruction string) {
-	registerLocalTool(
+func (m *manager) registerLLMTool(_ context.Context, name, description, instruction string) error {
+	_, err := registerLocalTool(
 		m,
 		name,
 		description,
@@ -33,6 +45,53 @@ func (m *manager) registerLLMTool(_ context.Context, name, description, instruct
 			return
 		},
 	)
+	return err
+}
+
+// registerLLMGenerateTool registers a tool running a generation of its own over the tool input
+func (m *manager) registerLLMGenerateTool(_ context.Context, name string, skill *entity.LLMAgentSkill) error {
+	_, err := registerLocalTool(
+		m,
+		name,
+		skill.Description,
+		nil,
+		func(ctx *Context, req LLMGenerateToolRequest) (res LLMGenerateToolResponse, err error) {
+			actionOpts := &ai.GenerateActionOptions{
+				Model: skill.Model,
+				Messages: []*ai.Message{
+					ai.NewSystemTextMessage(skill.Instruction),
+					ai.NewUserTextMessage(req.Input),
+				},
+				Config: skill.ModelConfig,
+			}
+			if len(skill.OutputSchema) > 0 {
+				actionOpts.Output = &ai.GenerateActionOutputConfig{
+					Format:      ai.OutputFormatJSON,
+					JsonSchema:  skill.OutputSchema,
+					Constrained: true,
+				}
+			}
+
+			resp, err := genkit.GenerateWithRequest(ctx, m.genkit, actionOpts, nil, nil)
+			if err != nil {
+				return res, errors.Wrapf(err, "failed to generate result of %s", name)
+			}
+
+			res.Model = skill.Model
+			if len(skill.OutputSchema) == 0 {
+				res.Output = strings.TrimSpace(resp.Text())
+				return res, nil
+			}
+
+			var output any
+			if err := resp.Output(&output); err != nil {
+				return res, errors.Wrapf(err, "failed to parse result of %s", name)
+			}
+			res.Output = output
+			return res, nil
+		},
+	)
+	return err
 }
 
 func (m *manager) registerLLMSkill(ctx context.Context, skill *entity.LLMAgentSkill) error {
@@ -49,7 +108,26 @@ func (m *manager) registerLLMSkill(ctx context.Context, skill *entity.LLMAgentSk
 	if !CanBeUsedAsToolName(toolName) {
 		return errors.New("llm tool name is not valid. only accept by [a-zA-Z0-9_-]{1,128}")
 	}
-	m.registerLLMTool(ctx, toolName, skill.Description, skill.Instruction)
+	switch skill.Mode {
+	case "", entity.LLMSkillModeInstruction:
+		if err := m.registerLLMTool(ctx, toolName, skill.Description, skill.Instruction); err != nil {
+			return err
+		}
+	case entity.LLMSkillModeGenerate:
+		if skill.Model == "" {
+			return errors.Errorf("model of llm skill %s is required in generate mode", skill.Name)
+		}
+		if len(skill.OutputSchema) > 0 {
+			if _, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(skill.OutputSchema)); err != nil {
+				return errors.Wrapf(err, "invalid output schema of llm skill %s", skill.Name)
+			}
+		}
+		if err := m.registerLLMGenerateTool(ctx, toolName, skill); err != nil {
+			return err
+		}
+	default:
+		return errors.Errorf("unknown mode %s of llm skill %s", skill.Mode, skill.Name)
+	}
 
 	if _, ok := m.skillToolNames[skill.Name]; ok {
 		if slices.Contains(m.skillToolNames[skill.Name], toolName) {
@@ -0,0 +1,95 @@
+package tool_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/firebase/genkit/go/ai"
+	fgenkit "github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLLMGenerateSkill(t *testing.T) {
+	ctx := tool.WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	var requests []*ai.ModelRequest
+	fgenkit.DefineModel(g, "test/classifier", &ai.ModelOptions{
+		Supports: &ai.ModelSupports{Multiturn: true, SystemRole: true},
+	}, func(ctx context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+		requests = append(requests, req)
+		text := "positive"
+		if req.Output != nil && req.Output.Format == ai.OutputFormatJSON {
+			text = "```json\n{\"label\": \"positive\", \"score\": 0.9}\n```"
+		}
+		return &ai.ModelResponse{
+			Request:      req,
+			Message:      ai.NewModelTextMessage(text),
+			FinishReason: ai.FinishReasonStop,
+		}, nil
+	})
+
+	toolManager, err := tool.NewToolManager(ctx, []entity.AgentSkillUnion{
+		{
+			Type: entity.AgentSkillTypeLLM,
+			OfLLM: &entity.LLMAgentSkill{
+				Name:        "sentiment",
+				Description: "Classify the sentiment of a text",
+				Instruction: "Answer with the sentiment of the text: positive, negative or neutral.",
+				Mode:        entity.LLMSkillModeGenerate,
+				Model:       "test/classifier",
+			},
+		},
+		{
+			Type: entity.AgentSkillTypeLLM,
+			OfLLM: &entity.LLMAgentSkill{
+				Name:        "sentiment_json",
+				Description: "Classify the sentiment of a text with a score",
+				Instruction: "Classify the sentiment of the text.",
+				Mode:        entity.LLMSkillModeGenerate,
+				Model:       "test/classifier",
+				OutputSchema: map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"label": map[string]any{"type": "string"},
+						"score": map[string]any{"type": "number"},
+					},
+					"required": []any{"label", "score"},
+				},
+			},
+		},
+	}, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+
+	out, err := toolManager.GetTool("sentiment").RunRaw(ctx, map[string]any{"input": "I love it"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"output": "positive", "model": "test/classifier"}, out)
+
+	require.Len(t, requests, 1)
+	require.Equal(t, ai.RoleSystem, requests[0].Messages[0].Role)
+	require.True(t, strings.HasPrefix(requests[0].Messages[0].Text(), "Answer with the sentiment"))
+	require.Equal(t, "I love it", requests[0].Messages[1].Text())
+
+	out, err = toolManager.GetTool("sentiment_json").RunRaw(ctx, map[string]any{"input": "I love it"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{"label": "positive", "score": 0.9}, out.(map[string]any)["output"])
+
+	_, err = tool.NewToolManager(ctx, []entity.AgentSkillUnion{
+		{
+			Type: entity.AgentSkillTypeLLM,
+			OfLLM: &entity.LLMAgentSkill{
+				Name:        "no_model",
+				Description: "Missing model",
+				Instruction: "Do something.",
+				Mode:        entity.LLMSkillModeGenerate,
+			},
+		},
+	}, slog.Default(), g, nil, nil, nil)
+	require.ErrorContains(t, err, "model of llm skill no_model is required")
+}
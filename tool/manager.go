@@ -3,15 +3,20 @@ package tool
 import (
 	"context"
 	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
 	"sync"
 
 	"github.com/firebase/genkit/go/ai"
 	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/audit"
+	"github.com/habiliai/agentruntime/config"
 	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/httpclient"
 	"github.com/habiliai/agentruntime/internal/mylog"
 	"github.com/habiliai/agentruntime/knowledge"
 	"github.com/habiliai/agentruntime/memory"
-	mcpclient "github.com/mark3labs/mcp-go/client"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +25,7 @@ type (
 		GetTool(toolName string) ai.Tool
 		GetMCPTool(serverName, toolName string) ai.Tool
 		GetMCPTools(ctx context.Context, serverName string) []ai.Tool
+		GetMCPServerStatuses() []MCPServerStatus
 		GetToolsBySkill(ctx context.Context, skill entity.AgentSkillUnion) ([]ai.Tool, error)
 		GetUsagePrompt(skill entity.AgentSkillUnion) string
 		Close()
@@ -27,11 +33,23 @@ type (
 	manager struct {
 		logger *mylog.Logger
 
-		mcpClients     map[string]*mcpclient.Client
-		mtx            sync.Mutex
-		genkit         *genkit.Genkit
-		skillToolNames map[string][]string // skill.Name -> tool names
-		usagePrompts   map[string]string
+		mcpConnections      map[string]*mcpConnection
+		mcpToolNames        map[string]map[string]string // server name -> MCP tool name -> registered tool name
+		mcpToolActions      map[string]*mcpToolAction    // registered tool name -> MCP tool and its action
+		mcpExtraToolNames   map[string]map[string]string // server name -> read_resource or prompt_<name> -> registered tool name
+		mcpResourceIndexers map[string]*mcpResourceIndexer
+		// mcpResourcesKnowledgeIDs are the knowledge IDs the skills indexing MCP resources index them under
+		mcpResourcesKnowledgeIDs []string
+		mtx                      sync.Mutex
+		genkit                   *genkit.Genkit
+		skillToolNames           map[string][]string // skill.Name -> tool names
+		localToolSettings        map[string]localToolSettings
+		usagePrompts             map[string]string
+		toolConfig               *config.ToolConfig
+		samplingApprover         MCPSamplingApprover
+		tokenStorage             *FileTokenStorage
+		httpClient               *http.Client
+		auditor                  *audit.Auditor
 
 		knowledgeService knowledge.Service
 		memoryService    memory.Service
@@ -46,15 +64,65 @@ var (
 	_ Manager = (*manager)(nil)
 )
 
-func NewToolManager(ctx context.Context, skills []entity.AgentSkillUnion, logger *slog.Logger, genkit *genkit.Genkit, knowledgeService knowledge.Service, memoryService memory.Service) (Manager, error) {
+// WithHTTPClient sets the HTTP client the native tools send their requests with
+func WithHTTPClient(client *http.Client) ManagerOption {
+	return func(m *manager) {
+		m.httpClient = client
+	}
+}
+
+// WithAuditor records the calls of the tools to an audit log
+func WithAuditor(auditor *audit.Auditor) ManagerOption {
+	return func(m *manager) {
+		m.auditor = auditor
+	}
+}
+
+func NewToolManager(ctx context.Context, skills []entity.AgentSkillUnion, logger *slog.Logger, genkit *genkit.Genkit, knowledgeService knowledge.Service, memoryService memory.Service, toolConfig *config.ToolConfig, opts ...ManagerOption) (Manager, error) {
+	if toolConfig == nil {
+		toolConfig = config.NewToolConfig()
+	}
+
 	s := &manager{
-		logger:           logger,
-		mcpClients:       make(map[string]*mcpclient.Client),
-		genkit:           genkit,
-		knowledgeService: knowledgeService,
-		memoryService:    memoryService,
-		skillToolNames:   make(map[string][]string),
-		usagePrompts:     make(map[string]string),
+		logger:              logger,
+		mcpConnections:      make(map[string]*mcpConnection),
+		mcpToolNames:        make(map[string]map[string]string),
+		mcpToolActions:      make(map[string]*mcpToolAction),
+		mcpExtraToolNames:   make(map[string]map[string]string),
+		mcpResourceIndexers: make(map[string]*mcpResourceIndexer),
+		genkit:              genkit,
+		knowledgeService:    knowledgeService,
+		memoryService:       memoryService,
+		skillToolNames:      make(map[string][]string),
+		localToolSettings:   make(map[string]localToolSettings),
+		usagePrompts:        make(map[string]string),
+		toolConfig:          toolConfig,
+	}
+
+	if toolConfig.MCPTokenDir != "" {
+		s.tokenStorage = NewFileTokenStorage(toolConfig.MCPTokenDir, toolConfig.MCPTokenKey)
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if s.httpClient == nil {
+		var err error
+		if s.httpClient, err = httpclient.New(config.NewHTTPConfig()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.registerReadToolResultTool(); err != nil {
+		return nil, errors.Wrapf(err, "failed to register %s tool", ReadToolResultToolName)
+	}
+
+	// Collected before the skills are registered, since knowledge_search may come before the MCP skills
+	for _, skill := range skills {
+		if skill.Type == entity.AgentSkillTypeMCP && skill.OfMCP != nil && skill.OfMCP.IndexResources {
+			s.mcpResourcesKnowledgeIDs = append(s.mcpResourcesKnowledgeIDs, MCPResourcesKnowledgeID(skill.OfMCP.Name))
+		}
 	}
 
 	for _, skill := range skills {
@@ -79,12 +147,35 @@ func NewToolManager(ctx context.Context, skills []entity.AgentSkillUnion, logger
 	return s, nil
 }
 
+// GetMCPTool returns the tool of an MCP server by its MCP tool name or by the name it is registered under
 func (m *manager) GetMCPTool(serverName, toolName string) ai.Tool {
-	if _, ok := m.mcpClients[serverName]; !ok {
+	// Tools are registered when the server is connected on first use
+	if err := m.connectMCPServer(context.Background(), serverName); err != nil {
+		m.logger.Warn("failed to connect mcp server", "serverName", serverName, "err", err)
 		return nil
 	}
 
-	return genkit.LookupTool(m.genkit, toolName)
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	toolNames, ok := m.mcpToolNames[serverName]
+	if !ok {
+		return nil
+	}
+
+	registeredName, ok := toolNames[toolName]
+	if !ok {
+		registeredName, ok = m.mcpExtraToolNames[serverName][toolName]
+	}
+	if !ok {
+		if !slices.Contains(slices.Collect(maps.Values(toolNames)), toolName) &&
+			!slices.Contains(slices.Collect(maps.Values(m.mcpExtraToolNames[serverName])), toolName) {
+			return nil
+		}
+		registeredName = toolName
+	}
+
+	return genkit.LookupTool(m.genkit, registeredName)
 }
 
 func (m *manager) GetUsagePrompt(skill entity.AgentSkillUnion) string {
@@ -106,14 +197,32 @@ func (m *manager) GetUsagePrompt(skill entity.AgentSkillUnion) string {
 }
 
 func (m *manager) Close() {
-	for _, client := range m.mcpClients {
-		if err := client.Close(); err != nil {
-			return
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	for _, conn := range m.mcpConnections {
+		if err := conn.Close(); err != nil {
+			m.logger.Warn("failed to close mcp server", "serverName", conn.serverID, "err", err)
 		}
 	}
 }
 
 func (m *manager) GetToolsBySkill(ctx context.Context, skill entity.AgentSkillUnion) ([]ai.Tool, error) {
+	tools, err := m.getToolsBySkill(ctx, skill)
+	if err != nil {
+		return nil, err
+	}
+
+	// Offer paging through condensed results whenever the skill's results can be condensed, unless the skill has
+	// no tools, like an unhealthy MCP server
+	if len(tools) > 0 && m.resultLimitBySkill(skill).enabled() {
+		tools = append(tools, m.GetTool(ReadToolResultToolName))
+	}
+
+	return tools, nil
+}
+
+func (m *manager) getToolsBySkill(ctx context.Context, skill entity.AgentSkillUnion) ([]ai.Tool, error) {
 	switch skill.Type {
 	case "llm", "nativeTool":
 		skillName := func() string {
@@ -137,15 +246,26 @@ func (m *manager) GetToolsBySkill(ctx context.Context, skill entity.AgentSkillUn
 		}
 		return tools, nil
 	case "mcp":
+		// Tools of an unhealthy server are hidden until its circuit breaker lets calls through again
+		if _, ok := m.getMCPConnection(skill.OfMCP.Name); ok && !m.isMCPServerAvailable(skill.OfMCP.Name) {
+			m.logger.WarnContext(ctx, "mcp server is unhealthy, skipping its tools", "serverName", skill.OfMCP.Name)
+			return nil, nil
+		}
+
 		skillToolNames := skill.OfMCP.Tools
 		if len(skillToolNames) == 0 {
 			return m.GetMCPTools(ctx, skill.OfMCP.Name), nil
 		}
+		// Servers that cannot be connected are skipped like unhealthy ones, see GetMCPServerStatuses for the reason
+		if err := m.connectMCPServer(ctx, skill.OfMCP.Name); err != nil {
+			m.logger.WarnContext(ctx, "failed to connect mcp server, skipping its tools", "serverName", skill.OfMCP.Name, "err", err)
+			return nil, nil
+		}
 		tools := make([]ai.Tool, 0, len(skillToolNames))
 		for _, skillToolName := range skillToolNames {
 			tool := m.GetMCPTool(skill.OfMCP.Name, skillToolName)
 			if tool == nil {
-				return nil, errors.Errorf("invalid tool name %s", skill.OfMCP.Name)
+				return nil, errors.Errorf("invalid tool name %s for mcp server %s", skillToolName, skill.OfMCP.Name)
 			}
 			tools = append(tools, tool)
 		}
@@ -1,10 +1,10 @@
 package tool
 
 import (
-	"bufio"
 	"context"
-	"fmt"
-	"io"
+	"maps"
+	"reflect"
+	"slices"
 	"strings"
 
 	"github.com/firebase/genkit/go/ai"
@@ -28,114 +28,281 @@ type RegisterMCPToolRequest struct {
 	// ServerConfig contains the full server configuration
 	// If provided, it takes precedence over the legacy fields
 	ServerConfig *MCPServerConfig
+
+	// ToolAliases maps MCP tool names to the names they are exposed under.
+	// Tools without an alias are exposed as <ServerID>__<tool name>
+	ToolAliases map[string]string
+
+	// MaxResultSize and ResultSummaryModel override the global tool result limits for this server
+	MaxResultSize      int
+	ResultSummaryModel string
+
+	// IndexResources indexes the resources of the server into the knowledge base
+	IndexResources bool
+
+	// Policies restrict the arguments the tools of the server are called with
+	Policies []entity.AgentSkillToolPolicy
+	policies []toolPolicy
 }
 
-func (m *manager) registerMCPTool(ctx context.Context, req RegisterMCPToolRequest) (err error) {
-	m.mtx.Lock()
-	defer m.mtx.Unlock()
+// registerMCPTool adds the MCP server to the manager.
+// The server is connected lazily on first use, which registers its tools, resources and prompts.
+func (m *manager) registerMCPTool(ctx context.Context, req RegisterMCPToolRequest) error {
+	// Create configuration from request
+	var config MCPServerConfig
+	if req.ServerConfig != nil {
+		// Use new server config if provided
+		config = *req.ServerConfig
+	} else {
+		// Build from legacy fields for backward compatibility
+		config = MCPServerConfig{
+			Command: req.Command,
+			Args:    req.Args,
+			Env:     req.Env,
+		}
+	}
 
-	// Use existing client if already registered
-	mcpClient, ok := m.mcpClients[req.ServerID]
-	if !ok {
-		// Create configuration from request
-		var config MCPServerConfig
-		if req.ServerConfig != nil {
-			// Use new server config if provided
-			config = *req.ServerConfig
+	factory := NewMCPClientFactory().WithTokenStorage(m.tokenStorage)
+	if config.Sampling != nil {
+		if config.SupportsSampling() {
+			factory.WithSamplingHandler(m.newMCPSamplingHandler(req.ServerID, *config.Sampling))
 		} else {
-			// Build from legacy fields for backward compatibility
-			config = MCPServerConfig{
-				Command: req.Command,
-				Args:    req.Args,
-				Env:     req.Env,
-			}
+			m.logger.WarnContext(ctx, "sampling is only supported for stdio mcp servers, ignoring it", "serverName", req.ServerID, "transport", config.GetTransport())
 		}
+	}
 
-		// Create client using factory
-		factory := NewMCPClientFactory()
-		c, err := factory.CreateClient(ctx, req.ServerID, config)
-		if err != nil {
-			return fmt.Errorf("failed to create MCP client: %w", err)
-		}
-
-		// Handle stderr for stdio clients
-		if config.GetTransport() == MCPTransportStdio {
-			// Try to get stderr from the client if it's a stdio client
-			stderr, ok := mcpclient.GetStderr(c)
-			if ok {
-				go func(stderr io.Reader) {
-					rd := bufio.NewReader(stderr)
-					for {
-						line, err := rd.ReadString('\n')
-						if err != nil {
-							if err == io.EOF || strings.Contains(err.Error(), "already closed") {
-								return
-							}
-							m.logger.Error("failed to copy stderr", "err", err, "serverName", req.ServerID)
-							return
-						}
-						m.logger.Warn("[MCP] "+strings.TrimSpace(line), "serverName", req.ServerID)
-					}
-				}(stderr)
-			}
-		}
+	policies, err := compileToolPolicies(req.Policies)
+	if err != nil {
+		return errors.Wrapf(err, "invalid policies of mcp server %s", req.ServerID)
+	}
+	req.policies = policies
+
+	m.addMCPServer(ctx, req, config, func(ctx context.Context) (*mcpclient.Client, error) {
+		return factory.CreateClient(ctx, req.ServerID, config)
+	})
+
+	return nil
+}
+
+func (m *manager) addMCPServer(ctx context.Context, req RegisterMCPToolRequest, config MCPServerConfig, newClient func(ctx context.Context) (*mcpclient.Client, error)) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if _, ok := m.mcpConnections[req.ServerID]; ok {
+		m.logger.InfoContext(ctx, "mcp server already registered", "serverName", req.ServerID)
+		return
+	}
 
-		initRequest := mcp.InitializeRequest{}
-		initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
-		initRequest.Params.ClientInfo = mcp.Implementation{
-			Name:    "agentruntime",
-			Version: "0.1.0",
+	conn := newMCPConnection(ctx, req.ServerID, config, newClient, m.logger)
+	conn.onConnect = func(ctx context.Context) error {
+		if err := m.registerMCPServerTools(ctx, req, conn); err != nil {
+			return err
 		}
-		if err := c.Start(ctx); err != nil {
-			return errors.Wrapf(err, "failed to start MCP client %s", req.ServerID)
+		if req.IndexResources {
+			// Indexing reads every resource, so it must not hold up the call that connected the server
+			go m.indexMCPServerResources(req, conn)
 		}
-		if _, err := c.Initialize(ctx, initRequest); err != nil {
-			return errors.Wrapf(err, "failed to initialize MCP client %s", req.ServerID)
+		return nil
+	}
+
+	// Pick up tools and prompts the server adds or changes at runtime
+	conn.OnNotification(func(notification mcp.JSONRPCNotification) {
+		switch notification.Method {
+		case mcp.MethodNotificationToolsListChanged, mcp.MethodNotificationPromptsListChanged:
+			go func() {
+				if err := m.registerMCPServerTools(conn.ctx, req, conn); err != nil {
+					m.logger.Error("failed to refresh tools of mcp server", "err", err, "serverName", req.ServerID)
+				}
+			}()
 		}
+	})
+
+	m.mcpConnections[req.ServerID] = conn
+}
 
-		m.mcpClients[req.ServerID] = c
-		mcpClient = c
+func (m *manager) getMCPConnection(serverName string) (*mcpConnection, bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	conn, ok := m.mcpConnections[serverName]
+	return conn, ok
+}
+
+// connectMCPServer connects the server if it is not connected yet
+func (m *manager) connectMCPServer(ctx context.Context, serverName string) error {
+	conn, ok := m.getMCPConnection(serverName)
+	if !ok {
+		return errors.Errorf("mcp server %s is not registered", serverName)
 	}
 
-	listToolsResult, err := mcpClient.ListTools(ctx, mcp.ListToolsRequest{})
+	_, err := conn.Client(ctx)
+	return err
+}
+
+// registerMCPServerTools registers the tools, resources and prompts the server currently offers.
+// Tools that are already registered are kept as they are.
+func (m *manager) registerMCPServerTools(ctx context.Context, req RegisterMCPToolRequest, conn *mcpConnection) error {
+	// A fresh connection is healthy, even if the circuit opened while the server was down
+	conn.breaker.RecordSuccess()
+
+	client := m.newResilientMCPClient(req.ServerID, conn, conn.config, conn.breaker, true)
+	listToolsResult, err := client.ListTools(ctx, mcp.ListToolsRequest{})
 	if err != nil {
 		return errors.Wrapf(err, "failed to list tools")
 	}
-	for _, tool := range listToolsResult.Tools {
-		if genkit.LookupTool(m.genkit, tool.Name) != nil {
-			m.logger.InfoContext(ctx, "tool already registered", "tool", tool.Name)
+	conn.setToolCount(len(listToolsResult.Tools))
+
+	capabilities := conn.GetServerCapabilities()
+	var resources []MCPResourceInfo
+	if capabilities.Resources != nil {
+		if resources, err = listMCPResources(ctx, client); err != nil {
+			return err
+		}
+	}
+	var prompts []mcp.Prompt
+	if capabilities.Prompts != nil {
+		listPromptsResult, err := client.ListPrompts(ctx, mcp.ListPromptsRequest{})
+		if err != nil {
+			return errors.Wrapf(err, "failed to list prompts")
+		}
+		prompts = listPromptsResult.Prompts
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	limit := m.newResultLimit(req.MaxResultSize, req.ResultSummaryModel)
+	if err := m.defineMCPTools(req, conn, listToolsResult.Tools, limit); err != nil {
+		return err
+	}
+	if capabilities.Resources != nil {
+		if err := m.defineReadResourceTool(req, client, resources, limit); err != nil {
+			return errors.Wrapf(err, "failed to register resources of mcp server %s", req.ServerID)
+		}
+	}
+	if err := m.defineMCPPromptTools(req, client, prompts, limit); err != nil {
+		return errors.Wrapf(err, "failed to register prompts of mcp server %s", req.ServerID)
+	}
+
+	return nil
+}
+
+// mcpToolAction is the action a tool of an MCP server is registered with and the definition it was created from
+type mcpToolAction struct {
+	tool   mcp.Tool
+	action *guardedAction
+}
+
+func (m *manager) defineMCPTools(req RegisterMCPToolRequest, conn *mcpConnection, tools []mcp.Tool, limit resultLimit) error {
+	toolNames, ok := m.mcpToolNames[req.ServerID]
+	if !ok {
+		toolNames = make(map[string]string)
+		m.mcpToolNames[req.ServerID] = toolNames
+	}
+
+	// Tools the server no longer offers stay defined, GetMCPTools only returns the ones currently listed
+	for _, tool := range tools {
+		toolName := NamespacedMCPToolName(req.ServerID, tool.Name)
+		if alias, ok := req.ToolAliases[tool.Name]; ok {
+			if !CanBeUsedAsToolName(alias) {
+				return errors.Errorf("invalid alias %q for tool %s. only accept by [a-zA-Z0-9_-]{1,128}", alias, tool.Name)
+			}
+			toolName = alias
+		}
+
+		// A tool whose definition changed is replaced behind the action it is registered with
+		registered, defined := m.mcpToolActions[toolName]
+		defined = defined && toolNames[tool.Name] == toolName
+		if defined && reflect.DeepEqual(registered.tool, tool) {
 			continue
 		}
-		if _, err := internalmcp.DefineTool(m.genkit, mcpClient, tool, func(ctx *ai.ToolContext, in any, out *mcp.CallToolResult) error {
-			appendCallData(ctx, CallData{
-				Name:      tool.Name,
+		if !defined && genkit.LookupTool(m.genkit, toolName) != nil {
+			return errors.Errorf("tool name %s of mcp server %s conflicts with an already registered tool", toolName, req.ServerID)
+		}
+
+		client := m.newResilientMCPClient(req.ServerID, conn, conn.config, conn.breaker, isRetryableMCPTool(tool))
+		mcpTool, err := internalmcp.NewTool(client, toolName, tool, func(ctx *ai.ToolContext, in any, out *mcp.CallToolResult) error {
+			// Keep a copy of the full result since out is condensed in place below
+			full := *out
+			callID := appendCallData(ctx, CallData{
+				Name:      toolName,
 				Arguments: in,
-				Result:    out,
+				Result:    &full,
+				pageSize:  m.resultPageSize(),
 			})
+
+			condensed, err := m.condenseToolResult(ctx, limit, callID, toolName, in, &full)
+			if err != nil {
+				return err
+			}
+			if condensed != nil {
+				out.Content = []mcp.Content{
+					mcp.NewTextContent(condensed.Notice + "\n\n" + condensed.Content),
+				}
+			}
 			return nil
-		}); err != nil {
+		})
+		if err != nil {
 			return errors.Wrapf(err, "failed to define tool")
 		}
+		if defined {
+			if err := registered.action.replace(mcpTool); err != nil {
+				return errors.Wrapf(err, "failed to redefine tool")
+			}
+			registered.tool = tool
+		} else {
+			// Policies name the tools of MCP skills by their original name
+			action, err := m.defineGuardedAction(mcpTool, req.ServerID, toolPoliciesFor(req.policies, tool.Name), nil)
+			if err != nil {
+				return errors.Wrapf(err, "failed to define tool")
+			}
+			m.mcpToolActions[toolName] = &mcpToolAction{tool: tool, action: action}
+		}
+		toolNames[tool.Name] = toolName
 	}
 
 	return nil
 }
 
 func (m *manager) GetMCPTools(ctx context.Context, mcpServerName string) []ai.Tool {
-	client, ok := m.mcpClients[mcpServerName]
+	conn, ok := m.getMCPConnection(mcpServerName)
 	if !ok {
 		return nil
 	}
 
+	if !m.isMCPServerAvailable(mcpServerName) {
+		m.logger.WarnContext(ctx, "mcp server is unhealthy, skipping its tools", "serverName", mcpServerName)
+		return nil
+	}
+
+	// Listing the tools connects the server on first use
+	client := m.newResilientMCPClient(mcpServerName, conn, conn.config, conn.breaker, false)
 	listToolsResult, err := client.ListTools(ctx, mcp.ListToolsRequest{})
 	if err != nil {
-		m.logger.Error("failed to list tools", "err", err)
+		m.logger.Error("failed to list tools", "err", err, "serverName", mcpServerName)
 		return nil
 	}
+	conn.setToolCount(len(listToolsResult.Tools))
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	toolNames := m.mcpToolNames[mcpServerName]
 
 	var tools []ai.Tool
 	for _, tool := range listToolsResult.Tools {
-		if t := genkit.LookupTool(m.genkit, tool.Name); t != nil {
+		toolName, ok := toolNames[tool.Name]
+		if !ok {
+			continue
+		}
+		if t := genkit.LookupTool(m.genkit, toolName); t != nil {
+			tools = append(tools, t)
+		}
+	}
+
+	// Resources and prompts are exposed through extra tools next to the tools of the server
+	for _, localName := range slices.Sorted(maps.Keys(m.mcpExtraToolNames[mcpServerName])) {
+		if t := genkit.LookupTool(m.genkit, m.mcpExtraToolNames[mcpServerName][localName]); t != nil {
 			tools = append(tools, t)
 		}
 	}
@@ -143,6 +310,21 @@ func (m *manager) GetMCPTools(ctx context.Context, mcpServerName string) []ai.To
 	return tools
 }
 
+// GetMCPServerStatuses reports the connection state of every registered MCP server, sorted by name
+func (m *manager) GetMCPServerStatuses() []MCPServerStatus {
+	m.mtx.Lock()
+	conns := slices.SortedFunc(maps.Values(m.mcpConnections), func(a, b *mcpConnection) int {
+		return strings.Compare(a.serverID, b.serverID)
+	})
+	m.mtx.Unlock()
+
+	statuses := make([]MCPServerStatus, 0, len(conns))
+	for _, conn := range conns {
+		statuses = append(statuses, conn.Status())
+	}
+	return statuses
+}
+
 func (m *manager) registerMCPSkill(ctx context.Context, skill *entity.MCPAgentSkill) error {
 	if skill.Name == "" {
 		return errors.New("mcp server name is required")
@@ -161,8 +343,13 @@ func (m *manager) registerMCPSkill(ctx context.Context, skill *entity.MCPAgentSk
 	}
 
 	if err := m.registerMCPTool(ctx, RegisterMCPToolRequest{
-		ServerID:     skill.Name,
-		ServerConfig: serverConfig,
+		ServerID:           skill.Name,
+		ServerConfig:       serverConfig,
+		ToolAliases:        skill.ToolAliases,
+		MaxResultSize:      skill.MaxResultSize,
+		ResultSummaryModel: skill.ResultSummaryModel,
+		IndexResources:     skill.IndexResources,
+		Policies:           skill.Policies,
 	}); err != nil {
 		return errors.Wrapf(err, "failed to register mcp tool")
 	}
@@ -14,7 +14,9 @@ import (
 
 // MCPClientFactory creates MCP clients based on the server configuration
 type MCPClientFactory struct {
-	httpClient *http.Client
+	httpClient      *http.Client
+	samplingHandler MCPSamplingHandler
+	tokenStorage    *FileTokenStorage
 }
 
 // NewMCPClientFactory creates a new MCP client factory
@@ -26,12 +28,28 @@ func NewMCPClientFactory() *MCPClientFactory {
 	}
 }
 
+// WithSamplingHandler sets the handler answering sampling requests of servers with sampling enabled
+func (f *MCPClientFactory) WithSamplingHandler(handler MCPSamplingHandler) *MCPClientFactory {
+	f.samplingHandler = handler
+	return f
+}
+
+// WithTokenStorage sets the storage persisting the tokens of oauth-sse servers.
+// Without a storage, tokens are kept in memory only.
+func (f *MCPClientFactory) WithTokenStorage(storage *FileTokenStorage) *MCPClientFactory {
+	f.tokenStorage = storage
+	return f
+}
+
 // CreateClient creates an MCP client based on the server configuration
 func (f *MCPClientFactory) CreateClient(ctx context.Context, serverID string, config MCPServerConfig) (*mcpclient.Client, error) {
 	transportType := config.GetTransport()
 
 	switch transportType {
 	case MCPTransportStdio:
+		if config.Sampling != nil && f.samplingHandler != nil {
+			return f.createSamplingStdioClient(ctx, serverID, config)
+		}
 		return f.createStdioClient(config)
 
 	case MCPTransportSSE:
@@ -98,6 +116,18 @@ func (f *MCPClientFactory) createOAuthSSEClient(config MCPServerConfig) (*mcpcli
 		PKCEEnabled:           config.OAuthConfig.PKCEEnabled,
 		TokenStore:            transport.NewMemoryTokenStore(),
 	}
+	if f.tokenStorage != nil {
+		oauthConfig.TokenStore = f.tokenStorage.TokenStore(config.URL, config.OAuthConfig.ClientID)
+
+		// Use the client registered by `agentruntime mcp auth` when the skill configures none
+		if oauthConfig.ClientID == "" {
+			clientID, clientSecret, err := f.tokenStorage.RegisteredClient(config.URL, "")
+			if err != nil {
+				return nil, err
+			}
+			oauthConfig.ClientID, oauthConfig.ClientSecret = clientID, clientSecret
+		}
+	}
 
 	opts := []transport.ClientOption{
 		transport.WithHTTPClient(f.httpClient),
@@ -131,11 +161,36 @@ func ConvertAgentSkillToMCPServerConfig(skill entity.AgentSkillUnion) (*MCPServe
 
 	mcpSkill := skill.OfMCP
 	config := &MCPServerConfig{
-		Command: mcpSkill.Command,
-		Args:    mcpSkill.Args,
-		Env:     mcpSkill.Env,
-		URL:     mcpSkill.URL,
-		Headers: mcpSkill.Headers,
+		Command:    mcpSkill.Command,
+		Args:       mcpSkill.Args,
+		Env:        mcpSkill.Env,
+		URL:        mcpSkill.URL,
+		Headers:    mcpSkill.Headers,
+		MaxRetries: mcpSkill.MaxRetries,
+
+		CircuitBreakerThreshold: mcpSkill.CircuitBreakerThreshold,
+	}
+
+	if mcpSkill.Timeout != "" {
+		timeout, err := time.ParseDuration(mcpSkill.Timeout)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timeout for MCP skill %s", mcpSkill.Name)
+		}
+		config.Timeout = timeout
+	}
+	if mcpSkill.RetryBackoff != "" {
+		backoff, err := time.ParseDuration(mcpSkill.RetryBackoff)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid retry backoff for MCP skill %s", mcpSkill.Name)
+		}
+		config.RetryBackoff = backoff
+	}
+	if mcpSkill.CircuitBreakerCooldown != "" {
+		cooldown, err := time.ParseDuration(mcpSkill.CircuitBreakerCooldown)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid circuit breaker cooldown for MCP skill %s", mcpSkill.Name)
+		}
+		config.CircuitBreakerCooldown = cooldown
 	}
 
 	// Set transport type
@@ -155,5 +210,17 @@ func ConvertAgentSkillToMCPServerConfig(skill entity.AgentSkillUnion) (*MCPServe
 		}
 	}
 
+	// Convert sampling config if present
+	if mcpSkill.Sampling != nil {
+		if len(mcpSkill.Sampling.Models) == 0 {
+			return nil, errors.Errorf("sampling of MCP skill %s requires at least one model", mcpSkill.Name)
+		}
+		config.Sampling = &MCPSamplingConfig{
+			Models:         mcpSkill.Sampling.Models,
+			MaxTokens:      mcpSkill.Sampling.MaxTokens,
+			MaxTotalTokens: mcpSkill.Sampling.MaxTotalTokens,
+		}
+	}
+
 	return config, nil
 }
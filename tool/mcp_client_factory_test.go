@@ -2,6 +2,7 @@ package tool_test
 
 import (
 	"context"
+	"time"
 
 	"github.com/habiliai/agentruntime/entity"
 	"github.com/habiliai/agentruntime/tool"
@@ -206,6 +207,29 @@ func (s *TestSuite) TestConvertAgentSkillToMCPServerConfig() {
 				},
 			},
 		},
+		{
+			name: "resilience settings",
+			skill: entity.AgentSkillUnion{
+				Type: "mcp",
+				OfMCP: &entity.MCPAgentSkill{
+					Name:                    "flaky-tools",
+					URL:                     "https://api.example.com/mcp",
+					Timeout:                 "30s",
+					MaxRetries:              2,
+					RetryBackoff:            "1s",
+					CircuitBreakerThreshold: 3,
+					CircuitBreakerCooldown:  "1m",
+				},
+			},
+			expectedConfig: tool.MCPServerConfig{
+				URL:                     "https://api.example.com/mcp",
+				Timeout:                 30 * time.Second,
+				MaxRetries:              2,
+				RetryBackoff:            time.Second,
+				CircuitBreakerThreshold: 3,
+				CircuitBreakerCooldown:  time.Minute,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -222,6 +246,11 @@ func (s *TestSuite) TestConvertAgentSkillToMCPServerConfig() {
 			s.Equal(tt.expectedConfig.Headers, config.Headers)
 			s.Equal(tt.expectedConfig.Args, config.Args)
 			s.Equal(tt.expectedConfig.Env, config.Env)
+			s.Equal(tt.expectedConfig.Timeout, config.Timeout)
+			s.Equal(tt.expectedConfig.MaxRetries, config.MaxRetries)
+			s.Equal(tt.expectedConfig.RetryBackoff, config.RetryBackoff)
+			s.Equal(tt.expectedConfig.CircuitBreakerThreshold, config.CircuitBreakerThreshold)
+			s.Equal(tt.expectedConfig.CircuitBreakerCooldown, config.CircuitBreakerCooldown)
 
 			if tt.expectedConfig.OAuthConfig != nil {
 				s.NotNil(config.OAuthConfig)
@@ -0,0 +1,381 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/habiliai/agentruntime/internal/mylog"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+)
+
+type (
+	MCPServerState string
+
+	// MCPServerStatus reports the connection state of an MCP server
+	MCPServerStatus struct {
+		Name        string           `json:"name"`
+		Transport   MCPTransportType `json:"transport"`
+		State       MCPServerState   `json:"state"`
+		LastError   string           `json:"lastError,omitempty"`
+		ToolCount   int              `json:"toolCount"`
+		Restarts    int              `json:"restarts"`
+		ConnectedAt *time.Time       `json:"connectedAt,omitempty"`
+	}
+
+	// mcpConnection owns the client of an MCP server.
+	// It connects lazily on first use and reconnects with backoff when the connection is lost.
+	mcpConnection struct {
+		serverID  string
+		config    MCPServerConfig
+		newClient func(ctx context.Context) (*mcpclient.Client, error)
+		// onConnect runs after every successful (re)connection, e.g. to register the tools of the server
+		onConnect func(ctx context.Context) error
+		// breaker is shared by all the requests to the server
+		breaker *circuitBreaker
+		logger  *mylog.Logger
+
+		// ctx outlives the requests that trigger connecting, since transports tie their lifetime to it
+		ctx    context.Context
+		cancel context.CancelFunc
+
+		connectMtx sync.Mutex
+		mtx        sync.Mutex
+
+		client      *mcpclient.Client
+		state       MCPServerState
+		lastError   error
+		failures    int
+		retryAt     time.Time
+		connectedAt time.Time
+		restarts    int
+		toolCount   int
+		handlers    []func(mcp.JSONRPCNotification)
+	}
+)
+
+const (
+	// MCPServerStateIdle means the server has not been used yet
+	MCPServerStateIdle MCPServerState = "idle"
+	// MCPServerStateConnected means the server is connected and initialized
+	MCPServerStateConnected MCPServerState = "connected"
+	// MCPServerStateReconnecting means the connection was lost and is being restored in the background
+	MCPServerStateReconnecting MCPServerState = "reconnecting"
+	// MCPServerStateFailed means connecting failed. It is retried on next use once the backoff has passed
+	MCPServerStateFailed MCPServerState = "failed"
+	// MCPServerStateClosed means the tool manager was closed
+	MCPServerStateClosed MCPServerState = "closed"
+
+	mcpPingTimeout = 10 * time.Second
+)
+
+func newMCPConnection(ctx context.Context, serverID string, config MCPServerConfig, newClient func(ctx context.Context) (*mcpclient.Client, error), logger *mylog.Logger) *mcpConnection {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &mcpConnection{
+		serverID:  serverID,
+		config:    config,
+		newClient: newClient,
+		breaker:   newCircuitBreaker(config.GetCircuitBreakerThreshold(), config.GetCircuitBreakerCooldown()),
+		logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		state:     MCPServerStateIdle,
+	}
+}
+
+// Client returns the connected client, connecting first if the server has not been used yet
+// or the backoff after a failed attempt has passed
+func (c *mcpConnection) Client(ctx context.Context) (mcpclient.MCPClient, error) {
+	c.mtx.Lock()
+	switch {
+	case c.state == MCPServerStateConnected:
+		client := c.client
+		c.mtx.Unlock()
+		return client, nil
+	case c.state == MCPServerStateClosed:
+		c.mtx.Unlock()
+		return nil, errors.Errorf("mcp server %s is closed", c.serverID)
+	case c.state == MCPServerStateReconnecting:
+		err := c.lastError
+		c.mtx.Unlock()
+		return nil, errors.Wrapf(err, "mcp server %s is reconnecting", c.serverID)
+	case c.state == MCPServerStateFailed && time.Now().Before(c.retryAt):
+		err, wait := c.lastError, time.Until(c.retryAt).Round(time.Second)
+		c.mtx.Unlock()
+		return nil, errors.Wrapf(err, "mcp server %s is not connected, retrying in %s", c.serverID, wait)
+	}
+	c.mtx.Unlock()
+
+	if err := c.connect(ctx); err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.client == nil {
+		return nil, errors.Errorf("mcp server %s is not connected", c.serverID)
+	}
+	return c.client, nil
+}
+
+// OnNotification registers a handler for notifications of the server that survives reconnections
+func (c *mcpConnection) OnNotification(handler func(notification mcp.JSONRPCNotification)) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.handlers = append(c.handlers, handler)
+}
+
+func (c *mcpConnection) dispatch(notification mcp.JSONRPCNotification) {
+	c.mtx.Lock()
+	handlers := c.handlers
+	c.mtx.Unlock()
+
+	for _, handler := range handlers {
+		handler(notification)
+	}
+}
+
+// GetServerCapabilities returns the capabilities of the connected server
+func (c *mcpConnection) GetServerCapabilities() mcp.ServerCapabilities {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.client == nil {
+		return mcp.ServerCapabilities{}
+	}
+	return c.client.GetServerCapabilities()
+}
+
+func (c *mcpConnection) setToolCount(n int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.toolCount = n
+}
+
+// ReportError checks in the background whether a failed request means that the connection was lost,
+// in which case the server is restarted or reconnected
+func (c *mcpConnection) ReportError(err error) {
+	if !isMCPConnectionError(err) {
+		return
+	}
+
+	c.mtx.Lock()
+	client, state := c.client, c.state
+	c.mtx.Unlock()
+	if state != MCPServerStateConnected || client == nil {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(c.ctx, mcpPingTimeout)
+		defer cancel()
+		if pingErr := client.Ping(ctx); pingErr == nil {
+			return
+		}
+		c.lost(client, err)
+	}()
+}
+
+// isMCPConnectionError reports whether err may be caused by a broken connection rather than by the server rejecting the request
+func isMCPConnectionError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || strings.Contains(err.Error(), "transport error")
+}
+
+func (c *mcpConnection) lost(client *mcpclient.Client, err error) {
+	c.mtx.Lock()
+	if c.client != client || c.state != MCPServerStateConnected {
+		c.mtx.Unlock()
+		return
+	}
+	c.client = nil
+	c.state = MCPServerStateReconnecting
+	c.lastError = err
+	c.mtx.Unlock()
+
+	c.logger.Warn("lost connection to mcp server, reconnecting", "serverName", c.serverID, "err", err)
+	if err := client.Close(); err != nil {
+		c.logger.Debug("failed to close mcp client", "serverName", c.serverID, "err", err)
+	}
+
+	go c.reconnect()
+}
+
+func (c *mcpConnection) reconnect() {
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(c.config.GetReconnectBackoff(attempt)):
+		}
+
+		if err := c.connect(c.ctx); err != nil {
+			c.logger.Warn("failed to reconnect mcp server", "serverName", c.serverID, "attempt", attempt, "err", err)
+			continue
+		}
+
+		c.logger.Info("reconnected mcp server", "serverName", c.serverID, "attempt", attempt)
+		return
+	}
+}
+
+func (c *mcpConnection) connect(ctx context.Context) error {
+	c.connectMtx.Lock()
+	defer c.connectMtx.Unlock()
+
+	c.mtx.Lock()
+	switch c.state {
+	case MCPServerStateConnected:
+		c.mtx.Unlock()
+		return nil
+	case MCPServerStateClosed:
+		c.mtx.Unlock()
+		return errors.Errorf("mcp server %s is closed", c.serverID)
+	}
+	c.mtx.Unlock()
+
+	client, err := c.dial(ctx)
+	if err != nil {
+		c.fail(err)
+		return err
+	}
+
+	c.mtx.Lock()
+	if c.state == MCPServerStateClosed {
+		c.mtx.Unlock()
+		_ = client.Close()
+		return errors.Errorf("mcp server %s is closed", c.serverID)
+	}
+	if !c.connectedAt.IsZero() {
+		c.restarts++
+	}
+	c.client = client
+	c.state = MCPServerStateConnected
+	c.lastError = nil
+	c.failures = 0
+	c.connectedAt = time.Now()
+	c.mtx.Unlock()
+
+	if c.onConnect != nil {
+		if err := c.onConnect(ctx); err != nil {
+			c.fail(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fail records a failed connection attempt and closes the client if it was connected
+func (c *mcpConnection) fail(err error) {
+	c.mtx.Lock()
+	client := c.client
+	c.client = nil
+	c.lastError = err
+	c.failures++
+	c.retryAt = time.Now().Add(c.config.GetReconnectBackoff(c.failures))
+	if c.state != MCPServerStateReconnecting && c.state != MCPServerStateClosed {
+		c.state = MCPServerStateFailed
+	}
+	c.mtx.Unlock()
+
+	if client != nil {
+		_ = client.Close()
+	}
+}
+
+func (c *mcpConnection) dial(ctx context.Context) (*mcpclient.Client, error) {
+	client, err := c.newClient(c.ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create MCP client %s", c.serverID)
+	}
+
+	if err := client.Start(c.ctx); err != nil {
+		return nil, wrapMCPConnectError(err, "failed to start MCP client %s", c.serverID)
+	}
+
+	// Forward the logs of stdio servers
+	if stderr, ok := mcpclient.GetStderr(client); ok {
+		go func(stderr io.Reader) {
+			rd := bufio.NewReader(stderr)
+			for {
+				line, err := rd.ReadString('\n')
+				if err != nil {
+					if err == io.EOF || strings.Contains(err.Error(), "already closed") {
+						return
+					}
+					c.logger.Error("failed to copy stderr", "err", err, "serverName", c.serverID)
+					return
+				}
+				c.logger.Warn("[MCP] "+strings.TrimSpace(line), "serverName", c.serverID)
+			}
+		}(stderr)
+	}
+
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = mcp.Implementation{
+		Name:    "agentruntime",
+		Version: "0.1.0",
+	}
+	if c.config.SupportsSampling() {
+		initRequest.Params.Capabilities.Sampling = &struct{}{}
+	}
+	initCtx, cancel := context.WithTimeout(ctx, c.config.GetTimeout())
+	defer cancel()
+	if _, err := client.Initialize(initCtx, initRequest); err != nil {
+		_ = client.Close()
+		return nil, wrapMCPConnectError(err, "failed to initialize MCP client %s", c.serverID)
+	}
+
+	client.OnNotification(c.dispatch)
+
+	return client, nil
+}
+
+// wrapMCPConnectError explains how to authorize servers rejecting the connection for a missing OAuth token
+func wrapMCPConnectError(err error, format string, serverID string) error {
+	if mcpclient.IsOAuthAuthorizationRequiredError(err) {
+		return errors.Wrapf(err, "mcp server %s requires authorization, run `agentruntime mcp auth <agent-file> %s`", serverID, serverID)
+	}
+	return errors.Wrapf(err, format, serverID)
+}
+
+// Status returns a snapshot of the connection state
+func (c *mcpConnection) Status() MCPServerStatus {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	status := MCPServerStatus{
+		Name:      c.serverID,
+		Transport: c.config.GetTransport(),
+		State:     c.state,
+		ToolCount: c.toolCount,
+		Restarts:  c.restarts,
+	}
+	if c.lastError != nil {
+		status.LastError = c.lastError.Error()
+	}
+	if c.state == MCPServerStateConnected {
+		connectedAt := c.connectedAt
+		status.ConnectedAt = &connectedAt
+	}
+	return status
+}
+
+func (c *mcpConnection) Close() error {
+	c.mtx.Lock()
+	client := c.client
+	c.client = nil
+	c.state = MCPServerStateClosed
+	c.mtx.Unlock()
+
+	c.cancel()
+	if client == nil {
+		return nil
+	}
+	return client.Close()
+}
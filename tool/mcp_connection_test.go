@@ -0,0 +1,178 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMCPConnectionLifecycle(t *testing.T) {
+	ctx := context.Background()
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	srv := newTestInProcessMCPServer()
+	addTestInProcessMCPServer(ctx, m, "docs", srv)
+
+	// The server is connected lazily on first use
+	statuses := m.GetMCPServerStatuses()
+	require.Len(t, statuses, 1)
+	require.Equal(t, MCPServerStateIdle, statuses[0].State)
+
+	require.NotNil(t, m.GetMCPTool("docs", "echo"))
+	status := m.GetMCPServerStatuses()[0]
+	require.Equal(t, MCPServerStateConnected, status.State)
+	require.Equal(t, 1, status.ToolCount)
+	require.NotNil(t, status.ConnectedAt)
+
+	// Tools added at runtime are registered on tools/list_changed
+	srv.AddTool(mcp.NewTool("reverse", mcp.WithString("text")), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("ok"), nil
+	})
+	conn, _ := m.getMCPConnection("docs")
+	conn.dispatch(mcp.JSONRPCNotification{Notification: mcp.Notification{Method: mcp.MethodNotificationToolsListChanged}})
+	require.Eventually(t, func() bool {
+		return m.GetMCPTool("docs", "reverse") != nil
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, 2, m.GetMCPServerStatuses()[0].ToolCount)
+
+	// A lost connection is restored in the background
+	conn.config.ReconnectBackoff = 10 * time.Millisecond
+	client := conn.client
+	conn.lost(client, errors.New("transport error: broken pipe"))
+	require.Equal(t, MCPServerStateReconnecting, m.GetMCPServerStatuses()[0].State)
+	require.Eventually(t, func() bool {
+		status := m.GetMCPServerStatuses()[0]
+		return status.State == MCPServerStateConnected && status.Restarts == 1
+	}, time.Second, 10*time.Millisecond)
+
+	tools := m.GetMCPTools(ctx, "docs")
+	require.Len(t, tools, 4)
+}
+
+func TestMCPConnectionFailure(t *testing.T) {
+	ctx := context.Background()
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	require.NoError(t, m.registerMCPTool(ctx, RegisterMCPToolRequest{
+		ServerID: "broken",
+		ServerConfig: &MCPServerConfig{
+			Transport: MCPTransportHTTP,
+		},
+	}))
+
+	require.Nil(t, m.GetMCPTools(ctx, "broken"))
+	status := m.GetMCPServerStatuses()[0]
+	require.Equal(t, MCPServerStateFailed, status.State)
+	require.Contains(t, status.LastError, "URL is required")
+	require.Nil(t, status.ConnectedAt)
+}
+
+func TestMCPToolDefinitionChange(t *testing.T) {
+	ctx := WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	srv := newTestInProcessMCPServer()
+	addTestInProcessMCPServer(ctx, m, "docs", srv)
+
+	echo := m.GetMCPTool("docs", "echo")
+	require.NotNil(t, echo)
+	require.NotContains(t, echo.Definition().InputSchema["properties"], "prefix")
+
+	// A tool whose schema changed is registered again on tools/list_changed
+	srv.AddTool(mcp.NewTool("echo", mcp.WithDescription("Echo the text after a prefix"), mcp.WithString("text"), mcp.WithString("prefix", mcp.Required())), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(req.GetString("prefix", "") + req.GetString("text", "")), nil
+	})
+	conn, _ := m.getMCPConnection("docs")
+	conn.dispatch(mcp.JSONRPCNotification{Notification: mcp.Notification{Method: mcp.MethodNotificationToolsListChanged}})
+	require.Eventually(t, func() bool {
+		return m.GetMCPTool("docs", "echo").Definition().Description == "Echo the text after a prefix"
+	}, time.Second, 10*time.Millisecond)
+
+	echo = m.GetMCPTool("docs", "echo")
+	require.Contains(t, echo.Definition().InputSchema["properties"], "prefix")
+	require.Equal(t, []any{"prefix"}, echo.Definition().InputSchema["required"])
+
+	// Calls are checked against the new schema
+	out, err := echo.RunRaw(ctx, map[string]any{"text": "hello"})
+	require.NoError(t, err)
+	require.Contains(t, out.(map[string]any)["error"], "prefix is required")
+
+	out, err = echo.RunRaw(ctx, map[string]any{"text": "hello", "prefix": "> "})
+	require.NoError(t, err)
+	require.Contains(t, fmt.Sprint(out), "> hello")
+}
+
+func TestReadToolResultOfUnhealthyMCPSkill(t *testing.T) {
+	ctx := context.Background()
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, &config.ToolConfig{MaxResultSize: 64})
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	addTestInProcessMCPServer(ctx, m, "docs", newTestInProcessMCPServer())
+	skill := entity.AgentSkillUnion{Type: entity.AgentSkillTypeMCP, OfMCP: &entity.MCPAgentSkill{Name: "docs"}}
+
+	tools, err := m.GetToolsBySkill(ctx, skill)
+	require.NoError(t, err)
+	require.Equal(t, ReadToolResultToolName, tools[len(tools)-1].Name())
+
+	// read_tool_result is not offered alone when the server contributes no tools
+	conn, _ := m.getMCPConnection("docs")
+	for conn.breaker.Allow() {
+		conn.breaker.RecordFailure()
+	}
+	tools, err = m.GetToolsBySkill(ctx, skill)
+	require.NoError(t, err)
+	require.Empty(t, tools)
+}
+
+func TestMCPToolNamesDifferingInInvalidCharacters(t *testing.T) {
+	ctx := context.Background()
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	srv := server.NewMCPServer("srv", "1.0.0", server.WithToolCapabilities(false))
+	for _, name := range []string{"foo.bar", "foo_bar"} {
+		srv.AddTool(mcp.NewTool(name), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(name), nil
+		})
+	}
+	addTestInProcessMCPServer(ctx, m, "srv", srv)
+
+	dotted, underscored := m.GetMCPTool("srv", "foo.bar"), m.GetMCPTool("srv", "foo_bar")
+	require.NotNil(t, dotted)
+	require.NotNil(t, underscored)
+	require.NotEqual(t, dotted.Name(), underscored.Name())
+	require.Len(t, m.GetMCPTools(ctx, "srv"), 2)
+}
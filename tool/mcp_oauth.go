@@ -0,0 +1,384 @@
+package tool
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/pkg/errors"
+)
+
+type (
+	// FileTokenStorage keeps the OAuth tokens of MCP servers in a directory, one AES-GCM encrypted file
+	// per server URL and client ID. The key is derived from a passphrase, or generated and kept in the
+	// directory when no passphrase is given.
+	FileTokenStorage struct {
+		mtx        sync.Mutex
+		dir        string
+		passphrase string
+	}
+
+	// storedOAuthToken is the content of a token file
+	storedOAuthToken struct {
+		ServerURL string `json:"serverUrl"`
+		ClientID  string `json:"clientId"`
+		// RegisteredClientID and RegisteredClientSecret are the credentials obtained through
+		// dynamic client registration when the skill does not configure a client ID
+		RegisteredClientID     string           `json:"registeredClientId,omitempty"`
+		RegisteredClientSecret string           `json:"registeredClientSecret,omitempty"`
+		Token                  *transport.Token `json:"token,omitempty"`
+	}
+
+	// fileTokenStore is the transport.TokenStore of a single server
+	fileTokenStore struct {
+		storage   *FileTokenStorage
+		serverURL string
+		clientID  string
+	}
+
+	// AuthorizeMCPServerRequest configures the authorization-code flow of an oauth-sse MCP server
+	AuthorizeMCPServerRequest struct {
+		Config  MCPServerConfig
+		Storage *FileTokenStorage
+		// OpenURL is called with the authorization URL the user has to visit
+		OpenURL func(authURL string) error
+		// ClientName is sent when the client registers itself dynamically
+		ClientName string
+	}
+)
+
+const (
+	// DefaultMCPOAuthRedirectURL is the redirect URL of the local listener when the skill configures none
+	DefaultMCPOAuthRedirectURL = "http://localhost:8085/oauth/callback"
+
+	mcpTokenKeyFile = ".key"
+	// mcpTokenExpirySkew refreshes access tokens this long before they expire, so requests do not race the expiry
+	mcpTokenExpirySkew = time.Minute
+)
+
+var errNoOAuthToken = errors.New("no token available")
+
+// NewFileTokenStorage creates a token storage in dir. The passphrase may be empty.
+func NewFileTokenStorage(dir, passphrase string) *FileTokenStorage {
+	return &FileTokenStorage{
+		dir:        dir,
+		passphrase: passphrase,
+	}
+}
+
+// TokenStore returns the token store of the server, as used by the OAuth transport of mcp-go
+func (s *FileTokenStorage) TokenStore(serverURL, clientID string) transport.TokenStore {
+	return &fileTokenStore{
+		storage:   s,
+		serverURL: serverURL,
+		clientID:  clientID,
+	}
+}
+
+// RegisteredClient returns the client credentials stored by a previous dynamic client registration
+func (s *FileTokenStorage) RegisteredClient(serverURL, clientID string) (string, string, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stored, err := s.load(serverURL, clientID)
+	if err != nil || stored == nil {
+		return "", "", err
+	}
+	return stored.RegisteredClientID, stored.RegisteredClientSecret, nil
+}
+
+// Delete removes the stored token of the server
+func (s *FileTokenStorage) Delete(serverURL, clientID string) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := os.Remove(s.path(serverURL, clientID)); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to delete token of %s", serverURL)
+	}
+	return nil
+}
+
+func (s *FileTokenStorage) update(serverURL, clientID string, fn func(stored *storedOAuthToken)) error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	stored, err := s.load(serverURL, clientID)
+	if err != nil {
+		return err
+	}
+	if stored == nil {
+		stored = &storedOAuthToken{ServerURL: serverURL, ClientID: clientID}
+	}
+	fn(stored)
+	return s.save(stored)
+}
+
+func (s *FileTokenStorage) path(serverURL, clientID string) string {
+	sum := sha256.Sum256([]byte(serverURL + "\n" + clientID))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:16])+".token")
+}
+
+func (s *FileTokenStorage) load(serverURL, clientID string) (*storedOAuthToken, error) {
+	data, err := os.ReadFile(s.path(serverURL, clientID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read token of %s", serverURL)
+	}
+
+	gcm, err := s.cipher()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, errors.Errorf("token file of %s is corrupted", serverURL)
+	}
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decrypt token of %s, was the token key changed?", serverURL)
+	}
+
+	var stored storedOAuthToken
+	if err := json.Unmarshal(plaintext, &stored); err != nil {
+		return nil, errors.Wrapf(err, "failed to decode token of %s", serverURL)
+	}
+	return &stored, nil
+}
+
+func (s *FileTokenStorage) save(stored *storedOAuthToken) error {
+	plaintext, err := json.Marshal(stored)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode token of %s", stored.ServerURL)
+	}
+
+	gcm, err := s.cipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrapf(err, "failed to generate nonce")
+	}
+
+	// Write to a temporary file first, so a crash never leaves a truncated token behind
+	path := s.path(stored.ServerURL, stored.ClientID)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, gcm.Seal(nonce, nonce, plaintext, nil), 0o600); err != nil {
+		return errors.Wrapf(err, "failed to write token of %s", stored.ServerURL)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrapf(err, "failed to write token of %s", stored.ServerURL)
+	}
+	return nil
+}
+
+func (s *FileTokenStorage) cipher() (cipher.AEAD, error) {
+	key, err := s.key()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create token cipher")
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *FileTokenStorage) key() ([]byte, error) {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return nil, errors.Wrapf(err, "failed to create token directory %s", s.dir)
+	}
+
+	if s.passphrase != "" {
+		key := sha256.Sum256([]byte(s.passphrase))
+		return key[:], nil
+	}
+
+	keyPath := filepath.Join(s.dir, mcpTokenKeyFile)
+	key, err := os.ReadFile(keyPath)
+	if err == nil {
+		if len(key) != 32 {
+			return nil, errors.Errorf("token key %s is corrupted", keyPath)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to read token key %s", keyPath)
+	}
+
+	key = make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrapf(err, "failed to generate token key")
+	}
+	if err := os.WriteFile(keyPath, key, 0o600); err != nil {
+		return nil, errors.Wrapf(err, "failed to write token key %s", keyPath)
+	}
+	return key, nil
+}
+
+// GetToken returns the stored token. Its expiry is moved forward by mcpTokenExpirySkew,
+// so the OAuth transport refreshes it shortly before it actually expires.
+func (t *fileTokenStore) GetToken() (*transport.Token, error) {
+	t.storage.mtx.Lock()
+	defer t.storage.mtx.Unlock()
+
+	stored, err := t.storage.load(t.serverURL, t.clientID)
+	if err != nil {
+		return nil, err
+	}
+	if stored == nil || stored.Token == nil {
+		return nil, errNoOAuthToken
+	}
+
+	token := *stored.Token
+	if !token.ExpiresAt.IsZero() {
+		token.ExpiresAt = token.ExpiresAt.Add(-mcpTokenExpirySkew)
+	}
+	return &token, nil
+}
+
+func (t *fileTokenStore) SaveToken(token *transport.Token) error {
+	return t.storage.update(t.serverURL, t.clientID, func(stored *storedOAuthToken) {
+		stored.Token = token
+	})
+}
+
+// AuthorizeMCPServer runs the authorization-code flow with PKCE for an oauth-sse MCP server.
+// It listens on the redirect URL for the callback of the authorization server and stores the obtained token.
+func AuthorizeMCPServer(ctx context.Context, req AuthorizeMCPServerRequest) error {
+	config := req.Config
+	if config.GetTransport() != MCPTransportOAuthSSE {
+		return errors.Errorf("transport %s does not use OAuth", config.GetTransport())
+	}
+	if config.URL == "" {
+		return errors.New("URL is required for OAuth SSE transport")
+	}
+	if config.OAuthConfig == nil {
+		return errors.New("OAuth configuration is required for OAuth SSE transport")
+	}
+
+	redirectURL := config.OAuthConfig.RedirectURL
+	if redirectURL == "" {
+		redirectURL = DefaultMCPOAuthRedirectURL
+	}
+	redirect, err := url.Parse(redirectURL)
+	if err != nil {
+		return errors.Wrapf(err, "invalid redirect URL %s", redirectURL)
+	}
+	if host := redirect.Hostname(); host != "localhost" && host != "127.0.0.1" && host != "::1" {
+		return errors.Errorf("redirect URL %s must point to localhost to receive the authorization code", redirectURL)
+	}
+	baseURL, err := url.Parse(config.URL)
+	if err != nil {
+		return errors.Wrapf(err, "invalid URL %s", config.URL)
+	}
+
+	listener, err := net.Listen("tcp", redirect.Host)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s", redirect.Host)
+	}
+	defer listener.Close()
+
+	clientID := config.OAuthConfig.ClientID
+	handler := transport.NewOAuthHandler(transport.OAuthConfig{
+		ClientID:              clientID,
+		ClientSecret:          config.OAuthConfig.ClientSecret,
+		RedirectURI:           redirectURL,
+		Scopes:                config.OAuthConfig.Scopes,
+		AuthServerMetadataURL: config.OAuthConfig.AuthServerMetadataURL,
+		PKCEEnabled:           true,
+		TokenStore:            req.Storage.TokenStore(config.URL, clientID),
+	})
+	handler.SetBaseURL(fmt.Sprintf("%s://%s", baseURL.Scheme, baseURL.Host))
+
+	if clientID == "" {
+		clientName := req.ClientName
+		if clientName == "" {
+			clientName = "agentruntime"
+		}
+		if err := handler.RegisterClient(ctx, clientName); err != nil {
+			return errors.Wrapf(err, "failed to register client, configure a clientId instead")
+		}
+		if err := req.Storage.update(config.URL, clientID, func(stored *storedOAuthToken) {
+			stored.RegisteredClientID = handler.GetClientID()
+			stored.RegisteredClientSecret = handler.GetClientSecret()
+		}); err != nil {
+			return err
+		}
+	}
+
+	codeVerifier, err := transport.GenerateCodeVerifier()
+	if err != nil {
+		return errors.Wrapf(err, "failed to generate code verifier")
+	}
+	state, err := transport.GenerateState()
+	if err != nil {
+		return errors.Wrapf(err, "failed to generate state")
+	}
+	authURL, err := handler.GetAuthorizationURL(ctx, state, transport.GenerateCodeChallenge(codeVerifier))
+	if err != nil {
+		return errors.Wrapf(err, "failed to build authorization URL")
+	}
+
+	type callback struct {
+		code, state string
+		err         error
+	}
+	callbackCh := make(chan callback, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(redirect.Path, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		result := callback{code: query.Get("code"), state: query.Get("state")}
+		if errCode := query.Get("error"); errCode != "" {
+			result.err = errors.Errorf("authorization failed: %s %s", errCode, query.Get("error_description"))
+		} else if result.code == "" {
+			result.err = errors.New("authorization callback has no code")
+		}
+
+		if result.err != nil {
+			http.Error(w, result.err.Error(), http.StatusBadRequest)
+		} else {
+			_, _ = io.WriteString(w, "Authorization complete. You can close this window.")
+		}
+		select {
+		case callbackCh <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	if err := req.OpenURL(authURL); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case result := <-callbackCh:
+		if result.err != nil {
+			return result.err
+		}
+		if err := handler.ProcessAuthorizationResponse(ctx, result.code, result.state, codeVerifier); err != nil {
+			return errors.Wrapf(err, "failed to exchange authorization code")
+		}
+	}
+
+	return nil
+}
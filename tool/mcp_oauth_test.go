@@ -0,0 +1,134 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTokenStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage := NewFileTokenStorage(dir, "")
+
+	store := storage.TokenStore("https://mcp.example.com/sse", "client")
+	_, err := store.GetToken()
+	require.Error(t, err)
+
+	require.NoError(t, store.SaveToken(&transport.Token{
+		AccessToken:  "secret-access-token",
+		RefreshToken: "secret-refresh-token",
+		TokenType:    "Bearer",
+		ExpiresAt:    time.Now().Add(30 * time.Second),
+	}))
+
+	// Tokens are encrypted at rest
+	files, err := filepath.Glob(filepath.Join(dir, "*.token"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	require.NotContains(t, string(data), "secret-access-token")
+
+	// A new storage on the same directory reads the token back, and tokens close to their expiry count as expired
+	token, err := NewFileTokenStorage(dir, "").TokenStore("https://mcp.example.com/sse", "client").GetToken()
+	require.NoError(t, err)
+	require.Equal(t, "secret-access-token", token.AccessToken)
+	require.True(t, token.IsExpired())
+
+	// Tokens are keyed by server URL and client ID
+	_, err = storage.TokenStore("https://mcp.example.com/sse", "other").GetToken()
+	require.Error(t, err)
+
+	passphraseStorage := NewFileTokenStorage(dir, "passphrase")
+	_, err = passphraseStorage.TokenStore("https://mcp.example.com/sse", "client").GetToken()
+	require.ErrorContains(t, err, "failed to decrypt")
+
+	require.NoError(t, storage.Delete("https://mcp.example.com/sse", "client"))
+	_, err = store.GetToken()
+	require.Error(t, err)
+}
+
+func TestAuthorizeMCPServer(t *testing.T) {
+	var authServer *httptest.Server
+	authServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/oauth-authorization-server":
+			_ = json.NewEncoder(w).Encode(transport.AuthServerMetadata{
+				Issuer:                authServer.URL,
+				AuthorizationEndpoint: authServer.URL + "/authorize",
+				TokenEndpoint:         authServer.URL + "/token",
+			})
+		case "/authorize":
+			query := r.URL.Query()
+			require.Equal(t, "S256", query.Get("code_challenge_method"))
+			http.Redirect(w, r, fmt.Sprintf("%s?code=auth-code&state=%s", query.Get("redirect_uri"), query.Get("state")), http.StatusFound)
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			require.Equal(t, "auth-code", r.Form.Get("code"))
+			require.NotEmpty(t, r.Form.Get("code_verifier"))
+			_ = json.NewEncoder(w).Encode(transport.Token{
+				AccessToken:  "access-token",
+				RefreshToken: "refresh-token",
+				TokenType:    "Bearer",
+				ExpiresIn:    3600,
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer authServer.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	redirectURL := fmt.Sprintf("http://%s/callback", listener.Addr())
+	require.NoError(t, listener.Close())
+
+	storage := NewFileTokenStorage(t.TempDir(), "passphrase")
+	config := MCPServerConfig{
+		URL:       authServer.URL + "/sse",
+		Transport: MCPTransportOAuthSSE,
+		OAuthConfig: &OAuthConfig{
+			ClientID:              "client",
+			AuthServerMetadataURL: authServer.URL + "/.well-known/oauth-authorization-server",
+			RedirectURL:           redirectURL,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = AuthorizeMCPServer(ctx, AuthorizeMCPServerRequest{
+		Config:  config,
+		Storage: storage,
+		// Plays the browser following the redirect of the authorization server
+		OpenURL: func(authURL string) error {
+			go func() {
+				resp, err := http.Get(authURL)
+				if err == nil {
+					resp.Body.Close()
+				}
+			}()
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	token, err := storage.TokenStore(config.URL, "client").GetToken()
+	require.NoError(t, err)
+	require.Equal(t, "access-token", token.AccessToken)
+	require.Equal(t, "refresh-token", token.RefreshToken)
+	require.False(t, token.IsExpired())
+
+	config.OAuthConfig.RedirectURL = "https://example.com/callback"
+	err = AuthorizeMCPServer(ctx, AuthorizeMCPServerRequest{Config: config, Storage: storage})
+	require.ErrorContains(t, err, "must point to localhost")
+}
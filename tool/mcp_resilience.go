@@ -0,0 +1,236 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/habiliai/agentruntime/internal/mylog"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+)
+
+type (
+	// circuitBreaker tracks consecutive failures of an MCP server.
+	// Once the threshold is reached the server is considered unhealthy until the cooldown passes,
+	// after which calls are let through again and the first success closes the circuit.
+	circuitBreaker struct {
+		mtx       sync.Mutex
+		threshold int
+		cooldown  time.Duration
+		failures  int
+		openedAt  time.Time
+	}
+
+	// mcpClientSource provides the client of an MCP server
+	mcpClientSource interface {
+		Client(ctx context.Context) (mcpclient.MCPClient, error)
+		// ReportError lets the source react to failed requests, e.g. by reconnecting
+		ReportError(err error)
+	}
+
+	// resilientMCPClient sends requests to an MCP server with timeouts, retries and a circuit breaker
+	resilientMCPClient struct {
+		source       mcpClientSource
+		serverID     string
+		timeout      time.Duration
+		maxRetries   int
+		retryBackoff time.Duration
+		breaker      *circuitBreaker
+		logger       *mylog.Logger
+	}
+)
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+// Allow reports whether calls should be sent to the server
+func (b *circuitBreaker) Allow() bool {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	return b.failures < b.threshold || time.Since(b.openedAt) >= b.cooldown
+}
+
+func (b *circuitBreaker) RecordSuccess() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.failures = 0
+}
+
+func (b *circuitBreaker) RecordFailure() {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openedAt = time.Now()
+	}
+}
+
+// newResilientMCPClient creates a client sending the requests of the server through its circuit breaker, which is
+// shared by all the clients of the server
+func (m *manager) newResilientMCPClient(serverID string, source mcpClientSource, config MCPServerConfig, breaker *circuitBreaker, retryable bool) *resilientMCPClient {
+	c := &resilientMCPClient{
+		source:       source,
+		serverID:     serverID,
+		timeout:      config.GetTimeout(),
+		retryBackoff: config.GetRetryBackoff(),
+		breaker:      breaker,
+		logger:       m.logger,
+	}
+	if retryable {
+		c.maxRetries = config.MaxRetries
+	}
+
+	return c
+}
+
+// isRetryableMCPTool reports whether the tool is safe to call more than once
+func isRetryableMCPTool(tool mcp.Tool) bool {
+	annotations := tool.Annotations
+	return (annotations.IdempotentHint != nil && *annotations.IdempotentHint) ||
+		(annotations.ReadOnlyHint != nil && *annotations.ReadOnlyHint)
+}
+
+// CallTool calls the tool with a timeout per attempt, retrying with exponential backoff
+// while the circuit breaker allows it
+func (c *resilientMCPClient) CallTool(ctx context.Context, req mcp.CallToolRequest) (out *mcp.CallToolResult, err error) {
+	err = c.do(ctx, fmt.Sprintf("call tool %s", req.Params.Name), func(ctx context.Context, client mcpclient.MCPClient) (err error) {
+		out, err = client.CallTool(ctx, req)
+		return
+	})
+	return
+}
+
+// ListTools lists the tools of the server with the same policy as tool calls
+func (c *resilientMCPClient) ListTools(ctx context.Context, req mcp.ListToolsRequest) (out *mcp.ListToolsResult, err error) {
+	err = c.do(ctx, "list tools", func(ctx context.Context, client mcpclient.MCPClient) (err error) {
+		out, err = client.ListTools(ctx, req)
+		return
+	})
+	return
+}
+
+// ListResources lists the resources of the server with the same policy as tool calls
+func (c *resilientMCPClient) ListResources(ctx context.Context, req mcp.ListResourcesRequest) (out *mcp.ListResourcesResult, err error) {
+	err = c.do(ctx, "list resources", func(ctx context.Context, client mcpclient.MCPClient) (err error) {
+		out, err = client.ListResources(ctx, req)
+		return
+	})
+	return
+}
+
+// ListResourceTemplates lists the resource templates of the server with the same policy as tool calls
+func (c *resilientMCPClient) ListResourceTemplates(ctx context.Context, req mcp.ListResourceTemplatesRequest) (out *mcp.ListResourceTemplatesResult, err error) {
+	err = c.do(ctx, "list resource templates", func(ctx context.Context, client mcpclient.MCPClient) (err error) {
+		out, err = client.ListResourceTemplates(ctx, req)
+		return
+	})
+	return
+}
+
+// ReadResource reads the resource with the same policy as tool calls
+func (c *resilientMCPClient) ReadResource(ctx context.Context, req mcp.ReadResourceRequest) (out *mcp.ReadResourceResult, err error) {
+	err = c.do(ctx, fmt.Sprintf("read resource %s", req.Params.URI), func(ctx context.Context, client mcpclient.MCPClient) (err error) {
+		out, err = client.ReadResource(ctx, req)
+		return
+	})
+	return
+}
+
+// Subscribe subscribes to updates of the resource with the same policy as tool calls
+func (c *resilientMCPClient) Subscribe(ctx context.Context, req mcp.SubscribeRequest) error {
+	return c.do(ctx, fmt.Sprintf("subscribe to resource %s", req.Params.URI), func(ctx context.Context, client mcpclient.MCPClient) error {
+		return client.Subscribe(ctx, req)
+	})
+}
+
+// ListPrompts lists the prompts of the server with the same policy as tool calls
+func (c *resilientMCPClient) ListPrompts(ctx context.Context, req mcp.ListPromptsRequest) (out *mcp.ListPromptsResult, err error) {
+	err = c.do(ctx, "list prompts", func(ctx context.Context, client mcpclient.MCPClient) (err error) {
+		out, err = client.ListPrompts(ctx, req)
+		return
+	})
+	return
+}
+
+// GetPrompt gets the prompt with the same policy as tool calls
+func (c *resilientMCPClient) GetPrompt(ctx context.Context, req mcp.GetPromptRequest) (out *mcp.GetPromptResult, err error) {
+	err = c.do(ctx, fmt.Sprintf("get prompt %s", req.Params.Name), func(ctx context.Context, client mcpclient.MCPClient) (err error) {
+		out, err = client.GetPrompt(ctx, req)
+		return
+	})
+	return
+}
+
+// do sends a request, retrying it while it fails for the connection or a timeout. A request failing after all its
+// attempts counts once against the circuit breaker, and requests the server rejects do not count, since it answered
+func (c *resilientMCPClient) do(ctx context.Context, action string, fn func(ctx context.Context, client mcpclient.MCPClient) error) error {
+	backoff := c.retryBackoff
+	for attempt := 0; ; attempt++ {
+		if !c.breaker.Allow() {
+			return errors.Errorf("mcp server %s is unavailable after repeated failures", c.serverID)
+		}
+
+		failed, err := c.doOnce(ctx, fn)
+		if err == nil {
+			c.breaker.RecordSuccess()
+			return nil
+		}
+		if !failed {
+			return errors.Wrapf(err, "failed to %s on mcp server %s", action, c.serverID)
+		}
+		if ctx.Err() != nil || attempt >= c.maxRetries {
+			c.breaker.RecordFailure()
+			return errors.Wrapf(err, "failed to %s on mcp server %s", action, c.serverID)
+		}
+
+		c.logger.WarnContext(ctx, "mcp request failed, retrying", "serverName", c.serverID, "request", action, "attempt", attempt+1, "backoff", backoff, "err", err)
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// doOnce sends a request with the timeout of a call, reporting whether it failed for the connection or the timeout.
+// The server is connected before the timeout starts, since connecting has its own timeout and also registers its tools
+func (c *resilientMCPClient) doOnce(ctx context.Context, fn func(ctx context.Context, client mcpclient.MCPClient) error) (bool, error) {
+	client, err := c.source.Client(ctx)
+	if err != nil {
+		return true, err
+	}
+
+	callCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	err = fn(callCtx, client)
+	if err == nil {
+		return false, nil
+	}
+	c.source.ReportError(err)
+
+	if ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		return true, errors.Wrapf(err, "timed out after %s", c.timeout)
+	}
+	return isMCPConnectionError(err), err
+}
+
+// isMCPServerAvailable reports whether the circuit breaker of the server lets calls through
+func (m *manager) isMCPServerAvailable(serverName string) bool {
+	conn, ok := m.getMCPConnection(serverName)
+	if !ok {
+		return false
+	}
+	return conn.breaker.Allow()
+}
@@ -0,0 +1,148 @@
+package tool
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type flakyMCPClient struct {
+	mcpclient.MCPClient
+
+	calls    int
+	failures int
+	delay    time.Duration
+	// rejected makes the server answer the calls with an error instead of dropping the connection
+	rejected bool
+}
+
+func (c *flakyMCPClient) CallTool(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	c.calls++
+	if c.delay > 0 {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(c.delay):
+		}
+	}
+	if c.rejected {
+		return nil, errors.New("invalid params")
+	}
+	if c.calls <= c.failures {
+		return nil, errors.New("transport error: connection reset")
+	}
+	return mcp.NewToolResultText("ok"), nil
+}
+
+// staticMCPClientSource always provides the same client
+type staticMCPClientSource struct {
+	client mcpclient.MCPClient
+}
+
+func (s staticMCPClientSource) Client(context.Context) (mcpclient.MCPClient, error) {
+	return s.client, nil
+}
+
+func (s staticMCPClientSource) ReportError(error) {}
+
+func newTestResilientClient(client mcpclient.MCPClient, config MCPServerConfig, tool mcp.Tool) *resilientMCPClient {
+	m := &manager{logger: slog.Default()}
+	breaker := newCircuitBreaker(config.GetCircuitBreakerThreshold(), config.GetCircuitBreakerCooldown())
+	return m.newResilientMCPClient("flaky", staticMCPClientSource{client}, config, breaker, isRetryableMCPTool(tool))
+}
+
+func TestResilientMCPClient_RetriesIdempotentTools(t *testing.T) {
+	client := &flakyMCPClient{failures: 2}
+	tool := mcp.NewTool("search", mcp.WithIdempotentHintAnnotation(true))
+	c := newTestResilientClient(client, MCPServerConfig{MaxRetries: 2, RetryBackoff: time.Millisecond}, tool)
+
+	out, err := c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	require.NotNil(t, out)
+	require.Equal(t, 3, client.calls)
+}
+
+func TestResilientMCPClient_DoesNotRetryNonIdempotentTools(t *testing.T) {
+	client := &flakyMCPClient{failures: 1}
+	tool := mcp.NewTool("write_file", mcp.WithIdempotentHintAnnotation(false))
+	c := newTestResilientClient(client, MCPServerConfig{MaxRetries: 2, RetryBackoff: time.Millisecond}, tool)
+
+	_, err := c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.Error(t, err)
+	require.Equal(t, 1, client.calls)
+}
+
+func TestResilientMCPClient_Timeout(t *testing.T) {
+	client := &flakyMCPClient{delay: time.Second}
+	c := newTestResilientClient(client, MCPServerConfig{Timeout: 10 * time.Millisecond}, mcp.NewTool("slow"))
+
+	_, err := c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.ErrorContains(t, err, "timed out")
+}
+
+func TestResilientMCPClient_CircuitBreaker(t *testing.T) {
+	client := &flakyMCPClient{failures: 100}
+	c := newTestResilientClient(client, MCPServerConfig{
+		CircuitBreakerThreshold: 2,
+		CircuitBreakerCooldown:  50 * time.Millisecond,
+	}, mcp.NewTool("search"))
+
+	for range 2 {
+		_, err := c.CallTool(context.Background(), mcp.CallToolRequest{})
+		require.ErrorContains(t, err, "connection reset")
+	}
+	require.False(t, c.breaker.Allow())
+
+	// Calls fail fast while the circuit is open
+	_, err := c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.ErrorContains(t, err, "unavailable")
+	require.Equal(t, 2, client.calls)
+
+	// After the cooldown a successful call closes the circuit again
+	time.Sleep(60 * time.Millisecond)
+	client.failures = 0
+	_, err = c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.NoError(t, err)
+	require.True(t, c.breaker.Allow())
+}
+
+func TestResilientMCPClient_RejectedCalls(t *testing.T) {
+	client := &flakyMCPClient{rejected: true}
+	tool := mcp.NewTool("search", mcp.WithIdempotentHintAnnotation(true))
+	c := newTestResilientClient(client, MCPServerConfig{
+		MaxRetries:              2,
+		RetryBackoff:            time.Millisecond,
+		CircuitBreakerThreshold: 1,
+	}, tool)
+
+	// The server answered, so the call is neither retried nor counted against it
+	_, err := c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.ErrorContains(t, err, "invalid params")
+	require.Equal(t, 1, client.calls)
+	require.True(t, c.breaker.Allow())
+}
+
+func TestResilientMCPClient_CountsRetriedCallsOnce(t *testing.T) {
+	client := &flakyMCPClient{failures: 100}
+	tool := mcp.NewTool("search", mcp.WithIdempotentHintAnnotation(true))
+	c := newTestResilientClient(client, MCPServerConfig{
+		MaxRetries:              2,
+		RetryBackoff:            time.Millisecond,
+		CircuitBreakerThreshold: 2,
+	}, tool)
+
+	_, err := c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.ErrorContains(t, err, "connection reset")
+	require.Equal(t, 3, client.calls)
+	require.True(t, c.breaker.Allow())
+
+	_, err = c.CallTool(context.Background(), mcp.CallToolRequest{})
+	require.Error(t, err)
+	require.False(t, c.breaker.Allow())
+}
@@ -0,0 +1,439 @@
+package tool
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/knowledge"
+	mcp "github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+)
+
+type (
+	ReadMCPResourceRequest struct {
+		URI string `json:"uri,omitempty" jsonschema:"description=URI of the resource to read. Leave empty to list the available resources"`
+	}
+
+	MCPResourceInfo struct {
+		URI         string `json:"uri,omitempty"`
+		URITemplate string `json:"uri_template,omitempty"`
+		Name        string `json:"name"`
+		Description string `json:"description,omitempty"`
+		MIMEType    string `json:"mime_type,omitempty"`
+	}
+
+	MCPResourceContent struct {
+		URI      string `json:"uri"`
+		MIMEType string `json:"mime_type,omitempty"`
+		Text     string `json:"text,omitempty"`
+		Blob     string `json:"blob,omitempty" jsonschema:"description=Base64 encoded binary content"`
+	}
+
+	ReadMCPResourceResponse struct {
+		Resources []MCPResourceInfo    `json:"resources,omitempty" jsonschema:"description=Available resources when no uri is given"`
+		Contents  []MCPResourceContent `json:"contents,omitempty" jsonschema:"description=Contents of the resource"`
+		Error     string               `json:"error,omitempty" jsonschema:"description=Error message if the resource could not be read"`
+	}
+
+	// mcpResourceIndexer keeps the resources of an MCP server indexed in the knowledge base
+	mcpResourceIndexer struct {
+		mtx         sync.Mutex
+		serverID    string
+		knowledgeID string
+		subscribe   bool
+		client      *resilientMCPClient
+		subscribed  map[string]bool
+	}
+)
+
+const (
+	ReadMCPResourceToolName = "read_resource"
+	MCPPromptToolNamePrefix = "prompt_"
+
+	// maxListedResources caps the number of resources listed in the description of the read_resource tool
+	maxListedResources = 50
+	// mcpResourceIndexTimeout caps the time of indexing all resources of a server
+	mcpResourceIndexTimeout = 10 * time.Minute
+)
+
+// MCPResourcesKnowledgeID returns the knowledge ID the resources of an MCP server are indexed under
+func MCPResourcesKnowledgeID(serverID string) string {
+	return fmt.Sprintf("%s-resources", serverID)
+}
+
+// registerMCPExtraTool records a tool that does not correspond to an MCP tool, such as read_resource or a prompt
+func (m *manager) registerMCPExtraTool(serverID, localName, toolName string) {
+	toolNames, ok := m.mcpExtraToolNames[serverID]
+	if !ok {
+		toolNames = make(map[string]string)
+		m.mcpExtraToolNames[serverID] = toolNames
+	}
+	toolNames[localName] = toolName
+}
+
+// defineReadResourceTool registers the read_resource tool of the server
+func (m *manager) defineReadResourceTool(req RegisterMCPToolRequest, client *resilientMCPClient, resources []MCPResourceInfo, limit resultLimit) error {
+	serverID := req.ServerID
+	if _, ok := m.mcpExtraToolNames[serverID][ReadMCPResourceToolName]; ok {
+		return nil
+	}
+
+	toolName := NamespacedMCPToolName(serverID, ReadMCPResourceToolName)
+	if genkit.LookupTool(m.genkit, toolName) != nil {
+		return errors.Errorf("tool name %s of mcp server %s conflicts with an already registered tool", toolName, serverID)
+	}
+
+	tool := ai.NewTool(
+		toolName,
+		readMCPResourceToolDescription(serverID, resources),
+		limitToolResult(m, toolName, limit, func(ctx *ai.ToolContext, in ReadMCPResourceRequest) (res ReadMCPResourceResponse, err error) {
+			if in.URI == "" {
+				if res.Resources, err = listMCPResources(ctx, client); err != nil {
+					res.Error = err.Error()
+				}
+				return res, nil
+			}
+
+			contents, err := readMCPResource(ctx, client, in.URI)
+			if err != nil {
+				res.Error = err.Error()
+				return res, nil
+			}
+			for _, content := range contents {
+				switch content := content.(type) {
+				case mcp.TextResourceContents:
+					res.Contents = append(res.Contents, MCPResourceContent{URI: content.URI, MIMEType: content.MIMEType, Text: content.Text})
+				case mcp.BlobResourceContents:
+					res.Contents = append(res.Contents, MCPResourceContent{URI: content.URI, MIMEType: content.MIMEType, Blob: content.Blob})
+				}
+			}
+			return res, nil
+		}),
+	)
+	// Policies name the extra tools by their name without the namespace
+	policies := toolPoliciesFor(req.policies, ReadMCPResourceToolName)
+	if _, err := m.registerGuardedTool(tool, serverID, policies, limitedOutputSchema(ReadMCPResourceResponse{}, limit)); err != nil {
+		return err
+	}
+	m.registerMCPExtraTool(serverID, ReadMCPResourceToolName, toolName)
+
+	return nil
+}
+
+// indexMCPServerResources indexes the resources of the server into the knowledge base. It runs in the background
+// after every connect, so failures are logged since the server stays usable without its resources being searchable.
+func (m *manager) indexMCPServerResources(req RegisterMCPToolRequest, conn *mcpConnection) {
+	ctx, cancel := context.WithTimeout(conn.ctx, mcpResourceIndexTimeout)
+	defer cancel()
+
+	capabilities := conn.GetServerCapabilities()
+	if capabilities.Resources == nil {
+		return
+	}
+	if m.knowledgeService == nil {
+		m.logger.WarnContext(ctx, "knowledge service is not available, skipping indexing of mcp resources", "serverName", req.ServerID)
+		return
+	}
+
+	m.mtx.Lock()
+	indexer, ok := m.mcpResourceIndexers[req.ServerID]
+	if !ok {
+		indexer = &mcpResourceIndexer{
+			serverID:    req.ServerID,
+			knowledgeID: MCPResourcesKnowledgeID(req.ServerID),
+			client:      m.newResilientMCPClient(req.ServerID, conn, conn.config, conn.breaker, true),
+		}
+		m.mcpResourceIndexers[req.ServerID] = indexer
+
+		// Re-index in the background whenever the server reports changed resources
+		conn.OnNotification(func(notification mcp.JSONRPCNotification) {
+			switch notification.Method {
+			case mcp.MethodNotificationResourceUpdated, mcp.MethodNotificationResourcesListChanged:
+				go func() {
+					ctx, cancel := context.WithTimeout(conn.ctx, mcpResourceIndexTimeout)
+					defer cancel()
+
+					if err := m.indexMCPResources(ctx, indexer); err != nil {
+						m.logger.Error("failed to re-index mcp resources", "err", err, "serverName", indexer.serverID)
+					}
+				}()
+			}
+		})
+	}
+	m.mtx.Unlock()
+
+	// Subscriptions do not survive reconnections, so they are renewed on every connect
+	indexer.mtx.Lock()
+	indexer.subscribe = capabilities.Resources.Subscribe
+	indexer.subscribed = make(map[string]bool)
+	indexer.mtx.Unlock()
+
+	if err := m.indexMCPResources(ctx, indexer); err != nil {
+		m.logger.ErrorContext(ctx, "failed to index mcp resources", "err", err, "serverName", req.ServerID)
+	}
+}
+
+// indexMCPResources reads all text and PDF resources of the server and replaces their knowledge with them
+func (m *manager) indexMCPResources(ctx context.Context, indexer *mcpResourceIndexer) error {
+	indexer.mtx.Lock()
+	defer indexer.mtx.Unlock()
+
+	result, err := indexer.client.ListResources(ctx, mcp.ListResourcesRequest{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to list resources of mcp server %s", indexer.serverID)
+	}
+
+	var inputs []*knowledge.DocumentReader
+	for _, resource := range result.Resources {
+		contents, err := readMCPResource(ctx, indexer.client, resource.URI)
+		if err != nil {
+			m.logger.WarnContext(ctx, "failed to read mcp resource, skipping it", "serverName", indexer.serverID, "uri", resource.URI, "err", err)
+			continue
+		}
+		for _, content := range contents {
+			if input := documentReaderFromResourceContents(content); input != nil {
+				inputs = append(inputs, input)
+			}
+		}
+
+		// Subscribe once per resource so that updates trigger re-indexing
+		if indexer.subscribe && !indexer.subscribed[resource.URI] {
+			req := mcp.SubscribeRequest{}
+			req.Params.URI = resource.URI
+			if err := indexer.client.Subscribe(ctx, req); err != nil {
+				m.logger.WarnContext(ctx, "failed to subscribe to mcp resource", "serverName", indexer.serverID, "uri", resource.URI, "err", err)
+				continue
+			}
+			indexer.subscribed[resource.URI] = true
+		}
+	}
+
+	if len(inputs) == 0 {
+		return errors.Wrapf(m.knowledgeService.DeleteKnowledge(ctx, indexer.knowledgeID), "failed to delete knowledge of mcp resources")
+	}
+
+	if _, err := m.knowledgeService.IndexKnowledgeFromDocuments(ctx, indexer.knowledgeID, func(yield func(*knowledge.DocumentReader, error) bool) {
+		for _, input := range inputs {
+			if !yield(input, nil) {
+				return
+			}
+		}
+	}); err != nil {
+		return errors.Wrapf(err, "failed to index resources of mcp server %s", indexer.serverID)
+	}
+
+	m.logger.InfoContext(ctx, "indexed mcp resources", "serverName", indexer.serverID, "documents", len(inputs))
+	return nil
+}
+
+// defineMCPPromptTools registers every prompt of the server as a tool returning the rendered prompt as instruction
+func (m *manager) defineMCPPromptTools(req RegisterMCPToolRequest, client *resilientMCPClient, prompts []mcp.Prompt, limit resultLimit) error {
+	serverID := req.ServerID
+	for _, prompt := range prompts {
+		localName := MCPPromptToolNamePrefix + prompt.Name
+		if _, ok := m.mcpExtraToolNames[serverID][localName]; ok {
+			continue
+		}
+
+		toolName := NamespacedMCPToolName(serverID, localName)
+		if genkit.LookupTool(m.genkit, toolName) != nil {
+			return errors.Errorf("tool name %s of mcp server %s conflicts with an already registered tool", toolName, serverID)
+		}
+
+		description := prompt.Description
+		if description == "" {
+			description = fmt.Sprintf("Get the instructions of prompt %s of MCP server %s", prompt.Name, serverID)
+		}
+
+		tool := ai.NewToolWithInputSchema(
+			toolName,
+			description,
+			promptInputSchema(prompt),
+			limitToolResult(m, toolName, limit, func(ctx *ai.ToolContext, in any) (res LLMToolResponse, err error) {
+				req := mcp.GetPromptRequest{}
+				req.Params.Name = prompt.Name
+				if args, ok := in.(map[string]any); ok && len(args) > 0 {
+					req.Params.Arguments = make(map[string]string, len(args))
+					for name, value := range args {
+						req.Params.Arguments[name] = fmt.Sprint(value)
+					}
+				}
+
+				out, err := client.GetPrompt(ctx, req)
+				if err != nil {
+					return res, err
+				}
+				res.Instruction = renderPromptMessages(out.Messages)
+				return res, nil
+			}),
+		)
+		policies := toolPoliciesFor(req.policies, localName)
+		if _, err := m.registerGuardedTool(tool, serverID, policies, limitedOutputSchema(LLMToolResponse{}, limit)); err != nil {
+			return err
+		}
+		m.registerMCPExtraTool(serverID, localName, toolName)
+	}
+
+	return nil
+}
+
+func listMCPResources(ctx context.Context, client *resilientMCPClient) ([]MCPResourceInfo, error) {
+	result, err := client.ListResources(ctx, mcp.ListResourcesRequest{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list resources")
+	}
+
+	resources := make([]MCPResourceInfo, 0, len(result.Resources))
+	for _, resource := range result.Resources {
+		resources = append(resources, MCPResourceInfo{
+			URI:         resource.URI,
+			Name:        resource.Name,
+			Description: resource.Description,
+			MIMEType:    resource.MIMEType,
+		})
+	}
+
+	// Templates are optional, so servers without them are not an error
+	if templates, err := client.ListResourceTemplates(ctx, mcp.ListResourceTemplatesRequest{}); err == nil {
+		for _, template := range templates.ResourceTemplates {
+			info := MCPResourceInfo{
+				Name:        template.Name,
+				Description: template.Description,
+				MIMEType:    template.MIMEType,
+			}
+			if template.URITemplate != nil {
+				info.URITemplate = template.URITemplate.Raw()
+			}
+			resources = append(resources, info)
+		}
+	}
+
+	return resources, nil
+}
+
+func readMCPResource(ctx context.Context, client *resilientMCPClient, uri string) ([]mcp.ResourceContents, error) {
+	req := mcp.ReadResourceRequest{}
+	req.Params.URI = uri
+
+	out, err := client.ReadResource(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return out.Contents, nil
+}
+
+func readMCPResourceToolDescription(serverID string, resources []MCPResourceInfo) string {
+	var description strings.Builder
+	fmt.Fprintf(&description, `Read a resource of the MCP server %s by its URI.
+
+Call without uri to list the available resources. Text resources are returned as text, binary resources as base64 encoded blobs.`, serverID)
+
+	if len(resources) > 0 {
+		description.WriteString("\n\nAvailable resources:")
+		for i, resource := range resources {
+			if i >= maxListedResources {
+				fmt.Fprintf(&description, "\n- ... and %d more", len(resources)-maxListedResources)
+				break
+			}
+			uri := resource.URI
+			if uri == "" {
+				uri = resource.URITemplate
+			}
+			fmt.Fprintf(&description, "\n- %s (%s)", resource.Name, uri)
+			if resource.Description != "" {
+				fmt.Fprintf(&description, ": %s", resource.Description)
+			}
+		}
+	}
+
+	return description.String()
+}
+
+// documentReaderFromResourceContents converts resource contents to a document the knowledge service can index.
+// It returns nil for contents of unsupported types.
+func documentReaderFromResourceContents(content mcp.ResourceContents) *knowledge.DocumentReader {
+	switch content := content.(type) {
+	case mcp.TextResourceContents:
+		contentType := content.MIMEType
+		switch contentType {
+		case "text/markdown", "text/html", "text/csv", "application/json", "text/json", "text/plain":
+		default:
+			if knowledge.DetectCodeLanguage("", contentType) == "" {
+				contentType = "text/plain"
+			}
+		}
+		return &knowledge.DocumentReader{
+			Content:     strings.NewReader(content.Text),
+			ContentType: contentType,
+			// The URI of source code files has the extension of their language
+			Filename: content.URI,
+		}
+	case mcp.BlobResourceContents:
+		switch content.MIMEType {
+		case "application/pdf", knowledge.MIMETypeDOCX, knowledge.MIMETypeXLSX, knowledge.MIMETypePPTX:
+		default:
+			return nil
+		}
+		return &knowledge.DocumentReader{
+			Content:     base64.NewDecoder(base64.StdEncoding, strings.NewReader(content.Blob)),
+			ContentType: content.MIMEType,
+		}
+	}
+	return nil
+}
+
+func promptInputSchema(prompt mcp.Prompt) map[string]any {
+	properties := make(map[string]any, len(prompt.Arguments))
+	required := make([]string, 0, len(prompt.Arguments))
+	for _, arg := range prompt.Arguments {
+		property := map[string]any{
+			"type": "string",
+		}
+		if arg.Description != "" {
+			property["description"] = arg.Description
+		}
+		properties[arg.Name] = property
+		if arg.Required {
+			required = append(required, arg.Name)
+		}
+	}
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// renderPromptMessages flattens the messages of a prompt into a single instruction
+func renderPromptMessages(messages []mcp.PromptMessage) string {
+	parts := make([]string, 0, len(messages))
+	for _, message := range messages {
+		var text string
+		switch content := message.Content.(type) {
+		case mcp.TextContent:
+			text = content.Text
+		case mcp.EmbeddedResource:
+			if resource, ok := content.Resource.(mcp.TextResourceContents); ok {
+				text = resource.Text
+			}
+		}
+		if text == "" {
+			continue
+		}
+		if message.Role == mcp.RoleAssistant {
+			text = "Assistant: " + text
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, "\n\n")
+}
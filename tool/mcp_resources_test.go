@@ -0,0 +1,176 @@
+package tool
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/knowledge"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestInProcessMCPServer() *server.MCPServer {
+	s := server.NewMCPServer(
+		"docs",
+		"1.0.0",
+		server.WithToolCapabilities(false),
+		server.WithResourceCapabilities(false, false),
+		server.WithPromptCapabilities(false),
+	)
+
+	s.AddTool(mcp.NewTool("echo", mcp.WithString("text")), func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(req.GetString("text", "")), nil
+	})
+	s.AddResource(
+		mcp.NewResource("docs://guide", "guide", mcp.WithResourceDescription("User guide"), mcp.WithMIMEType("text/markdown")),
+		func(ctx context.Context, req mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			return []mcp.ResourceContents{
+				mcp.TextResourceContents{URI: req.Params.URI, MIMEType: "text/markdown", Text: "# Guide\n\nRun the agent with agentruntime."},
+			}, nil
+		},
+	)
+	s.AddPrompt(
+		mcp.NewPrompt("review", mcp.WithPromptDescription("Review a document"), mcp.WithArgument("topic", mcp.RequiredArgument())),
+		func(ctx context.Context, req mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return mcp.NewGetPromptResult("Review", []mcp.PromptMessage{
+				mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Review the document about "+req.Params.Arguments["topic"])),
+			}), nil
+		},
+	)
+
+	return s
+}
+
+// addTestInProcessMCPServer registers an MCP server running in the same process
+func addTestInProcessMCPServer(ctx context.Context, m *manager, serverID string, s *server.MCPServer) {
+	m.addMCPServer(ctx, RegisterMCPToolRequest{ServerID: serverID}, MCPServerConfig{}, func(context.Context) (*mcpclient.Client, error) {
+		return mcpclient.NewInProcessClient(s)
+	})
+}
+
+func TestMCPResourcesAndPrompts(t *testing.T) {
+	ctx := WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	addTestInProcessMCPServer(ctx, m, "docs", newTestInProcessMCPServer())
+
+	tools := m.GetMCPTools(ctx, "docs")
+	var names []string
+	for _, tool := range tools {
+		names = append(names, tool.Name())
+	}
+	require.ElementsMatch(t, []string{"docs__echo", "docs__read_resource", "docs__prompt_review"}, names)
+
+	readResource := m.GetMCPTool("docs", ReadMCPResourceToolName)
+	require.NotNil(t, readResource)
+	require.Contains(t, readResource.Definition().Description, "docs://guide")
+
+	out, err := readResource.RunRaw(ctx, map[string]any{"uri": "docs://guide"})
+	require.NoError(t, err)
+	contents := out.(map[string]any)["contents"].([]any)
+	require.Len(t, contents, 1)
+	require.Contains(t, contents[0].(map[string]any)["text"], "# Guide")
+
+	out, err = readResource.RunRaw(ctx, map[string]any{})
+	require.NoError(t, err)
+	require.Len(t, out.(map[string]any)["resources"], 1)
+
+	prompt := m.GetMCPTool("docs", "docs__prompt_review")
+	require.NotNil(t, prompt)
+	require.Equal(t, []string{"topic"}, prompt.Definition().InputSchema["required"])
+
+	out, err = prompt.RunRaw(ctx, map[string]any{"topic": "onboarding"})
+	require.NoError(t, err)
+	require.Equal(t, "Review the document about onboarding", out.(map[string]any)["additional_important_instruction"])
+
+	// Prompts are guarded like the MCP tools, so calls missing required arguments are rejected
+	out, err = prompt.RunRaw(ctx, map[string]any{})
+	require.NoError(t, err)
+	require.Contains(t, out.(map[string]any)["error"], "topic")
+}
+
+func TestMCPResources_Policies(t *testing.T) {
+	ctx := WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	policies, err := compileToolPolicies([]entity.AgentSkillToolPolicy{
+		{Tool: ReadMCPResourceToolName, Argument: "uri", Deny: []string{`^docs://internal/`}},
+	})
+	require.NoError(t, err)
+	m.addMCPServer(ctx, RegisterMCPToolRequest{ServerID: "docs", policies: policies}, MCPServerConfig{}, func(context.Context) (*mcpclient.Client, error) {
+		return mcpclient.NewInProcessClient(newTestInProcessMCPServer())
+	})
+	require.NotEmpty(t, m.GetMCPTools(ctx, "docs"))
+
+	readResource := m.GetMCPTool("docs", ReadMCPResourceToolName)
+	out, err := readResource.RunRaw(ctx, map[string]any{"uri": "docs://internal/keys"})
+	require.NoError(t, err)
+	require.Contains(t, out.(map[string]any)["error"], "argument uri is not allowed")
+
+	out, err = readResource.RunRaw(ctx, map[string]any{"uri": "docs://guide"})
+	require.NoError(t, err)
+	require.Len(t, out.(map[string]any)["contents"], 1)
+}
+
+func TestMCPResources_Indexing(t *testing.T) {
+	ctx := WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	knowledgeService, err := knowledge.NewService(ctx, &config.ModelConfig{}, config.NewKnowledgeConfig(), slog.Default(), knowledge.WithEmbedder(knowledge.NewHashEmbedder(32)))
+	require.NoError(t, err)
+	defer knowledgeService.Close()
+
+	// knowledge_search is restricted to other knowledge, but still finds the resources of the MCP skill
+	toolManager, err := NewToolManager(ctx, []entity.AgentSkillUnion{
+		{
+			Type: entity.AgentSkillTypeNative,
+			OfNative: &entity.NativeAgentSkill{
+				Name: "knowledge_search",
+				Env:  map[string]any{"knowledge_ids": []string{"faq"}},
+			},
+		},
+		{
+			Type:  entity.AgentSkillTypeMCP,
+			OfMCP: &entity.MCPAgentSkill{Name: "docs", Command: "docs-mcp", IndexResources: true},
+		},
+	}, slog.Default(), g, knowledgeService, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	// Serve the skill in process instead of running its command
+	m.mtx.Lock()
+	delete(m.mcpConnections, "docs")
+	m.mtx.Unlock()
+	m.addMCPServer(ctx, RegisterMCPToolRequest{ServerID: "docs", IndexResources: true}, MCPServerConfig{}, func(context.Context) (*mcpclient.Client, error) {
+		return mcpclient.NewInProcessClient(newTestInProcessMCPServer())
+	})
+	require.NotEmpty(t, m.GetMCPTools(ctx, "docs"))
+
+	knowledgeSearch := m.GetTool("knowledge_search")
+	require.NotNil(t, knowledgeSearch)
+	require.Eventually(t, func() bool {
+		out, err := knowledgeSearch.RunRaw(ctx, map[string]any{"query": "run the agent"})
+		require.NoError(t, err)
+		results, _ := out.(map[string]any)["output"].([]any)
+		return len(results) > 0 && strings.Contains(results[0].(map[string]any)["context"].(string), "agentruntime")
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,216 @@
+package tool
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+)
+
+type (
+	// MCPSamplingHandler answers sampling/createMessage requests of an MCP server
+	MCPSamplingHandler func(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error)
+
+	// MCPSamplingApprover decides whether a sampling request of an MCP server may be sent to the selected model.
+	// Returning an error rejects the request, and the error is reported to the server.
+	MCPSamplingApprover func(ctx context.Context, serverID, model string, request mcp.CreateMessageRequest) error
+
+	ManagerOption func(m *manager)
+
+	// mcpSamplingUsage tracks the tokens an MCP server used for sampling, and the tokens reserved by the requests
+	// being answered
+	mcpSamplingUsage struct {
+		mtx      sync.Mutex
+		tokens   int
+		reserved int
+	}
+)
+
+const MCPMethodSamplingCreateMessage = "sampling/createMessage"
+
+// WithMCPSamplingApprover sets the hook approving sampling requests of MCP servers.
+// Without an approver, every request within the server's limits is sent to the model.
+func WithMCPSamplingApprover(approver MCPSamplingApprover) ManagerOption {
+	return func(m *manager) {
+		m.samplingApprover = approver
+	}
+}
+
+// reserve reserves up to maxTokens of the budget for a request, all of the remaining budget if maxTokens is not
+// positive. It returns the reserved tokens, or false if the budget is used up
+func (u *mcpSamplingUsage) reserve(budget, maxTokens int) (int, bool) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	remaining := budget - u.tokens - u.reserved
+	if remaining <= 0 {
+		return 0, false
+	}
+	if maxTokens <= 0 || maxTokens > remaining {
+		maxTokens = remaining
+	}
+	u.reserved += maxTokens
+	return maxTokens, true
+}
+
+// settle releases a reservation and adds the tokens the request actually used, zero if it failed
+func (u *mcpSamplingUsage) settle(reserved, tokens int) {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+	u.reserved -= reserved
+	u.tokens += tokens
+}
+
+// newMCPSamplingHandler returns the handler routing sampling requests of the server through the genkit models
+func (m *manager) newMCPSamplingHandler(serverID string, config MCPSamplingConfig) MCPSamplingHandler {
+	usage := &mcpSamplingUsage{}
+
+	return func(ctx context.Context, req mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+		maxTokens := req.MaxTokens
+		if config.MaxTokens > 0 && (maxTokens <= 0 || maxTokens > config.MaxTokens) {
+			maxTokens = config.MaxTokens
+		}
+
+		// The output tokens of the request are reserved until it is answered, so that concurrent requests cannot
+		// together exceed the budget
+		tokens, reserved := 0, 0
+		if config.MaxTotalTokens > 0 {
+			var ok bool
+			if reserved, ok = usage.reserve(config.MaxTotalTokens, maxTokens); !ok {
+				return nil, errors.Errorf("mcp server %s used up its sampling budget of %d tokens", serverID, config.MaxTotalTokens)
+			}
+			maxTokens = reserved
+			defer func() {
+				usage.settle(reserved, tokens)
+			}()
+		}
+
+		model := selectSamplingModel(config.Models, req.ModelPreferences)
+		if m.samplingApprover != nil {
+			if err := m.samplingApprover(ctx, serverID, model, req); err != nil {
+				return nil, errors.Wrapf(err, "sampling request of mcp server %s was rejected", serverID)
+			}
+		}
+
+		messages, err := samplingMessagesToGenkit(req.Messages)
+		if err != nil {
+			return nil, err
+		}
+
+		modelConfig := map[string]any{}
+		if maxTokens > 0 {
+			modelConfig["maxOutputTokens"] = maxTokens
+		}
+		if req.Temperature > 0 {
+			modelConfig["temperature"] = req.Temperature
+		}
+		if len(req.StopSequences) > 0 {
+			modelConfig["stopSequences"] = req.StopSequences
+		}
+
+		opts := []ai.GenerateOption{
+			ai.WithModelName(model),
+			ai.WithMessages(messages...),
+			ai.WithConfig(modelConfig),
+		}
+		if req.SystemPrompt != "" {
+			opts = append(opts, ai.WithSystem("%s", req.SystemPrompt))
+		}
+
+		resp, err := genkit.Generate(ctx, m.genkit, opts...)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate sampling response for mcp server %s", serverID)
+		}
+
+		if resp.Usage != nil {
+			tokens = resp.Usage.TotalTokens
+			if tokens == 0 {
+				tokens = resp.Usage.InputTokens + resp.Usage.OutputTokens
+			}
+		}
+		m.logger.InfoContext(ctx, "answered mcp sampling request", "serverName", serverID, "model", model, "tokens", tokens)
+
+		return &mcp.CreateMessageResult{
+			SamplingMessage: mcp.SamplingMessage{
+				Role:    mcp.RoleAssistant,
+				Content: mcp.NewTextContent(resp.Text()),
+			},
+			Model:      model,
+			StopReason: samplingStopReason(resp.FinishReason),
+		}, nil
+	}
+}
+
+// selectSamplingModel maps the model preferences of a request to one of the configured models.
+// Hints are matched as substrings of the model names. Without a matching hint, requests favoring
+// cost or speed over intelligence get the last (least capable) model and all others the first one.
+func selectSamplingModel(models []string, prefs *mcp.ModelPreferences) string {
+	if prefs == nil {
+		return models[0]
+	}
+
+	for _, hint := range prefs.Hints {
+		if hint.Name == "" {
+			continue
+		}
+		for _, model := range models {
+			if strings.Contains(model, hint.Name) {
+				return model
+			}
+		}
+	}
+
+	if max(prefs.CostPriority, prefs.SpeedPriority) > prefs.IntelligencePriority {
+		return models[len(models)-1]
+	}
+	return models[0]
+}
+
+func samplingMessagesToGenkit(messages []mcp.SamplingMessage) ([]*ai.Message, error) {
+	result := make([]*ai.Message, 0, len(messages))
+	for _, message := range messages {
+		content := message.Content
+		if contentMap, ok := content.(map[string]any); ok {
+			parsed, err := mcp.ParseContent(contentMap)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid sampling message content")
+			}
+			content = parsed
+		}
+
+		var part *ai.Part
+		switch content := content.(type) {
+		case mcp.TextContent:
+			part = ai.NewTextPart(content.Text)
+		case mcp.ImageContent:
+			part = ai.NewMediaPart(content.MIMEType, fmt.Sprintf("data:%s;base64,%s", content.MIMEType, content.Data))
+		default:
+			return nil, errors.Errorf("unsupported sampling message content %T", content)
+		}
+
+		role := ai.RoleUser
+		if message.Role == mcp.RoleAssistant {
+			role = ai.RoleModel
+		}
+		result = append(result, &ai.Message{
+			Role:    role,
+			Content: []*ai.Part{part},
+		})
+	}
+	return result, nil
+}
+
+func samplingStopReason(reason ai.FinishReason) string {
+	switch reason {
+	case ai.FinishReasonStop:
+		return "endTurn"
+	case ai.FinishReasonLength:
+		return "maxTokens"
+	}
+	return string(reason)
+}
@@ -0,0 +1,197 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	fgenkit "github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectSamplingModel(t *testing.T) {
+	models := []string{"openai/gpt-5", "openai/gpt-5-mini"}
+
+	require.Equal(t, "openai/gpt-5", selectSamplingModel(models, nil))
+	require.Equal(t, "openai/gpt-5-mini", selectSamplingModel(models, &mcp.ModelPreferences{
+		Hints: []mcp.ModelHint{{Name: "claude"}, {Name: "mini"}},
+	}))
+	require.Equal(t, "openai/gpt-5-mini", selectSamplingModel(models, &mcp.ModelPreferences{
+		CostPriority:         0.8,
+		IntelligencePriority: 0.2,
+	}))
+	require.Equal(t, "openai/gpt-5", selectSamplingModel(models, &mcp.ModelPreferences{
+		SpeedPriority:        0.3,
+		IntelligencePriority: 0.9,
+	}))
+}
+
+func newTestSamplingManager(t *testing.T, opts ...ManagerOption) *manager {
+	ctx := context.Background()
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	for _, name := range []string{"test/large", "test/small"} {
+		fgenkit.DefineModel(g, name, &ai.ModelOptions{
+			Supports: &ai.ModelSupports{Multiturn: true, SystemRole: true},
+		}, func(ctx context.Context, req *ai.ModelRequest, _ ai.ModelStreamCallback) (*ai.ModelResponse, error) {
+			config := req.Config.(map[string]any)
+			last := req.Messages[len(req.Messages)-1]
+			return &ai.ModelResponse{
+				Request:      req,
+				Message:      ai.NewModelTextMessage(name + ": " + last.Text()),
+				FinishReason: ai.FinishReasonStop,
+				Usage:        &ai.GenerationUsage{TotalTokens: config["maxOutputTokens"].(int)},
+			}, nil
+		})
+	}
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil, opts...)
+	require.NoError(t, err)
+	t.Cleanup(toolManager.Close)
+	return toolManager.(*manager)
+}
+
+func newTestSamplingRequest(text string) mcp.CreateMessageRequest {
+	req := mcp.CreateMessageRequest{}
+	req.Messages = []mcp.SamplingMessage{
+		{Role: mcp.RoleUser, Content: map[string]any{"type": "text", "text": text}},
+	}
+	req.MaxTokens = 1000
+	return req
+}
+
+func TestMCPSamplingHandler(t *testing.T) {
+	m := newTestSamplingManager(t, WithMCPSamplingApprover(func(ctx context.Context, serverID, model string, req mcp.CreateMessageRequest) error {
+		if strings.Contains(req.SystemPrompt, "forbidden") {
+			return errors.New("denied by policy")
+		}
+		return nil
+	}))
+	handler := m.newMCPSamplingHandler("docs", MCPSamplingConfig{
+		Models:         []string{"test/large", "test/small"},
+		MaxTokens:      10,
+		MaxTotalTokens: 25,
+	})
+	ctx := context.Background()
+
+	out, err := handler(ctx, newTestSamplingRequest("hello"))
+	require.NoError(t, err)
+	require.Equal(t, "test/large", out.Model)
+	require.Equal(t, "endTurn", out.StopReason)
+	require.Equal(t, mcp.RoleAssistant, out.Role)
+	require.Equal(t, "test/large: hello", out.Content.(mcp.TextContent).Text)
+
+	rejected := newTestSamplingRequest("hello")
+	rejected.SystemPrompt = "forbidden"
+	_, err = handler(ctx, rejected)
+	require.ErrorContains(t, err, "denied by policy")
+
+	// The per-request limit caps the output tokens and the total budget caps the last request
+	_, err = handler(ctx, newTestSamplingRequest("hello"))
+	require.NoError(t, err)
+	_, err = handler(ctx, newTestSamplingRequest("hello"))
+	require.NoError(t, err)
+	_, err = handler(ctx, newTestSamplingRequest("hello"))
+	require.ErrorContains(t, err, "sampling budget")
+}
+
+func TestMCPSamplingHandler_ConcurrentBudget(t *testing.T) {
+	release := make(chan struct{})
+	m := newTestSamplingManager(t, WithMCPSamplingApprover(func(ctx context.Context, serverID, model string, req mcp.CreateMessageRequest) error {
+		<-release
+		return nil
+	}))
+	handler := m.newMCPSamplingHandler("docs", MCPSamplingConfig{
+		Models:         []string{"test/large"},
+		MaxTokens:      10,
+		MaxTotalTokens: 25,
+	})
+
+	type result struct {
+		out *mcp.CreateMessageResult
+		err error
+	}
+	results := make(chan result)
+	for range 5 {
+		go func() {
+			out, err := handler(context.Background(), newTestSamplingRequest("hello"))
+			results <- result{out, err}
+		}()
+	}
+
+	// The requests in flight hold the whole budget, so the others are refused before any of them is answered
+	for range 2 {
+		select {
+		case res := <-results:
+			require.ErrorContains(t, res.err, "sampling budget")
+		case <-time.After(time.Second):
+			require.FailNow(t, "requests beyond the budget were not refused")
+		}
+	}
+	close(release)
+
+	for range 3 {
+		res := <-results
+		require.NoError(t, res.err)
+		require.Equal(t, "test/large: hello", res.out.Content.(mcp.TextContent).Text)
+	}
+
+	_, err := handler(context.Background(), newTestSamplingRequest("hello"))
+	require.ErrorContains(t, err, "sampling budget")
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestRouteServerOutput(t *testing.T) {
+	m := newTestSamplingManager(t)
+	factory := NewMCPClientFactory().WithSamplingHandler(m.newMCPSamplingHandler("docs", MCPSamplingConfig{
+		Models: []string{"test/small"},
+	}))
+
+	serverOutput := strings.Join([]string{
+		`{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`,
+		`{"jsonrpc":"2.0","id":"srv-1","method":"sampling/createMessage","params":{"messages":[{"role":"user","content":{"type":"text","text":"hi"}}],"maxTokens":5}}`,
+		`{"jsonrpc":"2.0","id":"srv-2","method":"roots/list"}`,
+		`{"jsonrpc":"2.0","id":1,"result":{}}`,
+	}, "\n") + "\n"
+
+	clientInput, clientInputWriter := io.Pipe()
+	output, outputWriter := io.Pipe()
+	go factory.routeServerOutput(context.Background(), "docs", strings.NewReader(serverOutput), outputWriter, &stdioServerInput{
+		stdin: nopWriteCloser{clientInputWriter},
+	})
+
+	// Only notifications and responses reach the transport
+	forwarded, err := io.ReadAll(output)
+	require.NoError(t, err)
+	require.Equal(t, `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`+"\n"+`{"jsonrpc":"2.0","id":1,"result":{}}`+"\n", string(forwarded))
+
+	// Requests are answered on the server's input
+	responses := map[string]map[string]any{}
+	rd := bufio.NewReader(clientInput)
+	for range 2 {
+		line, err := rd.ReadBytes('\n')
+		require.NoError(t, err)
+		var response map[string]any
+		require.NoError(t, json.Unmarshal(line, &response))
+		responses[response["id"].(string)] = response
+	}
+
+	result := responses["srv-1"]["result"].(map[string]any)
+	require.Equal(t, "test/small", result["model"])
+	require.Equal(t, "test/small: hi", result["content"].(map[string]any)["text"])
+	require.EqualValues(t, mcp.METHOD_NOT_FOUND, responses["srv-2"]["error"].(map[string]any)["code"])
+}
@@ -0,0 +1,146 @@
+package tool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+)
+
+type (
+	// stdioServerInput serializes writes to the stdin of the server process,
+	// which is shared by the transport and the responses to server requests
+	stdioServerInput struct {
+		mtx   sync.Mutex
+		stdin io.WriteCloser
+		cmd   *exec.Cmd
+	}
+
+	// serverRequest is a JSON-RPC request sent from the server to the client
+	serverRequest struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params json.RawMessage `json:"params"`
+	}
+)
+
+func (w *stdioServerInput) Write(p []byte) (int, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.stdin.Write(p)
+}
+
+func (w *stdioServerInput) Close() error {
+	if err := w.stdin.Close(); err != nil {
+		return err
+	}
+	return w.cmd.Wait()
+}
+
+// createSamplingStdioClient creates a stdio client that also answers sampling requests of the server.
+// The stdio transport of mcp-go only routes responses and notifications, so requests of the server are
+// taken out of its output before the transport reads it.
+func (f *MCPClientFactory) createSamplingStdioClient(ctx context.Context, serverID string, config MCPServerConfig) (*mcpclient.Client, error) {
+	if config.Command == "" {
+		return nil, errors.New("command is required for stdio transport")
+	}
+
+	cmd := exec.CommandContext(ctx, config.Command, config.Args...)
+	cmd.Env = os.Environ()
+	for key, val := range config.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, val))
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create stdin pipe")
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create stdout pipe")
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create stderr pipe")
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "failed to start command")
+	}
+
+	input := &stdioServerInput{stdin: stdin, cmd: cmd}
+	output, outputWriter := io.Pipe()
+	go f.routeServerOutput(ctx, serverID, stdout, outputWriter, input)
+
+	return mcpclient.NewClient(transport.NewIO(output, input, stderr)), nil
+}
+
+// routeServerOutput forwards responses and notifications of the server to the transport and answers its requests
+func (f *MCPClientFactory) routeServerOutput(ctx context.Context, serverID string, stdout io.Reader, output *io.PipeWriter, input *stdioServerInput) {
+	defer output.Close()
+
+	rd := bufio.NewReader(stdout)
+	for {
+		line, err := rd.ReadBytes('\n')
+		if len(line) > 0 {
+			var req serverRequest
+			if json.Unmarshal(line, &req) == nil && req.Method != "" && len(req.ID) > 0 && string(req.ID) != "null" {
+				go f.answerServerRequest(ctx, serverID, req, input)
+			} else if _, err := output.Write(line); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *MCPClientFactory) answerServerRequest(ctx context.Context, serverID string, req serverRequest, input *stdioServerInput) {
+	response := map[string]any{
+		"jsonrpc": mcp.JSONRPC_VERSION,
+		"id":      req.ID,
+	}
+
+	result, code, err := f.handleServerRequest(ctx, req)
+	if err != nil {
+		response["error"] = map[string]any{
+			"code":    code,
+			"message": err.Error(),
+		}
+	} else {
+		response["result"] = result
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	_, _ = input.Write(append(data, '\n'))
+}
+
+func (f *MCPClientFactory) handleServerRequest(ctx context.Context, req serverRequest) (any, int, error) {
+	switch req.Method {
+	case string(mcp.MethodPing):
+		return map[string]any{}, 0, nil
+	case MCPMethodSamplingCreateMessage:
+		var params mcp.CreateMessageParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, mcp.INVALID_PARAMS, errors.Wrapf(err, "invalid sampling request")
+		}
+		result, err := f.samplingHandler(ctx, mcp.CreateMessageRequest{CreateMessageParams: params})
+		if err != nil {
+			return nil, mcp.INTERNAL_ERROR, err
+		}
+		return result, 0, nil
+	}
+	return nil, mcp.METHOD_NOT_FOUND, errors.Errorf("method %s is not supported", req.Method)
+}
@@ -4,6 +4,7 @@ func (s *TestSuite) TestToolByMCP() {
 	tool := s.toolManager.GetMCPTool("filesystem", "list_directory")
 	s.NotNil(tool)
 
-	s.Equal("list_directory", tool.Definition().Name)
+	s.Equal("filesystem__list_directory", tool.Definition().Name)
+	s.NotNil(s.toolManager.GetMCPTool("filesystem", "filesystem__list_directory"))
 	s.T().Logf("tool definition: %v", tool.Definition())
 }
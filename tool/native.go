@@ -14,7 +14,9 @@ func registerNativeTool[In any, Out any](m *manager, toolName, toolDescription s
 		}
 	}
 
-	registerLocalTool(m, toolName, toolDescription, skill, fn)
+	if _, err := registerLocalTool(m, toolName, toolDescription, skill, fn); err != nil {
+		return err
+	}
 	m.skillToolNames[skill.Name] = append(toolNames, toolName)
 
 	return nil
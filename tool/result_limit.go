@@ -0,0 +1,252 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pkg/errors"
+)
+
+type (
+	resultLimit struct {
+		maxSize      int
+		summaryModel string
+	}
+
+	// LimitedToolResult replaces a tool result that exceeded the configured size limit.
+	// The full result is kept in the call data and can be paged with read_tool_result.
+	LimitedToolResult struct {
+		CallID    string `json:"call_id,omitempty" jsonschema:"description=ID of the tool call to pass to read_tool_result"`
+		Content   string `json:"content" jsonschema:"description=Truncated or summarized tool result"`
+		TotalSize int    `json:"total_size" jsonschema:"description=Size of the full result in bytes"`
+		Notice    string `json:"notice" jsonschema:"description=Explains how the result was condensed"`
+	}
+
+	ReadToolResultRequest struct {
+		CallID string `json:"call_id" jsonschema:"required,description=ID of the tool call whose result should be read"`
+		Offset int    `json:"offset,omitempty" jsonschema:"description=Byte offset to start reading from,default=0"`
+		Limit  int    `json:"limit,omitempty" jsonschema:"description=Maximum number of bytes to read"`
+	}
+
+	ReadToolResultResponse struct {
+		CallID     string `json:"call_id"`
+		Content    string `json:"content,omitempty"`
+		Offset     int    `json:"offset"`
+		NextOffset int    `json:"next_offset,omitempty"`
+		TotalSize  int    `json:"total_size"`
+		HasMore    bool   `json:"has_more"`
+		Error      string `json:"error,omitempty"`
+	}
+)
+
+const (
+	ReadToolResultToolName = "read_tool_result"
+
+	defaultResultPageSize = 64 * 1024
+	maxSummaryInputSize   = 256 * 1024
+)
+
+const resultSummarySystemPrompt = `You condense tool results for another AI assistant that called the tool.
+Keep every fact, identifier, number, name, URL and error message that could matter for the call's purpose.
+Drop repetition, boilerplate and formatting noise. Do not add commentary or information that is not in the result.`
+
+func (m *manager) newResultLimit(maxSize int, summaryModel string) resultLimit {
+	limit := resultLimit{
+		maxSize:      m.toolConfig.MaxResultSize,
+		summaryModel: m.toolConfig.ResultSummaryModel,
+	}
+	if maxSize > 0 {
+		limit.maxSize = maxSize
+	}
+	if summaryModel != "" {
+		limit.summaryModel = summaryModel
+	}
+	return limit
+}
+
+func (m *manager) resultLimitBySkill(skill entity.AgentSkillUnion) resultLimit {
+	switch skill.Type {
+	case entity.AgentSkillTypeMCP:
+		return m.newResultLimit(skill.OfMCP.MaxResultSize, skill.OfMCP.ResultSummaryModel)
+	case entity.AgentSkillTypeNative:
+		return m.newResultLimit(skill.OfNative.MaxResultSize, skill.OfNative.ResultSummaryModel)
+	}
+	return m.newResultLimit(0, "")
+}
+
+func (l resultLimit) enabled() bool {
+	return l.maxSize > 0
+}
+
+// resultText returns the text the model would read for a tool result.
+// MCP results are flattened to their text contents, everything else is JSON encoded.
+func resultText(result any) (string, error) {
+	if out, ok := result.(*mcp.CallToolResult); ok && out != nil {
+		parts := make([]string, 0, len(out.Content))
+		for _, content := range out.Content {
+			if text, ok := content.(mcp.TextContent); ok {
+				parts = append(parts, text.Text)
+				continue
+			}
+			v, err := json.Marshal(content)
+			if err != nil {
+				return "", errors.WithStack(err)
+			}
+			parts = append(parts, string(v))
+		}
+		return strings.Join(parts, "\n"), nil
+	}
+
+	v, err := json.Marshal(result)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(v), nil
+}
+
+// condenseToolResult truncates or summarizes result when it exceeds the limit.
+// It returns nil when the result fits and can be passed to the model unchanged.
+func (m *manager) condenseToolResult(ctx context.Context, limit resultLimit, callID, toolName string, arguments any, result any) (*LimitedToolResult, error) {
+	if !limit.enabled() {
+		return nil, nil
+	}
+
+	text, err := resultText(result)
+	if err != nil {
+		return nil, err
+	}
+	if len(text) <= limit.maxSize {
+		return nil, nil
+	}
+
+	condensed := &LimitedToolResult{
+		CallID:    callID,
+		TotalSize: len(text),
+	}
+
+	if limit.summaryModel != "" {
+		summary, err := m.summarizeToolResult(ctx, limit, toolName, arguments, text)
+		if err == nil {
+			condensed.Content = summary
+			condensed.Notice = fmt.Sprintf("The result of %s is %d bytes, which exceeds the limit of %d bytes, so it was summarized.", toolName, len(text), limit.maxSize)
+			if callID != "" {
+				condensed.Notice += fmt.Sprintf(" Call %s with call_id %q to read the original result.", ReadToolResultToolName, callID)
+			}
+			return condensed, nil
+		}
+		m.logger.WarnContext(ctx, "failed to summarize tool result, falling back to truncation", "tool", toolName, "error", err)
+	}
+
+	condensed.Content = truncateUTF8(text, limit.maxSize)
+	condensed.Notice = fmt.Sprintf("The result of %s is %d bytes, which exceeds the limit of %d bytes. Only the first %d bytes are shown.", toolName, len(text), limit.maxSize, len(condensed.Content))
+	if callID != "" {
+		condensed.Notice += fmt.Sprintf(" Call %s with call_id %q and offset %d to read the rest.", ReadToolResultToolName, callID, len(condensed.Content))
+	}
+
+	return condensed, nil
+}
+
+func (m *manager) summarizeToolResult(ctx context.Context, limit resultLimit, toolName string, arguments any, text string) (string, error) {
+	argumentsJson, err := json.Marshal(arguments)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Tool: %s\nArguments: %s\n\n", toolName, argumentsJson)
+	fmt.Fprintf(&prompt, "Summarize the following result in at most %d bytes.\n\n<result>\n%s\n</result>", limit.maxSize, truncateUTF8(text, maxSummaryInputSize))
+
+	summary, err := genkit.GenerateText(
+		ctx,
+		m.genkit,
+		ai.WithModelName(limit.summaryModel),
+		ai.WithSystem(resultSummarySystemPrompt),
+		ai.WithPrompt(prompt.String()),
+	)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to summarize tool result")
+	}
+
+	return truncateUTF8(strings.TrimSpace(summary), limit.maxSize), nil
+}
+
+// resultPageSize is the size of the pages read_tool_result reads the results condensed by the manager in
+func (m *manager) resultPageSize() int {
+	if m.toolConfig.MaxResultSize > 0 {
+		return m.toolConfig.MaxResultSize
+	}
+	return defaultResultPageSize
+}
+
+// registerReadToolResultTool registers read_tool_result behind its input schema, like the other tools. The tool is
+// shared by the managers of the genkit instance, so the page size comes with the call data of each result
+func (m *manager) registerReadToolResultTool() error {
+	if genkit.LookupTool(m.genkit, ReadToolResultToolName) != nil {
+		return nil
+	}
+
+	_, err := m.registerGuardedTool(ai.NewTool(
+		ReadToolResultToolName,
+		`Read the full result of an earlier tool call whose result was truncated or summarized.
+
+Use the call_id from the notice of the condensed result. Results are read in pages of limited size.
+Keep calling with next_offset while has_more is true to read the whole result.`,
+		func(ctx *ai.ToolContext, req ReadToolResultRequest) (res ReadToolResultResponse, err error) {
+			res.CallID = req.CallID
+
+			callData, ok := getCallDataById(ctx, req.CallID)
+			if !ok {
+				res.Error = fmt.Sprintf("no tool call found with call_id %q", req.CallID)
+				return res, nil
+			}
+
+			text, err := resultText(callData.Result)
+			if err != nil {
+				return res, err
+			}
+
+			pageSize := callData.pageSize
+			if pageSize <= 0 {
+				pageSize = defaultResultPageSize
+			}
+			limit := req.Limit
+			if limit <= 0 || limit > pageSize {
+				limit = pageSize
+			}
+
+			offset := min(max(req.Offset, 0), len(text))
+			for offset < len(text) && !utf8.RuneStart(text[offset]) {
+				offset++
+			}
+
+			res.Content = truncateUTF8(text[offset:], limit)
+			res.Offset = offset
+			res.TotalSize = len(text)
+			if end := offset + len(res.Content); end < len(text) {
+				res.HasMore = true
+				res.NextOffset = end
+			}
+
+			return res, nil
+		},
+	), "", nil, nil)
+	return err
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a multi-byte character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
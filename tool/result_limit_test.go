@@ -0,0 +1,145 @@
+package tool_test
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/config"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolResultLimit(t *testing.T) {
+	ctx := tool.WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	instruction := strings.Repeat("Always answer politely. ", 20)
+	toolManager, err := tool.NewToolManager(
+		ctx,
+		[]entity.AgentSkillUnion{
+			{
+				Type: entity.AgentSkillTypeLLM,
+				OfLLM: &entity.LLMAgentSkill{
+					Name:        "polite",
+					Description: "Instruction for polite answers",
+					Instruction: instruction,
+				},
+			},
+		},
+		slog.Default(),
+		g,
+		nil,
+		nil,
+		&config.ToolConfig{MaxResultSize: 64},
+	)
+	require.NoError(t, err)
+	defer toolManager.Close()
+
+	// Skills whose results can be condensed are offered read_tool_result
+	tools, err := toolManager.GetToolsBySkill(ctx, entity.AgentSkillUnion{
+		Type:  entity.AgentSkillTypeLLM,
+		OfLLM: &entity.LLMAgentSkill{Name: "polite"},
+	})
+	require.NoError(t, err)
+	require.Len(t, tools, 2)
+	require.Equal(t, tool.ReadToolResultToolName, tools[1].Name())
+
+	out, err := toolManager.GetTool("polite").RunRaw(ctx, map[string]any{})
+	require.NoError(t, err)
+
+	limited, ok := out.(map[string]any)
+	require.True(t, ok)
+	require.Equal(t, "call_1", limited["call_id"])
+	require.Len(t, limited["content"], 64)
+	require.Contains(t, limited["notice"], tool.ReadToolResultToolName)
+
+	callData := tool.GetCallData(ctx)
+	require.Len(t, callData, 1)
+	require.Equal(t, "call_1", callData[0].ID)
+
+	readTool := toolManager.GetTool(tool.ReadToolResultToolName)
+	require.NotNil(t, readTool)
+
+	var content strings.Builder
+	offset := 0
+	for {
+		page, err := readTool.RunRaw(ctx, map[string]any{
+			"call_id": "call_1",
+			"offset":  offset,
+		})
+		require.NoError(t, err)
+
+		res := page.(map[string]any)
+		require.Empty(t, res["error"])
+		content.WriteString(res["content"].(string))
+		if !res["has_more"].(bool) {
+			break
+		}
+		offset = int(res["next_offset"].(float64))
+	}
+	require.Contains(t, content.String(), instruction)
+
+	page, err := readTool.RunRaw(ctx, map[string]any{"call_id": "call_42"})
+	require.NoError(t, err)
+	require.NotEmpty(t, page.(map[string]any)["error"])
+
+	// Its arguments are checked against its input schema like the ones of the other tools
+	page, err = readTool.RunRaw(ctx, map[string]any{"call_id": 1})
+	require.NoError(t, err)
+	require.Contains(t, page.(map[string]any)["error"], "do not match the input schema")
+}
+
+func TestToolResultLimit_PageSizePerManager(t *testing.T) {
+	ctx := tool.WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	instruction := strings.Repeat("Always answer politely. ", 20)
+	newManager := func(name string, maxResultSize int) tool.Manager {
+		toolManager, err := tool.NewToolManager(
+			ctx,
+			[]entity.AgentSkillUnion{
+				{
+					Type: entity.AgentSkillTypeLLM,
+					OfLLM: &entity.LLMAgentSkill{
+						Name:        name,
+						Description: "Instruction for polite answers",
+						Instruction: instruction,
+					},
+				},
+			},
+			slog.Default(),
+			g,
+			nil,
+			nil,
+			&config.ToolConfig{MaxResultSize: maxResultSize},
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { toolManager.Close() })
+		return toolManager
+	}
+
+	// read_tool_result is shared by both managers, each result is still paged in the size of its own manager
+	first := newManager("polite", 64)
+	second := newManager("courteous", 128)
+
+	_, err := first.GetTool("polite").RunRaw(ctx, map[string]any{})
+	require.NoError(t, err)
+	_, err = second.GetTool("courteous").RunRaw(ctx, map[string]any{})
+	require.NoError(t, err)
+
+	readTool := second.GetTool(tool.ReadToolResultToolName)
+	require.NotNil(t, readTool)
+	for callID, pageSize := range map[string]int{"call_1": 64, "call_2": 128} {
+		page, err := readTool.RunRaw(ctx, map[string]any{"call_id": callID})
+		require.NoError(t, err)
+
+		res := page.(map[string]any)
+		require.Empty(t, res["error"])
+		require.Len(t, res["content"], pageSize)
+		require.True(t, res["has_more"].(bool))
+	}
+}
@@ -52,7 +52,7 @@ You can ONLY search through the following pre-configured RSS feeds:
 - Provide a search query to filter content
 - The tool searches through titles and descriptions of all feed items
 - Returns matching items along with their source URLs
-- Case-insensitive matching across title and description fields
+- Case-insensitive matching across title, description and full content fields
 - Processes feeds in parallel for faster results (30-second timeout per feed)
 
 ## Parameters
@@ -62,20 +62,28 @@ You can ONLY search through the following pre-configured RSS feeds:
   - You can include multiple URLs to search across several feeds simultaneously
   - Example: If searching for AI news and you have TechCrunch and Ars Technica in your allowed feeds, use both URLs
 - **query**: Search keyword or phrase to match *(required)*
-  - Searches in both titles and descriptions (case-insensitive)
+  - Searches in titles, descriptions and full contents (case-insensitive)
   - Example: "artificial intelligence", "ChatGPT", "machine learning"
   - Tip: Use specific terms for precise results, or broader terms to catch more articles
 - **max_items**: Maximum number of results to return *(optional)*
-  - Limits total results across all searched feeds
+  - Limits total results across all searched feeds, applied after sorting
   - Useful when searching high-volume feeds to avoid overwhelming output
   - Default: no limit (returns all matching items)
+- **since**: Only return items published at or after this date *(optional)*
+  - Format: "YYYY-MM-DD" or RFC 3339 (e.g., "2024-01-02T15:04:05Z")
+- **until**: Only return items published before this date *(optional)*
+  - Same format as since
+- **sort**: Order of the results *(optional)*
+  - "newest" or "oldest" sorts by publication date across all feeds
+  - Default: "feed" (feeds in the given order, items in the order of each feed)
+- Items published in several feeds (same GUID or link) are returned only once
 
 ## Output format
 Returns a JSON object containing:
 - **query**: The search query used
 - **results**: Array of matching items, each containing:
   - **source**: The RSS feed URL where the item was found
-  - **item**: Object with title, description, link, published date, author, and categories
+  - **item**: Object with guid, title, description, full content, link, published date, author, and categories
 - **count**: Total number of matching items found
 
 ## Best practices
@@ -84,6 +92,8 @@ Returns a JSON object containing:
 - Use specific keywords for better results
 - Include multiple relevant allowed feeds for comprehensive coverage
 - Set max_items to limit results when dealing with high-volume feeds
+- Combine sort "newest" with max_items to get the latest matching items
+- Use since to restrict results to recent items when the user asks about today's or this week's news
 - Consider using broader terms if initial search returns no results
 - If unsure which feeds to use, consider the feed descriptions and names
 
@@ -135,15 +145,24 @@ You can ONLY read from the following pre-configured RSS feeds:
   - Only one URL can be read at a time (use search_rss for multiple feeds)
 - **limit**: Maximum number of items to return *(optional)*
   - Useful for feeds with many items to avoid overwhelming output
-  - Returns the most recent items up to the limit
+  - Returns the first items in the requested order up to the limit
   - Default: no limit (returns all items in the feed)
+- **since**: Only return items published at or after this date *(optional)*
+  - Format: "YYYY-MM-DD" or RFC 3339 (e.g., "2024-01-02T15:04:05Z")
+- **until**: Only return items published before this date *(optional)*
+  - Same format as since
+- **sort**: Order of the items *(optional)*
+  - "newest" or "oldest" sorts by publication date
+  - Default: "feed" (the order of the feed)
 
 ## Output format
 Returns a JSON object containing:
 - **feed_url**: The URL of the RSS feed that was read
 - **items**: Array of all feed items, each containing:
+  - **guid**: Unique identifier of the item (if available)
   - **title**: Article/post title
   - **description**: Summary or full content
+  - **content**: Full content of the article (if the feed provides it)
   - **link**: URL to the full article
   - **published**: Publication date and time
   - **author**: Author name (if available)
@@ -153,6 +172,7 @@ Returns a JSON object containing:
 ## Best practices
 - Check the feed description to ensure it matches your information needs
 - Use the limit parameter for feeds known to have many items
+- Use sort "newest" with limit to get the latest items regardless of the feed order
 - For topic-specific content, use search_rss instead to filter by keywords
 - Consider reading multiple feeds sequentially if you need comprehensive coverage
 
@@ -177,6 +197,7 @@ func (m *manager) registerRSSSkill(skill *entity.NativeAgentSkill) error {
 	if err := mapstructure.Decode(skill.Env["allowed_feed_urls"], &allowedFeedUrls); err != nil {
 		return errors.WithStack(err)
 	}
+	reader := rss.NewRSSReaderWithClient(m.httpClient)
 
 	{
 		description := strings.Builder{}
@@ -193,7 +214,7 @@ func (m *manager) registerRSSSkill(skill *entity.NativeAgentSkill) error {
 			"search_rss",
 			description.String(),
 			skill,
-			rss.SearchRSS[*Context],
+			withToolContext(reader.SearchRSS),
 		); err != nil {
 			return err
 		}
@@ -214,7 +235,7 @@ func (m *manager) registerRSSSkill(skill *entity.NativeAgentSkill) error {
 			"read_rss",
 			description.String(),
 			skill,
-			rss.ReadRSS[*Context],
+			withToolContext(reader.ReadRSS),
 		); err != nil {
 			return err
 		}
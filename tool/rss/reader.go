@@ -3,6 +3,8 @@ package rss
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/mmcdole/gofeed"
@@ -11,32 +13,96 @@ import (
 // RSS Tool structure
 type RSSReader struct {
 	parser *gofeed.Parser
+	client *http.Client
+
+	// Feeds fetched before, revalidated with their ETag and Last-Modified headers
+	mtx   sync.Mutex
+	feeds map[string]*cachedFeed
 }
 
 // RSS item structure (format to pass to AI Agent)
 type FeedItem struct {
+	GUID        string    `json:"guid,omitempty"`
 	Title       string    `json:"title"`
 	Description string    `json:"description"`
+	Content     string    `json:"content,omitempty"`
 	Link        string    `json:"link"`
 	Published   time.Time `json:"published"`
 	Author      string    `json:"author,omitempty"`
 	Categories  []string  `json:"categories,omitempty"`
 }
 
+type cachedFeed struct {
+	etag         string
+	lastModified string
+	fetchedAt    time.Time
+	items        []FeedItem
+}
+
+// maxCachedFeeds bounds the feeds a reader keeps, the least recently fetched ones are dropped first
+const maxCachedFeeds = 256
+
 // Initialize RSS Reader
 func NewRSSReader() *RSSReader {
+	return NewRSSReaderWithClient(http.DefaultClient)
+}
+
+// Initialize RSS Reader fetching the feeds with client
+func NewRSSReaderWithClient(client *http.Client) *RSSReader {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	parser := gofeed.NewParser()
+	parser.Client = client
 	return &RSSReader{
-		parser: gofeed.NewParser(),
+		parser: parser,
+		client: client,
+		feeds:  make(map[string]*cachedFeed),
 	}
 }
 
-// Method to read feed
+// Method to read feed. Feeds read before are only downloaded again if the server reports a change
 func (r *RSSReader) ReadFeed(ctx context.Context, feedURL string) ([]FeedItem, error) {
 	// Set timeout using Context
 	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	feed, err := r.parser.ParseURLWithContext(feedURL, ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+	req.Header.Set("User-Agent", r.parser.UserAgent)
+
+	cached := r.cachedFeed(feedURL)
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse feed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		r.storeFeed(feedURL, &cachedFeed{
+			etag:         cached.etag,
+			lastModified: cached.lastModified,
+			fetchedAt:    time.Now(),
+			items:        cached.items,
+		})
+		return cached.items, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed to parse feed: %w", gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status})
+	}
+
+	feed, err := r.parser.Parse(resp.Body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse feed: %w", err)
 	}
@@ -44,15 +110,20 @@ func (r *RSSReader) ReadFeed(ctx context.Context, feedURL string) ([]FeedItem, e
 	items := make([]FeedItem, 0, len(feed.Items))
 	for _, item := range feed.Items {
 		feedItem := FeedItem{
+			GUID:        item.GUID,
 			Title:       item.Title,
 			Description: item.Description,
-			Link:        item.Link,
-			Categories:  item.Categories,
+			// content:encoded of RSS and content of Atom feeds
+			Content:    item.Content,
+			Link:       item.Link,
+			Categories: item.Categories,
 		}
 
 		// Parse publication time
 		if item.PublishedParsed != nil {
 			feedItem.Published = *item.PublishedParsed
+		} else if item.UpdatedParsed != nil {
+			feedItem.Published = *item.UpdatedParsed
 		}
 
 		// Author information
@@ -63,37 +134,74 @@ func (r *RSSReader) ReadFeed(ctx context.Context, feedURL string) ([]FeedItem, e
 		items = append(items, feedItem)
 	}
 
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != "" || lastModified != "" {
+		r.storeFeed(feedURL, &cachedFeed{
+			etag:         etag,
+			lastModified: lastModified,
+			fetchedAt:    time.Now(),
+			items:        items,
+		})
+	}
+
 	return items, nil
 }
 
+func (r *RSSReader) cachedFeed(feedURL string) *cachedFeed {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.feeds[feedURL]
+}
+
+func (r *RSSReader) storeFeed(feedURL string, feed *cachedFeed) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	r.feeds[feedURL] = feed
+	if len(r.feeds) <= maxCachedFeeds {
+		return
+	}
+
+	oldestURL := ""
+	for url, cached := range r.feeds {
+		if oldestURL == "" || cached.fetchedAt.Before(r.feeds[oldestURL].fetchedAt) {
+			oldestURL = url
+		}
+	}
+	delete(r.feeds, oldestURL)
+}
+
+type feedResult struct {
+	url   string
+	items []FeedItem
+	err   error
+}
+
+// readFeeds reads the feeds in parallel and returns the results in the order of feedURLs
+func (r *RSSReader) readFeeds(ctx context.Context, feedURLs []string) []feedResult {
+	results := make([]feedResult, len(feedURLs))
+
+	var wg sync.WaitGroup
+	for i, url := range feedURLs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items, err := r.ReadFeed(ctx, url)
+			results[i] = feedResult{url: url, items: items, err: err}
+		}()
+	}
+	wg.Wait()
+
+	return results
+}
+
 // Read multiple feeds simultaneously
 func (r *RSSReader) ReadMultipleFeeds(ctx context.Context, feedURLs []string) map[string][]FeedItem {
 	results := make(map[string][]FeedItem)
-	ch := make(chan struct {
-		url   string
-		items []FeedItem
-		err   error
-	}, len(feedURLs))
-
-	// Parallel processing with goroutines
-	for _, url := range feedURLs {
-		go func(feedURL string) {
-			items, err := r.ReadFeed(ctx, feedURL)
-			ch <- struct {
-				url   string
-				items []FeedItem
-				err   error
-			}{url: feedURL, items: items, err: err}
-		}(url)
-	}
-
-	// Collect results
-	for i := 0; i < len(feedURLs); i++ {
-		result := <-ch
+	for _, result := range r.readFeeds(ctx, feedURLs) {
 		if result.err == nil {
 			results[result.url] = result.items
 		}
 	}
-
 	return results
 }
@@ -2,8 +2,10 @@ package rss_test
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -259,3 +261,69 @@ func TestRSSReader_ReadFeed_EmptyFeed(t *testing.T) {
 	require.NoError(t, err)
 	assert.Empty(t, feed)
 }
+
+func TestRSSReader_ReadFeed_NotModified(t *testing.T) {
+	var requests, downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		downloads.Add(1)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		if _, err := w.Write([]byte(mockRSSFeed)); err != nil {
+			t.Logf("failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	reader := rss.NewRSSReader()
+	ctx := context.Background()
+
+	first, err := reader.ReadFeed(ctx, server.URL)
+	require.NoError(t, err)
+	second, err := reader.ReadFeed(ctx, server.URL)
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), requests.Load())
+	assert.Equal(t, int32(1), downloads.Load())
+	assert.Equal(t, first, second)
+
+	// Another reader has no cached copy to revalidate
+	_, err = rss.NewRSSReader().ReadFeed(ctx, server.URL)
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), downloads.Load())
+}
+
+func TestRSSReader_ReadMultipleFeeds_Parallel(t *testing.T) {
+	// Every request waits until all feeds were requested, which only completes when they are fetched concurrently
+	const feeds = 3
+	var requested atomic.Int32
+	allRequested := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requested.Add(1) == feeds {
+			close(allRequested)
+		}
+		select {
+		case <-allRequested:
+		case <-time.After(5 * time.Second):
+			w.WriteHeader(http.StatusGatewayTimeout)
+			return
+		}
+		w.Header().Set("Content-Type", "application/rss+xml")
+		if _, err := w.Write([]byte(mockRSSFeed)); err != nil {
+			t.Logf("failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	urls := make([]string, feeds)
+	for i := range urls {
+		urls[i] = fmt.Sprintf("%s/feed%d", server.URL, i)
+	}
+
+	results := rss.NewRSSReader().ReadMultipleFeeds(context.Background(), urls)
+	assert.Len(t, results, feeds)
+}
@@ -2,37 +2,78 @@ package rss
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Define tool parameters
 type ReadRSSParams struct {
 	URL   string `json:"url" description:"RSS feed URL to read"`
 	Limit *int   `json:"limit,omitempty" description:"Maximum number of items to return (default: no limit)"`
+	ItemFilter
 }
 
 type SearchRSSParams struct {
 	URLs     []string `json:"urls" description:"List of RSS feed URLs to search"`
 	Query    string   `json:"query" description:"Search query"`
 	MaxItems *int     `json:"max_items,omitempty" description:"Maximum items per feed (default: no limit)"`
+	ItemFilter
 }
 
+// ItemFilter selects and orders the items of feeds by their publication date
+type ItemFilter struct {
+	Since string `json:"since,omitempty" description:"Only items published at or after this date, YYYY-MM-DD or RFC 3339"`
+	Until string `json:"until,omitempty" description:"Only items published before this date, YYYY-MM-DD or RFC 3339"`
+	Sort  string `json:"sort,omitempty" description:"Order of the items: newest, oldest or feed (default: feed order)"`
+}
+
+const (
+	SortFeed   = "feed"
+	SortNewest = "newest"
+	SortOldest = "oldest"
+)
+
 type SearchRSSResult struct {
 	Source string   `json:"source" description:"Source URL of the RSS feed"`
 	Item   FeedItem `json:"item" description:"Item from the RSS feed"`
 }
 
-// Read single RSS feed
-func ReadRSS[ctxT context.Context](ctx ctxT, params ReadRSSParams) (reply struct {
+type ReadRSSReply struct {
 	FeedURL string     `json:"feed_url" description:"URL of the RSS feed"`
 	Items   []FeedItem `json:"items" description:"RSS feed items"`
 	Count   int        `json:"count" description:"Number of items in the RSS feed"`
-}, err error) {
-	reader := NewRSSReader()
-	reply.Items, err = reader.ReadFeed(ctx, params.URL)
+}
+
+type SearchRSSReply struct {
+	Query   string            `json:"query" description:"Search query"`
+	Results []SearchRSSResult `json:"results" description:"List of items from the RSS feeds"`
+	Count   int               `json:"count" description:"Number of items in the RSS feeds"`
+}
+
+// Read single RSS feed with the default reader
+func ReadRSS[ctxT context.Context](ctx ctxT, params ReadRSSParams) (ReadRSSReply, error) {
+	return NewRSSReader().ReadRSS(ctx, params)
+}
+
+// Search in multiple RSS feeds with the default reader
+func SearchRSS[ctxT context.Context](ctx ctxT, params SearchRSSParams) (SearchRSSReply, error) {
+	return NewRSSReader().SearchRSS(ctx, params)
+}
+
+// Read single RSS feed
+func (r *RSSReader) ReadRSS(ctx context.Context, params ReadRSSParams) (reply ReadRSSReply, err error) {
+	filter, err := params.ItemFilter.compile()
+	if err != nil {
+		return reply, err
+	}
+
+	items, err := r.ReadFeed(ctx, params.URL)
 	if err != nil {
 		return
 	}
+	reply.Items = filter.apply(dedupeItems(items, map[string]bool{}))
 
 	limit := 0
 	if params.Limit != nil {
@@ -51,44 +92,49 @@ func ReadRSS[ctxT context.Context](ctx ctxT, params ReadRSSParams) (reply struct
 }
 
 // Search in multiple RSS feeds
-func SearchRSS[ctxT context.Context](ctx ctxT, params SearchRSSParams) (reply struct {
-	Query   string            `json:"query" description:"Search query"`
-	Results []SearchRSSResult `json:"results" description:"List of items from the RSS feeds"`
-	Count   int               `json:"count" description:"Number of items in the RSS feeds"`
-}, err error) {
-	reader := NewRSSReader()
+func (r *RSSReader) SearchRSS(ctx context.Context, params SearchRSSParams) (reply SearchRSSReply, err error) {
+	filter, err := params.ItemFilter.compile()
+	if err != nil {
+		return reply, err
+	}
 
 	maxItems := 0
 	if params.MaxItems != nil {
 		maxItems = *params.MaxItems
 	}
 
+	// Items published in several feeds are only returned from the first one
+	seen := map[string]bool{}
 	reply.Results = make([]SearchRSSResult, 0, maxItems)
-	for _, url := range params.URLs {
-		items, err := reader.ReadFeed(ctx, url)
-		if err != nil {
+	for _, result := range r.readFeeds(ctx, params.URLs) {
+		if result.err != nil {
 			continue // Move to next feed if error occurs
 		}
 
-		// Filter by search query
-		stopLoop := false
-		for _, item := range items {
-			if maxItems > 0 && len(reply.Results) >= maxItems {
-				stopLoop = true
-				break
-			}
-
-			if containsQuery(item, params.Query) {
+		for _, item := range dedupeItems(result.items, seen) {
+			if containsQuery(item, params.Query) && filter.matches(item) {
 				reply.Results = append(reply.Results, SearchRSSResult{
-					Source: url,
+					Source: result.url,
 					Item:   item,
 				})
 			}
 		}
+	}
 
-		if stopLoop {
-			break
+	if filter.sort != SortFeed {
+		items := make([]FeedItem, len(reply.Results))
+		for i, result := range reply.Results {
+			items[i] = result.Item
+		}
+		order := filter.order(items)
+		sorted := make([]SearchRSSResult, len(order))
+		for i, idx := range order {
+			sorted[i] = reply.Results[idx]
 		}
+		reply.Results = sorted
+	}
+	if maxItems > 0 && len(reply.Results) > maxItems {
+		reply.Results = reply.Results[:maxItems]
 	}
 
 	reply.Query = params.Query
@@ -100,5 +146,109 @@ func SearchRSS[ctxT context.Context](ctx ctxT, params SearchRSSParams) (reply st
 func containsQuery(item FeedItem, query string) bool {
 	query = strings.ToLower(query)
 	return strings.Contains(strings.ToLower(item.Title), query) ||
-		strings.Contains(strings.ToLower(item.Description), query)
+		strings.Contains(strings.ToLower(item.Description), query) ||
+		strings.Contains(strings.ToLower(item.Content), query)
+}
+
+// dedupeItems drops the items whose GUID or link is in seen and adds the others to it
+func dedupeItems(items []FeedItem, seen map[string]bool) []FeedItem {
+	result := make([]FeedItem, 0, len(items))
+	for _, item := range items {
+		keys := make([]string, 0, 2)
+		if item.GUID != "" {
+			keys = append(keys, "guid:"+item.GUID)
+		}
+		if item.Link != "" {
+			keys = append(keys, "link:"+item.Link)
+		}
+		if slices.ContainsFunc(keys, func(key string) bool { return seen[key] }) {
+			continue
+		}
+		for _, key := range keys {
+			seen[key] = true
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+type itemFilter struct {
+	since, until time.Time
+	sort         string
+}
+
+func (f ItemFilter) compile() (filter itemFilter, err error) {
+	if filter.since, err = parseFilterDate(f.Since); err != nil {
+		return filter, fmt.Errorf("invalid since: %w", err)
+	}
+	if filter.until, err = parseFilterDate(f.Until); err != nil {
+		return filter, fmt.Errorf("invalid until: %w", err)
+	}
+
+	switch f.Sort {
+	case "", SortFeed:
+		filter.sort = SortFeed
+	case SortNewest, SortOldest:
+		filter.sort = f.Sort
+	default:
+		return filter, fmt.Errorf("invalid sort %q, expected newest, oldest or feed", f.Sort)
+	}
+	return filter, nil
+}
+
+func parseFilterDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, value)
+}
+
+// matches reports whether the item was published within the range. Items without a date only match unbounded ranges
+func (f itemFilter) matches(item FeedItem) bool {
+	if !f.since.IsZero() && (item.Published.IsZero() || item.Published.Before(f.since)) {
+		return false
+	}
+	if !f.until.IsZero() && (item.Published.IsZero() || !item.Published.Before(f.until)) {
+		return false
+	}
+	return true
+}
+
+// apply filters and sorts the items
+func (f itemFilter) apply(items []FeedItem) []FeedItem {
+	filtered := make([]FeedItem, 0, len(items))
+	for _, item := range items {
+		if f.matches(item) {
+			filtered = append(filtered, item)
+		}
+	}
+
+	result := make([]FeedItem, len(filtered))
+	for i, idx := range f.order(filtered) {
+		result[i] = filtered[idx]
+	}
+	return result
+}
+
+// order returns the indices of the items in the order of the filter, keeping the feed order among equal dates
+func (f itemFilter) order(items []FeedItem) []int {
+	indices := make([]int, len(items))
+	for i := range indices {
+		indices[i] = i
+	}
+	if f.sort == SortFeed {
+		return indices
+	}
+
+	slices.SortStableFunc(indices, func(a, b int) int {
+		cmp := items[a].Published.Compare(items[b].Published)
+		if f.sort == SortNewest {
+			return -cmp
+		}
+		return cmp
+	})
+	return indices
 }
@@ -272,3 +272,97 @@ func TestSearchRSS_EmptyURLs(t *testing.T) {
 	assert.Equal(t, 0, result.Count)
 	assert.Empty(t, result.Results)
 }
+
+func TestReadRSS_SinceUntilSort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		if _, err := w.Write([]byte(mockRSSFeedForTool)); err != nil {
+			t.Logf("failed to write response: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	limit := 1
+	result, err := rss.ReadRSS(ctx, rss.ReadRSSParams{
+		URL:   server.URL,
+		Limit: &limit,
+		ItemFilter: rss.ItemFilter{
+			Since: "2024-01-02",
+			Sort:  rss.SortNewest,
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Items, 1)
+	assert.Equal(t, "Database Performance Optimization", result.Items[0].Title)
+
+	result, err = rss.ReadRSS(ctx, rss.ReadRSSParams{
+		URL: server.URL,
+		ItemFilter: rss.ItemFilter{
+			Since: "2024-01-02T00:00:00Z",
+			Until: "2024-01-03",
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Items, 1)
+	assert.Equal(t, "New Programming Language Released", result.Items[0].Title)
+
+	_, err = rss.ReadRSS(ctx, rss.ReadRSSParams{URL: server.URL, ItemFilter: rss.ItemFilter{Since: "yesterday"}})
+	assert.Error(t, err)
+	_, err = rss.ReadRSS(ctx, rss.ReadRSSParams{URL: server.URL, ItemFilter: rss.ItemFilter{Sort: "random"}})
+	assert.Error(t, err)
+}
+
+func TestSearchRSS_SortAndDedupe(t *testing.T) {
+	server1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		if _, err := w.Write([]byte(mockRSSFeedForTool)); err != nil {
+			t.Logf("failed to write response: %v", err)
+		}
+	}))
+	defer server1.Close()
+
+	// Republishes an item of the first feed next to its own one
+	server2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		if _, err := w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/">
+  <channel>
+    <title>Aggregator</title>
+    <item>
+      <title>AI Breakthrough in Machine Learning (repost)</title>
+      <link>https://technews.com/ai-breakthrough</link>
+      <description>Reposted</description>
+      <pubDate>Sat, 06 Jan 2024 12:00:00 GMT</pubDate>
+    </item>
+    <item>
+      <guid>aggregator-1</guid>
+      <title>Weekly roundup</title>
+      <link>https://aggregator.com/roundup</link>
+      <description>The news of the week</description>
+      <content:encoded><![CDATA[<p>Advances in machine learning dominated the week</p>]]></content:encoded>
+      <pubDate>Sun, 07 Jan 2024 12:00:00 GMT</pubDate>
+    </item>
+  </channel>
+</rss>`)); err != nil {
+			t.Logf("failed to write response: %v", err)
+		}
+	}))
+	defer server2.Close()
+
+	result, err := rss.SearchRSS(context.Background(), rss.SearchRSSParams{
+		URLs:       []string{server1.URL, server2.URL},
+		Query:      "machine learning",
+		ItemFilter: rss.ItemFilter{Sort: rss.SortNewest},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, result.Count)
+
+	// The roundup only matches in its full content
+	assert.Equal(t, "Weekly roundup", result.Results[0].Item.Title)
+	assert.Equal(t, "aggregator-1", result.Results[0].Item.GUID)
+	assert.Contains(t, result.Results[0].Item.Content, "Advances in machine learning")
+	assert.Equal(t, server2.URL, result.Results[0].Source)
+	assert.Equal(t, "AI Breakthrough in Machine Learning", result.Results[1].Item.Title)
+	assert.Equal(t, server1.URL, result.Results[1].Source)
+}
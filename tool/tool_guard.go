@@ -0,0 +1,329 @@
+package tool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/firebase/genkit/go/ai"
+	"github.com/firebase/genkit/go/core/api"
+	"github.com/firebase/genkit/go/genkit"
+	"github.com/habiliai/agentruntime/audit"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/pkg/errors"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+type (
+	// guardedAction is registered in place of the action of a tool. It checks the arguments against the
+	// input schema and the policies of the skill before the tool runs. Rejected calls are answered with a
+	// ToolArgumentError, so the model can correct its arguments instead of the whole generation failing.
+	// Every call, including the rejected ones, is recorded to the audit log.
+	guardedAction struct {
+		// target is replaced when an MCP server changes the definition of the tool
+		target atomic.Pointer[guardedTarget]
+		// outputSchema replaces the output schema of the wrapped tool, if it is set
+		outputSchema map[string]any
+		policies     []toolPolicy
+		server       string
+		auditor      *audit.Auditor
+	}
+
+	// guardedTarget is the wrapped action of a guardedAction and its compiled input schema
+	guardedTarget struct {
+		action api.Action
+		schema *gojsonschema.Schema
+	}
+
+	// ToolArgumentError is the result of a tool call rejected before it ran
+	ToolArgumentError struct {
+		Error string `json:"error"`
+	}
+
+	// toolPolicy is the compiled form of an entity.AgentSkillToolPolicy
+	toolPolicy struct {
+		tool         string
+		argument     string
+		allow        []*regexp.Regexp
+		deny         []*regexp.Regexp
+		pathPrefixes []string
+		max          *float64
+	}
+)
+
+// compileToolPolicies compiles the argument policies of a skill
+func compileToolPolicies(policies []entity.AgentSkillToolPolicy) ([]toolPolicy, error) {
+	compiled := make([]toolPolicy, 0, len(policies))
+	for _, policy := range policies {
+		if policy.Argument == "" {
+			return nil, errors.New("argument of tool policy is required")
+		}
+
+		p := toolPolicy{
+			tool:     policy.Tool,
+			argument: policy.Argument,
+			max:      policy.Max,
+		}
+		for _, pattern := range policy.Allow {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid allow pattern of tool policy for argument %s", policy.Argument)
+			}
+			p.allow = append(p.allow, re)
+		}
+		for _, pattern := range policy.Deny {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid deny pattern of tool policy for argument %s", policy.Argument)
+			}
+			p.deny = append(p.deny, re)
+		}
+		for _, prefix := range policy.PathPrefixes {
+			p.pathPrefixes = append(p.pathPrefixes, path.Clean(prefix))
+		}
+		compiled = append(compiled, p)
+	}
+	return compiled, nil
+}
+
+// toolPoliciesFor returns the policies applying to the tool
+func toolPoliciesFor(policies []toolPolicy, toolName string) []toolPolicy {
+	var result []toolPolicy
+	for _, policy := range policies {
+		if policy.tool == "" || policy.tool == toolName {
+			result = append(result, policy)
+		}
+	}
+	return result
+}
+
+// check returns an error if a value of the argument violates the policy. Missing arguments are left to the schema.
+func (p toolPolicy) check(args map[string]any) error {
+	var value any = args
+	for _, key := range strings.Split(p.argument, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if value, ok = object[key]; !ok {
+			return nil
+		}
+	}
+
+	values, ok := value.([]any)
+	if !ok {
+		values = []any{value}
+	}
+	for _, value := range values {
+		if err := p.checkValue(value); err != nil {
+			return errors.Wrapf(err, "argument %s is not allowed", p.argument)
+		}
+	}
+	return nil
+}
+
+func (p toolPolicy) checkValue(value any) error {
+	text := fmt.Sprint(value)
+	if str, ok := value.(string); ok {
+		text = str
+	}
+
+	if len(p.allow) > 0 {
+		allowed := false
+		for _, re := range p.allow {
+			if re.MatchString(text) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return errors.Errorf("%q matches none of the allowed patterns", text)
+		}
+	}
+	for _, re := range p.deny {
+		if re.MatchString(text) {
+			return errors.Errorf("%q matches the denied pattern %s", text, re)
+		}
+	}
+
+	if len(p.pathPrefixes) > 0 {
+		str, ok := value.(string)
+		if !ok {
+			return errors.Errorf("%v is not a path", value)
+		}
+		cleaned := path.Clean(str)
+		within := false
+		for _, prefix := range p.pathPrefixes {
+			if cleaned == prefix || strings.HasPrefix(cleaned, strings.TrimSuffix(prefix, "/")+"/") {
+				within = true
+				break
+			}
+		}
+		if !within {
+			return errors.Errorf("%s is outside of %s", str, strings.Join(p.pathPrefixes, ", "))
+		}
+	}
+
+	if p.max != nil {
+		number, ok := value.(float64)
+		if !ok {
+			return errors.Errorf("%v is not a number", value)
+		}
+		if number > *p.max {
+			return errors.Errorf("%v exceeds the maximum of %v", number, *p.max)
+		}
+	}
+
+	return nil
+}
+
+// registerGuardedTool registers t, which must not be registered yet, behind its input schema and the given policies.
+// server is the MCP server of the tool recorded in the audit log, empty for other tools. outputSchema replaces the
+// output schema of t if it is not nil
+func (m *manager) registerGuardedTool(t ai.Tool, server string, policies []toolPolicy, outputSchema map[string]any) (ai.Tool, error) {
+	if _, err := m.defineGuardedAction(t, server, policies, outputSchema); err != nil {
+		return nil, err
+	}
+	return genkit.LookupTool(m.genkit, t.Name()), nil
+}
+
+// defineGuardedAction is registerGuardedTool returning the registered action, so that its tool can be replaced
+func (m *manager) defineGuardedAction(t ai.Tool, server string, policies []toolPolicy, outputSchema map[string]any) (*guardedAction, error) {
+	guarded := &guardedAction{
+		outputSchema: outputSchema,
+		policies:     policies,
+		server:       server,
+		auditor:      m.auditor,
+	}
+	if err := guarded.replace(t); err != nil {
+		return nil, err
+	}
+
+	genkit.RegisterAction(m.genkit, guarded)
+	return guarded, nil
+}
+
+// replace makes the guarded action run t, which must have the same name as the tool it replaces
+func (a *guardedAction) replace(t ai.Tool) error {
+	action, ok := t.(api.Action)
+	if !ok {
+		return errors.Errorf("tool %s is not an action", t.Name())
+	}
+
+	target := &guardedTarget{action: action}
+	if inputSchema := action.Desc().InputSchema; inputSchema != nil {
+		schema, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(inputSchema))
+		if err != nil {
+			return errors.Wrapf(err, "invalid input schema of tool %s", t.Name())
+		}
+		target.schema = schema
+	}
+	a.target.Store(target)
+	return nil
+}
+
+func (a *guardedAction) Register(r api.Registry) {
+	r.RegisterAction(a.Desc().Key, a)
+}
+
+func (a *guardedAction) Name() string {
+	return a.target.Load().action.Name()
+}
+
+// Desc returns the descriptor of the wrapped tool, which is registered like any other tool
+func (a *guardedAction) Desc() api.ActionDesc {
+	desc := a.target.Load().action.Desc()
+	desc.Metadata = maps.Clone(desc.Metadata)
+	delete(desc.Metadata, "dynamic")
+	if a.outputSchema != nil {
+		desc.OutputSchema = a.outputSchema
+	}
+	return desc
+}
+
+func (a *guardedAction) RunJSON(ctx context.Context, input json.RawMessage, cb func(context.Context, json.RawMessage) error) (json.RawMessage, error) {
+	target := a.target.Load()
+	if rejected, err := a.check(ctx, target, input); rejected != nil || err != nil {
+		return rejected, err
+	}
+
+	startedAt := time.Now()
+	out, err := target.action.RunJSON(ctx, input, cb)
+	a.auditor.RecordCall(ctx, a.Name(), a.server, input, out, err, startedAt)
+	return out, err
+}
+
+func (a *guardedAction) RunJSONWithTelemetry(ctx context.Context, input json.RawMessage, cb func(context.Context, json.RawMessage) error) (*api.ActionRunResult[json.RawMessage], error) {
+	target := a.target.Load()
+	if rejected, err := a.check(ctx, target, input); rejected != nil || err != nil {
+		return &api.ActionRunResult[json.RawMessage]{Result: rejected}, err
+	}
+
+	startedAt := time.Now()
+	result, err := target.action.RunJSONWithTelemetry(ctx, input, cb)
+	var out json.RawMessage
+	if result != nil {
+		out = result.Result
+	}
+	a.auditor.RecordCall(ctx, a.Name(), a.server, input, out, err, startedAt)
+	return result, err
+}
+
+// check returns the result to answer the call with if the input is rejected
+func (a *guardedAction) check(ctx context.Context, target *guardedTarget, input json.RawMessage) (json.RawMessage, error) {
+	var args any = map[string]any{}
+	if len(input) > 0 && string(input) != "null" {
+		if err := json.Unmarshal(input, &args); err != nil {
+			return a.reject(ctx, string(input), errors.Wrapf(err, "arguments are not valid JSON"))
+		}
+	}
+
+	if target.schema != nil {
+		result, err := target.schema.Validate(gojsonschema.NewGoLoader(args))
+		if err != nil {
+			return a.reject(ctx, args, errors.Wrapf(err, "failed to validate arguments"))
+		}
+		if !result.Valid() {
+			violations := make([]string, 0, len(result.Errors()))
+			for _, violation := range result.Errors() {
+				violations = append(violations, violation.String())
+			}
+			return a.reject(ctx, args, errors.Errorf("arguments do not match the input schema: %s", strings.Join(violations, "; ")))
+		}
+	}
+
+	if object, ok := args.(map[string]any); ok {
+		for _, policy := range a.policies {
+			if err := policy.check(object); err != nil {
+				return a.reject(ctx, args, err)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+func (a *guardedAction) reject(ctx context.Context, args any, reason error) (json.RawMessage, error) {
+	response := ToolArgumentError{
+		Error: fmt.Sprintf("tool %s was not called: %s. Fix the arguments and try again", a.Name(), reason),
+	}
+	appendCallData(ctx, CallData{
+		Name:      a.Name(),
+		Arguments: args,
+		Result:    response,
+	})
+
+	input, err := json.Marshal(args)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	a.auditor.RecordCall(ctx, a.Name(), a.server, input, nil, errors.New(response.Error), time.Now())
+
+	return json.Marshal(response)
+}
@@ -0,0 +1,169 @@
+package tool
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/habiliai/agentruntime/audit"
+	"github.com/habiliai/agentruntime/entity"
+	"github.com/habiliai/agentruntime/internal/genkit"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/stretchr/testify/require"
+)
+
+type testReadFileRequest struct {
+	Path  string `json:"path" jsonschema:"required"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+func TestToolArgumentGuard(t *testing.T) {
+	ctx := WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	maxLimit := 100.0
+	skill := &entity.NativeAgentSkill{
+		Name: "files",
+		Policies: []entity.AgentSkillToolPolicy{
+			{Tool: "read_file", Argument: "path", PathPrefixes: []string{"/data"}, Deny: []string{`\.env$`}},
+			{Argument: "limit", Max: &maxLimit},
+		},
+	}
+	calls := 0
+	readFile, err := registerLocalTool(m, "read_file", "Read a file", skill, func(ctx *Context, req testReadFileRequest) (string, error) {
+		calls++
+		return "content of " + req.Path, nil
+	})
+	require.NoError(t, err)
+
+	out, err := readFile.RunRaw(ctx, map[string]any{"path": "/data/notes.txt", "limit": 10})
+	require.NoError(t, err)
+	require.Equal(t, "content of /data/notes.txt", out)
+	require.Equal(t, 1, calls)
+
+	for name, args := range map[string]map[string]any{
+		"missing required argument": {"limit": 10},
+		"wrong type":                {"path": 42},
+		"outside of path prefixes":  {"path": "/data/../etc/passwd"},
+		"denied pattern":            {"path": "/data/.env"},
+		"over the maximum":          {"path": "/data/notes.txt", "limit": 1000},
+	} {
+		t.Run(name, func(t *testing.T) {
+			out, err := readFile.RunRaw(ctx, args)
+			require.NoError(t, err)
+			require.Contains(t, out.(map[string]any)["error"], "read_file was not called")
+			require.Equal(t, 1, calls)
+		})
+	}
+
+	_, err = registerLocalTool(m, "broken", "Broken policies", &entity.NativeAgentSkill{
+		Name:     "broken",
+		Policies: []entity.AgentSkillToolPolicy{{Argument: "path", Allow: []string{"("}}},
+	}, func(ctx *Context, req testReadFileRequest) (string, error) {
+		return "", nil
+	})
+	require.ErrorContains(t, err, "invalid allow pattern")
+
+	// The tool keeps the output schema of its results, which may be condensed
+	require.Contains(t, readFile.Definition().OutputSchema["anyOf"], map[string]any{"type": "string"})
+
+	// Skills sharing a tool must share its settings, as the tool is registered once
+	_, err = registerLocalTool(m, "read_file", "Read a file", &entity.NativeAgentSkill{
+		Name:     "other_files",
+		Policies: skill.Policies,
+	}, func(ctx *Context, req testReadFileRequest) (string, error) {
+		return "", nil
+	})
+	require.NoError(t, err)
+	_, err = registerLocalTool(m, "read_file", "Read a file", &entity.NativeAgentSkill{
+		Name:          "large_files",
+		Policies:      skill.Policies,
+		MaxResultSize: 1024,
+	}, func(ctx *Context, req testReadFileRequest) (string, error) {
+		return "", nil
+	})
+	require.ErrorContains(t, err, "already registered by another skill")
+}
+
+func TestToolAudit(t *testing.T) {
+	sink, err := audit.NewJSONLSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+	require.NoError(t, err)
+	defer sink.Close()
+
+	ctx := WithEmptyCallDataStore(context.Background())
+	ctx = audit.WithRunInfo(ctx, audit.RunInfo{RunID: "run-1", Agent: "alice", Thread: "3"})
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil, WithAuditor(audit.NewAuditor(sink, nil, nil)))
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	skill := &entity.NativeAgentSkill{
+		Name:     "files",
+		Policies: []entity.AgentSkillToolPolicy{{Tool: "read_file", Argument: "path", PathPrefixes: []string{"/data"}}},
+	}
+	readFile, err := registerLocalTool(m, "read_file", "Read a file", skill, func(ctx *Context, req testReadFileRequest) (string, error) {
+		return "content of " + req.Path, nil
+	})
+	require.NoError(t, err)
+
+	_, err = readFile.RunRaw(ctx, map[string]any{"path": "/data/notes.txt"})
+	require.NoError(t, err)
+	_, err = readFile.RunRaw(ctx, map[string]any{"path": "/etc/passwd"})
+	require.NoError(t, err)
+
+	records, err := sink.Query(context.Background(), audit.Filter{RunID: "run-1"})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+
+	rejected, succeeded := records[0], records[1]
+	if rejected.Error == "" {
+		rejected, succeeded = succeeded, rejected
+	}
+	require.Equal(t, "read_file", succeeded.Tool)
+	require.Equal(t, "alice", succeeded.Agent)
+	require.Equal(t, "3", succeeded.Thread)
+	require.Empty(t, succeeded.Server)
+	require.JSONEq(t, `{"path":"/data/notes.txt"}`, string(succeeded.Arguments))
+	require.NotEmpty(t, succeeded.ResultDigest)
+	require.Empty(t, succeeded.Error)
+	require.Contains(t, rejected.Error, "path")
+	require.Empty(t, rejected.ResultDigest)
+}
+
+func TestMCPToolArgumentGuard(t *testing.T) {
+	ctx := WithEmptyCallDataStore(context.Background())
+	g := genkit.NewGenkit(ctx, nil, slog.Default(), false)
+
+	toolManager, err := NewToolManager(ctx, nil, slog.Default(), g, nil, nil, nil)
+	require.NoError(t, err)
+	defer toolManager.Close()
+	m := toolManager.(*manager)
+
+	policies, err := compileToolPolicies([]entity.AgentSkillToolPolicy{
+		{Tool: "echo", Argument: "text", Allow: []string{"^hello"}},
+	})
+	require.NoError(t, err)
+	s := newTestInProcessMCPServer()
+	m.addMCPServer(ctx, RegisterMCPToolRequest{ServerID: "docs", policies: policies}, MCPServerConfig{}, func(context.Context) (*mcpclient.Client, error) {
+		return mcpclient.NewInProcessClient(s)
+	})
+
+	echo := m.GetMCPTool("docs", "docs__echo")
+	require.NotNil(t, echo)
+
+	out, err := echo.RunRaw(ctx, map[string]any{"text": "hello world"})
+	require.NoError(t, err)
+	require.Contains(t, out.(map[string]any)["content"], map[string]any{"type": "text", "text": "hello world"})
+
+	out, err = echo.RunRaw(ctx, map[string]any{"text": "goodbye"})
+	require.NoError(t, err)
+	require.Contains(t, out.(map[string]any)["error"], "matches none of the allowed patterns")
+}
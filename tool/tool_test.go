@@ -56,6 +56,7 @@ func (s *TestSuite) SetupTest() {
 		g,
 		nil,
 		nil,
+		nil,
 	)
 	s.Require().NoError(err)
 
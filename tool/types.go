@@ -1,6 +1,8 @@
 package tool
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"regexp"
 	"time"
 )
@@ -35,6 +37,36 @@ type MCPServerConfig struct {
 	// Connection settings
 	Timeout           time.Duration `json:"timeout,omitempty" yaml:"timeout,omitempty"`
 	KeepAliveInterval time.Duration `json:"keepAliveInterval,omitempty" yaml:"keepAliveInterval,omitempty"`
+
+	// Resilience settings
+	// MaxRetries is the number of retries for failed calls of idempotent or read-only tools
+	MaxRetries int `json:"maxRetries,omitempty" yaml:"maxRetries,omitempty"`
+	// RetryBackoff is the delay before the first retry, doubled on every further retry
+	RetryBackoff time.Duration `json:"retryBackoff,omitempty" yaml:"retryBackoff,omitempty"`
+	// CircuitBreakerThreshold is the number of consecutive failures after which the server is marked unhealthy
+	CircuitBreakerThreshold int `json:"circuitBreakerThreshold,omitempty" yaml:"circuitBreakerThreshold,omitempty"`
+	// CircuitBreakerCooldown is how long an unhealthy server is skipped before it is tried again
+	CircuitBreakerCooldown time.Duration `json:"circuitBreakerCooldown,omitempty" yaml:"circuitBreakerCooldown,omitempty"`
+
+	// Sampling lets the server request completions from the agent's models.
+	// Only stdio servers are supported since the remote transports cannot receive requests from the server.
+	Sampling *MCPSamplingConfig `json:"sampling,omitempty" yaml:"sampling,omitempty"`
+
+	// Connection lifecycle settings
+	// ReconnectBackoff is the delay before the first reconnection attempt, doubled on every further attempt
+	ReconnectBackoff time.Duration `json:"reconnectBackoff,omitempty" yaml:"reconnectBackoff,omitempty"`
+	// MaxReconnectBackoff caps the delay between reconnection attempts
+	MaxReconnectBackoff time.Duration `json:"maxReconnectBackoff,omitempty" yaml:"maxReconnectBackoff,omitempty"`
+}
+
+// MCPSamplingConfig limits the completions an MCP server may request
+type MCPSamplingConfig struct {
+	// Models are the models the server may use, from most to least capable. The first one is the default
+	Models []string `json:"models" yaml:"models"`
+	// MaxTokens caps the output tokens of a single request
+	MaxTokens int `json:"maxTokens,omitempty" yaml:"maxTokens,omitempty"`
+	// MaxTotalTokens caps the tokens the server may use over the lifetime of the tool manager
+	MaxTotalTokens int `json:"maxTotalTokens,omitempty" yaml:"maxTotalTokens,omitempty"`
 }
 
 // OAuthConfig contains OAuth authentication configuration
@@ -66,8 +98,98 @@ func (c *MCPServerConfig) GetTransport() MCPTransportType {
 	return c.Transport
 }
 
+const (
+	DefaultMCPCallTimeout             = 60 * time.Second
+	DefaultMCPRetryBackoff            = 500 * time.Millisecond
+	DefaultMCPCircuitBreakerThreshold = 5
+	DefaultMCPCircuitBreakerCooldown  = 30 * time.Second
+	DefaultMCPReconnectBackoff        = time.Second
+	DefaultMCPMaxReconnectBackoff     = time.Minute
+)
+
+// GetTimeout returns the per-call timeout, defaulting to DefaultMCPCallTimeout
+func (c *MCPServerConfig) GetTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return DefaultMCPCallTimeout
+	}
+	return c.Timeout
+}
+
+// GetRetryBackoff returns the initial retry backoff, defaulting to DefaultMCPRetryBackoff
+func (c *MCPServerConfig) GetRetryBackoff() time.Duration {
+	if c.RetryBackoff <= 0 {
+		return DefaultMCPRetryBackoff
+	}
+	return c.RetryBackoff
+}
+
+// GetCircuitBreakerThreshold returns the failure threshold, defaulting to DefaultMCPCircuitBreakerThreshold
+func (c *MCPServerConfig) GetCircuitBreakerThreshold() int {
+	if c.CircuitBreakerThreshold <= 0 {
+		return DefaultMCPCircuitBreakerThreshold
+	}
+	return c.CircuitBreakerThreshold
+}
+
+// GetCircuitBreakerCooldown returns the cooldown, defaulting to DefaultMCPCircuitBreakerCooldown
+func (c *MCPServerConfig) GetCircuitBreakerCooldown() time.Duration {
+	if c.CircuitBreakerCooldown <= 0 {
+		return DefaultMCPCircuitBreakerCooldown
+	}
+	return c.CircuitBreakerCooldown
+}
+
+// GetReconnectBackoff returns the backoff before the given reconnection attempt, starting at 1.
+// It doubles from ReconnectBackoff up to MaxReconnectBackoff.
+func (c *MCPServerConfig) GetReconnectBackoff(attempt int) time.Duration {
+	backoff, maxBackoff := c.ReconnectBackoff, c.MaxReconnectBackoff
+	if backoff <= 0 {
+		backoff = DefaultMCPReconnectBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMCPMaxReconnectBackoff
+	}
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, maxBackoff)
+}
+
+// SupportsSampling reports whether sampling requests of the server can be answered
+func (c *MCPServerConfig) SupportsSampling() bool {
+	return c.Sampling != nil && c.GetTransport() == MCPTransportStdio
+}
+
 func CanBeUsedAsToolName(toolName string) bool {
 	// regexp: ([a-zA-Z0-9_-]{1,128})
 	re := regexp.MustCompile(`^[a-zA-Z0-9_-]{1,128}$`)
 	return re.MatchString(toolName)
 }
+
+const (
+	// MCPToolNameSeparator separates the server name from the tool name in namespaced MCP tool names
+	MCPToolNameSeparator = "__"
+
+	maxToolNameLength = 128
+)
+
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+
+// SanitizeToolName turns name into a name that satisfies CanBeUsedAsToolName.
+// Invalid characters are replaced by '_' and overlong names are shortened. A name that had to be changed gets a
+// hash suffix of the original name, so that names differing only in invalid characters stay unique.
+func SanitizeToolName(name string) string {
+	sanitized := invalidToolNameChars.ReplaceAllString(name, "_")
+	if sanitized == name && name != "" && len(sanitized) <= maxToolNameLength {
+		return sanitized
+	}
+
+	sum := sha1.Sum([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	return sanitized[:min(len(sanitized), maxToolNameLength-len(suffix))] + suffix
+}
+
+// NamespacedMCPToolName returns the name an MCP tool is registered under, e.g. github__search
+func NamespacedMCPToolName(serverName, toolName string) string {
+	return SanitizeToolName(serverName + MCPToolNameSeparator + toolName)
+}
@@ -0,0 +1,55 @@
+package tool_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/habiliai/agentruntime/tool"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespacedMCPToolName(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverName string
+		toolName   string
+		expected   string
+	}{
+		{
+			name:       "simple names",
+			serverName: "github",
+			toolName:   "search",
+			expected:   "github__search",
+		},
+		{
+			name:       "invalid characters are replaced",
+			serverName: "my server.v2",
+			toolName:   "read/file",
+			expected:   "my_server_v2__read_file_0fd8885f",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tool.NamespacedMCPToolName(tt.serverName, tt.toolName)
+			require.Equal(t, tt.expected, got)
+			require.True(t, tool.CanBeUsedAsToolName(got))
+		})
+	}
+
+	t.Run("overlong names stay unique", func(t *testing.T) {
+		long := strings.Repeat("a", 200)
+		a := tool.NamespacedMCPToolName("server", long+"1")
+		b := tool.NamespacedMCPToolName("server", long+"2")
+		require.True(t, tool.CanBeUsedAsToolName(a))
+		require.True(t, tool.CanBeUsedAsToolName(b))
+		require.NotEqual(t, a, b)
+	})
+
+	t.Run("names differing in invalid characters stay unique", func(t *testing.T) {
+		dotted := tool.NamespacedMCPToolName("srv", "foo.bar")
+		require.True(t, tool.CanBeUsedAsToolName(dotted))
+		require.NotEqual(t, tool.NamespacedMCPToolName("srv", "foo_bar"), dotted)
+		require.Equal(t, "srv__foo_bar", tool.NamespacedMCPToolName("srv", "foo_bar"))
+	})
+}